@@ -38,6 +38,10 @@ func (b Address) String() string {
 	return string(txt)
 }
 
+func init() {
+	RegisterType(new(Address))
+}
+
 func (Address) GetDBHash() IHash {
 	return Sha([]byte("Address"))
 }
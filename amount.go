@@ -0,0 +1,188 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/**************************************
+ * Amount
+ *
+ * An amount of Factoids, held exactly as a count of factoshis.  One
+ * Factoid is 100000000 factoshis.  Amounts are written with a decimal
+ * point, as "1.5" or "0.00000001", and never lose precision going to or
+ * from a string.
+ **************************************/
+
+const (
+	AMOUNT_DECIMALS   = 8
+	FACTOSHIS_PER_FCT = 100000000
+	// Amounts must fit in an int64 (see ValidateAmounts()).
+	MAX_AMOUNT Amount = 1<<63 - 1
+)
+
+type Amount uint64
+
+// How to round when converting Factoids to Entry Credits.
+type Rounding int
+
+const (
+	ROUND_DOWN    Rounding = iota // Drop any fraction of an Entry Credit
+	ROUND_UP                      // Any fraction costs a whole Entry Credit
+	ROUND_NEAREST                 // Half an Entry Credit or more rounds up
+)
+
+// Parse an amount of Factoids, such as "12", "0.5", ".5" or "12.".  More
+// than 8 decimal places is an error, not a rounding.
+func ParseAmount(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	whole, frac := str, ""
+	if index := strings.Index(str, "."); index >= 0 {
+		whole, frac = str[:index], str[index+1:]
+	}
+	if len(whole)+len(frac) == 0 {
+		return 0, fmt.Errorf("'%s' is not an amount", s)
+	}
+	if len(frac) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("'%s' has more than %d decimal places", s, AMOUNT_DECIMALS)
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("'%s' is not an amount", s)
+			}
+		}
+	}
+
+	var w, f uint64
+	var err error
+	if len(whole) > 0 {
+		if w, err = strconv.ParseUint(whole, 10, 64); err != nil {
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "'%s' is out of range", s)
+		}
+	}
+	if len(frac) > 0 {
+		f, _ = strconv.ParseUint(frac+strings.Repeat("0", AMOUNT_DECIMALS-len(frac)), 10, 64)
+	}
+	a, err := Amount(w).Mul(FACTOSHIS_PER_FCT)
+	if err != nil {
+		return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "'%s' is out of range", s)
+	}
+	return a.Add(Amount(f))
+}
+
+// The amount in Factoids, with as few decimal places as it needs.
+func (a Amount) String() string {
+	whole := uint64(a) / FACTOSHIS_PER_FCT
+	frac := uint64(a) % FACTOSHIS_PER_FCT
+	if frac == 0 {
+		return strconv.FormatUint(whole, 10)
+	}
+	fstr := fmt.Sprintf("%08d", frac)
+	return strconv.FormatUint(whole, 10) + "." + strings.TrimRight(fstr, "0")
+}
+
+func (a Amount) Factoshis() uint64 {
+	return uint64(a)
+}
+
+// Add two amounts.  A sum past MAX_AMOUNT is an ERR_AMOUNT_OVERFLOW.
+func (a Amount) Add(b Amount) (Amount, error) {
+	if a > MAX_AMOUNT || b > MAX_AMOUNT-a {
+		return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "%s plus %s is out of range", a, b)
+	}
+	return a + b, nil
+}
+
+// Subtract b from a.  Going below zero is an ERR_AMOUNT_OVERFLOW.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b > a {
+		return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "%s minus %s is below zero", a, b)
+	}
+	return a - b, nil
+}
+
+// Multiply an amount by a count.  A product past MAX_AMOUNT is an
+// ERR_AMOUNT_OVERFLOW.
+func (a Amount) Mul(n uint64) (Amount, error) {
+	if n != 0 && uint64(a) > uint64(MAX_AMOUNT)/n {
+		return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "%s times %d is out of range", a, n)
+	}
+	return a * Amount(n), nil
+}
+
+// Add up a list of amounts.
+func SumAmounts(amts ...Amount) (sum Amount, err error) {
+	for _, amt := range amts {
+		if sum, err = sum.Add(amt); err != nil {
+			return 0, err
+		}
+	}
+	return sum, nil
+}
+
+// The Entry Credits the amount buys at the given rate, rounded as asked.
+func (a Amount) ToEC(factoshisPerEC uint64, r Rounding) (uint64, error) {
+	if factoshisPerEC == 0 {
+		return 0, fmt.Errorf("The Entry Credit rate is zero")
+	}
+	ecs := uint64(a) / factoshisPerEC
+	rem := uint64(a) % factoshisPerEC
+	switch r {
+	case ROUND_DOWN:
+	case ROUND_UP:
+		if rem > 0 {
+			ecs++
+		}
+	case ROUND_NEAREST:
+		if rem >= factoshisPerEC-rem {
+			ecs++
+		}
+	default:
+		return 0, fmt.Errorf("Unknown rounding %d", int(r))
+	}
+	return ecs, nil
+}
+
+// What a number of Entry Credits costs at the given rate.
+func ECToAmount(ecs uint64, factoshisPerEC uint64) (Amount, error) {
+	return Amount(factoshisPerEC).Mul(ecs)
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	v, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Amounts are written to JSON as strings, since a JSON number may not
+// hold 8 decimal places exactly.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// Reads an amount written as a string or as a number.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		s, err := strconv.Unquote(string(data))
+		if err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	return a.UnmarshalText(data)
+}
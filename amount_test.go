@@ -0,0 +1,140 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_ParseAmount(test *testing.T) {
+	good := map[string]Amount{
+		"0":                    0,
+		"1":                    100000000,
+		"1.5":                  150000000,
+		".5":                   50000000,
+		"12.":                  1200000000,
+		"0.00000001":           1,
+		" 10.999 ":             1099900000,
+		"92233720368.54775807": MAX_AMOUNT,
+	}
+	for s, v := range good {
+		a, err := ParseAmount(s)
+		if err != nil || a != v {
+			Prtln("ParseAmount(", s, ") returned ", uint64(a), " ", err)
+			test.Fail()
+		}
+	}
+	for _, s := range []string{"", ".", "-1", "+1", "1.2.3", "1e8", "abc", "0.000000001", "1 000"} {
+		if _, err := ParseAmount(s); err == nil {
+			Prtln("ParseAmount(", s, ") should fail")
+			test.Fail()
+		}
+	}
+	for _, s := range []string{"92233720368.54775808", "100000000000", "99999999999999999999"} {
+		if _, err := ParseAmount(s); GetValidationErrorKind(err) != ERR_AMOUNT_OVERFLOW {
+			Prtln("ParseAmount(", s, ") should overflow: ", err)
+			test.Fail()
+		}
+	}
+}
+
+func Test_Amount_String(test *testing.T) {
+	strs := map[Amount]string{
+		0:          "0",
+		1:          "0.00000001",
+		100000000:  "1",
+		150000000:  "1.5",
+		1099900000: "10.999",
+		MAX_AMOUNT: "92233720368.54775807",
+	}
+	for a, s := range strs {
+		if a.String() != s {
+			Prtln(uint64(a), " printed as ", a.String(), " not ", s)
+			test.Fail()
+		}
+		if b, err := ParseAmount(a.String()); err != nil || b != a {
+			Prtln(s, " did not parse back: ", err)
+			test.Fail()
+		}
+	}
+}
+
+func Test_Amount_arithmetic(test *testing.T) {
+	if _, err := MAX_AMOUNT.Add(1); GetValidationErrorKind(err) != ERR_AMOUNT_OVERFLOW {
+		test.Fail()
+	}
+	if a, err := Amount(5).Sub(3); err != nil || a != 2 {
+		test.Fail()
+	}
+	if _, err := Amount(3).Sub(5); GetValidationErrorKind(err) != ERR_AMOUNT_OVERFLOW {
+		test.Fail()
+	}
+	if _, err := (MAX_AMOUNT/2 + 1).Mul(2); GetValidationErrorKind(err) != ERR_AMOUNT_OVERFLOW {
+		test.Fail()
+	}
+	if a, err := SumAmounts(1, 2, 3); err != nil || a != 6 {
+		test.Fail()
+	}
+	if _, err := SumAmounts(MAX_AMOUNT, 1); err == nil {
+		test.Fail()
+	}
+}
+
+func Test_Amount_EC(test *testing.T) {
+	rate := uint64(1000)
+	cases := []struct {
+		a                 Amount
+		down, up, nearest uint64
+	}{
+		{0, 0, 0, 0},
+		{1000, 1, 1, 1},
+		{1499, 1, 2, 1},
+		{1500, 1, 2, 2},
+		{1999, 1, 2, 2},
+	}
+	for _, c := range cases {
+		down, _ := c.a.ToEC(rate, ROUND_DOWN)
+		up, _ := c.a.ToEC(rate, ROUND_UP)
+		nearest, _ := c.a.ToEC(rate, ROUND_NEAREST)
+		if down != c.down || up != c.up || nearest != c.nearest {
+			Prtln(uint64(c.a), " converted to ", down, " ", up, " ", nearest)
+			test.Fail()
+		}
+	}
+	if _, err := Amount(1).ToEC(0, ROUND_DOWN); err == nil {
+		test.Fail()
+	}
+	if a, err := ECToAmount(3, rate); err != nil || a != 3000 {
+		test.Fail()
+	}
+	if _, err := ECToAmount(1<<62, rate); err == nil {
+		test.Fail()
+	}
+}
+
+func Test_Amount_JSON(test *testing.T) {
+	type payment struct {
+		Amount Amount
+	}
+	data, err := json.Marshal(payment{150000001})
+	if err != nil || string(data) != `{"Amount":"1.50000001"}` {
+		Prtln(string(data), " ", err)
+		test.Fail()
+	}
+	var p payment
+	if err := json.Unmarshal(data, &p); err != nil || p.Amount != 150000001 {
+		Prtln(uint64(p.Amount), " ", err)
+		test.Fail()
+	}
+	if err := json.Unmarshal([]byte(`{"Amount":2.5}`), &p); err != nil || p.Amount != 250000000 {
+		Prtln(uint64(p.Amount), " ", err)
+		test.Fail()
+	}
+	if err := json.Unmarshal([]byte(`{"Amount":"0.000000001"}`), &p); err == nil {
+		Prtln("Too many decimal places should fail")
+		test.Fail()
+	}
+}
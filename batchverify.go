@@ -0,0 +1,133 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"github.com/FactomProject/factoid/ed25519batch"
+)
+
+/**************************************
+ * IBatchVerifier
+ *
+ * Checks the signatures of many transactions at once, for replaying blocks
+ * and admitting batches of transactions from the network.  If the batch
+ * fails, the transactions are checked one at a time to find the first that
+ * fails, so a batch never rejects what ValidateSignatures() accepts.
+ *
+ * A batch can accept a set of signatures crafted from points of small
+ * order that fail one at a time (see package ed25519batch).  The
+ * validation of new blocks should stick to ValidateSignatures().
+ **************************************/
+
+type IBatchVerifier interface {
+	// Add the signatures of a transaction to the batch.  The transaction
+	// must not change until Verify() is done.
+	AddTransaction(trans ITransaction)
+	// The number of transactions in the batch
+	Len() int
+	// Check every signature.  Returns -1 and nil if they all verify,
+	// otherwise the index (in the order added) and the error from
+	// ValidateSignatures() of the first transaction that fails.
+	Verify() (int, error)
+}
+
+type BatchVerifier struct {
+	transactions []ITransaction
+	batch        ed25519batch.Batch
+	failed       bool // A signature checked outside the batch failed
+}
+
+var _ IBatchVerifier = (*BatchVerifier)(nil)
+
+// An RCD whose signature can be checked in a batch returns the key that
+// must have signed the input, or nil if the input can't go into a batch.
+type signingKeyRCD interface {
+	signingKey(sigblk ISignatureBlock) *[32]byte
+}
+
+func (w RCD_1) signingKey(sigblk ISignatureBlock) *[32]byte {
+	return &w.publicKey
+}
+
+func (b RCD_3) signingKey(sigblk ISignatureBlock) *[32]byte {
+	if inner, ok := b.inner.(signingKeyRCD); ok {
+		return inner.signingKey(sigblk)
+	}
+	return nil
+}
+
+// The recipient signs with the preimage, and the sender without it.  A bad
+// preimage fails without a signature to check.
+func (b RCD_4) signingKey(sigblk ISignatureBlock) *[32]byte {
+	if preimage := sigblk.GetPreimage(); len(preimage) > 0 {
+		if !CheckPreimage(b.hash[:], preimage) {
+			return nil
+		}
+		return &b.recipient
+	}
+	return &b.sender
+}
+
+// The data signed for an input, and the first signature in its signature
+// block.  Nil if either is missing.
+func signedData(trans ITransaction, input int, sigblk ISignatureBlock) ([]byte, *[SIGNATURE_LENGTH]byte) {
+	if sigblk == nil {
+		return nil, nil
+	}
+	data, err := trans.MarshalBinarySigHash(input, sigblk.GetSigHashType())
+	if err != nil {
+		return nil, nil
+	}
+	signature := sigblk.GetSignature(0)
+	if signature == nil {
+		return nil, nil
+	}
+	cryptosig := signature.GetSignature()
+	if cryptosig == nil {
+		return nil, nil
+	}
+	return data, cryptosig
+}
+
+func (v *BatchVerifier) AddTransaction(trans ITransaction) {
+	v.transactions = append(v.transactions, trans)
+	sigBlks := trans.GetSignatureBlocks()
+	for i, rcd := range trans.GetRCDs() {
+		var sigblk ISignatureBlock
+		if i < len(sigBlks) {
+			sigblk = sigBlks[i]
+		}
+		if sigblk != nil {
+			if r, ok := rcd.(signingKeyRCD); ok {
+				key := r.signingKey(sigblk)
+				data, signature := signedData(trans, i, sigblk)
+				if key != nil && signature != nil {
+					v.batch.Add(key, data, signature)
+					continue
+				}
+			}
+		}
+		// Anything else, like a multisig, is checked on the spot
+		if !rcd.CheckSig(trans, i, sigblk) {
+			v.failed = true
+		}
+	}
+}
+
+func (v *BatchVerifier) Len() int {
+	return len(v.transactions)
+}
+
+func (v *BatchVerifier) Verify() (int, error) {
+	if !v.failed && v.batch.Verify() {
+		return -1, nil
+	}
+	for i, trans := range v.transactions {
+		if err := trans.ValidateSignatures(); err != nil {
+			return i, err
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"testing"
+)
+
+// A transaction spending a plain key, a time locked key, and both sides of
+// a hash time lock.
+func newBatchTransaction(ts uint64) ITransaction {
+	t := new(Transaction)
+	t.SetMilliTimestamp(ts)
+	var privates []*[64]byte
+
+	privates = append(privates, addKeyInput(t, 1000))
+
+	inner, private := nextKey()
+	locked, _ := NewRCD_3(LOCK_DBHEIGHT, 10, inner)
+	adr, _ := locked.GetAddress()
+	t.AddInput(adr, 1000)
+	t.AddRCD(locked)
+	privates = append(privates, private)
+
+	preimage := []byte("batch")
+	for _, claim := range []bool{true, false} {
+		recipient, rprivate := nextKey()
+		sender, sprivate := nextKey()
+		htlc, _ := NewRCD_4(Sha(preimage).Bytes(), 10, recipient.(IRCD_1).GetPublicKey(), sender.(IRCD_1).GetPublicKey())
+		adr, _ := htlc.GetAddress()
+		t.AddInput(adr, 1000)
+		t.AddRCD(htlc)
+		if claim {
+			privates = append(privates, rprivate)
+		} else {
+			privates = append(privates, sprivate)
+		}
+	}
+	t.AddOutput(nextAddress(), 3000)
+
+	for i, private := range privates {
+		signInput(t, i, private, SIGHASH_ALL)
+	}
+	t.GetSignatureBlock(2).SetPreimage(preimage)
+	return t
+}
+
+func Test_BatchVerifier(test *testing.T) {
+	var transactions []ITransaction
+	for i := 0; i < 10; i++ {
+		t := newBatchTransaction(uint64(1000 + i))
+		if err := t.ValidateSignatures(); err != nil {
+			test.Fatal(err)
+		}
+		transactions = append(transactions, t)
+	}
+
+	verify := func() (int, error) {
+		v := new(BatchVerifier)
+		for _, t := range transactions {
+			v.AddTransaction(t)
+		}
+		if v.Len() != len(transactions) {
+			test.Fail()
+		}
+		return v.Verify()
+	}
+
+	if i, err := verify(); i != -1 || err != nil {
+		Prtln("A batch of valid transactions failed at ", i, ": ", err)
+		test.Fail()
+	}
+	if i, err := new(BatchVerifier).Verify(); i != -1 || err != nil {
+		test.Fail()
+	}
+
+	// Break one signature of each kind in turn, in the middle of the batch
+	for input := 0; input < 4; input++ {
+		t := newBatchTransaction(2000)
+		t.GetSignatureBlock(input).GetSignature(0).GetSignature()[0] ^= 1
+		transactions[5] = t
+		i, err := verify()
+		if i != 5 || GetValidationErrorKind(err) != ERR_BAD_SIGNATURE || err.(*ValidationError).Input != input {
+			Prtln("Expected input ", input, " of transaction 5 to fail, got ", i, ": ", err)
+			test.Fail()
+		}
+	}
+
+	// A wrong preimage never reaches the batch, but fails all the same;
+	// so does a multisig, and a missing signature.
+	t := newBatchTransaction(3000)
+	t.GetSignatureBlock(2).SetPreimage([]byte("wrong"))
+	transactions[5] = t
+	if i, err := verify(); i != 5 || err.(*ValidationError).Input != 2 {
+		Prtln("Expected the wrong preimage to fail, got ", i, ": ", err)
+		test.Fail()
+	}
+
+	t = newBatchTransaction(3000)
+	t.AddInput(nextAddress(), 0)
+	t.AddRCD(nextAuth2())
+	t.SetSignatureBlock(4, new(SignatureBlock))
+	transactions[5] = t
+	if i, _ := verify(); i != 5 {
+		Prtln("Expected the multisig to fail, got ", i)
+		test.Fail()
+	}
+
+	t = newBatchTransaction(3000)
+	t.SetSignatureBlock(0, new(SignatureBlock))
+	transactions[5] = t
+	if i, _ := verify(); i != 5 {
+		Prtln("Expected the missing signature to fail, got ", i)
+		test.Fail()
+	}
+
+	// The first of several failures is the one reported
+	transactions[7] = t
+	transactions[2] = t
+	if i, _ := verify(); i != 2 {
+		test.Fail()
+	}
+}
+
+func Benchmark_BatchVerifier(b *testing.B) {
+	var transactions []ITransaction
+	for i := 0; i < 16; i++ {
+		transactions = append(transactions, newBatchTransaction(uint64(1000+i)))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		v := new(BatchVerifier)
+		for _, t := range transactions {
+			v.AddTransaction(t)
+		}
+		if i, err := v.Verify(); i != -1 {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_ValidateSignatures(b *testing.B) {
+	var transactions []ITransaction
+	for i := 0; i < 16; i++ {
+		transactions = append(transactions, newBatchTransaction(uint64(1000+i)))
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, t := range transactions {
+			if err := t.ValidateSignatures(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -7,47 +7,159 @@ package block
 import (
 	"fmt"
 	fct "github.com/FactomProject/factoid"
-	"github.com/FactomProject/factoid/wallet"
+	"sort"
 )
 
 var _ = fct.Prt
 var _ = fmt.Println
 
-var adrs []fct.IAddress
-var amount uint64 = 5000000000 // One Factoid (remember, fixed point math!
-var addressCnt int = 0         // No coinbase payments until Milestone 3
+// The coinbase is the first transaction of every Factoid block.  It pays
+// the federated servers (or whoever else the network decides to pay) and
+// has no inputs.  Since every server must produce exactly the same
+// coinbase for a given block, the payouts come from a schedule that is
+// known in advance.  The schedule is a list of changes, each taking effect
+// at a given Directory Block height and holding until the next change.
+type ICoinbaseSchedule interface {
+	// Set the payouts made from the given height onward (until the next
+	// change in the schedule).  An empty list of payouts stops all payouts.
+	SetPayouts(height uint32, payouts []CoinbasePayout) error
+	// Get the payouts in effect at the given height
+	GetPayouts(height uint32) []CoinbasePayout
+	// Build the coinbase transaction for the given height
+	GetCoinbase(ftime uint64, height uint32) fct.ITransaction
+	// Check that a coinbase transaction pays exactly what the schedule
+	// calls for at the given height.
+	ValidateCoinbase(height uint32, trans fct.ITransaction) error
+}
+
+// One output of the coinbase transaction.
+type CoinbasePayout struct {
+	Address fct.IAddress
+	Amount  uint64
+}
+
+type coinbaseChange struct {
+	height  uint32
+	payouts []CoinbasePayout
+}
+
+type CoinbaseSchedule struct {
+	changes []coinbaseChange // Sorted by height
+}
+
+var _ ICoinbaseSchedule = (*CoinbaseSchedule)(nil)
 
-// Allows the amount paid in the coinbase to be modified.   This is
-// NOT allowed in production!  That's why it is here in Test!
-func UpdateAmount(amt uint64) {
-	amount = amt
+// The schedule used by GetCoinbase() and block validation.  Starts out
+// empty, i.e. no coinbase payments.
+var coinbaseSchedule ICoinbaseSchedule = NewCoinbaseSchedule()
+
+func NewCoinbaseSchedule() *CoinbaseSchedule {
+	return new(CoinbaseSchedule)
+}
+
+// Set the schedule used to build and validate coinbase transactions.  All
+// the servers on a network must use the same schedule.
+func SetCoinbaseSchedule(s ICoinbaseSchedule) {
+	if s == nil {
+		s = NewCoinbaseSchedule()
+	}
+	coinbaseSchedule = s
 }
 
-// This routine generates the Coinbase.  This is a fixed amount to be
-// paid to the federated servers.
-//
-// Currently we are paying just a few fixed addresses.
-//
-func GetCoinbase(ftime uint64) fct.ITransaction {
+func GetCoinbaseSchedule() ICoinbaseSchedule {
+	return coinbaseSchedule
+}
 
-	if false && adrs == nil {
-		var w wallet.ISCWallet
-		w = new(wallet.SCWallet)
-		w.Init()
+// This routine generates the Coinbase for a block at the given height,
+// using the current coinbase schedule.
+func GetCoinbase(ftime uint64, height uint32) fct.ITransaction {
+	return coinbaseSchedule.GetCoinbase(ftime, height)
+}
 
-		adrs = make([]fct.IAddress, addressCnt)
-		for i := 0; i < addressCnt; i++ {
-			adr, _ := w.GenerateFctAddress([]byte("adr"+string(i)), 1, 1)
-			adrs[i] = adr
+func (s *CoinbaseSchedule) SetPayouts(height uint32, payouts []CoinbasePayout) error {
+	if len(payouts) > 255 {
+		return fmt.Errorf("The coinbase cannot have more than 255 payouts")
+	}
+	var total uint64
+	seen := make(map[[32]byte]bool, len(payouts))
+	cpy := make([]CoinbasePayout, len(payouts))
+	for i, payout := range payouts {
+		if payout.Address == nil {
+			return fmt.Errorf("Coinbase payout %d has no address", i)
+		}
+		if payout.Amount < fct.MINIMUM_AMOUNT {
+			return fmt.Errorf("Coinbase payout %d is below the minimum amount", i)
 		}
+		if seen[payout.Address.Fixed()] {
+			return fmt.Errorf("Coinbase payout %d pays an address more than once", i)
+		}
+		seen[payout.Address.Fixed()] = true
+		var err error
+		total, err = fct.ValidateAmounts(total, payout.Amount)
+		if err != nil {
+			return fmt.Errorf("Coinbase payouts are out of range: %s", err.Error())
+		}
+		cpy[i] = CoinbasePayout{fct.CreateAddress(payout.Address), payout.Amount}
+	}
+
+	i := sort.Search(len(s.changes), func(i int) bool { return s.changes[i].height >= height })
+	if i < len(s.changes) && s.changes[i].height == height {
+		s.changes[i].payouts = cpy
+		return nil
 	}
+	s.changes = append(s.changes, coinbaseChange{})
+	copy(s.changes[i+1:], s.changes[i:])
+	s.changes[i] = coinbaseChange{height, cpy}
+	return nil
+}
+
+// Returns the payouts of the last change at or below the given height.
+// Before the first change, there are no payouts.
+func (s *CoinbaseSchedule) GetPayouts(height uint32) []CoinbasePayout {
+	i := sort.Search(len(s.changes), func(i int) bool { return s.changes[i].height > height })
+	if i == 0 {
+		return nil
+	}
+	return s.changes[i-1].payouts
+}
 
+func (s *CoinbaseSchedule) GetCoinbase(ftime uint64, height uint32) fct.ITransaction {
 	coinbase := new(fct.Transaction)
 	coinbase.SetMilliTimestamp(ftime)
 
-	for _, adr := range adrs {
-		coinbase.AddOutput(adr, amount) // add specified amount
+	for _, payout := range s.GetPayouts(height) {
+		coinbase.AddOutput(fct.CreateAddress(payout.Address), payout.Amount)
 	}
 
 	return coinbase
 }
+
+func (s *CoinbaseSchedule) ValidateCoinbase(height uint32, trans fct.ITransaction) error {
+	if len(trans.GetInputs()) != 0 {
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction cannot have any inputs")
+	}
+	if len(trans.GetECOutputs()) != 0 {
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction cannot buy Entry Credits")
+	}
+	payouts := s.GetPayouts(height)
+	outputs := trans.GetOutputs()
+	if len(outputs) != len(payouts) {
+		e := fct.NewValidationError(fct.ERR_COINBASE, "The coinbase at height %d has %d payouts, but the schedule calls for %d",
+			height, len(outputs), len(payouts))
+		e.Required = uint64(len(payouts))
+		e.Provided = uint64(len(outputs))
+		return e
+	}
+	for i, payout := range payouts {
+		if outputs[i].GetAmount() != payout.Amount ||
+			!outputs[i].GetAddress().IsSameAs(payout.Address) {
+			e := fct.NewValidationError(fct.ERR_COINBASE, "Coinbase payout %d at height %d does not match the schedule", i, height)
+			e.Input = i
+			e.Address = outputs[i].GetAddress()
+			e.Required = payout.Amount
+			e.Provided = outputs[i].GetAmount()
+			return e
+		}
+	}
+	return nil
+}
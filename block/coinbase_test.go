@@ -0,0 +1,95 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	fct "github.com/FactomProject/factoid"
+	"testing"
+)
+
+func Test_coinbase_schedule(test *testing.T) {
+	adr1 := fct.CreateAddress(fct.Sha([]byte("payee one")))
+	adr2 := fct.CreateAddress(fct.Sha([]byte("payee two")))
+
+	s := NewCoinbaseSchedule()
+	if err := s.SetPayouts(10, []CoinbasePayout{{adr1, 500}}); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	if err := s.SetPayouts(20, []CoinbasePayout{{adr1, 300}, {adr2, 200}}); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	if err := s.SetPayouts(30, nil); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+
+	if len(s.GetPayouts(9)) != 0 || len(s.GetPayouts(10)) != 1 || len(s.GetPayouts(19)) != 1 ||
+		len(s.GetPayouts(20)) != 2 || len(s.GetPayouts(29)) != 2 || len(s.GetPayouts(30)) != 0 {
+		fct.Prtln("Payouts do not change at the scheduled heights")
+		test.Fail()
+	}
+
+	cb := s.GetCoinbase(1000, 25)
+	if cb.GetMilliTimestamp() != 1000 || len(cb.GetOutputs()) != 2 ||
+		cb.GetOutputs()[1].GetAmount() != 200 {
+		fct.Prtln("Bad coinbase\n", cb)
+		test.Fail()
+	}
+	if err := s.ValidateCoinbase(25, cb); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	if err := s.ValidateCoinbase(15, cb); err == nil {
+		fct.Prtln("Coinbase built for height 25 should not be valid at height 15")
+		test.Fail()
+	}
+	cb.GetOutputs()[0].SetAmount(301)
+	if err := s.ValidateCoinbase(25, cb); err == nil {
+		fct.Prtln("Coinbase paying the wrong amount should not be valid")
+		test.Fail()
+	}
+
+	if err := s.SetPayouts(40, []CoinbasePayout{{adr1, 1}, {adr1, 2}}); err == nil {
+		fct.Prtln("Paying the same address twice should not be allowed")
+		test.Fail()
+	}
+	if err := s.SetPayouts(40, []CoinbasePayout{{adr1, 0}}); err == nil {
+		fct.Prtln("Paying a zero amount should not be allowed")
+		test.Fail()
+	}
+}
+
+func Test_coinbase_block_validation(test *testing.T) {
+	adr := fct.CreateAddress(fct.Sha([]byte("payee")))
+	s := NewCoinbaseSchedule()
+	s.SetPayouts(1, []CoinbasePayout{{adr, 5000000000}})
+	SetCoinbaseSchedule(s)
+	defer SetCoinbaseSchedule(nil)
+
+	b := NewFBlock(1000, 1)
+	if err := b.AddCoinbase(new(fct.Transaction)); err == nil {
+		fct.Prtln("A coinbase without the scheduled payouts should be rejected")
+		test.Fail()
+	}
+	if err := b.AddCoinbase(GetCoinbase(0, 1)); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	b.CalculateHashes()
+	if err := b.Validate(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+
+	// Tamper with the payout, and the block must fail validation.
+	b.GetTransactions()[0].GetOutputs()[0].SetAmount(6000000000)
+	b.CalculateHashes()
+	if err := b.Validate(); err == nil {
+		fct.Prtln("A block whose coinbase does not match the schedule should not be valid")
+		test.Fail()
+	}
+}
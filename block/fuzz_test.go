@@ -0,0 +1,61 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	fct "github.com/FactomProject/factoid"
+	"testing"
+)
+
+func fuzzFBlock() IFBlock {
+	b := NewFBlock(1000, 1)
+	b.AddCoinbase(GetCoinbase(0, 1))
+	b.EndOfPeriod(1)
+	b.EndOfPeriod(2)
+	return b
+}
+
+// An FBlock that decodes must marshal and decode again to the same
+// block.  No data may panic the decoder.
+func FuzzFBlock(f *testing.F) {
+	data, err := fuzzFBlock().MarshalBinary()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	for i := 0; i < len(data); i += 7 {
+		f.Add(data[:i])
+	}
+	f.Fuzz(func(test *testing.T, data []byte) {
+		first, second := new(FBlock), new(FBlock)
+		if _, err := first.UnmarshalBinaryData(data); err != nil {
+			return
+		}
+		bin, err := first.MarshalBinary()
+		if err != nil {
+			test.Fatalf("Decoded %x, but could not marshal it: %v", data, err)
+		}
+		if _, err := second.UnmarshalBinaryData(bin); err != nil {
+			test.Fatalf("Marshaled %x, but could not decode it: %v", bin, err)
+		}
+		if first.IsEqual(second) != nil {
+			test.Fatalf("%x did not decode to the same block twice", data)
+		}
+	})
+}
+
+// Every truncation of a block is an error, not a panic.
+func Test_truncated_fblock(test *testing.T) {
+	data, err := fuzzFBlock().MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	for i := 0; i < len(data); i++ {
+		if _, err := new(FBlock).UnmarshalBinaryData(data[:i]); err == nil {
+			fct.Prtln("A block decoded from ", i, " of ", len(data), " bytes")
+			test.Fail()
+		}
+	}
+}
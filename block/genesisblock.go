@@ -4,49 +4,109 @@
 
 package block
 
-/*
 import (
+	"bufio"
 	"fmt"
 	fct "github.com/FactomProject/factoid"
-	"github.com/FactomProject/factoid/wallet"
+	"io"
+	"os"
+	"strings"
 )
 
 var _ = fct.Prt
 var _ = fmt.Println
-var genesisBlock IFBlock
 
-// Provide the initial Exchange Rate, and the number of addresses to
-// fund, and how much to put at each address.
-//
-// GetGenesisBlock(1000000,10,200000000000)
-//
-// This is close to .1 a penny per Entry Credit with a Factoid price of
-// 15 cents, and 2000 Factoids distributed to 10 addresses.
-//
+// GetGenesisFBlock() in genesisBlockNew.go returns the mainnet genesis block.
+// To run a private network, build a genesis block of your own from a list
+// of allocations.  Every server on that network must build its genesis
+// block from the same allocations, exchange rate, and timestamp.
 
-func GetGenesisFBlock(ftime uint64, ExRate uint64, addressCnt int, Factoids uint64) IFBlock {
-	if genesisBlock != nil {
-		return genesisBlock
+// One address funded by the genesis block.
+type GenesisAllocation struct {
+	Address fct.IAddress
+	Amount  uint64 // In Factoshis
+}
+
+// Read allocations from a file.  See ReadGenesisAllocations() for the format.
+func LoadGenesisAllocations(filename string) ([]GenesisAllocation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
-	genesisBlock = NewFBlock(1000000, uint32(0))
+	defer f.Close()
+	return ReadGenesisAllocations(f)
+}
 
-	w := new(wallet.SCWallet)
-	w.Init()
+// Read allocations, one per line, as a human readable Factoid address
+// followed by an amount in Factoids:
+//
+//	FA2jK2HcLnRdS94dEcU27rF3meoJfpUcZPSinpb7AwQvPRY6RL1Q  2000
+//	FA3upjWMKHmStAHR5ZgKVK4zVHPb8U74L2wzKaaSDQEonHajiLeq  12.5
+//
+// Blank lines, and lines starting with '#', are ignored.
+func ReadGenesisAllocations(r io.Reader) ([]GenesisAllocation, error) {
+	allocations := make([]GenesisAllocation, 0, 10)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Line %d: expected an address and an amount", line)
+		}
+		adr, err := fct.ParseUserStrAs(fields[0], fct.USER_FCT_ADDRESS)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %s is not a valid Factoid address (%s)", line, fields[0], err.Error())
+		}
+		amount, err := fct.ParseAmount(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: invalid amount %s (%s)", line, fields[1], err.Error())
+		}
+		allocations = append(allocations, GenesisAllocation{adr.Key, amount.Factoshis()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
 
-	t := w.CreateTransaction(ftime)
+// Build a genesis block paying the given allocations in its coinbase.  The
+// same allocations, exchange rate and timestamp always produce the same block.
+func NewGenesisFBlock(ftime uint64, ExRate uint64, allocations []GenesisAllocation) (IFBlock, error) {
+	if len(allocations) > 255 {
+		return nil, fmt.Errorf("The genesis block cannot fund more than 255 addresses")
+	}
 
-	for i := 0; i < addressCnt; i++ {
-		h, _ := w.GenerateFctAddress([]byte("test "+string(i)), 1, 1)
-		w.AddOutput(t, h, Factoids)
+	var total uint64
+	seen := make(map[[32]byte]bool, len(allocations))
+	coinbase := new(fct.Transaction)
+	coinbase.SetMilliTimestamp(ftime)
+	for i, alloc := range allocations {
+		if alloc.Address == nil {
+			return nil, fmt.Errorf("Allocation %d has no address", i)
+		}
+		if alloc.Amount < fct.MINIMUM_AMOUNT {
+			return nil, fmt.Errorf("Allocation %d is below the minimum amount", i)
+		}
+		if seen[alloc.Address.Fixed()] {
+			return nil, fmt.Errorf("Allocation %d funds an address more than once", i)
+		}
+		seen[alloc.Address.Fixed()] = true
+		var err error
+		total, err = fct.ValidateAmounts(total, alloc.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("Genesis allocations are out of range: %s", err.Error())
+		}
+		coinbase.AddOutput(fct.CreateAddress(alloc.Address), alloc.Amount)
 	}
 
-	err := genesisBlock.AddCoinbase(t)
-	if err != nil {
-		fct.Prtln(" Error Adding Genesis Block: ", err)
+	genesisBlock := NewFBlock(ExRate, uint32(0))
+	if err := genesisBlock.AddCoinbase(coinbase); err != nil {
+		return nil, err
 	}
-        genesisBlock.SetExchRate(uint64(666666))
-	genesisBlock.GetKeyMR()
+	genesisBlock.CalculateHashes()
 
-	return genesisBlock
+	return genesisBlock, nil
 }
-*/
@@ -4,26 +4,81 @@
 
 package block
 
-/*
 import (
-	"encoding/binary"
-	"fmt"
-	"github.com/FactomProject/ed25519"
 	fct "github.com/FactomProject/factoid"
-	"math/rand"
+	"strings"
 	"testing"
 )
 
-var _ = fct.Prt
-var _ = fmt.Printf
-var _ = ed25519.Sign
-var _ = rand.New
-var _ = binary.Write
-
 func Test_create_genesis_block(test *testing.T) {
-	gb := GetGenesisFBlock(0, 1000000, 10, 200000000000)
-	var _ = gb
-	fct.Prtln(gb)
-	fct.Prtln("Hash: ", gb.GetHash())
+	adr1 := fct.ConvertFctAddressToUserStr(fct.NewAddress(fct.Sha([]byte("one")).Bytes()))
+	adr2 := fct.ConvertFctAddressToUserStr(fct.NewAddress(fct.Sha([]byte("two")).Bytes()))
+	file := "# Test network\n\n" + adr1 + " 2000\n" + adr2 + "  12.5\n"
+
+	allocations, err := ReadGenesisAllocations(strings.NewReader(file))
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	if len(allocations) != 2 || allocations[0].Amount != 200000000000 ||
+		allocations[1].Amount != 1250000000 {
+		fct.Prtln("Allocations not read properly: ", allocations)
+		test.Fail()
+		return
+	}
+
+	gb, err := NewGenesisFBlock(1000, 666600, allocations)
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	if err := gb.Validate(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	if gb.GetDBHeight() != 0 || gb.GetExchRate() != 666600 {
+		test.Fail()
+	}
+
+	gb2, _ := NewGenesisFBlock(1000, 666600, allocations)
+	if !gb.GetHash().IsSameAs(gb2.GetHash()) {
+		fct.Prtln("Genesis block is not deterministic")
+		test.Fail()
+	}
+
+	data, err := gb.MarshalBinary()
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	gb3 := new(FBlock)
+	if err := gb3.UnmarshalBinary(data); err != nil || gb.IsEqual(gb3) != nil {
+		fct.Prtln("Genesis block does not survive marshalling ", err)
+		test.Fail()
+	}
+}
+
+func Test_bad_genesis_allocations(test *testing.T) {
+	adr := fct.ConvertFctAddressToUserStr(fct.NewAddress(fct.Sha([]byte("one")).Bytes()))
+	ec := fct.ConvertECAddressToUserStr(fct.NewAddress(fct.Sha([]byte("one")).Bytes()))
+
+	bad := []string{
+		adr,                           // Missing amount
+		adr + " ten",                  // Bad amount
+		ec + " 10",                    // Not a Factoid address
+		adr + " 10\n" + adr + " 20\n", // Duplicate address
+	}
+	for _, file := range bad {
+		allocations, err := ReadGenesisAllocations(strings.NewReader(file))
+		if err == nil {
+			_, err = NewGenesisFBlock(0, 1000, allocations)
+		}
+		if err == nil {
+			fct.Prtln("Should have rejected: ", file)
+			test.Fail()
+		}
+	}
 }
-*/
@@ -0,0 +1,163 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	fct "github.com/FactomProject/factoid"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Checking signatures dominates the cost of validating a block, so the
+// transactions of a block are validated on a pool of workers.  The number
+// of workers defaults to the number of CPUs.
+var validationWorkers = runtime.NumCPU()
+
+// Set the number of workers used to validate the transactions of a block.
+// Anything less than 1 validates transactions one at a time.
+func SetValidationWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	validationWorkers = n
+}
+
+func GetValidationWorkers() int {
+	return validationWorkers
+}
+
+// Run ValidateTransaction() on every transaction in the block, including
+// the signatures.  Returns the index and error of the first transaction (by
+// index) that fails, or -1 and nil if they all pass.  The result does not
+// depend on the number of workers.  Once a transaction fails, transactions
+// following it in the block are not checked.
+func ValidateTransactions(b IFBlock) (int, error) {
+	transactions := b.GetTransactions()
+
+	workers := validationWorkers
+	if workers > len(transactions) {
+		workers = len(transactions)
+	}
+	if workers <= 1 {
+		for i, trans := range transactions {
+			if err := b.ValidateTransaction(i, trans); err != nil {
+				return i, err
+			}
+		}
+		return -1, nil
+	}
+
+	errs := make([]error, len(transactions))
+	failed := int64(len(transactions)) // Lowest failing index so far
+	next := int64(-1)                  // Last index handed to a worker
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := atomic.AddInt64(&next, 1)
+				// Indexes are handed out in order, so once we pass a
+				// failure there is nothing left that matters.
+				if i >= atomic.LoadInt64(&failed) {
+					return
+				}
+				if err := b.ValidateTransaction(int(i), transactions[i]); err != nil {
+					errs[i] = err
+					for {
+						f := atomic.LoadInt64(&failed)
+						if i >= f || atomic.CompareAndSwapInt64(&failed, f, i) {
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed < int64(len(transactions)) {
+		return int(failed), errs[failed]
+	}
+	return -1, nil
+}
+
+// Signatures already checked in a batch.
+type signaturesChecked struct {
+	fct.ITransaction
+}
+
+func (signaturesChecked) ValidateSignatures() error {
+	return nil
+}
+
+// The same as ValidateTransactions(), with the same result, but the
+// signatures are checked in batches, one batch per worker.  For replaying
+// blocks already accepted by the network; a batch can accept signatures
+// crafted to cancel out, which one at a time would not (see package
+// ed25519batch), so new blocks should go through ValidateTransactions().
+func ValidateTransactionsBatched(b IFBlock) (int, error) {
+	transactions := b.GetTransactions()
+
+	// The coinbase has no signatures to check.
+	failed := len(transactions)
+	if len(transactions) > 1 {
+		signed := transactions[1:]
+		workers := validationWorkers
+		if workers > len(signed) {
+			workers = len(signed)
+		}
+		size := (len(signed) + workers - 1) / workers
+		failures := make([]int, workers)
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			start := w * size
+			end := start + size
+			if end > len(signed) {
+				end = len(signed)
+			}
+			failures[w] = -1
+			if start >= end {
+				continue
+			}
+			wg.Add(1)
+			go func(w, start, end int) {
+				defer wg.Done()
+				v := new(fct.BatchVerifier)
+				for _, trans := range signed[start:end] {
+					v.AddTransaction(trans)
+				}
+				if i, _ := v.Verify(); i >= 0 {
+					failures[w] = 1 + start + i
+				}
+			}(w, start, end)
+		}
+		wg.Wait()
+
+		// Batches are in order, so the first to fail has the first failure
+		for _, f := range failures {
+			if f >= 0 {
+				failed = f
+				break
+			}
+		}
+	}
+
+	// Everything but the signatures is cheap, and checked in order.  The
+	// transaction with the first bad signature is checked in full, to
+	// report the same error as ValidateTransactions().
+	for i, trans := range transactions {
+		if i > 0 && i != failed {
+			trans = signaturesChecked{trans}
+		}
+		if err := b.ValidateTransaction(i, trans); err != nil {
+			return i, err
+		}
+	}
+	return -1, nil
+}
@@ -10,7 +10,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	fct "github.com/FactomProject/factoid"
-	"strings"
 )
 
 type IFBlock interface {
@@ -21,6 +20,8 @@ type IFBlock interface {
 	// Validation functions
 	Validate() error
 	ValidateTransaction(int, fct.ITransaction) error
+	// Check that the BodyMR matches the transactions in the block
+	ValidateBodyMR() error
 	// Marshal just the header for the block. This is to include the header
 	// in the LedgerKeyMR
 	MarshalHeader() ([]byte, error)
@@ -122,6 +123,10 @@ func (b FBlock) GetNewInstance() fct.IBlock {
 	return new(FBlock)
 }
 
+func init() {
+	fct.RegisterType(new(FBlock))
+}
+
 func (FBlock) GetDBHash() fct.IHash {
 	return fct.Sha([]byte("FBlock"))
 }
@@ -163,7 +168,30 @@ func (b *FBlock) MarshalTrans() ([]byte, error) {
 	return out.Bytes(), nil
 }
 
+// The length of MarshalTrans(), without building it.  Every block has an
+// end of minute marker for each period, and the transactions cache their
+// marshaled form.
+func (b *FBlock) marshalTransLen() (int, error) {
+	n := len(b.endOfPeriod)
+	for _, trans := range b.Transactions {
+		data, err := trans.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+		n += len(data)
+	}
+	return n, nil
+}
+
 func (b *FBlock) MarshalHeader() ([]byte, error) {
+	transLen, err := b.marshalTransLen()
+	if err != nil {
+		return nil, err
+	}
+	return b.marshalHeader(transLen)
+}
+
+func (b *FBlock) marshalHeader(transLen int) ([]byte, error) {
 	var out bytes.Buffer
 
 	b.EndOfPeriod(0) // Clean up end of minute markers, if needed.
@@ -205,12 +233,7 @@ func (b *FBlock) MarshalHeader() ([]byte, error) {
 
 	binary.Write(&out, binary.BigEndian, uint32(len(b.Transactions)))
 
-	transdata, err := b.MarshalTrans() // first get trans data
-	if err != nil {
-		return nil, err
-	}
-
-	binary.Write(&out, binary.BigEndian, uint32(len(transdata))) // write out its length
+	binary.Write(&out, binary.BigEndian, uint32(transLen)) // write out the length of the trans data
 
 	return out.Bytes(), nil
 }
@@ -219,35 +242,29 @@ func (b *FBlock) MarshalHeader() ([]byte, error) {
 func (b *FBlock) MarshalBinary() ([]byte, error) {
 	var out bytes.Buffer
 
-	data, err := b.MarshalHeader()
+	transdata, err := b.MarshalTrans() // first get trans data
 	if err != nil {
 		return nil, err
 	}
-	out.Write(data)
 
-	transdata, err := b.MarshalTrans() // first get trans data
+	data, err := b.marshalHeader(len(transdata))
 	if err != nil {
 		return nil, err
 	}
+	out.Grow(len(data) + len(transdata))
+	out.Write(data)
 	out.Write(transdata) // write out trans data
 
 	return out.Bytes(), nil
 }
 
-// UnmarshalBinary assumes that the Binary is all good.  We do error
-// out if there isn't enough data, or the transaction is too large.
+// We error out if there isn't enough data, or if the data is not what
+// MarshalBinary() would have written.
 func (b *FBlock) UnmarshalBinaryData(data []byte) (newdata []byte, err error) {
 
-	// To catch memory errors, I capture the panic and turn it into
-	// a reported error.
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling transaction: %v", r)
-		}
-	}()
-
-	// To capture the panic, my code needs to be in a function.  So I'm
-	// creating one here, and call it at the end of this function.
+	if len(data) < fct.ADDRESS_LENGTH {
+		return nil, fmt.Errorf("Data source too short to unmarshal an FBlock: %d", len(data))
+	}
 	if bytes.Compare(data[:fct.ADDRESS_LENGTH], fct.FACTOID_CHAINID[:]) != 0 {
 		return nil, fmt.Errorf("Block does not begin with the Factoid ChainID")
 	}
@@ -271,36 +288,65 @@ func (b *FBlock) UnmarshalBinaryData(data []byte) (newdata []byte, err error) {
 		return nil, err
 	}
 
+	if len(data) < 12 {
+		return nil, fmt.Errorf("Data source too short to unmarshal an FBlock header: %d", len(data))
+	}
 	b.ExchRate, data = binary.BigEndian.Uint64(data[0:8]), data[8:]
 	b.DBHeight, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
 
-	skip, data := fct.DecodeVarInt(data) // Skip the Expansion Header, if any, since
-	data = data[skip:]                   // we don't know what to do with it.
+	// Skip the Expansion Header, if any, since we don't know what to do
+	// with it.
+	skip, data, err := fct.DecodeCanonicalVarInt(data)
+	if err != nil {
+		return nil, err
+	}
+	if skip > uint64(len(data)) {
+		return nil, fmt.Errorf("Expansion header of %d bytes runs past the end of the data", skip)
+	}
+	data = data[skip:]
 
+	if len(data) < 8 {
+		return nil, fmt.Errorf("Data source too short to unmarshal an FBlock header: %d", len(data))
+	}
 	cnt, data := binary.BigEndian.Uint32(data[0:4]), data[4:]
-
-	data = data[4:] // Just skip the size... We don't really need it.
+	size, data := binary.BigEndian.Uint32(data[0:4]), data[4:]
+	if uint64(size) > uint64(len(data)) || cnt > size {
+		return nil, fmt.Errorf("FBlock claims %d transactions in %d bytes, but only %d bytes remain", cnt, size, len(data))
+	}
+	body := data[:size]
+	data = data[size:]
 
 	b.Transactions = make([]fct.ITransaction, cnt, cnt)
+	transactions := make([]fct.Transaction, cnt) // Allocate them all at once
 	for i, _ := range b.endOfPeriod {
 		b.endOfPeriod[i] = 0
 	}
 	var periodMark = 0
 	for i := uint32(0); i < cnt; i++ {
 
-		for data[0] == fct.MARKER {
+		for len(body) > 0 && body[0] == fct.MARKER {
+			if i == 0 || periodMark >= len(b.endOfPeriod) {
+				return nil, fmt.Errorf("Misplaced end of minute marker before transaction %d", i)
+			}
 			b.endOfPeriod[periodMark] = int(i)
-			data = data[1:]
+			body = body[1:]
 			periodMark++
 		}
 
-		trans := new(fct.Transaction)
-		data, err = trans.UnmarshalBinaryData(data)
+		trans := &transactions[i]
+		body, err = trans.UnmarshalBinaryData(body)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to unmarshal a transaction in block.\n" + err.Error())
 		}
 		b.Transactions[i] = trans
 	}
+	// The markers for minutes after the last transaction
+	for ; len(body) > 0 && body[0] == fct.MARKER && periodMark < len(b.endOfPeriod); periodMark++ {
+		body = body[1:]
+	}
+	if len(body) != 0 {
+		return nil, fmt.Errorf("%d bytes left over at the end of the FBlock body", len(body))
+	}
 
 	return data, nil
 
@@ -322,7 +368,8 @@ func (b1 *FBlock) IsEqual(block fct.IBlock) []fct.IBlock {
 
 	if !ok || // Not the right kind of IBlock
 		b1.ExchRate != b2.ExchRate ||
-		b1.DBHeight != b2.DBHeight {
+		b1.DBHeight != b2.DBHeight ||
+		len(b1.Transactions) != len(b2.Transactions) {
 		r := make([]fct.IBlock, 0, 3)
 		return append(r, b1)
 	}
@@ -402,10 +449,9 @@ func (b *FBlock) GetLedgerMR() fct.IHash {
 			marker++
 			hashes = append(hashes, fct.Sha(fct.ZERO))
 		}
-		data, err := trans.MarshalBinarySig()
-		hash := fct.Sha(data)
-		if err != nil {
-			panic("Failed to get LedgerMR: " + err.Error())
+		hash := trans.GetSigHash()
+		if hash == nil {
+			panic("Failed to get LedgerMR")
 		}
 		hashes = append(hashes, hash)
 	}
@@ -512,14 +558,15 @@ func (b FBlock) ValidateTransaction(index int, trans fct.ITransaction) error {
 		}
 
 		if tin < sum {
-			str, _ := trans.JSONString()
-			fmt.Printf("%v\n", str)
-			return fmt.Errorf("The inputs %s do not cover the outputs %s,\n"+
+			e := fct.NewValidationError(fct.ERR_FEE_TOO_LOW, "The inputs %s do not cover the outputs %s,\n"+
 				"the Entry Credit outputs %s, and the required fee %s",
-				strings.TrimSpace(fct.ConvertDecimal(tin)),
-				strings.TrimSpace(fct.ConvertDecimal(tout)),
-				strings.TrimSpace(fct.ConvertDecimal(tec)),
-				strings.TrimSpace(fct.ConvertDecimal(fee)))
+				fct.Amount(tin).String(),
+				fct.Amount(tout).String(),
+				fct.Amount(tec).String(),
+				fct.Amount(fee).String())
+			e.Required = sum
+			e.Provided = tin
+			return e
 		}
 	}
 
@@ -527,23 +574,33 @@ func (b FBlock) ValidateTransaction(index int, trans fct.ITransaction) error {
 }
 
 func (b FBlock) Validate() error {
+	if _, err := ValidateTransactions(&b); err != nil {
+		return err
+	}
 	for i, trans := range b.Transactions {
-		if err := b.ValidateTransaction(i, trans); err != nil {
-			return err
-		}
 		if i == 0 {
 			if len(trans.GetInputs()) != 0 {
-				return fmt.Errorf("Block has a coinbase transaction with inputs")
+				return fct.NewValidationError(fct.ERR_COINBASE, "Block has a coinbase transaction with inputs")
+			}
+			if b.DBHeight > 0 {
+				if err := coinbaseSchedule.ValidateCoinbase(b.DBHeight, trans); err != nil {
+					return err
+				}
 			}
 		} else {
 			if len(trans.GetInputs()) == 0 {
-				return fmt.Errorf("Block contains transactions without inputs")
+				return fct.NewValidationError(fct.ERR_MALFORMED, "Block contains transactions without inputs")
 			}
 		}
 	}
 
-	// Need to check balances are all good.
+	// Balances are checked against the Factoid State, see
+	// state.ValidateBlock()
+
+	return b.ValidateBodyMR()
+}
 
+func (b FBlock) ValidateBodyMR() error {
 	// Save what we got for our hashes
 	mr := b.BodyMR
 
@@ -552,7 +609,7 @@ func (b FBlock) Validate() error {
 
 	// Make sure nothing changes.  If something did, this block is bad.
 	if mr.IsSameAs(b.BodyMR) == false {
-		return fmt.Errorf("This blocks Merkle Root of the transactions does not match the transactions")
+		return fct.NewValidationError(fct.ERR_MALFORMED, "This blocks Merkle Root of the transactions does not match the transactions")
 	}
 
 	return nil
@@ -564,22 +621,28 @@ func (b FBlock) Validate() error {
 func (b *FBlock) AddCoinbase(trans fct.ITransaction) error {
 	b.BodyMR = nil
 	if len(b.Transactions) != 0 {
-		return fmt.Errorf("The coinbase transaction must be the first transaction")
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction must be the first transaction")
 	}
 	if len(trans.GetInputs()) != 0 {
-		return fmt.Errorf("The coinbase transaction cannot have any inputs")
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction cannot have any inputs")
 	}
 	if len(trans.GetECOutputs()) != 0 {
-		return fmt.Errorf("The coinbase transaction cannot buy Entry Credits")
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction cannot buy Entry Credits")
 	}
 	if len(trans.GetRCDs()) != 0 {
-		return fmt.Errorf("The coinbase transaction cannot have anyRCD blocks")
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction cannot have anyRCD blocks")
 	}
 	if len(trans.GetSignatureBlocks()) != 0 {
-		return fmt.Errorf("The coinbase transaction is not signed")
+		return fct.NewValidationError(fct.ERR_COINBASE, "The coinbase transaction is not signed")
 	}
 
-	// TODO Add check here for the proper payouts.
+	// The genesis block's coinbase distributes the initial allocation of
+	// Factoids, so it isn't held to the coinbase schedule.
+	if b.DBHeight > 0 {
+		if err := coinbaseSchedule.ValidateCoinbase(b.DBHeight, trans); err != nil {
+			return err
+		}
+	}
 
 	b.Transactions = append(b.Transactions, trans)
 	return nil
@@ -0,0 +1,176 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package block
+
+import (
+	"bytes"
+	"github.com/FactomProject/ed25519"
+	fct "github.com/FactomProject/factoid"
+	"math/rand"
+	"testing"
+)
+
+// A block like those on the chain: a coinbase, then signed transactions
+// spread over the minutes of the block.
+func newRealisticFBlock(ntrans int) IFBlock {
+	r := rand.New(rand.NewSource(1))
+	ts := uint64(1444444444444)
+	b := NewFBlock(1000, 1)
+	b.AddCoinbase(GetCoinbase(ts, 1))
+	for i := 0; i < ntrans; i++ {
+		t := new(fct.Transaction)
+		t.SetMilliTimestamp(ts + uint64(i))
+		public, private, _ := ed25519.GenerateKey(r)
+		rcd := fct.NewRCD_1(public[:])
+		adr, _ := rcd.GetAddress()
+		t.AddInput(adr, uint64(r.Int63n(100000000000)))
+		t.AddRCD(rcd)
+		t.AddOutput(fct.CreateAddress(fct.Sha([]byte{byte(i)})), uint64(r.Int63n(100000000)))
+		if i%2 == 0 {
+			t.AddOutput(adr, uint64(r.Int63n(100000000)))
+		}
+		if i%5 == 0 {
+			t.AddECOutput(fct.CreateAddress(fct.Sha([]byte{byte(i), 1})), 1000000)
+		}
+		data, _ := t.MarshalBinarySig()
+		sig := new(fct.Signature)
+		sig.SetSignature(ed25519.Sign(private, data)[:])
+		sigblk := new(fct.SignatureBlock)
+		sigblk.AddSignature(sig)
+		t.SetSignatureBlock(0, sigblk)
+
+		b.(*FBlock).Transactions = append(b.GetTransactions(), t)
+		if i%(ntrans/10+1) == 0 && i/(ntrans/10+1) < 9 {
+			b.EndOfPeriod(i/(ntrans/10+1) + 1)
+		}
+	}
+	b.CalculateHashes()
+	return b
+}
+
+func Test_FBlock_caches(test *testing.T) {
+	b := newRealisticFBlock(50)
+	data, err := b.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	header, _ := b.MarshalHeader()
+	trans, _ := b.MarshalTrans()
+	if !bytes.Equal(data, append(header, trans...)) {
+		fct.Prtln("The block is not its header and its transactions")
+		test.Fail()
+	}
+
+	b2 := new(FBlock)
+	if err := b2.UnmarshalBinary(data); err != nil {
+		test.Fatal(err)
+	}
+	if b.IsEqual(b2) != nil || !b.GetKeyMR().IsSameAs(b2.GetKeyMR()) ||
+		!b.GetLedgerKeyMR().IsSameAs(b2.GetLedgerKeyMR()) {
+		fct.Prtln("The decoded block does not match")
+		test.Fail()
+	}
+	if err := b2.Validate(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+
+	// A change to a transaction in the block shows up in its hashes.
+	kmr := b2.GetKeyMR()
+	lkmr := b2.GetLedgerKeyMR()
+	b2.GetTransactions()[3].GetOutputs()[0].SetAmount(1)
+	b2.CalculateHashes()
+	if kmr.IsSameAs(b2.GetKeyMR()) || lkmr.IsSameAs(b2.GetLedgerKeyMR()) {
+		fct.Prtln("Changing a transaction did not change the block's hashes")
+		test.Fail()
+	}
+	if b2.Validate() == nil {
+		fct.Prtln("A changed transaction should fail its signature")
+		test.Fail()
+	}
+}
+
+var benchBlockData []byte
+
+func getBenchBlockData(b *testing.B) []byte {
+	if benchBlockData == nil {
+		data, err := newRealisticFBlock(200).MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchBlockData = data
+	}
+	return benchBlockData
+}
+
+func decodeBenchBlock(b *testing.B) IFBlock {
+	blk := new(FBlock)
+	if err := blk.UnmarshalBinary(getBenchBlockData(b)); err != nil {
+		b.Fatal(err)
+	}
+	return blk
+}
+
+// Setting the timestamp of a transaction, even to what it was, clears its
+// caches.
+func clearTransactionCaches(blk IFBlock) {
+	for _, t := range blk.GetTransactions() {
+		t.SetMilliTimestamp(t.GetMilliTimestamp())
+	}
+}
+
+func Benchmark_FBlock_Marshal(b *testing.B) {
+	blk := decodeBenchBlock(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clearTransactionCaches(blk)
+		blk.MarshalBinary()
+	}
+}
+
+func Benchmark_FBlock_Marshal_cached(b *testing.B) {
+	blk := decodeBenchBlock(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		blk.MarshalBinary()
+	}
+}
+
+func Benchmark_FBlock_Unmarshal(b *testing.B) {
+	data := getBenchBlockData(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		blk := new(FBlock)
+		if err := blk.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The hashes of a block just loaded, as when the state is rebuilt.
+func Benchmark_FBlock_Hashes(b *testing.B) {
+	blk := decodeBenchBlock(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		clearTransactionCaches(blk)
+		blk.GetKeyMR()
+		blk.GetLedgerKeyMR()
+	}
+}
+
+func Benchmark_FBlock_Hashes_cached(b *testing.B) {
+	blk := decodeBenchBlock(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		blk.GetKeyMR()
+		blk.GetLedgerKeyMR()
+	}
+}
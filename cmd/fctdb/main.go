@@ -0,0 +1,129 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// fctdb looks after the Bolt database that holds the Factoid state.
+//
+//	fctdb --check <database>    Report the schema version, and any records
+//	                            that can't be read.  Nothing is changed.
+//	fctdb --migrate <database>  Upgrade the database to the current schema
+//	                            version.
+//	fctdb --copy <logdb> <database>
+//	                            Copy the database, bucket by bucket, into a
+//	                            new LogDB.  The LogDB file must end in .fctlog
+//	                            and must not exist yet.  The database is only
+//	                            read, so it must be at the current schema
+//	                            version; migrate it first.
+//
+// Add --wallet if the database is a wallet rather than the chain.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/FactomProject/factoid/database"
+	"github.com/FactomProject/factoid/state/stateinit"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	check := flag.Bool("check", false, "report records that can't be read, without changing the database")
+	migrate := flag.Bool("migrate", false, "upgrade the database to the current schema version")
+	copyTo := flag.String("copy", "", "copy the database into a new LogDB at this path")
+	isWallet := flag.Bool("wallet", false, "the database is a wallet")
+	flag.Parse()
+
+	modes := 0
+	for _, on := range []bool{*check, *migrate, *copyTo != ""} {
+		if on {
+			modes++
+		}
+	}
+	if flag.NArg() != 1 || modes != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: fctdb [--wallet] --check|--migrate|--copy <logdb> <database>")
+		os.Exit(2)
+	}
+	filename := flag.Arg(0)
+
+	if *check {
+		report, err := database.CheckBolt(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(report.String())
+		if len(report.Problems) > 0 || report.Version != database.SCHEMA_VERSION {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *copyTo != "" {
+		from, err := database.OpenBoltReadOnly(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer from.Close()
+		if err := copyToLog(from, *copyTo); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if _, err := os.Stat(filename); err != nil {
+		fmt.Fprintf(os.Stderr, "Database %s was not found\n", filename)
+		os.Exit(1)
+	}
+	// Opening the database migrates it
+	open := stateinit.GetDatabase
+	if *isWallet {
+		open = stateinit.GetWalletDatabase
+	}
+	db, err := open(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	bolt, ok := db.(*database.BoltDB)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Database %s is not a BoltDB\n", filename)
+		os.Exit(1)
+	}
+
+	version, err := bolt.GetVersion()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Database %s is at schema version %d\n", filename, version)
+}
+
+func copyToLog(from *database.BoltDB, filename string) error {
+	if filepath.Ext(filename) != database.LOGDB_EXT {
+		return fmt.Errorf("A LogDB file must end in %s", database.LOGDB_EXT)
+	}
+	if _, err := os.Stat(filename); err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+	buckets, err := from.GetBuckets()
+	if err != nil {
+		return err
+	}
+	to := new(database.LogDB)
+	if err := to.Init(buckets, filename); err != nil {
+		return err
+	}
+	defer to.Close()
+	for _, bucket := range buckets {
+		n, err := database.CopyBucket(from, to, bucket)
+		if err != nil {
+			return fmt.Errorf("Copying bucket '%s' failed: %s", string(bucket), err.Error())
+		}
+		fmt.Printf("%-20s %d records\n", string(bucket), n)
+	}
+	return nil
+}
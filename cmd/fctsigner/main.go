@@ -0,0 +1,140 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+// fctsigner holds private keys outside the node, and signs for it over a
+// unix socket (see wallet.SocketSigner).
+//
+//	fctsigner --keys <file> [--max <amount>] [--dest <addresses>] [--allow-data] <socket>
+//
+// The keys file holds human readable private keys (Fs... or Es...), one to
+// a line.  Blank lines and lines starting with # are skipped.
+//
+//	--max         The most a transaction may pay, in Factoids
+//	--dest        Comma separated Factoid and Entry Credit addresses; the
+//	              only ones a transaction may pay
+//	--allow-data  Sign data that isn't a transaction, like commits.  With
+//	              this, --max and --dest can be got around.
+//
+// The socket can only be used by the user running fctsigner.  It needs
+// the umask to make sure of that, so fctsigner is not built for Windows.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/wallet"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+func main() {
+	keys := flag.String("keys", "", "file of human readable private keys")
+	max := flag.String("max", "", "the most a transaction may pay, in Factoids")
+	dest := flag.String("dest", "", "comma separated addresses transactions may pay")
+	allowData := flag.Bool("allow-data", false, "sign data that isn't a transaction, like commits")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *keys == "" {
+		fmt.Fprintln(os.Stderr, "Usage: fctsigner --keys <file> [--max <amount>] [--dest <addresses>] [--allow-data] <socket>")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	policy := new(wallet.SignerPolicy)
+	policy.AllowData = *allowData
+	if *max != "" {
+		amount, err := fct.ParseAmount(*max)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		policy.MaxAmount = amount.Factoshis()
+	}
+	if *dest != "" {
+		for _, str := range strings.Split(*dest, ",") {
+			u, err := fct.ParseUserStr(str)
+			if err == nil && u.Kind != fct.USER_FCT_ADDRESS && u.Kind != fct.USER_EC_ADDRESS {
+				err = fmt.Errorf("%s is not an address", strings.TrimSpace(str))
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			policy.Destinations = append(policy.Destinations, u.Key)
+		}
+	}
+
+	w := new(wallet.SCWallet)
+	w.Init()
+	n, err := loadKeys(w, *keys)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(os.Stderr, "%s already exists.  Remove it if no signer is running.\n", path)
+		os.Exit(1)
+	}
+	// Only our own user may ask for signatures.  The socket is created
+	// that way, so there is no moment when anyone else can connect.
+	umask := syscall.Umask(0077)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	server := wallet.NewSignerServer(w.GetSigner(), policy)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
+	fmt.Printf("Signing with %d keys on %s\n", n, path)
+	server.Serve(l) // Returns once closed, which removes the socket
+}
+
+// Import the keys in the file into the wallet, and return how many.
+func loadKeys(w *wallet.SCWallet, filename string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(scanner.Text())
+		if str == "" || strings.HasPrefix(str, "#") {
+			continue
+		}
+		name := []byte(fmt.Sprintf("key %d", line))
+		switch {
+		case fct.ValidateFPrivateUserStr(str):
+			_, err = w.GenerateFctAddressFromHumanReadablePrivateKey(name, str, 1, 1)
+		case fct.ValidateECPrivateUserStr(str):
+			_, err = w.GenerateECAddressFromHumanReadablePrivateKey(name, str)
+		default:
+			err = fmt.Errorf("not a private key")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s line %d: %s", filename, line, err.Error())
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,83 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	fct "github.com/FactomProject/factoid"
+)
+
+// One write held in a batch.  A delete has a nil value.
+type batchOp struct {
+	bucket []byte
+	key    []byte
+	value  fct.IBlock
+	delete bool
+}
+
+// The writes made between Begin() and Commit(), in the order they were
+// made.  A later write to the same key replaces the earlier one.
+type writeBatch struct {
+	ops   []*batchOp
+	index map[string]*batchOp
+}
+
+func newWriteBatch() *writeBatch {
+	b := new(writeBatch)
+	b.ops = make([]*batchOp, 0, 32)
+	b.index = make(map[string]*batchOp, 32)
+	return b
+}
+
+func (b *writeBatch) set(bucket []byte, key []byte, value fct.IBlock, delete bool) {
+	k := encodeKey(bucket, key)
+	op, ok := b.index[k]
+	if !ok {
+		op = new(batchOp)
+		op.bucket = append([]byte{}, bucket...)
+		op.key = append([]byte{}, key...)
+		b.index[k] = op
+		b.ops = append(b.ops, op)
+	}
+	op.value = value
+	op.delete = delete
+}
+
+func (b *writeBatch) put(bucket []byte, key []byte, value fct.IBlock) {
+	b.set(bucket, key, value, false)
+}
+
+func (b *writeBatch) deleteKey(bucket []byte, key []byte) {
+	b.set(bucket, key, nil, true)
+}
+
+// Returns the value written to the key in this batch, and true if the
+// batch holds a write (or delete) for the key.
+func (b *writeBatch) get(bucket []byte, key []byte) (fct.IBlock, bool) {
+	op, ok := b.index[encodeKey(bucket, key)]
+	if !ok {
+		return nil, false
+	}
+	return op.value, true
+}
+
+// Apply the writes of the batch to the keys and values of a bucket.
+func (b *writeBatch) merge(bucket []byte, keys [][]byte, values []fct.IBlock) ([][]byte, []fct.IBlock) {
+	rkeys := make([][]byte, 0, len(keys))
+	rvalues := make([]fct.IBlock, 0, len(values))
+	for i, key := range keys {
+		if _, ok := b.get(bucket, key); !ok {
+			rkeys = append(rkeys, key)
+			rvalues = append(rvalues, values[i])
+		}
+	}
+	for _, op := range b.ops {
+		if !op.delete && bytes.Equal(op.bucket, bucket) {
+			rkeys = append(rkeys, op.key)
+			rvalues = append(rvalues, op.value)
+		}
+	}
+	return rkeys, rvalues
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"os"
+	"testing"
+)
+
+func newBatchTestBolt(t *testing.T, filename string) *BoltDB {
+	db := new(BoltDB)
+	os.Remove(filename)
+	if err := db.Init([][]byte{[]byte("one"), []byte("two")}, filename); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func batchAddress(s string) *fct.Address {
+	a := new(fct.Address)
+	a.SetBytes(fct.Sha([]byte(s)).Bytes())
+	return a
+}
+
+func Test_batch_MapDB_over_BoltDB(t *testing.T) {
+	bolt := newBatchTestBolt(t, "/tmp/batch_test.db")
+	defer os.Remove("/tmp/batch_test.db")
+	defer bolt.Close()
+
+	db := new(MapDB)
+	db.Init()
+	db.SetPersist(bolt)
+
+	k1, k2 := fct.Sha([]byte("k1")), fct.Sha([]byte("k2"))
+	a1, a2 := batchAddress("a1"), batchAddress("a2")
+
+	// Writes in a rolled back batch are seen inside the batch, then lost.
+	db.Begin()
+	db.Put("one", k1, a1)
+	if v, _ := db.Get("one", k1); a1.IsEqual(v) != nil {
+		fmt.Println("A batch should read its own writes")
+		t.Fail()
+	}
+	if err := db.Begin(); err == nil {
+		fmt.Println("Batches should not nest")
+		t.Fail()
+	}
+	db.Rollback()
+	if v, _ := db.Get("one", k1); v != nil {
+		fmt.Println("Rolled back write is still visible")
+		t.Fail()
+	}
+
+	// Writes in a committed batch reach the persist database.
+	db.Begin()
+	db.Put("one", k1, a1)
+	db.Put("two", k2, a2)
+	if v, _ := bolt.Get("one", k1); v != nil {
+		fmt.Println("Write reached the persist database before the commit")
+		t.Fail()
+	}
+	if err := db.Commit(); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	if v, _ := bolt.Get("two", k2); a2.IsEqual(v) != nil {
+		fmt.Println("Committed write did not reach the persist database")
+		t.Fail()
+	}
+
+	// A batch that fails to commit leaves nothing behind, in the persist
+	// database or the cache.
+	db.Begin()
+	db.DeleteKey([]byte("one"), k1.Bytes())
+	db.Put("two", k1, a1)
+	db.Put("three", k1, a1) // No such bucket
+	if err := db.Commit(); err == nil {
+		fmt.Println("Commit into a missing bucket should fail")
+		t.Fail()
+	}
+	if v, _ := db.Get("one", k1); a1.IsEqual(v) != nil {
+		fmt.Println("Failed commit deleted a key")
+		t.Fail()
+	}
+	if v, _ := bolt.Get("two", k1); v != nil {
+		fmt.Println("Failed commit wrote a key")
+		t.Fail()
+	}
+}
+
+func Test_batch_GetKeysValues(t *testing.T) {
+	bolt := newBatchTestBolt(t, "/tmp/batch_keys_test.db")
+	defer os.Remove("/tmp/batch_keys_test.db")
+	defer bolt.Close()
+
+	k1, k2 := fct.Sha([]byte("k1")), fct.Sha([]byte("k2"))
+	bolt.Put("one", k1, batchAddress("a1"))
+
+	bolt.Begin()
+	bolt.DeleteKey([]byte("one"), k1.Bytes())
+	bolt.Put("one", k2, batchAddress("a2"))
+	keys, _, err := bolt.GetKeysValues([]byte("one"))
+	if err != nil || len(keys) != 1 || fct.NewHash(keys[0]).IsEqual(k2) != nil {
+		fmt.Println("Keys should reflect the open batch: ", keys, err)
+		t.Fail()
+	}
+	bolt.Commit()
+
+	keys, _, err = bolt.GetKeysValues([]byte("one"))
+	if err != nil || len(keys) != 1 || fct.NewHash(keys[0]).IsEqual(k2) != nil {
+		fmt.Println("Keys should reflect the committed batch: ", keys, err)
+		t.Fail()
+	}
+}
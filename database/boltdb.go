@@ -21,13 +21,10 @@ var _ = hex.EncodeToString
 // all those buckets exist.  (Avoids checking and building buckets in every
 // write).
 //
-// It also needs a map of a hash to a IBlock instance.  To support this,
-// every block needs to be able to give the database a Hash for its type.
-// This has to match the reverse, where looking up the hash gives the
-// database the type for the hash.  This way, the database can marshal
-// and unmarshal IBlocks for storage in the database.  And since the IBlocks
-// can provide the hash, we don't need two maps.  Just the Hash to the
-// IBlock.
+// Every IBlock stored is written with the Hash of its type.  Reading it
+// back, the type is found from that Hash in the registry of IBlock types
+// (see factoid.RegisterType() and factoid.Decode()), so every type stored
+// must be registered.
 //
 // Lastly it needs a filename with a full path.  If none is specified, it will
 // use "/tmp/bolt_my.db".  Not the best idea to let this code default.
@@ -35,9 +32,8 @@ var _ = hex.EncodeToString
 type BoltDB struct {
 	FDatabase
 
-	db        *bolt.DB                // Pointer to the bolt db
-	instances map[[32]byte]fct.IBlock // Maps a hash to an instance of an IBlock
-	filename  []byte                  // location to write the db
+	db       *bolt.DB // Pointer to the bolt db
+	filename []byte   // location to write the db
 }
 
 var _ IFDatabase = (*BoltDB)(nil)
@@ -91,23 +87,30 @@ func (bdb BoltDB) IsEqual(blk2 fct.IBlock) []fct.IBlock {
 	return b
 }
 
-func (bdb BoltDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock) {
+func (bdb BoltDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
 	keys = make([][]byte, 0, 32)
 	values = make([]fct.IBlock, 0, 32)
-	bdb.db.View(func(tx *bolt.Tx) error {
+	err = bdb.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		if b == nil {
-			fmt.Println("bucket '", bucket, "' not found")
-		} else {
-			b.ForEach(func(k, v []byte) error {
-				keys = append(keys, k)
-				instance := bdb.GetInstance(v)
-				values = append(values, instance)
-				return nil
-			})
+			return NewNoBucketError(bucket)
 		}
-		return nil
+		return b.ForEach(func(k, v []byte) error {
+			instance, err := bdb.GetInstance(v)
+			if err != nil {
+				return corruptionAt(err, bucket, k)
+			}
+			keys = append(keys, append([]byte{}, k...))
+			values = append(values, instance)
+			return nil
+		})
 	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if bdb.batch != nil {
+		keys, values = bdb.batch.merge(bucket, keys, values)
+	}
 	return
 }
 
@@ -119,16 +122,16 @@ func (b BoltDB) String() string {
 	return string(txt)
 }
 
-func (d *BoltDB) Clear(bucketList [][]byte) {
+func (d *BoltDB) Clear(bucketList [][]byte) error {
 
 	if d.filename == nil {
-		panic("Database has not been initialized properly; missing filename")
+		return fmt.Errorf("Database has not been initialized properly; missing filename")
 	}
 
 	tdb, err := bolt.Open(string(d.filename), 0600, nil)
 
 	if err != nil {
-		panic("Database " + string(d.filename) + " was not found, and could not be created.")
+		return fmt.Errorf("Database %s was not found, and could not be created: %s", string(d.filename), err.Error())
 	}
 	defer tdb.Close()
 
@@ -141,67 +144,83 @@ func (d *BoltDB) Clear(bucketList [][]byte) {
 			return nil
 		})
 	}
+	return nil
 }
 
 // We have to make accomadation for many Init functions.  But what we really
 // want here is:
 //
-//      Init(bucketList [][]byte, instances map[[32]byte]IBlock, filename string)
+//      Init(bucketList [][]byte, filename string)
 //
-func (d *BoltDB) Init(a ...interface{}) {
+func (d *BoltDB) Init(a ...interface{}) error {
 
 	if d.doNotCache == nil {
 		d.doNotCache = make(map[string][]byte, 5)
 		d.doNotPersist = make(map[string][]byte, 5)
 	}
 
-	bucketList := a[0].([][]byte)
-
-	if d.instances == nil {
-		d.instances = a[1].(map[[32]byte]fct.IBlock)
-	} else {
-		for k, v := range a[1].(map[[32]byte]fct.IBlock) {
-			d.instances[k] = v
-		}
+	bucketList, a, err := initArgs("BoltDB", a)
+	if err != nil {
+		return err
 	}
 
 	if d.db == nil {
-		if len(a) < 3 {
+		if len(a) < 1 {
 			if d.filename == nil {
 				d.filename = []byte("/tmp/bolt_my.db")
 			}
 		} else {
-			d.filename = []byte(a[2].(string))
+			filename, ok := a[0].(string)
+			if !ok {
+				return fmt.Errorf("BoltDB.Init() expected a filename")
+			}
+			d.filename = []byte(filename)
 		}
 
 		tdb, err := bolt.Open(string(d.filename), 0600, nil)
 		if err != nil {
-			panic("Database was not found, and could not be created.")
+			return fmt.Errorf("Database %s was not found, and could not be created: %s", string(d.filename), err.Error())
 		}
 
 		d.db = tdb
+
+		if err := d.openSchema(); err != nil {
+			return err
+		}
 	}
 
 	for _, bucket := range bucketList {
-		d.db.Update(func(tx *bolt.Tx) error {
+		err := d.db.Update(func(tx *bolt.Tx) error {
 			_, err := tx.CreateBucketIfNotExists(bucket)
 			if err != nil {
 				return fmt.Errorf("create bucket: %s", err)
 			}
 			return nil
 		})
+		if err != nil {
+			return err
+		}
 	}
 
+	return nil
 }
 
 func (d *BoltDB) Close() {
 	d.db.Close()
 }
 
-func (d *BoltDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock) {
+func (d *BoltDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock, err error) {
+	if d.batch != nil {
+		if value, ok := d.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
 	var v []byte
-	d.db.View(func(tx *bolt.Tx) error {
+	err = d.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket(bucket)
+		if b == nil {
+			return NewNoBucketError(bucket)
+		}
 		v1 := b.Get(key)
 		if v1 == nil {
 			return nil
@@ -210,90 +229,314 @@ func (d *BoltDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock) {
 		copy(v, v1)
 		return nil
 	})
-	if v == nil || len(v) < 32 { // If the value is undefined, return nil
-		return nil
+	if err != nil {
+		return nil, err
+	}
+	if v == nil { // If the value is undefined, return nil
+		return nil, nil
 	}
 
-	return d.GetInstance(v)
+	value, err = d.GetInstance(v)
+	if err != nil {
+		return nil, corruptionAt(err, bucket, key)
+	}
+	return value, nil
+}
 
+// Fill in where a corrupted record was found.
+func corruptionAt(err error, bucket []byte, key []byte) error {
+	if c, ok := err.(*CorruptionError); ok {
+		c.Bucket = append([]byte{}, bucket...)
+		c.Key = append([]byte{}, key...)
+	}
+	return err
 }
 
 // Return the instance, properly unmarshaled, given the entry in the database, which is
 // the hash for the Instance (vv) followed by the source from which to unmarshal (v)
-func (d *BoltDB) GetInstance(v []byte) fct.IBlock {
+func (d *BoltDB) GetInstance(v []byte) (fct.IBlock, error) {
+	return decodeRecord(v)
+}
 
-	var vv [32]byte
-	copy(vv[:], v[:32])
-	v = v[32:]
+// Decode a record written by encodeRecord().  The type of the IBlock is
+// found in the registry of IBlock types kept by the factoid package.
+func decodeRecord(v []byte) (fct.IBlock, error) {
 
-	var instance fct.IBlock = d.instances[vv]
-	if instance == nil {
-		vp := fct.NewHash(vv[:])
-		fct.Prtln("Object hash: ", vp)
-		panic("This should not happen.  Object stored in the database has no IBlock instance")
+	if len(v) < 36 {
+		return nil, NewCorruptionError("Record of %d bytes is too short", len(v))
 	}
 
-	r := instance.GetNewInstance()
-	if r == nil {
-		panic("An IBlock has failed to implement GetNewInstance()")
-	}
+	var vv [32]byte
+	copy(vv[:], v[:32])
+	v = v[32:]
 
 	datalen, v := binary.BigEndian.Uint32(v[0:4]), v[4:]
 	if len(v) != int(datalen) {
-		fct.Prtln("Lengths don't match.  Expected ", datalen, " and got ", len(v))
-		panic("Data not returned properly")
+		return nil, NewCorruptionError("Lengths don't match.  Expected %d and got %d", datalen, len(v))
 	}
-	err := r.UnmarshalBinary(v)
+	r, err := fct.Decode(vv, v)
 	if err != nil {
-		panic("This should not happen.  IBlock failed to unmarshal.")
+		return nil, NewCorruptionError("%s", err.Error())
 	}
 
-	return r
+	return r, nil
 }
 
-func (d *BoltDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) {
+// Init() takes a bucket list, and then, for a database kept in a file, the
+// filename.  Callers once had to pass a map of IBlock instances between the
+// two; types now come from the registry, so such a map is skipped.  Returns
+// the bucket list and the arguments after it.
+func initArgs(name string, a []interface{}) ([][]byte, []interface{}, error) {
+	if len(a) < 1 {
+		return nil, nil, fmt.Errorf("%s.Init() requires a bucket list", name)
+	}
+	bucketList, ok := a[0].([][]byte)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s.Init() expected a bucket list", name)
+	}
+	a = a[1:]
+	if len(a) > 0 {
+		if _, ok := a[0].(map[[32]byte]fct.IBlock); ok {
+			a = a[1:]
+		}
+	}
+	return bucketList, a, nil
+}
+
+// The record for an IBlock is the hash of its type, followed by the length
+// of its data, and the data.
+func encodeRecord(value fct.IBlock) ([]byte, error) {
 	var out bytes.Buffer
 	hash := value.GetDBHash()
 	out.Write(hash.Bytes())
 	data, err := value.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal IBlock for BoltDB: %s", err.Error())
+	}
 	binary.Write(&out, binary.BigEndian, uint32(len(data)))
 	out.Write(data)
+	return out.Bytes(), nil
+}
 
+func putRecord(tx *bolt.Tx, bucket []byte, key []byte, value fct.IBlock) error {
+	record, err := encodeRecord(value)
 	if err != nil {
-		panic("This should not happen.  Failed to marshal IBlock for BoltDB")
-	}
-	d.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucket)
-		err := b.Put(key, out.Bytes())
 		return err
-	})
+	}
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return NewNoBucketError(bucket)
+	}
+	return b.Put(key, record)
+}
 
+func deleteRecord(tx *bolt.Tx, bucket []byte, key []byte) error {
+	b := tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
 }
 
-// We don't care if delete works or not.  If the key isn't there, that's ok
-func (d *BoltDB) DeleteKey(bucket []byte, key []byte) {
-	d.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucket)
-		b.Delete(key)
+func (d *BoltDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) error {
+	if d.batch != nil {
+		d.batch.put(bucket, key, value)
 		return nil
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return putRecord(tx, bucket, key, value)
 	})
+}
 
+// We don't care if the key is there or not.  If it isn't, that's ok
+func (d *BoltDB) DeleteKey(bucket []byte, key []byte) error {
+	if d.batch != nil {
+		d.batch.deleteKey(bucket, key)
+		return nil
+	}
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return deleteRecord(tx, bucket, key)
+	})
 }
 
-func (db *BoltDB) Get(bucket string, key fct.IHash) (value fct.IBlock) {
+// The whole batch is written in one bolt transaction, so it is written
+// completely or not at all, with one sync to disk.
+func (d *BoltDB) Commit() error {
+	batch := d.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	d.batch = nil
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, op := range batch.ops {
+			var err error
+			if op.delete {
+				err = deleteRecord(tx, op.bucket, op.key)
+			} else {
+				err = putRecord(tx, op.bucket, op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *BoltDB) Get(bucket string, key fct.IHash) (value fct.IBlock, err error) {
 	return db.GetRaw([]byte(bucket), key.Bytes())
 }
 
-func (db *BoltDB) GetKey(key IDBKey) (value fct.IBlock) {
+func (db *BoltDB) GetKey(key IDBKey) (value fct.IBlock, err error) {
 	return db.GetRaw(key.GetBucket(), key.GetKey())
 }
 
-func (db *BoltDB) Put(bucket string, key fct.IHash, value fct.IBlock) {
+func (db *BoltDB) Put(bucket string, key fct.IHash, value fct.IBlock) error {
 	b := []byte(bucket)
 	k := key.Bytes()
-	db.PutRaw(b, k, value)
+	return db.PutRaw(b, k, value)
+}
+
+func (db *BoltDB) PutKey(key IDBKey, value fct.IBlock) error {
+	return db.PutRaw(key.GetBucket(), key.GetKey(), value)
+}
+
+// The number of records a BoltDB iterator reads in each bolt transaction.
+// Holding a read transaction open while the caller works would block bolt
+// from growing the database file, so records are read a page at a time.
+const BOLT_ITERATOR_PAGE = 64
+
+// Iterates over a bucket with bolt cursors, a page at a time.
+type boltIterator struct {
+	db     *BoltDB
+	bucket []byte
+	r      *KeyRange
+	keys   [][]byte
+	values []fct.IBlock
+	pos    int
+	seek   []byte // Where the next page starts
+	skip   bool   // Skip the key at seek, because we have seen it
+	done   bool   // No pages are left
+	err    error
+}
+
+var _ IIterator = (*boltIterator)(nil)
+
+func (bdb *BoltDB) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	err := bdb.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucket) == nil {
+			return NewNoBucketError(bucket)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	it := &boltIterator{db: bdb, bucket: append([]byte{}, bucket...), r: r}
+	it.Seek(nil)
+	return overlayBatch(it, bdb.batch, bucket, r), nil
+}
+
+// Read the next page of records.
+func (it *boltIterator) fill() {
+	it.keys, it.values, it.pos = it.keys[:0], it.values[:0], -1
+	it.err = it.db.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(it.bucket)
+		if b == nil {
+			return NewNoBucketError(it.bucket)
+		}
+		c := b.Cursor()
+		var k, v []byte
+		if it.seek == nil {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(it.seek)
+		}
+		if it.skip && k != nil && bytes.Equal(k, it.seek) {
+			k, v = c.Next()
+		}
+		for ; k != nil; k, v = c.Next() {
+			if it.r.past(k) {
+				it.done = true
+				return nil
+			}
+			if len(it.keys) == BOLT_ITERATOR_PAGE {
+				return nil
+			}
+			if !it.r.Contains(k) {
+				continue
+			}
+			instance, err := it.db.GetInstance(v)
+			if err != nil {
+				return corruptionAt(err, it.bucket, k)
+			}
+			it.keys = append(it.keys, append([]byte{}, k...))
+			it.values = append(it.values, instance)
+		}
+		it.done = true
+		return nil
+	})
+	if it.err != nil {
+		it.done = true
+		it.keys, it.values = it.keys[:0], it.values[:0]
+	} else if len(it.keys) > 0 {
+		it.seek, it.skip = it.keys[len(it.keys)-1], true
+	}
 }
 
-func (db *BoltDB) PutKey(key IDBKey, value fct.IBlock) {
-	db.PutRaw(key.GetBucket(), key.GetKey(), value)
+func (it *boltIterator) Next() bool {
+	for {
+		if it.pos+1 < len(it.keys) {
+			it.pos++
+			return true
+		}
+		if it.done {
+			it.pos = len(it.keys)
+			return false
+		}
+		it.fill()
+	}
+}
+
+func (it *boltIterator) Seek(key []byte) {
+	first := it.r.first()
+	if bytes.Compare(key, first) < 0 {
+		key = first
+	}
+	it.seek = key
+	if len(key) > 0 {
+		it.seek = append([]byte{}, key...)
+	}
+	it.skip, it.done, it.err = false, false, nil
+	it.keys, it.values, it.pos = it.keys[:0], it.values[:0], -1
+}
+
+func (it *boltIterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.pos]
+}
+
+func (it *boltIterator) Value() fct.IBlock {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+func (it *boltIterator) Err() error { return it.err }
+
+func (it *boltIterator) Close() {
+	it.keys, it.values, it.done = nil, nil, true
+}
+
+// The names of all the buckets in the database, but for the schema bucket.
+func (d *BoltDB) GetBuckets() (buckets [][]byte, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		buckets = (&boltMigrationTx{tx}).Buckets()
+		return nil
+	})
+	return
 }
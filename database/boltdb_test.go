@@ -5,11 +5,14 @@
 package database
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"github.com/FactomProject/bolt"
 	"github.com/FactomProject/ed25519"
 	fct "github.com/FactomProject/factoid"
 	"math/rand"
+	"os"
 	"testing"
 )
 
@@ -70,20 +73,109 @@ func Test_bolt_init(t *testing.T) {
 		a = new(fct.Transaction)
 		instances[cp(a.GetDBHash())] = a
 	}
-	db.Init(bucketList, instances)
+	if err := db.Init(bucketList, instances, "/tmp/bolt_init_test.db"); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer os.Remove("/tmp/bolt_init_test.db")
+	defer db.Close()
+
 	a := new(fct.Address)
 	a.SetBytes(fct.Sha([]byte("I came, I saw")).Bytes())
-	db.Put("one", fct.Sha([]byte("one")), a)
-	r := db.Get("one", fct.Sha([]byte("one")))
+	if err := db.Put("one", fct.Sha([]byte("one")), a); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	r, err := db.Get("one", fct.Sha([]byte("one")))
 
-	if a.IsEqual(r) != nil {
+	if err != nil || a.IsEqual(r) != nil {
 		t.Fail()
 	}
 
 	db.DeleteKey([]byte("one"), fct.Sha([]byte("one")).Bytes())
-	r = db.Get("one", fct.Sha([]byte("one")))
+	r, err = db.Get("one", fct.Sha([]byte("one")))
+
+	if err != nil || r != nil {
+		t.Fail()
+	}
+
+	// Writes to a bucket that doesn't exist fail, rather than being lost.
+	if err := db.Put("six", fct.Sha([]byte("one")), a); err == nil {
+		fmt.Println("Put into a missing bucket should fail")
+		t.Fail()
+	}
+}
 
-	if r != nil {
+func Test_bolt_corruption(t *testing.T) {
+	db := new(BoltDB)
+	if err := db.Init([][]byte{[]byte("one")}, "/tmp/bolt_corruption_test.db"); err != nil {
+		fmt.Println(err)
 		t.Fail()
+		return
+	}
+	defer os.Remove("/tmp/bolt_corruption_test.db")
+	defer db.Close()
+
+	a := new(fct.Address)
+	a.SetBytes(fct.Sha([]byte("I came, I saw")).Bytes())
+	db.Put("one", fct.Sha([]byte("good")), a)
+
+	// Write a record whose type hash no registered type answers to, and one that
+	// has been cut short.
+	key := fct.Sha([]byte("bad")).Bytes()
+	db.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("one"))
+		b.Put(key, make([]byte, 40))
+		b.Put([]byte("short"), []byte{1, 2, 3})
+		return nil
+	})
+
+	if r, err := db.Get("one", fct.Sha([]byte("good"))); err != nil || a.IsEqual(r) != nil {
+		fmt.Println("Good record should still read back: ", err)
+		t.Fail()
+	}
+	_, err := db.GetRaw([]byte("one"), key)
+	if !IsCorruption(err) || !bytes.Equal(err.(*CorruptionError).Key, key) {
+		fmt.Println("Expected corruption at the bad key, got: ", err)
+		t.Fail()
+	}
+	if _, err := db.GetRaw([]byte("one"), []byte("short")); !IsCorruption(err) {
+		fmt.Println("Expected corruption for a short record, got: ", err)
+		t.Fail()
+	}
+	if _, _, err := db.GetKeysValues([]byte("one")); !IsCorruption(err) {
+		fmt.Println("Expected GetKeysValues to report corruption, got: ", err)
+		t.Fail()
+	}
+}
+
+// Types are found in the registry, whatever package they come from.
+func Test_bolt_registry(t *testing.T) {
+	db := new(BoltDB)
+	if err := db.Init([][]byte{[]byte("one")}, "/tmp/bolt_registry_test.db"); err != nil {
+		fmt.Println(err)
+		t.Fail()
+		return
+	}
+	defer os.Remove("/tmp/bolt_registry_test.db")
+	defer db.Close()
+
+	bs := new(ByteStore)
+	bs.SetBytes([]byte("some bytes"))
+	values := []fct.IBlock{
+		fct.NewAddress(fct.Sha([]byte("an address")).Bytes()),
+		fct.NewRCD_1(fct.Sha([]byte("a public key")).Bytes()),
+		bs,
+	}
+	for i, v := range values {
+		db.PutRaw([]byte("one"), []byte{byte(i)}, v)
+	}
+	for i, v := range values {
+		r, err := db.GetRaw([]byte("one"), []byte{byte(i)})
+		if err != nil || v.IsEqual(r) != nil {
+			fmt.Printf("%T did not read back from the registry: %v\n", v, err)
+			t.Fail()
+		}
 	}
 }
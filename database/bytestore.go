@@ -47,6 +47,10 @@ func (b ByteStore) String() string {
 	return string(b.byteData)
 }
 
+func init() {
+	fct.RegisterType(new(ByteStore))
+}
+
 func (ByteStore) GetDBHash() fct.IHash {
 	return fct.Sha([]byte("ByteStore"))
 }
@@ -59,7 +63,13 @@ func (b ByteStore) CustomMarshalText() ([]byte, error) {
 // for the UnmarshalBinary() method from encode.  We define our own method that
 // makes the code easier to read and way more efficent.
 func (b *ByteStore) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("Data source too short to unmarshal a ByteStore: %d", len(data))
+	}
 	size, data := binary.BigEndian.Uint32(data), data[4:]
+	if uint64(size) > uint64(len(data)) {
+		return nil, fmt.Errorf("ByteStore of %d bytes runs past the end of the data", size)
+	}
 	b.byteData = make([]byte, size, size)
 	copy(b.byteData, data[:size])
 	return data[size:], nil
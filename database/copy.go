@@ -0,0 +1,31 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+// Copy every key in a bucket from one database to another, as one batch.
+// Returns the number of keys copied.
+func CopyBucket(from IFDatabase, to IFDatabase, bucket []byte) (int, error) {
+	it, err := from.Iterate(bucket, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	if err := to.Begin(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for it.Next() {
+		if err := to.PutRaw(bucket, it.Key(), it.Value()); err != nil {
+			to.Rollback()
+			return 0, err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		to.Rollback()
+		return 0, err
+	}
+	return n, to.Commit()
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+)
+
+// Returned when a record in the database exists, but can't be turned back
+// into an IBlock.  Bucket and Key identify the record, when known.
+type CorruptionError struct {
+	Bucket []byte
+	Key    []byte
+	Msg    string
+}
+
+func NewCorruptionError(format string, args ...interface{}) *CorruptionError {
+	e := new(CorruptionError)
+	e.Msg = fmt.Sprintf(format, args...)
+	return e
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Bucket == nil {
+		return "Database corruption: " + e.Msg
+	}
+	return fmt.Sprintf("Database corruption in %s at %x: %s", string(e.Bucket), e.Key, e.Msg)
+}
+
+// True if err reports a corrupted record.
+func IsCorruption(err error) bool {
+	_, ok := err.(*CorruptionError)
+	return ok
+}
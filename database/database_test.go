@@ -32,10 +32,10 @@ func Test_Auth1_Equals(test *testing.T) {
 	b := new(t_balance)                    // Get a balance IBlock
 	b.balance = 1000                       // Set the balance
 
-	scd.Put("ec", ecAdr, b)    // Write balance to db
-	b2 := scd.Get("ec", ecAdr) // Get it back.
+	scd.Put("ec", ecAdr, b)         // Write balance to db
+	b2, err := scd.Get("ec", ecAdr) // Get it back.
 
-	if b.balance != b2.(*t_balance).balance { // Make sure we got it back.
+	if err != nil || b.balance != b2.(*t_balance).balance { // Make sure we got it back.
 		test.Fail()
 	}
 
@@ -0,0 +1,339 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// A conformance suite for IFDatabase implementations.  Every database
+// should behave the same way as seen through IFDatabase, so any
+// implementation (and any stack of caches over a persist database) can be
+// handed to Run() or RunLayered() from its own tests.
+package dbtest
+
+import (
+	"bytes"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/database"
+	"sort"
+	"testing"
+)
+
+// A database implementation under test.
+type Backend struct {
+	Name string
+	// Open an empty database holding the given buckets.
+	Open func(buckets [][]byte) (database.IFDatabase, error)
+	// Open again a database that has been closed.  Nil if the
+	// database does not persist anything across a Close().
+	Reopen func(db database.IFDatabase, buckets [][]byte) (database.IFDatabase, error)
+}
+
+// The buckets every database under test must hold.  Buckets that differ
+// only by trailing zeros are different buckets.
+var Buckets = [][]byte{
+	[]byte("one"),
+	[]byte("one\x00"),
+	[]byte("a bucket with a name longer than thirty two bytes"),
+}
+
+// Keys of different lengths, including keys that are prefixes of each
+// other, and keys longer than a hash.
+var Keys = [][]byte{
+	[]byte("k"),
+	[]byte("k\x00"),
+	[]byte("k\x00\x00"),
+	[]byte("\x00"),
+	fct.Sha([]byte("hash")).Bytes(),
+	bytes.Repeat([]byte("long key "), 20),
+}
+
+// The value the suite writes to a key.
+func Value(bucket []byte, key []byte) fct.IBlock {
+	return fct.NewAddress(fct.Sha([]byte(string(bucket) + "/" + string(key))).Bytes())
+}
+
+type suite struct {
+	t    *testing.T
+	name string
+}
+
+func (s *suite) fail(format string, args ...interface{}) {
+	fmt.Printf(s.name+": "+format+"\n", args...)
+	s.t.Fail()
+}
+
+func (s *suite) open(b Backend) database.IFDatabase {
+	db, err := b.Open(Buckets)
+	if err != nil {
+		s.t.Fatal(s.name, ": ", err)
+	}
+	return db
+}
+
+// Check the value of a key; nil means the key should be missing.
+func (s *suite) expect(db database.IFDatabase, bucket []byte, key []byte, value fct.IBlock) {
+	v, err := db.GetRaw(bucket, key)
+	if err != nil {
+		s.fail("key %x in bucket %q: %v", key, bucket, err)
+		return
+	}
+	if value == nil {
+		if v != nil {
+			s.fail("key %x in bucket %q should be missing", key, bucket)
+		}
+		return
+	}
+	if value.IsEqual(v) != nil {
+		s.fail("key %x in bucket %q has the wrong value", key, bucket)
+	}
+}
+
+func (s *suite) put(db database.IFDatabase, bucket []byte, key []byte) {
+	if err := db.PutRaw(bucket, key, Value(bucket, key)); err != nil {
+		s.fail("put %x in bucket %q: %v", key, bucket, err)
+	}
+}
+
+func (s *suite) putAll(db database.IFDatabase) {
+	for _, bucket := range Buckets {
+		for _, key := range Keys {
+			s.put(db, bucket, key)
+		}
+	}
+}
+
+// Check that GetKeysValues() and Iterate() both return exactly the given
+// keys, with the values the suite wrote.
+func (s *suite) expectKeys(db database.IFDatabase, bucket []byte, expected [][]byte) {
+	want := make([]string, 0, len(expected))
+	for _, k := range expected {
+		want = append(want, string(k))
+	}
+	sort.Strings(want)
+
+	keys, values, err := db.GetKeysValues(bucket)
+	if err != nil {
+		s.fail("GetKeysValues(%q): %v", bucket, err)
+		return
+	}
+	found := make([]string, 0, len(keys))
+	for i, k := range keys {
+		if Value(bucket, k).IsEqual(values[i]) != nil {
+			s.fail("GetKeysValues(%q) has the wrong value for %x", bucket, k)
+		}
+		found = append(found, string(k))
+	}
+	sort.Strings(found)
+	if !equalKeys(found, want) {
+		s.fail("GetKeysValues(%q) expected keys %q but found %q", bucket, want, found)
+	}
+
+	it, err := db.Iterate(bucket, nil)
+	if err != nil {
+		s.fail("Iterate(%q): %v", bucket, err)
+		return
+	}
+	defer it.Close()
+	found = found[:0]
+	for it.Next() {
+		if Value(bucket, it.Key()).IsEqual(it.Value()) != nil {
+			s.fail("Iterate(%q) has the wrong value for %x", bucket, it.Key())
+		}
+		found = append(found, string(it.Key()))
+	}
+	if it.Err() != nil {
+		s.fail("Iterate(%q): %v", bucket, it.Err())
+	}
+	if !equalKeys(found, want) {
+		s.fail("Iterate(%q) expected keys %q in order but found %q", bucket, want, found)
+	}
+}
+
+func equalKeys(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Run the whole suite against a database implementation.
+func Run(t *testing.T, b Backend) {
+	s := &suite{t: t, name: b.Name}
+	s.checkGetPut(s.open(b))
+	s.checkDelete(s.open(b))
+	s.checkBatch(s.open(b))
+	if b.Reopen != nil {
+		s.checkPersistence(b)
+	}
+}
+
+// Missing keys, and keys that must not collide.
+func (s *suite) checkGetPut(db database.IFDatabase) {
+	defer db.Close()
+	for _, bucket := range Buckets {
+		for _, key := range Keys {
+			s.expect(db, bucket, key, nil)
+		}
+		s.expectKeys(db, bucket, nil)
+	}
+
+	s.putAll(db)
+	for _, bucket := range Buckets {
+		for _, key := range Keys {
+			s.expect(db, bucket, key, Value(bucket, key))
+		}
+		s.expectKeys(db, bucket, Keys)
+	}
+
+	// Overwrites replace the value.
+	other := Value([]byte("other"), nil)
+	if err := db.PutRaw(Buckets[0], Keys[0], other); err != nil {
+		s.fail("overwrite: %v", err)
+	}
+	s.expect(db, Buckets[0], Keys[0], other)
+	s.put(db, Buckets[0], Keys[0])
+
+	// The same, through a DBKey.
+	dbkey := database.NewDBKey(Buckets[1], Keys[1])
+	if v, err := db.GetKey(dbkey); err != nil || Value(Buckets[1], Keys[1]).IsEqual(v) != nil {
+		s.fail("GetKey() did not find the key: %v", err)
+	}
+
+	// Writes to a bucket the database doesn't hold are not lost quietly.
+	missing := []byte("missing bucket")
+	if err := db.PutRaw(missing, Keys[0], Value(missing, Keys[0])); err == nil {
+		if v, _ := db.GetRaw(missing, Keys[0]); v == nil {
+			s.fail("a write to a missing bucket was lost without an error")
+		}
+	}
+}
+
+// Deletes touch only the key deleted.  Deleting a missing key is not an
+// error.
+func (s *suite) checkDelete(db database.IFDatabase) {
+	defer db.Close()
+	s.putAll(db)
+	for _, key := range [][]byte{Keys[1], []byte("missing")} {
+		if err := db.DeleteKey(Buckets[0], key); err != nil {
+			s.fail("DeleteKey(%x): %v", key, err)
+		}
+	}
+	s.expect(db, Buckets[0], Keys[1], nil)
+	s.expect(db, Buckets[0], Keys[2], Value(Buckets[0], Keys[2]))
+	s.expect(db, Buckets[1], Keys[1], Value(Buckets[1], Keys[1]))
+	s.expectKeys(db, Buckets[0], append([][]byte{Keys[0]}, Keys[2:]...))
+	s.expectKeys(db, Buckets[1], Keys)
+}
+
+// Batches read their own writes, and are kept or lost as a whole.
+func (s *suite) checkBatch(db database.IFDatabase) {
+	defer db.Close()
+	s.put(db, Buckets[0], Keys[0])
+
+	if err := db.Begin(); err != nil {
+		s.fail("Begin(): %v", err)
+		return
+	}
+	if err := db.Begin(); err == nil {
+		s.fail("batches should not nest")
+	}
+	s.put(db, Buckets[0], Keys[1])
+	db.DeleteKey(Buckets[0], Keys[0])
+	s.expect(db, Buckets[0], Keys[1], Value(Buckets[0], Keys[1]))
+	s.expect(db, Buckets[0], Keys[0], nil)
+	s.expectKeys(db, Buckets[0], Keys[1:2])
+	if err := db.Rollback(); err != nil {
+		s.fail("Rollback(): %v", err)
+	}
+	s.expect(db, Buckets[0], Keys[1], nil)
+	s.expect(db, Buckets[0], Keys[0], Value(Buckets[0], Keys[0]))
+
+	db.Begin()
+	s.put(db, Buckets[0], Keys[1])
+	s.put(db, Buckets[1], Keys[1])
+	db.DeleteKey(Buckets[0], Keys[0])
+	if err := db.Commit(); err != nil {
+		s.fail("Commit(): %v", err)
+	}
+	s.expectKeys(db, Buckets[0], Keys[1:2])
+	s.expectKeys(db, Buckets[1], Keys[1:2])
+
+	if err := db.Commit(); err == nil {
+		s.fail("Commit() without a batch should fail")
+	}
+	if err := db.Rollback(); err == nil {
+		s.fail("Rollback() without a batch should fail")
+	}
+}
+
+// What is written before a Close() is there after the database is opened
+// again.
+func (s *suite) checkPersistence(b Backend) {
+	db := s.open(b)
+	s.putAll(db)
+	db.DeleteKey(Buckets[0], Keys[0])
+	db.Begin()
+	s.put(db, Buckets[2], []byte("in a batch"))
+	db.Commit()
+	db.Begin()
+	s.put(db, Buckets[2], []byte("rolled back"))
+	db.Rollback()
+	db.Close()
+
+	db, err := b.Reopen(db, Buckets)
+	if err != nil {
+		s.fail("Reopen: %v", err)
+		return
+	}
+	defer db.Close()
+	s.expectKeys(db, Buckets[0], Keys[1:])
+	s.expectKeys(db, Buckets[1], Keys)
+	s.expectKeys(db, Buckets[2], append([][]byte{[]byte("in a batch")}, Keys...))
+}
+
+// Run the suite against a cache over a persist database, then check that
+// the writes made through the cache reached the persist database, and that
+// buckets that are not persisted did not.
+func RunLayered(t *testing.T, name string, cache func() database.IFDatabase, b Backend) {
+	layered := Backend{Name: name, Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		p, err := b.Open(buckets)
+		if err != nil {
+			return nil, err
+		}
+		db := cache()
+		db.SetPersist(p)
+		db.SetBacker(p)
+		return db, nil
+	}}
+	Run(t, layered)
+
+	s := &suite{t: t, name: name}
+	p := s.open(b)
+	defer p.Close()
+
+	db := cache()
+	db.SetPersist(p)
+	db.SetBacker(p)
+	db.DoNotPersist(string(Buckets[1]))
+	s.putAll(db)
+	db.Begin()
+	s.put(db, Buckets[2], []byte("in a batch"))
+	db.Commit()
+
+	s.expectKeys(p, Buckets[0], Keys)
+	s.expectKeys(p, Buckets[1], nil)
+	s.expectKeys(p, Buckets[2], append([][]byte{[]byte("in a batch")}, Keys...))
+
+	// A new cache over the same persist database reads what was written.
+	db = cache()
+	db.SetPersist(p)
+	db.SetBacker(p)
+	for _, key := range Keys {
+		s.expect(db, Buckets[0], key, Value(Buckets[0], key))
+	}
+	s.expectKeys(db, Buckets[2], append([][]byte{[]byte("in a batch")}, Keys...))
+}
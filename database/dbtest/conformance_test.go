@@ -0,0 +1,178 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package dbtest
+
+import (
+	"fmt"
+	"github.com/FactomProject/factoid/database"
+	"os"
+	"testing"
+)
+
+var mapDB = Backend{
+	Name: "MapDB",
+	Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		db := new(database.MapDB)
+		return db, db.Init()
+	},
+}
+
+var lruDB = Backend{
+	Name: "LRUDB",
+	Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		db := new(database.LRUDB)
+		return db, db.Init(2, 0)
+	},
+}
+
+var faultDB = Backend{
+	Name: "FaultDB",
+	Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		db := new(database.FaultDB)
+		return db, db.Init(buckets)
+	},
+	Reopen: func(db database.IFDatabase, buckets [][]byte) (database.IFDatabase, error) {
+		return db, db.Init(buckets)
+	},
+}
+
+const boltFile = "/tmp/dbtest_conformance.db"
+
+// Each database opened replaces the last one.
+var lastBolt *database.BoltDB
+
+var boltDB = Backend{
+	Name: "BoltDB",
+	Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		if lastBolt != nil {
+			lastBolt.Close()
+		}
+		os.Remove(boltFile)
+		lastBolt = new(database.BoltDB)
+		return lastBolt, lastBolt.Init(buckets, boltFile)
+	},
+	Reopen: func(db database.IFDatabase, buckets [][]byte) (database.IFDatabase, error) {
+		lastBolt = new(database.BoltDB)
+		return lastBolt, lastBolt.Init(buckets, boltFile)
+	},
+}
+
+const logFile = "/tmp/dbtest_conformance" + database.LOGDB_EXT
+
+var lastLog *database.LogDB
+
+var logDB = Backend{
+	Name: "LogDB",
+	Open: func(buckets [][]byte) (database.IFDatabase, error) {
+		if lastLog != nil {
+			lastLog.Close()
+		}
+		os.Remove(logFile)
+		lastLog = new(database.LogDB)
+		return lastLog, lastLog.Init(buckets, logFile)
+	},
+	Reopen: func(db database.IFDatabase, buckets [][]byte) (database.IFDatabase, error) {
+		lastLog = new(database.LogDB)
+		return lastLog, lastLog.Init(buckets, logFile)
+	},
+}
+
+func Test_conformance_MapDB(t *testing.T) {
+	Run(t, mapDB)
+}
+
+func Test_conformance_LRUDB(t *testing.T) {
+	Run(t, lruDB)
+}
+
+func Test_conformance_FaultDB(t *testing.T) {
+	Run(t, faultDB)
+}
+
+func Test_conformance_BoltDB(t *testing.T) {
+	defer os.Remove(boltFile)
+	Run(t, boltDB)
+	lastBolt.Close()
+}
+
+func Test_conformance_LogDB(t *testing.T) {
+	defer os.Remove(logFile)
+	Run(t, logDB)
+	lastLog.Close()
+}
+
+func Test_conformance_layered(t *testing.T) {
+	defer os.Remove(boltFile)
+	newMapDB := func() database.IFDatabase {
+		db := new(database.MapDB)
+		db.Init()
+		return db
+	}
+	newLRUDB := func() database.IFDatabase {
+		db := new(database.LRUDB)
+		db.Init(2, 0)
+		return db
+	}
+	RunLayered(t, "MapDB over BoltDB", newMapDB, boltDB)
+	RunLayered(t, "LRUDB over BoltDB", newLRUDB, boltDB)
+	RunLayered(t, "MapDB over FaultDB", newMapDB, faultDB)
+	RunLayered(t, "LRUDB over MapDB", newLRUDB, mapDB)
+	RunLayered(t, "LRUDB over LogDB", newLRUDB, logDB)
+	lastBolt.Close()
+	lastLog.Close()
+	os.Remove(logFile)
+}
+
+func Test_FaultDB_faults(t *testing.T) {
+	db := new(database.FaultDB)
+	db.Init(Buckets)
+	b, k := Buckets[0], Keys[0]
+
+	// The second write fails, and the third is corrupted.
+	db.InjectFault(2, database.FAULT_FAIL)
+	db.InjectFault(3, database.FAULT_CORRUPT)
+
+	if err := db.PutRaw(b, k, Value(b, k)); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	db.Begin()
+	db.PutRaw(b, Keys[1], Value(b, Keys[1]))
+	db.DeleteKey(b, k)
+	if err := db.Commit(); err == nil {
+		fmt.Println("The second write should fail")
+		t.Fail()
+	}
+	if v, _ := db.GetRaw(b, k); Value(b, k).IsEqual(v) != nil {
+		fmt.Println("A failed batch was partly written")
+		t.Fail()
+	}
+	if v, _ := db.GetRaw(b, Keys[1]); v != nil {
+		fmt.Println("A failed batch was partly written")
+		t.Fail()
+	}
+
+	if err := db.PutRaw(b, Keys[2], Value(b, Keys[2])); err != nil {
+		fmt.Println("A corrupted write should report success: ", err)
+		t.Fail()
+	}
+	if _, err := db.GetRaw(b, Keys[2]); !database.IsCorruption(err) {
+		fmt.Println("Expected the corrupted write to read back as corruption: ", err)
+		t.Fail()
+	}
+
+	// Faults happen only once, and survive a reopen.
+	db.PutRaw(b, Keys[2], Value(b, Keys[2]))
+	db.Close()
+	db.Init(Buckets)
+	if v, err := db.GetRaw(b, Keys[2]); err != nil || Value(b, Keys[2]).IsEqual(v) != nil {
+		fmt.Println("Rewrite was lost: ", err)
+		t.Fail()
+	}
+	if db.GetWrites() != 4 {
+		fmt.Println("Expected 4 writes, counted ", db.GetWrites())
+		t.Fail()
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+)
+
+// The faults a FaultDB can inject into a write.
+const (
+	FAULT_NONE    = iota
+	FAULT_FAIL    // The write fails, and nothing is written
+	FAULT_CORRUPT // The write reports success, but its records are damaged
+)
+
+// An in memory database that fails or corrupts writes on a schedule.  It
+// stores records just as BoltDB does, so a FaultDB can stand in for a
+// BoltDB in tests of what happens when the disk lets us down.
+//
+// Every PutRaw() or DeleteKey() made outside a batch is one write, and so
+// is every Commit().  A fault scheduled for a Commit() applies to the
+// whole batch.
+//
+// Close() does not lose the records.  Calling Init() again is like
+// opening the file again after a crash.
+type FaultDB struct {
+	FDatabase
+	buckets map[string]bool
+	records map[string][]byte // Maps an encoded DBKey to its record
+	writes  int               // The number of writes made so far
+	faults  map[int]int       // Maps a write number to a fault
+}
+
+var _ IFDatabase = (*FaultDB)(nil)
+
+/*************************************
+ *       Stubs
+ *************************************/
+
+func (FaultDB) Close() {}
+
+func (FaultDB) IsEqual(fct.IBlock) []fct.IBlock {
+	return nil
+}
+
+func (FaultDB) GetNewInstance() fct.IBlock {
+	return new(FaultDB)
+}
+
+func (FaultDB) MarshalBinary() ([]byte, error) {
+	return nil, nil
+}
+
+func (FaultDB) UnmarshalBinary([]byte) error {
+	return nil
+}
+
+func (FaultDB) UnmarshalBinaryData([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (b FaultDB) String() string {
+	return fmt.Sprintf("FaultDB records %d writes %d", len(b.records), b.writes)
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+// Takes the same arguments as BoltDB, less the filename:
+//
+//	Init(bucketList [][]byte)
+func (db *FaultDB) Init(a ...interface{}) error {
+	if db.doNotCache == nil {
+		db.doNotCache = make(map[string][]byte, 5)
+		db.doNotPersist = make(map[string][]byte, 5)
+	}
+	bucketList, _, err := initArgs("FaultDB", a)
+	if err != nil {
+		return err
+	}
+
+	if db.records == nil {
+		db.buckets = make(map[string]bool, len(bucketList))
+		db.records = make(map[string][]byte, 100)
+		db.faults = make(map[int]int, 5)
+	}
+	for _, bucket := range bucketList {
+		db.buckets[string(bucket)] = true
+	}
+	db.batch = nil
+	return nil
+}
+
+// Schedule a fault for the nth write from now.  The next write is 1.
+func (db *FaultDB) InjectFault(n int, fault int) {
+	db.faults[db.writes+n] = fault
+}
+
+// The number of writes made so far, including those that failed.
+func (db *FaultDB) GetWrites() int {
+	return db.writes
+}
+
+// Count a write, and return the fault scheduled for it.
+func (db *FaultDB) nextWrite() int {
+	db.writes++
+	fault := db.faults[db.writes]
+	delete(db.faults, db.writes)
+	return fault
+}
+
+func (db *FaultDB) checkBucket(bucket []byte) error {
+	if !db.buckets[string(bucket)] {
+		return NewNoBucketError(bucket)
+	}
+	return nil
+}
+
+// Apply the given writes, or none of them.
+func (db *FaultDB) write(ops []*batchOp) error {
+	records := make([][]byte, len(ops))
+	for i, op := range ops {
+		if err := db.checkBucket(op.bucket); err != nil && !op.delete {
+			return err
+		}
+		if !op.delete {
+			record, err := encodeRecord(op.value)
+			if err != nil {
+				return err
+			}
+			records[i] = record
+		}
+	}
+
+	switch db.nextWrite() {
+	case FAULT_FAIL:
+		return fmt.Errorf("Injected fault on write %d", db.writes)
+	case FAULT_CORRUPT:
+		for _, record := range records {
+			for i := 0; i < len(record) && i < 32; i++ {
+				record[i] ^= 0xFF // No instance answers to this type hash
+			}
+		}
+	}
+
+	for i, op := range ops {
+		if op.delete {
+			delete(db.records, encodeKey(op.bucket, op.key))
+		} else {
+			db.records[encodeKey(op.bucket, op.key)] = records[i]
+		}
+	}
+	return nil
+}
+
+func (db *FaultDB) GetRaw(bucket []byte, key []byte) (fct.IBlock, error) {
+	if db.batch != nil {
+		if value, ok := db.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
+	if err := db.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	record := db.records[encodeKey(bucket, key)]
+	if record == nil {
+		return nil, nil
+	}
+	value, err := decodeRecord(record)
+	if err != nil {
+		return nil, corruptionAt(err, bucket, key)
+	}
+	return value, nil
+}
+
+func (db *FaultDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) error {
+	if db.batch != nil {
+		db.batch.put(bucket, key, value)
+		return nil
+	}
+	return db.write([]*batchOp{{bucket: bucket, key: key, value: value}})
+}
+
+func (db *FaultDB) DeleteKey(bucket []byte, key []byte) error {
+	if db.batch != nil {
+		db.batch.deleteKey(bucket, key)
+		return nil
+	}
+	return db.write([]*batchOp{{bucket: bucket, key: key, delete: true}})
+}
+
+func (db *FaultDB) Commit() error {
+	batch := db.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	db.batch = nil
+	return db.write(batch.ops)
+}
+
+func (db FaultDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
+	if err := db.checkBucket(bucket); err != nil {
+		return nil, nil, err
+	}
+	keys = make([][]byte, 0, 32)
+	values = make([]fct.IBlock, 0, 32)
+	for k, record := range db.records {
+		dbKey := decodeKey(k)
+		if string(dbKey.GetBucket()) != string(bucket) {
+			continue
+		}
+		value, err := decodeRecord(record)
+		if err != nil {
+			return nil, nil, corruptionAt(err, bucket, dbKey.GetKey())
+		}
+		keys = append(keys, dbKey.GetKey())
+		values = append(values, value)
+	}
+	if db.batch != nil {
+		keys, values = db.batch.merge(bucket, keys, values)
+	}
+	return
+}
+
+func (db FaultDB) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	if err := db.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, 0, 32)
+	values := make([]fct.IBlock, 0, 32)
+	for k, record := range db.records {
+		dbKey := decodeKey(k)
+		if string(dbKey.GetBucket()) != string(bucket) || !r.Contains(dbKey.GetKey()) {
+			continue
+		}
+		value, err := decodeRecord(record)
+		if err != nil {
+			return nil, corruptionAt(err, bucket, dbKey.GetKey())
+		}
+		keys = append(keys, dbKey.GetKey())
+		values = append(values, value)
+	}
+	return overlayBatch(sortedIterator(keys, values, r), db.batch, bucket, r), nil
+}
+
+func (db *FaultDB) Get(bucket string, key fct.IHash) (value fct.IBlock, err error) {
+	return db.GetRaw([]byte(bucket), key.Bytes())
+}
+
+func (db *FaultDB) GetKey(key IDBKey) (value fct.IBlock, err error) {
+	return db.GetRaw(key.GetBucket(), key.GetKey())
+}
+
+func (db *FaultDB) Put(bucket string, key fct.IHash, value fct.IBlock) error {
+	return db.PutRaw([]byte(bucket), key.Bytes(), value)
+}
+
+func (db *FaultDB) PutKey(key IDBKey, value fct.IBlock) error {
+	return db.PutRaw(key.GetBucket(), key.GetKey(), value)
+}
@@ -23,6 +23,12 @@ import (
  * This isn't intended to be "real" but to provide a database like interface
  * that could become real, or could just be used for testing.
  *
+ * Every call that touches storage returns an error.  A record that can't
+ * be decoded is reported as a *CorruptionError, so callers can tell a
+ * damaged database apart from a failed read or write.  Databases written
+ * against the first IFDatabase, whose methods did not return errors, can
+ * be used through NewV1Database().
+ *
  * Values are not limited here.  Factom limits most things to 10k
  ************************************************/
 type IFDatabase interface {
@@ -34,23 +40,34 @@ type IFDatabase interface {
 	//
 	// Clear(bucketList [][]byte)
 
-	// Users must call Init() prior to using the database.
-	Init(a ...interface{})
+	// Users must call Init() prior to using the database.  Returns an
+	// error if the database could not be opened or created.
+	Init(a ...interface{}) error
 
 	// Users should defer a call to Close()
 	Close()
 
 	// The Get methods return an entry, or nil if it does not yet
-	// exist.  No errors are thrown.
-	Get(bucket string, key factoid.IHash) factoid.IBlock
-	GetRaw(bucket []byte, key []byte) factoid.IBlock
-	GetKey(key IDBKey) factoid.IBlock
+	// exist.  An entry that exists but can't be read back returns
+	// a *CorruptionError.
+	Get(bucket string, key factoid.IHash) (factoid.IBlock, error)
+	GetRaw(bucket []byte, key []byte) (factoid.IBlock, error)
+	GetKey(key IDBKey) (factoid.IBlock, error)
+
+	// Put places the value in the database.  Returns an error if the
+	// value could not be written.
+	Put(bucket string, key factoid.IHash, value factoid.IBlock) error
+	PutRaw(bucket []byte, key []byte, value factoid.IBlock) error
+	PutKey(key IDBKey, value factoid.IBlock) error
+	// Deleting a key that isn't there is not an error.
+	DeleteKey(bucket []byte, key []byte) error
 
-	// Put places the value in the database.  No errors are thrown.
-	Put(bucket string, key factoid.IHash, value factoid.IBlock)
-	PutRaw(bucket []byte, key []byte, value factoid.IBlock)
-	PutKey(key IDBKey, value factoid.IBlock)
-	DeleteKey(bucket []byte, key []byte)
+	// Writes made between Begin() and Commit() are applied together, or
+	// not at all.  Reads see the writes of the open batch.  Rollback()
+	// discards them.  Batches do not nest.
+	Begin() error
+	Commit() error
+	Rollback() error
 
 	// A Backer database allows the implementation of a least recently
 	// used cache to purge data from memory.
@@ -68,5 +85,8 @@ type IFDatabase interface {
 	// access to it.
 	DoNotCache(bucket string)
 	// Get a list of the keys and values in a bucket
-	GetKeysValues(bucket []byte) (keys [][]byte, values []factoid.IBlock)
+	GetKeysValues(bucket []byte) (keys [][]byte, values []factoid.IBlock, err error)
+	// Iterate over the keys in a bucket that fall in the range, in order.
+	// A nil range visits every key in the bucket.
+	Iterate(bucket []byte, r *KeyRange) (IIterator, error)
 }
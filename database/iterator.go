@@ -0,0 +1,244 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	fct "github.com/FactomProject/factoid"
+	"sort"
+)
+
+// The keys of a bucket an iterator visits.  All the fields are optional.
+// Only keys that begin with Prefix, are at or after Start, and are before
+// Limit are visited.
+type KeyRange struct {
+	Prefix []byte
+	Start  []byte
+	Limit  []byte
+}
+
+// Visit only the keys that begin with prefix.
+func PrefixRange(prefix []byte) *KeyRange {
+	return &KeyRange{Prefix: prefix}
+}
+
+func (r *KeyRange) Contains(key []byte) bool {
+	if r == nil {
+		return true
+	}
+	return bytes.HasPrefix(key, r.Prefix) &&
+		(r.Start == nil || bytes.Compare(key, r.Start) >= 0) &&
+		(r.Limit == nil || bytes.Compare(key, r.Limit) < 0)
+}
+
+// The lowest key that could be in the range.
+func (r *KeyRange) first() []byte {
+	if r == nil {
+		return nil
+	}
+	if bytes.Compare(r.Start, r.Prefix) > 0 {
+		return r.Start
+	}
+	return r.Prefix
+}
+
+// True if neither this key nor any key after it can be in the range.
+func (r *KeyRange) past(key []byte) bool {
+	if r == nil {
+		return false
+	}
+	if r.Limit != nil && bytes.Compare(key, r.Limit) >= 0 {
+		return true
+	}
+	return bytes.Compare(key, r.Prefix) > 0 && !bytes.HasPrefix(key, r.Prefix)
+}
+
+/***********************************************
+ * IIterator
+ *
+ * Visits the keys of a bucket in order (by bytes.Compare) along with their
+ * values.  An iterator starts before the first key, so Next() must be
+ * called before Key() or Value().  Iteration can stop at any point; the
+ * user should always call Close() when done.
+ *
+ *     it, err := db.Iterate(bucket, PrefixRange(prefix))
+ *     if err != nil { ... }
+ *     defer it.Close()
+ *     for it.Next() {
+ *         ... it.Key(), it.Value() ...
+ *     }
+ *     if it.Err() != nil { ... }
+ *
+ * Writes made to the database while iterating may or may not be seen.
+ ************************************************/
+type IIterator interface {
+	// Move to the next key.  Returns false when there are no more keys
+	// in the range, or on an error.
+	Next() bool
+	// Move so the next call to Next() lands on the first key at or after
+	// the given key.
+	Seek(key []byte)
+	Key() []byte
+	Value() fct.IBlock
+	// The error that stopped the iteration, if any.
+	Err() error
+	Close()
+}
+
+// Iterates over keys and values already in memory.  The keys must be
+// sorted.
+type sliceIterator struct {
+	keys   [][]byte
+	values []fct.IBlock
+	next   int
+	cur    int
+}
+
+var _ IIterator = (*sliceIterator)(nil)
+
+func newSliceIterator(keys [][]byte, values []fct.IBlock) *sliceIterator {
+	return &sliceIterator{keys: keys, values: values, cur: -1}
+}
+
+// Sort the given keys and values, keeping only those in the range.
+func sortedIterator(keys [][]byte, values []fct.IBlock, r *KeyRange) *sliceIterator {
+	it := newSliceIterator(make([][]byte, 0, len(keys)), make([]fct.IBlock, 0, len(values)))
+	for i, k := range keys {
+		if r.Contains(k) {
+			it.keys = append(it.keys, k)
+			it.values = append(it.values, values[i])
+		}
+	}
+	sort.Sort(it)
+	return it
+}
+
+func (it *sliceIterator) Len() int           { return len(it.keys) }
+func (it *sliceIterator) Less(i, j int) bool { return bytes.Compare(it.keys[i], it.keys[j]) < 0 }
+func (it *sliceIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.next >= len(it.keys) {
+		it.cur = -1
+		return false
+	}
+	it.cur = it.next
+	it.next++
+	return true
+}
+
+func (it *sliceIterator) Seek(key []byte) {
+	it.next = sort.Search(len(it.keys), func(i int) bool {
+		return bytes.Compare(it.keys[i], key) >= 0
+	})
+	it.cur = -1
+}
+
+func (it *sliceIterator) Key() []byte {
+	if it.cur < 0 {
+		return nil
+	}
+	return it.keys[it.cur]
+}
+
+func (it *sliceIterator) Value() fct.IBlock {
+	if it.cur < 0 {
+		return nil
+	}
+	return it.values[it.cur]
+}
+
+func (it *sliceIterator) Err() error { return nil }
+func (it *sliceIterator) Close()     {}
+
+// Lays the writes of an open batch over another iterator.  Writes in the
+// batch replace the values of the iterator, and deletes hide them.
+type batchIterator struct {
+	base   IIterator
+	ops    []batchOp // Sorted by key
+	i      int       // Next op to visit
+	peeked bool      // base has been moved to a key we have not visited
+	baseOK bool      // base is on a key
+	key    []byte
+	value  fct.IBlock
+}
+
+var _ IIterator = (*batchIterator)(nil)
+
+// Returns the base iterator if there is no batch, or no writes in the
+// batch touch the range.
+func overlayBatch(base IIterator, batch *writeBatch, bucket []byte, r *KeyRange) IIterator {
+	if batch == nil {
+		return base
+	}
+	ops := make([]batchOp, 0, 8)
+	for _, op := range batch.ops {
+		if bytes.Equal(op.bucket, bucket) && r.Contains(op.key) {
+			ops = append(ops, *op) // Later writes to the batch are not seen
+		}
+	}
+	if len(ops) == 0 {
+		return base
+	}
+	sort.Sort(opsByKey(ops))
+	return &batchIterator{base: base, ops: ops}
+}
+
+type opsByKey []batchOp
+
+func (o opsByKey) Len() int           { return len(o) }
+func (o opsByKey) Less(i, j int) bool { return bytes.Compare(o[i].key, o[j].key) < 0 }
+func (o opsByKey) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
+func (it *batchIterator) Next() bool {
+	for {
+		if !it.peeked {
+			it.baseOK = it.base.Next()
+			it.peeked = true
+		}
+		if it.i < len(it.ops) {
+			op := it.ops[it.i]
+			cmp := -1
+			if it.baseOK {
+				cmp = bytes.Compare(op.key, it.base.Key())
+			}
+			if cmp <= 0 {
+				it.i++
+				if cmp == 0 {
+					it.peeked = false // The batch replaces this key
+				}
+				if op.delete {
+					continue
+				}
+				it.key, it.value = op.key, op.value
+				return true
+			}
+		}
+		if !it.baseOK {
+			it.key, it.value = nil, nil
+			return false
+		}
+		it.key, it.value = it.base.Key(), it.base.Value()
+		it.peeked = false
+		return true
+	}
+}
+
+func (it *batchIterator) Seek(key []byte) {
+	it.base.Seek(key)
+	it.peeked = false
+	it.i = sort.Search(len(it.ops), func(i int) bool {
+		return bytes.Compare(it.ops[i].key, key) >= 0
+	})
+	it.key, it.value = nil, nil
+}
+
+func (it *batchIterator) Key() []byte       { return it.key }
+func (it *batchIterator) Value() fct.IBlock { return it.value }
+func (it *batchIterator) Err() error        { return it.base.Err() }
+func (it *batchIterator) Close()            { it.base.Close() }
@@ -0,0 +1,192 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// Keys are two bytes, {i/16, i%16}, so they sort in the order of i.
+func iteratorKey(i int) []byte {
+	return []byte{byte(i / 16), byte(i % 16)}
+}
+
+// Collects the keys visited, checking that they are in order and that
+// each value matches its key.
+func collect(t *testing.T, it IIterator, max int) []int {
+	found := make([]int, 0, 16)
+	var last []byte
+	for len(found) < max && it.Next() {
+		k := it.Key()
+		if last != nil && bytes.Compare(last, k) >= 0 {
+			fmt.Printf("Keys out of order: %x then %x\n", last, k)
+			t.Fail()
+		}
+		last = k
+		i := int(k[0])*16 + int(k[1])
+		if batchAddress(fmt.Sprint(i)).IsEqual(it.Value()) != nil {
+			fmt.Printf("Wrong value for key %x\n", k)
+			t.Fail()
+		}
+		found = append(found, i)
+	}
+	if it.Err() != nil {
+		fmt.Println(it.Err())
+		t.Fail()
+	}
+	return found
+}
+
+func expectKeys(t *testing.T, name string, found []int, first int, last int) {
+	ok := len(found) == last-first+1
+	for i := 0; ok && i < len(found); i++ {
+		ok = found[i] == first+i
+	}
+	if !ok {
+		fmt.Println(name, ": expected keys ", first, " to ", last, " but found ", found)
+		t.Fail()
+	}
+}
+
+func iterate(t *testing.T, db IFDatabase, r *KeyRange) IIterator {
+	it, err := db.Iterate([]byte("one"), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return it
+}
+
+// Runs the same scans over any database holding keys 0 through 199 in
+// bucket "one".
+func checkIterate(t *testing.T, name string, db IFDatabase) {
+	expectKeys(t, name+" all", collect(t, iterate(t, db, nil), 1000), 0, 199)
+	expectKeys(t, name+" prefix", collect(t, iterate(t, db, PrefixRange([]byte{3})), 1000), 48, 63)
+	expectKeys(t, name+" range", collect(t, iterate(t, db,
+		&KeyRange{Start: iteratorKey(70), Limit: iteratorKey(150)}), 1000), 70, 149)
+	expectKeys(t, name+" prefix and range", collect(t, iterate(t, db,
+		&KeyRange{Prefix: []byte{3}, Start: iteratorKey(50), Limit: iteratorKey(200)}), 1000), 50, 63)
+	expectKeys(t, name+" empty", collect(t, iterate(t, db, PrefixRange([]byte{99})), 1000), 0, -1)
+
+	// Stop early, then seek forward and back.
+	it := iterate(t, db, nil)
+	expectKeys(t, name+" early stop", collect(t, it, 5), 0, 4)
+	it.Seek(iteratorKey(180))
+	expectKeys(t, name+" seek forward", collect(t, it, 1000), 180, 199)
+	it.Seek(iteratorKey(10))
+	expectKeys(t, name+" seek back", collect(t, it, 3), 10, 12)
+	it.Close()
+
+	// Seeking before the range starts at the range.
+	it = iterate(t, db, PrefixRange([]byte{5}))
+	it.Seek(nil)
+	expectKeys(t, name+" seek before range", collect(t, it, 1000), 80, 95)
+	it.Close()
+}
+
+func fillIterateDB(t *testing.T, db IFDatabase) {
+	for i := 0; i < 200; i++ {
+		if err := db.PutRaw([]byte("one"), iteratorKey(i), batchAddress(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.PutRaw([]byte("two"), iteratorKey(1), batchAddress("1"))
+}
+
+func Test_Iterate_BoltDB(t *testing.T) {
+	bolt := newBatchTestBolt(t, "/tmp/iterate_test.db")
+	defer os.Remove("/tmp/iterate_test.db")
+	defer bolt.Close()
+
+	fillIterateDB(t, bolt)
+	checkIterate(t, "BoltDB", bolt)
+
+	if _, err := bolt.Iterate([]byte("none"), nil); err == nil {
+		fmt.Println("Iterating a missing bucket should fail")
+		t.Fail()
+	}
+}
+
+func Test_Iterate_MapDB(t *testing.T) {
+	db := new(MapDB)
+	db.Init()
+	fillIterateDB(t, db)
+	checkIterate(t, "MapDB", db)
+
+	bolt := newBatchTestBolt(t, "/tmp/iterate_test.db")
+	defer os.Remove("/tmp/iterate_test.db")
+	defer bolt.Close()
+
+	db = new(MapDB)
+	db.Init()
+	db.SetPersist(bolt)
+	fillIterateDB(t, db)
+	checkIterate(t, "MapDB over BoltDB", db)
+
+	lru := new(LRUDB)
+	lru.Init(10, 0)
+	lru.SetPersist(bolt)
+	checkIterate(t, "LRUDB over BoltDB", lru)
+}
+
+func Test_Iterate_batch(t *testing.T) {
+	bolt := newBatchTestBolt(t, "/tmp/iterate_test.db")
+	defer os.Remove("/tmp/iterate_test.db")
+	defer bolt.Close()
+
+	db := new(MapDB)
+	db.Init()
+	db.SetPersist(bolt)
+	for i := 0; i < 200; i += 2 {
+		db.PutRaw([]byte("one"), iteratorKey(i), batchAddress(fmt.Sprint(i)))
+	}
+	db.PutRaw([]byte("one"), iteratorKey(200), batchAddress("200"))
+
+	// The open batch fills in the odd keys, replaces a value and deletes
+	// the last key.
+	db.Begin()
+	for i := 1; i < 200; i += 2 {
+		db.PutRaw([]byte("one"), iteratorKey(i), batchAddress(fmt.Sprint(i)))
+	}
+	db.PutRaw([]byte("one"), iteratorKey(4), batchAddress("4"))
+	db.DeleteKey([]byte("one"), iteratorKey(200))
+
+	checkIterate(t, "Batch", db)
+	db.Rollback()
+
+	it := iterate(t, db, PrefixRange([]byte{0}))
+	found := collect(t, it, 1000)
+	if len(found) != 8 {
+		fmt.Println("Rolled back writes are still visible: ", found)
+		t.Fail()
+	}
+}
+
+func Test_KeyRange(t *testing.T) {
+	r := &KeyRange{Prefix: []byte("ab"), Start: []byte("abc"), Limit: []byte("abx")}
+	for _, k := range []string{"abc", "abcd", "abw"} {
+		if !r.Contains([]byte(k)) {
+			fmt.Println("Range should contain ", k)
+			t.Fail()
+		}
+	}
+	for _, k := range []string{"a", "abb", "abx", "ac"} {
+		if r.Contains([]byte(k)) {
+			fmt.Println("Range should not contain ", k)
+			t.Fail()
+		}
+	}
+	if !r.past([]byte("abx")) || !r.past([]byte("b")) || r.past([]byte("abb")) {
+		fmt.Println("Range has the wrong end")
+		t.Fail()
+	}
+	var all *KeyRange
+	if !all.Contains([]byte("anything")) || all.past([]byte{0xff}) {
+		fmt.Println("A nil range should hold every key")
+		t.Fail()
+	}
+}
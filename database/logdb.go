@@ -0,0 +1,629 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A LogDB keeps its records in a single file that is only ever appended
+// to.  The file starts with a header:
+//
+//	LOGDB_MAGIC  8 bytes
+//	LOGDB_VERSION  4 byte big endian
+//
+// followed by frames.  Each frame is one PutRaw() or DeleteKey() made
+// outside a batch, or one whole Commit():
+//
+//	crc32 of the payload  4 byte big endian
+//	length of the payload  4 byte big endian
+//	payload, a list of operations, each of which is
+//	    LOGDB_PUT or LOGDB_DELETE  1 byte
+//	    length of the encoded DBKey  uvarint
+//	    the encoded DBKey (see encodeKey())
+//	    for a put, the length of the record  uvarint
+//	    for a put, the record (see encodeRecord())
+//
+// Opening the file replays the frames to build an index in memory from
+// each key to where its record is in the file.  A frame that was cut short
+// or fails its crc was never finished, so it and anything after it is
+// dropped.  Every frame is synced to disk before the write returns.
+//
+// Overwritten and deleted records leave dead space in the file.  Once the
+// file is at least compactMin bytes and less than half of it is live, the
+// live records are copied to a new file in the background, and the new
+// file replaces the old one.
+const (
+	LOGDB_MAGIC       = "FCTLOGDB"
+	LOGDB_VERSION     = 1
+	LOGDB_EXT         = ".fctlog" // Files with this extension are LogDBs
+	LOGDB_COMPACT_MIN = 4 << 20   // Don't bother compacting smaller files
+
+	LOGDB_PUT    = 1
+	LOGDB_DELETE = 2
+
+	logHeaderSize = len(LOGDB_MAGIC) + 4
+	logFrameSize  = 8 // crc and length ahead of every payload
+)
+
+// Where a record is in the file.
+type logEntry struct {
+	offset int64
+	length int
+}
+
+type LogDB struct {
+	FDatabase
+
+	lock       sync.Mutex
+	file       *os.File
+	filename   string
+	buckets    map[string]bool
+	index      map[string]logEntry // Maps an encoded DBKey to its record
+	size       int64               // The length of the file
+	live       int64               // Bytes of the file that are live records
+	compactMin int64
+	compacting sync.WaitGroup
+	busy       bool // A compaction is running
+}
+
+var _ IFDatabase = (*LogDB)(nil)
+
+/*************************************
+ *       Stubs
+ *************************************/
+
+func (*LogDB) IsEqual(fct.IBlock) []fct.IBlock {
+	return nil
+}
+
+func (*LogDB) GetNewInstance() fct.IBlock {
+	return new(LogDB)
+}
+
+func (*LogDB) MarshalBinary() ([]byte, error) {
+	return nil, nil
+}
+
+func (*LogDB) UnmarshalBinary([]byte) error {
+	return nil
+}
+
+func (*LogDB) UnmarshalBinaryData([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (d *LogDB) String() string {
+	return fmt.Sprintf("LogDB %s size %d live %d", d.filename, d.size, d.live)
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+// Takes the same arguments as BoltDB:
+//
+//	Init(bucketList [][]byte, filename string)
+//
+// Calling Init() again on an open LogDB adds buckets.
+func (d *LogDB) Init(a ...interface{}) error {
+	if d.doNotCache == nil {
+		d.doNotCache = make(map[string][]byte, 5)
+		d.doNotPersist = make(map[string][]byte, 5)
+	}
+	bucketList, a, err := initArgs("LogDB", a)
+	if err != nil {
+		return err
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.buckets == nil {
+		d.buckets = make(map[string]bool, len(bucketList))
+	}
+	for _, bucket := range bucketList {
+		d.buckets[string(bucket)] = true
+	}
+
+	if d.file == nil {
+		if len(a) < 1 {
+			if d.filename == "" {
+				d.filename = "/tmp/logdb_my" + LOGDB_EXT
+			}
+		} else {
+			filename, ok := a[0].(string)
+			if !ok {
+				return fmt.Errorf("LogDB.Init() expected a filename")
+			}
+			d.filename = filename
+		}
+		if d.compactMin == 0 {
+			d.compactMin = LOGDB_COMPACT_MIN
+		}
+		// A compaction that didn't finish left its file behind.
+		os.Remove(d.filename + ".compact")
+		if err := d.open(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open the file, and replay it to build the index.
+func (d *LogDB) open() error {
+	f, err := os.OpenFile(d.filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("Database %s was not found, and could not be created: %s", d.filename, err.Error())
+	}
+	d.file = f
+	d.index = make(map[string]logEntry, 1000)
+	d.size = 0
+	d.live = 0
+	if err := d.replay(); err != nil {
+		f.Close()
+		d.file = nil
+		return err
+	}
+	return nil
+}
+
+func (d *LogDB) replay() error {
+	info, err := d.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		var header [logHeaderSize]byte
+		copy(header[:], LOGDB_MAGIC)
+		binary.BigEndian.PutUint32(header[len(LOGDB_MAGIC):], LOGDB_VERSION)
+		if _, err := d.file.WriteAt(header[:], 0); err != nil {
+			return err
+		}
+		d.size = int64(logHeaderSize)
+		return d.file.Sync()
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(d.file, 0, info.Size()))
+	var header [logHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:len(LOGDB_MAGIC)]) != LOGDB_MAGIC {
+		return fmt.Errorf("%s is not a LogDB database", d.filename)
+	}
+	if v := binary.BigEndian.Uint32(header[len(LOGDB_MAGIC):]); v != LOGDB_VERSION {
+		return fmt.Errorf("Database %s is at version %d, but this code reads version %d", d.filename, v, LOGDB_VERSION)
+	}
+
+	offset := int64(logHeaderSize)
+	for {
+		var frame [logFrameSize]byte
+		if _, err := io.ReadFull(r, frame[:]); err != nil {
+			break
+		}
+		crc := binary.BigEndian.Uint32(frame[0:4])
+		length := binary.BigEndian.Uint32(frame[4:8])
+		if int64(length) > info.Size()-offset-logFrameSize {
+			break
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil || crc32.ChecksumIEEE(payload) != crc {
+			break
+		}
+		if err := d.apply(payload, offset+logFrameSize); err != nil {
+			return NewCorruptionError("Frame at offset %d of %s: %s", offset, d.filename, err.Error())
+		}
+		offset += logFrameSize + int64(length)
+	}
+
+	// Drop whatever follows the last whole frame.
+	if offset < info.Size() {
+		if err := d.file.Truncate(offset); err != nil {
+			return err
+		}
+		if err := d.file.Sync(); err != nil {
+			return err
+		}
+	}
+	d.size = offset
+	return nil
+}
+
+// Apply the operations of a frame to the index.  The payload starts at
+// the given offset in the file.
+func (d *LogDB) apply(payload []byte, offset int64) error {
+	pos := 0
+	for pos < len(payload) {
+		op := payload[pos]
+		pos++
+		klen, n := binary.Uvarint(payload[pos:])
+		if n <= 0 || uint64(len(payload)-pos-n) < klen {
+			return fmt.Errorf("Bad key length")
+		}
+		pos += n
+		k := string(payload[pos : pos+int(klen)])
+		pos += int(klen)
+		dbKey := decodeKey(k)
+		d.buckets[string(dbKey.GetBucket())] = true
+
+		switch op {
+		case LOGDB_PUT:
+			rlen, n := binary.Uvarint(payload[pos:])
+			if n <= 0 || uint64(len(payload)-pos-n) < rlen {
+				return fmt.Errorf("Bad record length")
+			}
+			pos += n
+			d.setEntry(k, logEntry{offset: offset + int64(pos), length: int(rlen)})
+			pos += int(rlen)
+		case LOGDB_DELETE:
+			d.deleteEntry(k)
+		default:
+			return fmt.Errorf("Unknown operation %d", op)
+		}
+	}
+	return nil
+}
+
+func (d *LogDB) setEntry(k string, e logEntry) {
+	d.deleteEntry(k)
+	d.index[k] = e
+	d.live += int64(len(k) + e.length)
+}
+
+func (d *LogDB) deleteEntry(k string) {
+	if old, ok := d.index[k]; ok {
+		d.live -= int64(len(k) + old.length)
+		delete(d.index, k)
+	}
+}
+
+func (d *LogDB) checkBucket(bucket []byte) error {
+	if !d.buckets[string(bucket)] {
+		return NewNoBucketError(bucket)
+	}
+	return nil
+}
+
+// Append a frame holding the given writes, and sync it to disk.
+func (d *LogDB) write(ops []*batchOp) error {
+	var payload bytes.Buffer
+	var buf [binary.MaxVarintLen64]byte
+	entries := make([]logEntry, len(ops)) // Where each record is in the payload
+	for i, op := range ops {
+		if err := d.checkBucket(op.bucket); err != nil && !op.delete {
+			return err
+		}
+		k := encodeKey(op.bucket, op.key)
+		if op.delete {
+			payload.WriteByte(LOGDB_DELETE)
+		} else {
+			payload.WriteByte(LOGDB_PUT)
+		}
+		payload.Write(buf[:binary.PutUvarint(buf[:], uint64(len(k)))])
+		payload.WriteString(k)
+		if !op.delete {
+			record, err := encodeRecord(op.value)
+			if err != nil {
+				return err
+			}
+			payload.Write(buf[:binary.PutUvarint(buf[:], uint64(len(record)))])
+			entries[i] = logEntry{offset: int64(payload.Len()), length: len(record)}
+			payload.Write(record)
+		}
+	}
+
+	frame := make([]byte, logFrameSize, logFrameSize+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:4], crc32.ChecksumIEEE(payload.Bytes()))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(payload.Len()))
+	frame = append(frame, payload.Bytes()...)
+	if _, err := d.file.WriteAt(frame, d.size); err != nil {
+		d.file.Truncate(d.size)
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+
+	start := d.size + logFrameSize
+	d.size += int64(len(frame))
+	for i, op := range ops {
+		k := encodeKey(op.bucket, op.key)
+		if op.delete {
+			d.deleteEntry(k)
+		} else {
+			entries[i].offset += start
+			d.setEntry(k, entries[i])
+		}
+	}
+	d.startCompaction()
+	return nil
+}
+
+func (d *LogDB) read(k string) (fct.IBlock, error) {
+	e, ok := d.index[k]
+	if !ok {
+		return nil, nil
+	}
+	record := make([]byte, e.length)
+	if _, err := d.file.ReadAt(record, e.offset); err != nil {
+		return nil, err
+	}
+	return decodeRecord(record)
+}
+
+func (d *LogDB) GetRaw(bucket []byte, key []byte) (fct.IBlock, error) {
+	if d.batch != nil {
+		if value, ok := d.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	value, err := d.read(encodeKey(bucket, key))
+	if err != nil {
+		return nil, corruptionAt(err, bucket, key)
+	}
+	return value, nil
+}
+
+func (d *LogDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) error {
+	if d.batch != nil {
+		d.batch.put(bucket, key, value)
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.write([]*batchOp{{bucket: bucket, key: key, value: value}})
+}
+
+func (d *LogDB) DeleteKey(bucket []byte, key []byte) error {
+	if d.batch != nil {
+		d.batch.deleteKey(bucket, key)
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.write([]*batchOp{{bucket: bucket, key: key, delete: true}})
+}
+
+func (d *LogDB) Commit() error {
+	batch := d.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	d.batch = nil
+	if len(batch.ops) == 0 {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.write(batch.ops)
+}
+
+// The keys and values of a bucket that fall in the range, in no order.
+func (d *LogDB) scan(bucket []byte, r *KeyRange) (keys [][]byte, values []fct.IBlock, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if err := d.checkBucket(bucket); err != nil {
+		return nil, nil, err
+	}
+	prefix := encodeKey(bucket, nil)
+	keys = make([][]byte, 0, 32)
+	values = make([]fct.IBlock, 0, 32)
+	for k := range d.index {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		key := []byte(k[len(prefix):])
+		if !r.Contains(key) {
+			continue
+		}
+		value, err := d.read(k)
+		if err != nil {
+			return nil, nil, corruptionAt(err, bucket, key)
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
+
+func (d *LogDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
+	keys, values, err = d.scan(bucket, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.batch != nil {
+		keys, values = d.batch.merge(bucket, keys, values)
+	}
+	return
+}
+
+func (d *LogDB) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	keys, values, err := d.scan(bucket, r)
+	if err != nil {
+		return nil, err
+	}
+	return overlayBatch(sortedIterator(keys, values, r), d.batch, bucket, r), nil
+}
+
+func (d *LogDB) Get(bucket string, key fct.IHash) (value fct.IBlock, err error) {
+	return d.GetRaw([]byte(bucket), key.Bytes())
+}
+
+func (d *LogDB) GetKey(key IDBKey) (value fct.IBlock, err error) {
+	return d.GetRaw(key.GetBucket(), key.GetKey())
+}
+
+func (d *LogDB) Put(bucket string, key fct.IHash, value fct.IBlock) error {
+	return d.PutRaw([]byte(bucket), key.Bytes(), value)
+}
+
+func (d *LogDB) PutKey(key IDBKey, value fct.IBlock) error {
+	return d.PutRaw(key.GetBucket(), key.GetKey(), value)
+}
+
+// The names of all the buckets the database holds.
+func (d *LogDB) GetBuckets() [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	buckets := make([]string, 0, len(d.buckets))
+	for b := range d.buckets {
+		buckets = append(buckets, b)
+	}
+	sort.Strings(buckets)
+	r := make([][]byte, len(buckets))
+	for i, b := range buckets {
+		r[i] = []byte(b)
+	}
+	return r
+}
+
+// Waits for a compaction to finish, then closes the file.
+func (d *LogDB) Close() {
+	d.compacting.Wait()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+}
+
+/***************************************
+ *       Compaction
+ ***************************************/
+
+// Start a compaction in the background if the file has enough dead space.
+// Called with the lock held.
+func (d *LogDB) startCompaction() {
+	if d.busy || d.size < d.compactMin || d.live*2 > d.size {
+		return
+	}
+	d.busy = true
+	d.compacting.Add(1)
+	go func() {
+		defer d.compacting.Done()
+		// If compaction fails, the old file is still whole, and is
+		// kept.  The next write will try again.
+		d.compact()
+	}()
+}
+
+// Copy the live records to a new file, and replace the old file with it.
+// Returns once the new file is in place.
+func (d *LogDB) Compact() error {
+	d.compacting.Wait()
+	d.lock.Lock()
+	if d.busy {
+		d.lock.Unlock()
+		return fmt.Errorf("A compaction is already running")
+	}
+	d.busy = true
+	d.compacting.Add(1)
+	d.lock.Unlock()
+	defer d.compacting.Done()
+	return d.compact()
+}
+
+// The records are copied without holding the lock, since the file is only
+// appended to.  Writes made during the copy are then copied over as they
+// were written, with the lock held.
+func (d *LogDB) compact() error {
+	d.lock.Lock()
+	defer func() {
+		d.busy = false
+		d.lock.Unlock()
+	}()
+	old := d.file
+	end := d.size
+	keys := make([]string, 0, len(d.index))
+	entries := make(map[string]logEntry, len(d.index))
+	for k, e := range d.index {
+		keys = append(keys, k)
+		entries[k] = e
+	}
+	d.lock.Unlock()
+
+	tmpname := d.filename + ".compact"
+	tmp, err := d.copyLive(old, tmpname, keys, entries)
+
+	d.lock.Lock()
+	if err == nil {
+		err = copyTail(old, tmp, end, d.size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if tmp != nil {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpname, d.filename)
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return fmt.Errorf("Compaction of %s failed: %s", d.filename, err.Error())
+	}
+	old.Close()
+	return d.open()
+}
+
+// Write the header and a frame for each live record to a new file.
+func (d *LogDB) copyLive(old *os.File, tmpname string, keys []string, entries map[string]logEntry) (*os.File, error) {
+	tmp, err := os.OpenFile(tmpname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, logHeaderSize)
+	if _, err := old.ReadAt(header, 0); err != nil {
+		return tmp, err
+	}
+	w := bufio.NewWriter(tmp)
+	w.Write(header)
+
+	sort.Strings(keys)
+	var buf [binary.MaxVarintLen64]byte
+	for _, k := range keys {
+		e := entries[k]
+		record := make([]byte, e.length)
+		if _, err := old.ReadAt(record, e.offset); err != nil {
+			return tmp, err
+		}
+		var payload bytes.Buffer
+		payload.WriteByte(LOGDB_PUT)
+		payload.Write(buf[:binary.PutUvarint(buf[:], uint64(len(k)))])
+		payload.WriteString(k)
+		payload.Write(buf[:binary.PutUvarint(buf[:], uint64(len(record)))])
+		payload.Write(record)
+
+		var frame [logFrameSize]byte
+		binary.BigEndian.PutUint32(frame[0:4], crc32.ChecksumIEEE(payload.Bytes()))
+		binary.BigEndian.PutUint32(frame[4:8], uint32(payload.Len()))
+		w.Write(frame[:])
+		w.Write(payload.Bytes())
+	}
+	return tmp, w.Flush()
+}
+
+// Append the frames written to the old file between start and end.
+func copyTail(old *os.File, tmp *os.File, start int64, end int64) error {
+	if _, err := tmp.Seek(0, os.SEEK_END); err != nil {
+		return err
+	}
+	_, err := io.Copy(tmp, io.NewSectionReader(old, start, end-start))
+	return err
+}
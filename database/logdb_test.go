@@ -0,0 +1,186 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"os"
+	"testing"
+)
+
+const logTestFile = "/tmp/logdb_test" + LOGDB_EXT
+
+func openLogTest(t *testing.T) *LogDB {
+	db := new(LogDB)
+	db.compactMin = 1024
+	if err := db.Init([][]byte{[]byte("one"), []byte("two")}, logTestFile); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func logValue(i int) fct.IBlock {
+	return fct.NewAddress(fct.Sha([]byte(fmt.Sprintf("value %d", i))).Bytes())
+}
+
+func logKey(i int) []byte {
+	return []byte(fmt.Sprintf("key %d", i))
+}
+
+func expectLogKeys(t *testing.T, db *LogDB, n int, what string) {
+	for i := 0; i < n; i++ {
+		v, err := db.GetRaw([]byte("one"), logKey(i))
+		if err != nil || logValue(i).IsEqual(v) != nil {
+			fmt.Println(what, ": key ", i, " was not found: ", err)
+			t.Fail()
+			return
+		}
+	}
+	keys, _, _ := db.GetKeysValues([]byte("one"))
+	if len(keys) != n {
+		fmt.Println(what, ": expected ", n, " keys, found ", len(keys))
+		t.Fail()
+	}
+}
+
+// A write cut short by a crash is dropped, and what came before is kept.
+func Test_logdb_recovery(t *testing.T) {
+	os.Remove(logTestFile)
+	defer os.Remove(logTestFile)
+
+	db := openLogTest(t)
+	for i := 0; i < 10; i++ {
+		db.PutRaw([]byte("one"), logKey(i), logValue(i))
+	}
+	size := db.size
+	db.Begin()
+	db.PutRaw([]byte("one"), logKey(10), logValue(10))
+	db.PutRaw([]byte("one"), logKey(11), logValue(11))
+	db.Commit()
+	db.Close()
+
+	// Cut the last frame short, as if the batch was being written when
+	// the power went out.
+	os.Truncate(logTestFile, size+20)
+	db = openLogTest(t)
+	expectLogKeys(t, db, 10, "After a torn write")
+	if db.size != size {
+		fmt.Println("The torn write was not truncated: ", db.size, " ", size)
+		t.Fail()
+	}
+
+	// A damaged frame is dropped along with all that follows it.
+	db.PutRaw([]byte("one"), logKey(10), logValue(10))
+	db.PutRaw([]byte("one"), logKey(11), logValue(11))
+	db.Close()
+	f, _ := os.OpenFile(logTestFile, os.O_RDWR, 0600)
+	f.WriteAt([]byte{0xFF, 0xFF}, size+logFrameSize+4)
+	f.Close()
+	db = openLogTest(t)
+	expectLogKeys(t, db, 10, "After a damaged frame")
+
+	// And the database can be written again.
+	db.PutRaw([]byte("one"), logKey(10), logValue(10))
+	db.Close()
+	db = openLogTest(t)
+	expectLogKeys(t, db, 11, "After recovery")
+	db.Close()
+}
+
+func Test_logdb_compaction(t *testing.T) {
+	os.Remove(logTestFile)
+	defer os.Remove(logTestFile)
+
+	db := openLogTest(t)
+	db.compactMin = 1 << 30 // No compaction in the background yet
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 10; i++ {
+			db.PutRaw([]byte("one"), logKey(i), logValue(i))
+		}
+	}
+	db.PutRaw([]byte("two"), logKey(0), logValue(0))
+	db.DeleteKey([]byte("two"), logKey(0))
+	before := db.size
+	if err := db.Compact(); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	if db.size*10 > before {
+		fmt.Println("Compaction left ", db.size, " of ", before, " bytes")
+		t.Fail()
+	}
+	expectLogKeys(t, db, 10, "After compaction")
+	if v, _ := db.GetRaw([]byte("two"), logKey(0)); v != nil {
+		fmt.Println("A deleted key came back after compaction")
+		t.Fail()
+	}
+
+	// Compaction in the background, with writes going on.
+	db.compactMin = 1024
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 20; i++ {
+			db.PutRaw([]byte("one"), logKey(i), logValue(i))
+		}
+	}
+	db.Close()
+	if _, err := os.Stat(logTestFile + ".compact"); err == nil {
+		fmt.Println("Compaction left its file behind")
+		t.Fail()
+	}
+	db = openLogTest(t)
+	expectLogKeys(t, db, 20, "After compaction in the background")
+	if db.size > 20*1024 {
+		fmt.Println("The file was never compacted: ", db.size)
+		t.Fail()
+	}
+	db.Close()
+}
+
+func Test_logdb_copy_from_bolt(t *testing.T) {
+	os.Remove(logTestFile)
+	os.Remove("/tmp/logdb_copy_test.db")
+	defer os.Remove(logTestFile)
+	defer os.Remove("/tmp/logdb_copy_test.db")
+
+	from := new(BoltDB)
+	if err := from.Init([][]byte{[]byte("one"), []byte("two")}, "/tmp/logdb_copy_test.db"); err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	for i := 0; i < 10; i++ {
+		from.PutRaw([]byte("one"), logKey(i), logValue(i))
+	}
+	from.PutRaw([]byte("two"), logKey(0), logValue(0))
+
+	buckets, err := from.GetBuckets()
+	if err != nil || len(buckets) != 2 {
+		fmt.Println("Expected two buckets, found ", len(buckets), " ", err)
+		t.Fail()
+	}
+	to := openLogTest(t)
+	total := 0
+	for _, bucket := range buckets {
+		n, err := CopyBucket(from, to, bucket)
+		if err != nil {
+			fmt.Println(err)
+			t.Fail()
+		}
+		total += n
+	}
+	if total != 11 {
+		fmt.Println("Expected 11 records copied, not ", total)
+		t.Fail()
+	}
+	to.Close()
+
+	to = openLogTest(t)
+	defer to.Close()
+	expectLogKeys(t, to, 10, "After the copy")
+	if v, _ := to.GetRaw([]byte("two"), logKey(0)); logValue(0).IsEqual(v) != nil {
+		fmt.Println("Bucket two was not copied")
+		t.Fail()
+	}
+}
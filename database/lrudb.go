@@ -0,0 +1,373 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+)
+
+// A cache database that holds a bounded number of entries (or bytes) in
+// memory, and drops the least recently used entries when it is full.
+// Reads that miss the cache go to the Backer, then to the Persist
+// database.  Writes go through to the Persist database.
+//
+// Values that have nowhere else to live, because there is no Persist
+// database or their bucket is DoNotPersist, are never evicted.  They
+// still count against the limits.
+type LRUDB struct {
+	FDatabase
+	maxEntries int // 0 for no limit
+	maxBytes   int // 0 for no limit
+
+	entries map[string]*list.Element // Maps an encoded DBKey to its entry
+	lru     *list.List               // Most recently used at the front
+	size    int                      // Bytes held by cached values
+
+	stats CacheStats
+}
+
+var _ IFDatabase = (*LRUDB)(nil)
+
+// Counts of how well the cache is doing.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int
+}
+
+type lruEntry struct {
+	key    string
+	bucket []byte
+	dbkey  []byte
+	value  fct.IBlock
+	size   int
+	pinned bool
+}
+
+/*************************************
+ *       Stubs
+ *************************************/
+
+func (LRUDB) Close() {}
+
+func (LRUDB) IsEqual(fct.IBlock) []fct.IBlock {
+	return nil
+}
+
+func (LRUDB) GetNewInstance() fct.IBlock {
+	return new(LRUDB)
+}
+
+func (LRUDB) MarshalBinary() ([]byte, error) {
+	return nil, nil
+}
+
+func (LRUDB) UnmarshalBinary([]byte) error {
+	return nil
+}
+
+func (LRUDB) UnmarshalBinaryData([]byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (b LRUDB) String() string {
+	return fmt.Sprintf("LRUDB entries %d/%d bytes %d/%d hits %d misses %d evictions %d",
+		len(b.entries), b.maxEntries, b.size, b.maxBytes,
+		b.stats.Hits, b.stats.Misses, b.stats.Evictions)
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+// Init takes optional limits:
+//
+//	Init(maxEntries int, maxBytes int)
+//
+// A limit of zero (or a missing limit) means no limit.
+func (db *LRUDB) Init(a ...interface{}) error {
+	db.maxEntries, db.maxBytes = 0, 0
+	if len(a) > 0 {
+		n, ok := a[0].(int)
+		if !ok || n < 0 {
+			return fmt.Errorf("LRUDB.Init() expected a count of entries")
+		}
+		db.maxEntries = n
+	}
+	if len(a) > 1 {
+		n, ok := a[1].(int)
+		if !ok || n < 0 {
+			return fmt.Errorf("LRUDB.Init() expected a count of bytes")
+		}
+		db.maxBytes = n
+	}
+	db.entries = make(map[string]*list.Element, 100)
+	db.lru = list.New()
+	db.size = 0
+	db.stats = CacheStats{}
+	if db.doNotCache == nil {
+		db.doNotCache = make(map[string][]byte, 5)
+		db.doNotPersist = make(map[string][]byte, 5)
+	}
+	return nil
+}
+
+func (db *LRUDB) GetStats() CacheStats {
+	s := db.stats
+	s.Entries = db.lru.Len()
+	s.Bytes = db.size
+	return s
+}
+
+// True if the value has no home but this cache.
+func (db *LRUDB) mustPin(bucket []byte) bool {
+	return db.GetPersist() == nil || db.doNotPersist[string(bucket)] != nil
+}
+
+func (db *LRUDB) add(bucket []byte, key []byte, value fct.IBlock) {
+	k := encodeKey(bucket, key)
+	db.remove(k)
+
+	if value == nil {
+		return
+	}
+	if db.doNotCache[string(bucket)] != nil && !db.mustPin(bucket) {
+		return
+	}
+
+	e := new(lruEntry)
+	e.key = k
+	e.bucket = append([]byte{}, bucket...)
+	e.dbkey = append([]byte{}, key...)
+	e.value = value
+	if data, err := value.MarshalBinary(); err == nil {
+		e.size = len(data)
+	}
+	e.pinned = db.mustPin(bucket)
+
+	db.entries[k] = db.lru.PushFront(e)
+	db.size += e.size
+	db.evict()
+}
+
+func (db *LRUDB) remove(k string) {
+	if el, ok := db.entries[k]; ok {
+		db.size -= el.Value.(*lruEntry).size
+		db.lru.Remove(el)
+		delete(db.entries, k)
+	}
+}
+
+func (db *LRUDB) full() bool {
+	return (db.maxEntries > 0 && db.lru.Len() > db.maxEntries) ||
+		(db.maxBytes > 0 && db.size > db.maxBytes)
+}
+
+// Drop least recently used entries until we are within our limits, or
+// only pinned entries are left.
+func (db *LRUDB) evict() {
+	for el := db.lru.Back(); el != nil && db.full(); {
+		prev := el.Prev()
+		e := el.Value.(*lruEntry)
+		if !e.pinned {
+			db.remove(e.key)
+			db.stats.Evictions++
+		}
+		el = prev
+	}
+}
+
+// Values already cached in a bucket that stops being persisted are pinned.
+func (db *LRUDB) DoNotPersist(bucket string) {
+	db.FDatabase.DoNotPersist(bucket)
+	if db.lru == nil {
+		return
+	}
+	for el := db.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*lruEntry)
+		if string(e.bucket) == bucket {
+			e.pinned = true
+		}
+	}
+}
+
+func (db *LRUDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock, err error) {
+	if db.batch != nil {
+		if value, ok := db.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
+	if el, ok := db.entries[encodeKey(bucket, key)]; ok {
+		db.stats.Hits++
+		db.lru.MoveToFront(el)
+		return el.Value.(*lruEntry).value, nil
+	}
+	db.stats.Misses++
+
+	if db.GetBacker() != nil {
+		value, err = db.GetBacker().GetRaw(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value == nil && db.GetPersist() != nil && db.GetPersist() != db.GetBacker() {
+		value, err = db.GetPersist().GetRaw(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value != nil {
+		db.add(bucket, key, value)
+	}
+	return value, nil
+}
+
+func (db *LRUDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) error {
+	if db.batch != nil {
+		db.batch.put(bucket, key, value)
+		return nil
+	}
+	if db.doNotPersist[string(bucket)] == nil && db.GetPersist() != nil {
+		if err := db.GetPersist().PutRaw(bucket, key, value); err != nil {
+			return err
+		}
+	}
+	db.add(bucket, key, value)
+	return nil
+}
+
+func (db *LRUDB) DeleteKey(bucket []byte, key []byte) error {
+	if db.batch != nil {
+		db.batch.deleteKey(bucket, key)
+		return nil
+	}
+	db.remove(encodeKey(bucket, key))
+	if db.doNotPersist[string(bucket)] == nil && db.GetPersist() != nil {
+		if err := db.GetPersist().DeleteKey(bucket, key); err != nil {
+			return err
+		}
+	}
+	if db.GetBacker() != nil && db.GetBacker() != db.GetPersist() {
+		return db.GetBacker().DeleteKey(bucket, key)
+	}
+	return nil
+}
+
+// The batch is written to the persist database as a batch of its own.
+// Only once that succeeds is the cache updated.
+func (db *LRUDB) Commit() error {
+	batch := db.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	db.batch = nil
+
+	if p := db.GetPersist(); p != nil {
+		if err := p.Begin(); err != nil {
+			return err
+		}
+		for _, op := range batch.ops {
+			if db.doNotPersist[string(op.bucket)] != nil {
+				continue
+			}
+			var err error
+			if op.delete {
+				err = p.DeleteKey(op.bucket, op.key)
+			} else {
+				err = p.PutRaw(op.bucket, op.key, op.value)
+			}
+			if err != nil {
+				p.Rollback()
+				return err
+			}
+		}
+		if err := p.Commit(); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range batch.ops {
+		if op.delete {
+			db.remove(encodeKey(op.bucket, op.key))
+			if db.GetBacker() != nil && db.GetBacker() != db.GetPersist() {
+				if err := db.GetBacker().DeleteKey(op.bucket, op.key); err != nil {
+					return err
+				}
+			}
+		} else {
+			db.add(op.bucket, op.key, op.value)
+		}
+	}
+	return nil
+}
+
+// Only pinned values are sure to be in the cache, so buckets that are
+// persisted are listed from the persist database.
+func (db LRUDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
+	if db.mustPin(bucket) {
+		keys = make([][]byte, 0, 32)
+		values = make([]fct.IBlock, 0, 32)
+		for el := db.lru.Front(); el != nil; el = el.Next() {
+			e := el.Value.(*lruEntry)
+			if bytes.Equal(e.bucket, bucket) {
+				keys = append(keys, e.dbkey)
+				values = append(values, e.value)
+			}
+		}
+	} else {
+		keys, values, err = db.GetPersist().GetKeysValues(bucket)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if db.batch != nil {
+		keys, values = db.batch.merge(bucket, keys, values)
+	}
+	return
+}
+
+func (db LRUDB) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	var it IIterator
+	if db.mustPin(bucket) {
+		keys := make([][]byte, 0, 32)
+		values := make([]fct.IBlock, 0, 32)
+		for el := db.lru.Front(); el != nil; el = el.Next() {
+			e := el.Value.(*lruEntry)
+			if bytes.Equal(e.bucket, bucket) {
+				keys = append(keys, e.dbkey)
+				values = append(values, e.value)
+			}
+		}
+		it = sortedIterator(keys, values, r)
+	} else {
+		var err error
+		it, err = db.GetPersist().Iterate(bucket, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return overlayBatch(it, db.batch, bucket, r), nil
+}
+
+func (db *LRUDB) Get(bucket string, key fct.IHash) (value fct.IBlock, err error) {
+	return db.GetRaw([]byte(bucket), key.Bytes())
+}
+
+func (db *LRUDB) GetKey(key IDBKey) (value fct.IBlock, err error) {
+	return db.GetRaw(key.GetBucket(), key.GetKey())
+}
+
+func (db *LRUDB) Put(bucket string, key fct.IHash, value fct.IBlock) error {
+	return db.PutRaw([]byte(bucket), key.Bytes(), value)
+}
+
+func (db *LRUDB) PutKey(key IDBKey, value fct.IBlock) error {
+	return db.PutRaw(key.GetBucket(), key.GetKey(), value)
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"testing"
+)
+
+func Test_LRUDB_evicts_least_recently_used(t *testing.T) {
+	persist := new(MapDB)
+	persist.Init()
+
+	db := new(LRUDB)
+	db.Init(2, 0)
+	db.SetPersist(persist)
+
+	k1, k2, k3 := fct.Sha([]byte("k1")), fct.Sha([]byte("k2")), fct.Sha([]byte("k3"))
+	a1, a2, a3 := batchAddress("a1"), batchAddress("a2"), batchAddress("a3")
+
+	db.Put("one", k1, a1)
+	db.Put("one", k2, a2)
+	db.Get("one", k1) // k1 is now more recently used than k2
+	db.Put("one", k3, a3)
+
+	s := db.GetStats()
+	if s.Entries != 2 || s.Evictions != 1 || s.Hits != 1 {
+		fmt.Println("Unexpected stats: ", s)
+		t.Fail()
+	}
+	if _, ok := db.entries[encodeKey([]byte("one"), k2.Bytes())]; ok {
+		fmt.Println("The least recently used entry was not evicted")
+		t.Fail()
+	}
+
+	// An evicted value is read back from the persist database.
+	if v, _ := db.Get("one", k2); a2.IsEqual(v) != nil {
+		fmt.Println("Evicted value was lost")
+		t.Fail()
+	}
+	if s := db.GetStats(); s.Misses != 1 || s.Entries != 2 {
+		fmt.Println("Unexpected stats: ", s)
+		t.Fail()
+	}
+}
+
+func Test_LRUDB_byte_limit(t *testing.T) {
+	persist := new(MapDB)
+	persist.Init()
+
+	a := batchAddress("a")
+	data, _ := a.MarshalBinary()
+
+	db := new(LRUDB)
+	db.Init(0, 3*len(data))
+	db.SetPersist(persist)
+
+	for i := 0; i < 10; i++ {
+		db.Put("one", fct.Sha([]byte{byte(i)}), batchAddress(fmt.Sprint(i)))
+	}
+	if s := db.GetStats(); s.Entries != 3 || s.Bytes != 3*len(data) || s.Evictions != 7 {
+		fmt.Println("Unexpected stats: ", s)
+		t.Fail()
+	}
+	for i := 0; i < 10; i++ {
+		if v, _ := db.Get("one", fct.Sha([]byte{byte(i)})); v == nil {
+			fmt.Println("Value ", i, " was not written through")
+			t.Fail()
+		}
+	}
+}
+
+func Test_LRUDB_read_through_backer(t *testing.T) {
+	backer := new(MapDB)
+	backer.Init()
+	k := fct.Sha([]byte("k"))
+	a := batchAddress("a")
+	backer.Put("one", k, a)
+
+	db := new(LRUDB)
+	db.Init(10, 0)
+	db.SetBacker(backer)
+	db.SetPersist(backer)
+
+	if v, _ := db.Get("one", k); a.IsEqual(v) != nil {
+		fmt.Println("Value was not read from the backer")
+		t.Fail()
+	}
+	db.Get("one", k)
+	if s := db.GetStats(); s.Hits != 1 || s.Misses != 1 {
+		fmt.Println("Unexpected stats: ", s)
+		t.Fail()
+	}
+
+	db.DeleteKey([]byte("one"), k.Bytes())
+	if v, _ := backer.Get("one", k); v != nil {
+		fmt.Println("Delete did not reach the backer")
+		t.Fail()
+	}
+	if v, _ := db.Get("one", k); v != nil {
+		fmt.Println("Deleted value is still cached")
+		t.Fail()
+	}
+}
+
+func Test_LRUDB_pins_unpersisted_values(t *testing.T) {
+	persist := new(MapDB)
+	persist.Init()
+
+	db := new(LRUDB)
+	db.Init(1, 0)
+	db.DoNotPersist("temp")
+	db.SetPersist(persist)
+
+	// The setting made before SetPersist() is passed down.
+	if persist.doNotPersist["temp"] == nil {
+		fmt.Println("DoNotPersist was not passed to the persist database")
+		t.Fail()
+	}
+
+	kt, k1, k2 := fct.Sha([]byte("kt")), fct.Sha([]byte("k1")), fct.Sha([]byte("k2"))
+	at := batchAddress("at")
+	db.Put("temp", kt, at)
+	db.Put("one", k1, batchAddress("a1"))
+	db.Put("one", k2, batchAddress("a2"))
+
+	if v, _ := db.Get("temp", kt); at.IsEqual(v) != nil {
+		fmt.Println("An unpersisted value was evicted")
+		t.Fail()
+	}
+	keys, _, _ := db.GetKeysValues([]byte("temp"))
+	if len(keys) != 1 {
+		fmt.Println("Expected one unpersisted key, found ", len(keys))
+		t.Fail()
+	}
+	keys, _, _ = db.GetKeysValues([]byte("one"))
+	if len(keys) != 2 {
+		fmt.Println("Expected two persisted keys, found ", len(keys))
+		t.Fail()
+	}
+
+	// Without a persist database, nothing is evicted.
+	mem := new(LRUDB)
+	mem.Init(1, 0)
+	mem.Put("one", k1, batchAddress("a1"))
+	mem.Put("one", k2, batchAddress("a2"))
+	if s := mem.GetStats(); s.Entries != 2 || s.Evictions != 0 {
+		fmt.Println("Values with nowhere else to live were evicted: ", s)
+		t.Fail()
+	}
+}
+
+func Test_LRUDB_batch(t *testing.T) {
+	persist := new(MapDB)
+	persist.Init()
+
+	db := new(LRUDB)
+	db.Init(10, 0)
+	db.SetPersist(persist)
+
+	k := fct.Sha([]byte("k"))
+	a := batchAddress("a")
+
+	db.Begin()
+	db.Put("one", k, a)
+	if v, _ := persist.Get("one", k); v != nil {
+		fmt.Println("Write reached the persist database before the commit")
+		t.Fail()
+	}
+	db.Rollback()
+	if v, _ := db.Get("one", k); v != nil {
+		fmt.Println("Rolled back write is still visible")
+		t.Fail()
+	}
+
+	db.Begin()
+	db.Put("one", k, a)
+	if err := db.Commit(); err != nil {
+		fmt.Println(err)
+		t.Fail()
+	}
+	if v, _ := persist.Get("one", k); a.IsEqual(v) != nil {
+		fmt.Println("Committed write did not reach the persist database")
+		t.Fail()
+	}
+}
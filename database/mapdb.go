@@ -14,7 +14,7 @@ var _ = bytes.Compare
 
 type MapDB struct {
 	FDatabase
-	cache map[DBKey](fct.IBlock) // Our Cache
+	cache map[string](fct.IBlock) // Our Cache, keyed by the encoded DBKey
 }
 
 var _ IFDatabase = (*MapDB)(nil)
@@ -41,25 +41,55 @@ func (MapDB) UnmarshalBinary([]byte) error {
 func (MapDB) UnmarshalBinaryData([]byte) ([]byte, error) {
 	return nil, nil
 }
-func (b MapDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock) {
+func (b MapDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
 
 	if b.GetPersist() == nil || b.doNotPersist[string(bucket)] != nil {
 		keys = make([][]byte, 0, 32)
 		values = make([]fct.IBlock, 0, 32)
 
-		for dbKey, v := range b.cache {
-			b := dbKey.GetBucket()
-			for b[len(b)-1] == 0 {
-				b = b[:len(b)-1]
+		for k, v := range b.cache {
+			dbKey := decodeKey(k)
+			if bytes.Equal(dbKey.GetBucket(), bucket) {
+				keys = append(keys, dbKey.GetKey())
+				values = append(values, v)
 			}
-			if bytes.Compare(b, bucket) == 0 {
+		}
+	} else {
+		keys, values, err = b.GetPersist().GetKeysValues(bucket)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if b.batch != nil {
+		keys, values = b.batch.merge(bucket, keys, values)
+	}
+	return
+}
+
+// Buckets that are persisted are iterated from the persist database, so
+// the whole bucket is never loaded.  Buckets held only in memory are
+// sorted first.
+func (b MapDB) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	var it IIterator
+	if b.GetPersist() == nil || b.doNotPersist[string(bucket)] != nil {
+		keys := make([][]byte, 0, 32)
+		values := make([]fct.IBlock, 0, 32)
+		for k, v := range b.cache {
+			dbKey := decodeKey(k)
+			if bytes.Equal(dbKey.GetBucket(), bucket) {
 				keys = append(keys, dbKey.GetKey())
 				values = append(values, v)
 			}
 		}
-		return
+		it = sortedIterator(keys, values, r)
+	} else {
+		var err error
+		it, err = b.GetPersist().Iterate(bucket, r)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return b.GetPersist().GetKeysValues(bucket)
+	return overlayBatch(it, b.batch, bucket, r), nil
 }
 
 func (b MapDB) String() string {
@@ -70,68 +100,140 @@ func (b MapDB) String() string {
 	return string(txt)
 }
 
-func (db *MapDB) Init(a ...interface{}) {
-	db.cache = make(map[DBKey](fct.IBlock), 100)
+func (db *MapDB) Init(a ...interface{}) error {
+	db.cache = make(map[string](fct.IBlock), 100)
 	db.doNotCache = make(map[string][]byte, 5)
 	db.doNotPersist = make(map[string][]byte, 5)
+	return nil
 }
 
-func (db *MapDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock) {
-	dbkey := makeKey(bucket, key).(*DBKey)
-	value = db.cache[*dbkey]
+func (db *MapDB) GetRaw(bucket []byte, key []byte) (value fct.IBlock, err error) {
+	if db.batch != nil {
+		if value, ok := db.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
+	dbkey := encodeKey(bucket, key)
+	value = db.cache[dbkey]
 	if value == nil && db.GetBacker() != nil {
-		value = db.GetBacker().GetRaw(bucket, key)
+		value, err = db.GetBacker().GetRaw(bucket, key)
+		if err != nil {
+			return nil, err
+		}
 		if value != nil && db.doNotCache[string(bucket)] == nil {
-			db.cache[*dbkey] = value // Put this value in our cache
+			db.cache[dbkey] = value // Put this value in our cache
 		}
 	}
-	if value == nil && db.GetPersist() != nil {
-		value = db.GetPersist().GetRaw(bucket, key)
+	if value == nil && db.GetPersist() != nil && db.GetPersist() != db.GetBacker() {
+		value, err = db.GetPersist().GetRaw(bucket, key)
+		if err != nil {
+			return nil, err
+		}
 		if value != nil && db.doNotCache[string(bucket)] == nil {
-			db.cache[*dbkey] = value // Put this value in our cache
+			db.cache[dbkey] = value // Put this value in our cache
 		}
 	}
-	return value
+	return value, nil
 }
 
-func (db *MapDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) {
-	dbkey := makeKey(bucket, key).(*DBKey)
+// The cache is only updated once the value is persisted, so a failed
+// write leaves the cache and the persisted database in agreement.
+func (db *MapDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) error {
+	if db.batch != nil {
+		db.batch.put(bucket, key, value)
+		return nil
+	}
+	if db.doNotPersist[string(bucket)] == nil && db.GetPersist() != nil {
+		if err := db.GetPersist().PutRaw(bucket, key, value); err != nil {
+			return err
+		}
+	}
 	if db.doNotCache[string(bucket)] == nil {
-		db.cache[*dbkey] = value
+		db.cache[encodeKey(bucket, key)] = value
 	}
-	if db.doNotPersist[string(bucket)] != nil {
-		return
+	return nil
+}
+
+func (db *MapDB) DeleteKey(bucket []byte, key []byte) error {
+	if db.batch != nil {
+		db.batch.deleteKey(bucket, key)
+		return nil
+	}
+	delete(db.cache, encodeKey(bucket, key))
+	if db.doNotPersist[string(bucket)] == nil && db.GetPersist() != nil {
+		if err := db.GetPersist().DeleteKey(bucket, key); err != nil {
+			return err
+		}
 	}
-	if db.GetPersist() != nil {
-		db.GetPersist().PutRaw(bucket, key, value)
+	if db.GetBacker() != nil && db.GetBacker() != db.GetPersist() {
+		return db.GetBacker().DeleteKey(bucket, key)
 	}
+	return nil
 }
 
-func (db *MapDB) DeleteKey(bucket []byte, key []byte) {
-	dbkey := makeKey(bucket, key).(*DBKey)
-	db.cache[*dbkey] = nil
-	if db.doNotPersist[string(bucket)] != nil && db.GetPersist() != nil {
-		db.GetPersist().DeleteKey(bucket, key)
+// The batch is written to the persist database as a batch of its own.
+// Only once that succeeds is the cache updated.
+func (db *MapDB) Commit() error {
+	batch := db.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	db.batch = nil
+
+	if p := db.GetPersist(); p != nil {
+		if err := p.Begin(); err != nil {
+			return err
+		}
+		for _, op := range batch.ops {
+			if db.doNotPersist[string(op.bucket)] != nil {
+				continue
+			}
+			var err error
+			if op.delete {
+				err = p.DeleteKey(op.bucket, op.key)
+			} else {
+				err = p.PutRaw(op.bucket, op.key, op.value)
+			}
+			if err != nil {
+				p.Rollback()
+				return err
+			}
+		}
+		if err := p.Commit(); err != nil {
+			return err
+		}
 	}
-	if db.GetBacker() != nil {
-		db.GetBacker().DeleteKey(bucket, key)
+
+	for _, op := range batch.ops {
+		dbkey := encodeKey(op.bucket, op.key)
+		if op.delete {
+			delete(db.cache, dbkey)
+			if db.GetBacker() != nil && db.GetBacker() != db.GetPersist() {
+				if err := db.GetBacker().DeleteKey(op.bucket, op.key); err != nil {
+					return err
+				}
+			}
+		} else if db.doNotCache[string(op.bucket)] == nil {
+			db.cache[dbkey] = op.value
+		}
 	}
+	return nil
 }
 
-func (db *MapDB) Get(bucket string, key fct.IHash) (value fct.IBlock) {
+func (db *MapDB) Get(bucket string, key fct.IHash) (value fct.IBlock, err error) {
 	return db.GetRaw([]byte(bucket), key.Bytes())
 }
 
-func (db *MapDB) GetKey(key IDBKey) (value fct.IBlock) {
+func (db *MapDB) GetKey(key IDBKey) (value fct.IBlock, err error) {
 	return db.GetRaw(key.GetBucket(), key.GetKey())
 }
 
-func (db *MapDB) Put(bucket string, key fct.IHash, value fct.IBlock) {
+func (db *MapDB) Put(bucket string, key fct.IHash, value fct.IBlock) error {
 	b := []byte(bucket)
 	k := key.Bytes()
-	db.PutRaw(b, k, value)
+	return db.PutRaw(b, k, value)
 }
 
-func (db *MapDB) PutKey(key IDBKey, value fct.IBlock) {
-	db.PutRaw(key.GetBucket(), key.GetKey(), value)
+func (db *MapDB) PutKey(key IDBKey, value fct.IBlock) error {
+	return db.PutRaw(key.GetBucket(), key.GetKey(), value)
 }
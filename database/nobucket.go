@@ -0,0 +1,30 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+)
+
+// Returned when a bucket the database was never given is read or written.
+type NoBucketError struct {
+	Bucket []byte
+}
+
+func NewNoBucketError(bucket []byte) *NoBucketError {
+	e := new(NoBucketError)
+	e.Bucket = append([]byte{}, bucket...)
+	return e
+}
+
+func (e *NoBucketError) Error() string {
+	return fmt.Sprintf("Bucket '%s' not found", string(e.Bucket))
+}
+
+// True if err reports a missing bucket.
+func IsNoBucket(err error) bool {
+	_, ok := err.(*NoBucketError)
+	return ok
+}
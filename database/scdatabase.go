@@ -5,6 +5,8 @@
 package database
 
 import (
+	"encoding/binary"
+	"fmt"
 	"github.com/FactomProject/factoid"
 )
 
@@ -13,6 +15,7 @@ type FDatabase struct {
 	persist      IFDatabase // We do need LevelDB or Bolt.  It would go here.
 	doNotPersist map[string][]byte
 	doNotCache   map[string][]byte
+	batch        *writeBatch // Writes waiting on Commit(), if a batch is open
 }
 
 var _ IFDatabase = (*FDatabase)(nil)
@@ -55,51 +58,91 @@ func (FDatabase) UnmarshalBinaryData([]byte) ([]byte, error) {
 	return nil, nil
 }
 
-func (FDatabase) DeleteKey(bucket []byte, key []byte) {}
-
-func (FDatabase) Get(bucket string, key factoid.IHash) factoid.IBlock {
+func (FDatabase) DeleteKey(bucket []byte, key []byte) error {
 	return nil
 }
 
-func (FDatabase) GetKey(key IDBKey) factoid.IBlock {
-	return nil
+func (FDatabase) Get(bucket string, key factoid.IHash) (factoid.IBlock, error) {
+	return nil, nil
 }
 
-func (FDatabase) GetKeysValues(bucket []byte) (keys [][]byte, values []factoid.IBlock) {
+func (FDatabase) GetKey(key IDBKey) (factoid.IBlock, error) {
 	return nil, nil
 }
 
+func (FDatabase) GetKeysValues(bucket []byte) (keys [][]byte, values []factoid.IBlock, err error) {
+	return nil, nil, nil
+}
+
+func (FDatabase) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	return newSliceIterator(nil, nil), nil
+}
+
 func (FDatabase) IsEqual(factoid.IBlock) []factoid.IBlock {
 	return nil
 }
 
-func (FDatabase) GetRaw(bucket []byte, key []byte) factoid.IBlock {
-	return nil
+func (FDatabase) GetRaw(bucket []byte, key []byte) (factoid.IBlock, error) {
+	return nil, nil
 }
 
 func (FDatabase) String() string {
 	return ""
 }
 
-func (FDatabase) Init(a ...interface{}) {}
+func (FDatabase) Init(a ...interface{}) error {
+	return nil
+}
 
-func (FDatabase) Put(bucket string, key factoid.IHash, value factoid.IBlock) {}
+func (FDatabase) Put(bucket string, key factoid.IHash, value factoid.IBlock) error {
+	return nil
+}
 
-func (FDatabase) PutKey(key IDBKey, value factoid.IBlock) {}
+func (FDatabase) PutKey(key IDBKey, value factoid.IBlock) error {
+	return nil
+}
 
-func (FDatabase) PutRaw(bucket []byte, key []byte, value factoid.IBlock) {}
+func (FDatabase) PutRaw(bucket []byte, key []byte, value factoid.IBlock) error {
+	return nil
+}
 
 /***************************************
  *       Methods
  ***************************************/
 
+func (db *FDatabase) Begin() error {
+	if db.batch != nil {
+		return fmt.Errorf("A batch is already open")
+	}
+	db.batch = newWriteBatch()
+	return nil
+}
+
+// Databases that store anything must provide their own Commit()
+func (db *FDatabase) Commit() error {
+	if db.batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	db.batch = nil
+	return nil
+}
+
+func (db *FDatabase) Rollback() error {
+	if db.batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	db.batch = nil
+	return nil
+}
+
 func (FDatabase) GetNewInstance() factoid.IBlock {
 	return new(FDatabase)
 }
 
 // Do not hold objects in this cache in memory.  They are too big, and there
-// is no interesting reason to keep them in memory.
-func (db FDatabase) DoNotCache(bucket string) {
+// is no interesting reason to keep them in memory.  The setting is passed
+// down to the Backer and Persist databases.
+func (db *FDatabase) DoNotCache(bucket string) {
 	if db.doNotCache == nil {
 		db.doNotCache = make(map[string][]byte, 5)
 	}
@@ -107,14 +150,15 @@ func (db FDatabase) DoNotCache(bucket string) {
 	if db.backer != nil {
 		db.backer.DoNotCache(bucket)
 	}
-	if db.persist != nil {
+	if db.persist != nil && db.persist != db.backer {
 		db.persist.DoNotCache(bucket)
 	}
 }
 
 // Do not write to disk.  These items are small, we need fast writes, and we don't need
-// the overhead of writing to disk.
-func (db FDatabase) DoNotPersist(bucket string) {
+// the overhead of writing to disk.  The setting is passed down to the Backer
+// and Persist databases.
+func (db *FDatabase) DoNotPersist(bucket string) {
 	if db.doNotPersist == nil {
 		db.doNotPersist = make(map[string][]byte, 5)
 	}
@@ -122,18 +166,28 @@ func (db FDatabase) DoNotPersist(bucket string) {
 	if db.backer != nil {
 		db.backer.DoNotPersist(bucket)
 	}
-	if db.persist != nil {
+	if db.persist != nil && db.persist != db.backer {
 		db.persist.DoNotPersist(bucket)
 	}
 }
 
+// Pass our DoNotCache and DoNotPersist settings on to a database below us.
+func (db *FDatabase) propagate(to IFDatabase) {
+	for bucket := range db.doNotCache {
+		to.DoNotCache(bucket)
+	}
+	for bucket := range db.doNotPersist {
+		to.DoNotPersist(bucket)
+	}
+}
+
 // A Backer database allows the implementation of a least recently
 // used cache to purge data from memory.
 func (db *FDatabase) SetBacker(b IFDatabase) {
 	db.backer = b
-
-	//TODO We should tell our backer about our DoNotCache and DoNotPersist maps.  We
-	//don't now, but all we have to do is set up the databases first.
+	if b != nil {
+		db.propagate(b)
+	}
 }
 func (db FDatabase) GetBacker() IFDatabase {
 	return db.backer
@@ -143,10 +197,9 @@ func (db FDatabase) GetBacker() IFDatabase {
 // one can hook up a LevelDB or Bolt database.
 func (db *FDatabase) SetPersist(p IFDatabase) {
 	db.persist = p
-
-	//TODO We should tell our backer about our DoNotCache and DoNotPersist maps.  We
-	//don't now, but all we have to do is set up the databases first.
-
+	if p != nil {
+		db.propagate(p)
+	}
 }
 func (db FDatabase) GetPersist() IFDatabase {
 	return db.persist
@@ -154,6 +207,11 @@ func (db FDatabase) GetPersist() IFDatabase {
 
 /*****************************************************************
  * Database Key for Key/Value Databases that don't support buckets
+ *
+ * Buckets and keys can be any length.  A DBKey is encoded as the length
+ * of the bucket (as a varint), the bucket, and then the key.  So no two
+ * bucket and key pairs share an encoding, and the encoding can be used
+ * as the key of a Go map.
  *****************************************************************/
 
 type IDBKey interface {
@@ -162,29 +220,47 @@ type IDBKey interface {
 }
 
 type DBKey struct {
-	bucket [factoid.ADDRESS_LENGTH]byte
-	key    [factoid.KEY_LIMIT]byte
+	bucket []byte
+	key    []byte
 }
 
 var _ IDBKey = (*DBKey)(nil)
 
 func (k DBKey) GetBucket() []byte {
-	return k.bucket[:]
+	return k.bucket
 }
 
 func (k DBKey) GetKey() []byte {
-	return k.key[:]
+	return k.key
 }
 
-func makeKey(bucket []byte, key []byte) IDBKey {
-
-	if len(bucket) > factoid.ADDRESS_LENGTH || len(key) > factoid.KEY_LIMIT {
-		panic("Key or bucket provided to IFDatabase is too long")
-	}
+func (k DBKey) String() string {
+	return encodeKey(k.bucket, k.key)
+}
 
+// The bucket and key are copied, so the caller can reuse them.
+func NewDBKey(bucket []byte, key []byte) *DBKey {
 	k := new(DBKey)
-	copy(k.bucket[:], bucket)
-	copy(k.key[:], key)
+	k.bucket = append([]byte{}, bucket...)
+	k.key = append([]byte{}, key...)
+	return k
+}
+
+func encodeKey(bucket []byte, key []byte) string {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(bucket)))
+	return string(buf[:n]) + string(bucket) + string(key)
+}
 
+// The reverse of encodeKey().
+func decodeKey(s string) *DBKey {
+	data := []byte(s)
+	n, l := binary.Uvarint(data)
+	if l <= 0 || uint64(len(data)-l) < n {
+		panic("Invalid encoding of a DBKey")
+	}
+	k := new(DBKey)
+	k.bucket = data[l : l+int(n)]
+	k.key = data[l+int(n):]
 	return k
 }
@@ -0,0 +1,343 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/FactomProject/bolt"
+)
+
+// Every BoltDB file records the version of the layout of its buckets and
+// records.  When a change is made to how anything is stored, bump
+// SCHEMA_VERSION and register a Migration that upgrades a database from
+// the previous version.
+//
+// Files written before there was a version are version 0.
+const (
+	SCHEMA_VERSION = 1
+	SCHEMA_BUCKET  = "schema"  // Holds the version, and nothing else
+	SCHEMA_KEY     = "version" // The version is a 4 byte big endian value
+)
+
+// A step that upgrades a database from version From to version From+1.
+// Each step runs in one bolt transaction along with the update of the
+// version, so a failed step leaves the database at version From.
+type Migration struct {
+	From    uint32
+	Name    string
+	Migrate func(tx IMigrationTx) error
+}
+
+// What a migration can do to a database.  Records are handled raw, as the
+// type hash, the length of the data, and the data.  See SplitRecord() and
+// JoinRecord().
+type IMigrationTx interface {
+	// The names of all buckets, but for the schema bucket.
+	Buckets() [][]byte
+	CreateBucket(bucket []byte) error
+	DeleteBucket(bucket []byte) error
+	// The record passed to f is only valid until f returns.
+	ForEach(bucket []byte, f func(key []byte, record []byte) error) error
+	Put(bucket []byte, key []byte, record []byte) error
+	Delete(bucket []byte, key []byte) error
+}
+
+var migrations = []Migration{
+	{From: 0, Name: "Record the schema version", Migrate: func(IMigrationTx) error { return nil }},
+}
+
+// Add a migration to those run when a BoltDB is opened.  Migrations must
+// be registered before the database is opened.
+func RegisterMigration(m Migration) {
+	migrations = append(migrations, m)
+}
+
+// Split a record into its type hash and its data.
+func SplitRecord(record []byte) (hash [32]byte, data []byte, err error) {
+	if len(record) < 36 {
+		return hash, nil, NewCorruptionError("Record of %d bytes is too short", len(record))
+	}
+	copy(hash[:], record[:32])
+	datalen := binary.BigEndian.Uint32(record[32:36])
+	data = record[36:]
+	if len(data) != int(datalen) {
+		return hash, nil, NewCorruptionError("Lengths don't match.  Expected %d and got %d", datalen, len(data))
+	}
+	return hash, data, nil
+}
+
+// Build a record from a type hash and the data.
+func JoinRecord(hash [32]byte, data []byte) []byte {
+	record := make([]byte, 36, 36+len(data))
+	copy(record, hash[:])
+	binary.BigEndian.PutUint32(record[32:36], uint32(len(data)))
+	return append(record, data...)
+}
+
+type boltMigrationTx struct {
+	tx *bolt.Tx
+}
+
+var _ IMigrationTx = (*boltMigrationTx)(nil)
+
+func (m *boltMigrationTx) Buckets() [][]byte {
+	buckets := make([][]byte, 0, 16)
+	m.tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if string(name) != SCHEMA_BUCKET {
+			buckets = append(buckets, append([]byte{}, name...))
+		}
+		return nil
+	})
+	return buckets
+}
+
+func (m *boltMigrationTx) CreateBucket(bucket []byte) error {
+	_, err := m.tx.CreateBucketIfNotExists(bucket)
+	return err
+}
+
+func (m *boltMigrationTx) DeleteBucket(bucket []byte) error {
+	if m.tx.Bucket(bucket) == nil {
+		return nil
+	}
+	return m.tx.DeleteBucket(bucket)
+}
+
+func (m *boltMigrationTx) ForEach(bucket []byte, f func(key []byte, record []byte) error) error {
+	b := m.tx.Bucket(bucket)
+	if b == nil {
+		return NewNoBucketError(bucket)
+	}
+	// Collect the keys first, so f can write to the bucket.
+	keys := make([][]byte, 0, 64)
+	b.ForEach(func(k, _ []byte) error {
+		keys = append(keys, append([]byte{}, k...))
+		return nil
+	})
+	for _, k := range keys {
+		if v := b.Get(k); v != nil {
+			if err := f(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *boltMigrationTx) Put(bucket []byte, key []byte, record []byte) error {
+	b := m.tx.Bucket(bucket)
+	if b == nil {
+		return NewNoBucketError(bucket)
+	}
+	return b.Put(key, append([]byte{}, record...))
+}
+
+func (m *boltMigrationTx) Delete(bucket []byte, key []byte) error {
+	b := m.tx.Bucket(bucket)
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// The version of the database.  A file with no version is version 0.
+func readVersion(tx *bolt.Tx) uint32 {
+	b := tx.Bucket([]byte(SCHEMA_BUCKET))
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(SCHEMA_KEY))
+	if len(v) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+func writeVersion(tx *bolt.Tx, version uint32) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(SCHEMA_BUCKET))
+	if err != nil {
+		return err
+	}
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], version)
+	return b.Put([]byte(SCHEMA_KEY), v[:])
+}
+
+// A new, empty file is given the current version.  Anything else is brought
+// up to the current version.
+func (d *BoltDB) openSchema() error {
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(SCHEMA_BUCKET)) != nil {
+			return nil
+		}
+		empty := true
+		tx.ForEach(func([]byte, *bolt.Bucket) error {
+			empty = false
+			return nil
+		})
+		if empty {
+			return writeVersion(tx, SCHEMA_VERSION)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return d.migrate(SCHEMA_VERSION, migrations)
+}
+
+// The version of the schema of the database.
+func (d *BoltDB) GetVersion() (version uint32, err error) {
+	err = d.db.View(func(tx *bolt.Tx) error {
+		version = readVersion(tx)
+		return nil
+	})
+	return
+}
+
+// Run the migrations needed to bring the database to the target version,
+// one step at a time.
+func (d *BoltDB) migrate(target uint32, steps []Migration) error {
+	for {
+		version, err := d.GetVersion()
+		if err != nil {
+			return err
+		}
+		if version == target {
+			return nil
+		}
+		if version > target {
+			return fmt.Errorf("Database %s is at schema version %d, which is newer than this code (version %d)",
+				string(d.filename), version, target)
+		}
+		var step *Migration
+		for i := range steps {
+			if steps[i].From == version {
+				step = &steps[i]
+			}
+		}
+		if step == nil {
+			return fmt.Errorf("No migration from schema version %d", version)
+		}
+		err = d.db.Update(func(tx *bolt.Tx) error {
+			if err := step.Migrate(&boltMigrationTx{tx}); err != nil {
+				return err
+			}
+			return writeVersion(tx, version+1)
+		})
+		if err != nil {
+			return fmt.Errorf("Migration from schema version %d (%s) failed: %s", version, step.Name, err.Error())
+		}
+	}
+}
+
+// What was found by checking every record in a database.
+type CheckReport struct {
+	Version  uint32
+	Buckets  int
+	Records  int
+	Problems []*CorruptionError // Records with unknown type hashes, or that can't be decoded
+}
+
+func (r *CheckReport) String() string {
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("Schema version %d (current is %d)\n", r.Version, SCHEMA_VERSION))
+	out.WriteString(fmt.Sprintf("%d records in %d buckets\n", r.Records, r.Buckets))
+	for _, p := range r.Problems {
+		out.WriteString(p.Error())
+		out.WriteString("\n")
+	}
+	if len(r.Problems) == 0 {
+		out.WriteString("No problems found\n")
+	}
+	return out.String()
+}
+
+// Try to decode every record in the database, and report those that can't
+// be.  Nothing in the database is changed, and a damaged record does not
+// stop the check.
+func (d *BoltDB) Check() (*CheckReport, error) {
+	r := new(CheckReport)
+	err := d.db.View(func(tx *bolt.Tx) error {
+		r.Version = readVersion(tx)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if string(name) == SCHEMA_BUCKET {
+				return nil
+			}
+			r.Buckets++
+			return b.ForEach(func(k, v []byte) error {
+				r.Records++
+				if v == nil {
+					return nil // A nested bucket
+				}
+				if _, err := decodeRecord(v); err != nil {
+					c, ok := err.(*CorruptionError)
+					if !ok {
+						c = NewCorruptionError("%s", err.Error())
+					}
+					c.Bucket = append([]byte{}, name...)
+					c.Key = append([]byte{}, k...)
+					r.Problems = append(r.Problems, c)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Open a database file only to read it.  Nothing in the file is changed:
+// the schema is not upgraded, and no buckets are created.
+func openBoltReadOnly(filename string) (*BoltDB, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, fmt.Errorf("Database %s was not found", filename)
+	}
+	tdb, err := bolt.Open(filename, 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("Database %s could not be opened: %s", filename, err.Error())
+	}
+	d := new(BoltDB)
+	d.db = tdb
+	d.filename = []byte(filename)
+	return d, nil
+}
+
+// Open a database file just to check it.  The schema is not upgraded, and
+// no buckets are created.
+func CheckBolt(filename string) (*CheckReport, error) {
+	d, err := openBoltReadOnly(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return d.Check()
+}
+
+// Open a database file to read from, say to copy it.  The file is not
+// changed, so a database at an older schema version is refused rather
+// than migrated; run the migration first.
+func OpenBoltReadOnly(filename string) (*BoltDB, error) {
+	d, err := openBoltReadOnly(filename)
+	if err != nil {
+		return nil, err
+	}
+	version, err := d.GetVersion()
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	if version != SCHEMA_VERSION {
+		d.Close()
+		return nil, fmt.Errorf("Database %s is at schema version %d, not %d", filename, version, SCHEMA_VERSION)
+	}
+	return d, nil
+}
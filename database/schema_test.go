@@ -0,0 +1,228 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/FactomProject/bolt"
+)
+
+const schemaTestFile = "/tmp/schema_test.db"
+
+// Write a database the way it was written before it had a version.
+func writeLegacyBolt(t *testing.T, records map[string][]byte) {
+	os.Remove(schemaTestFile)
+	tdb, err := bolt.Open(schemaTestFile, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	tdb.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucketIfNotExists([]byte("one"))
+		for k, v := range records {
+			b.Put([]byte(k), v)
+		}
+		return nil
+	})
+}
+
+func openSchemaTestBolt() (*BoltDB, error) {
+	db := new(BoltDB)
+	err := db.Init([][]byte{[]byte("one")}, schemaTestFile)
+	return db, err
+}
+
+func Test_schema_version(t *testing.T) {
+	defer os.Remove(schemaTestFile)
+
+	// A new database is at the current version.
+	os.Remove(schemaTestFile)
+	db, err := openSchemaTestBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := db.GetVersion(); v != SCHEMA_VERSION {
+		fmt.Println("New database is at version ", v)
+		t.Fail()
+	}
+	db.Close()
+
+	// A database from before versions is upgraded, and keeps its records.
+	a := batchAddress("a")
+	record, _ := encodeRecord(a)
+	writeLegacyBolt(t, map[string][]byte{"a": record})
+	db, err = openSchemaTestBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := db.GetVersion(); v != SCHEMA_VERSION {
+		fmt.Println("Legacy database was not upgraded: ", v)
+		t.Fail()
+	}
+	if v, _ := db.GetRaw([]byte("one"), []byte("a")); a.IsEqual(v) != nil {
+		fmt.Println("Legacy record was lost")
+		t.Fail()
+	}
+
+	// A database newer than the code is refused.
+	db.db.Update(func(tx *bolt.Tx) error { return writeVersion(tx, SCHEMA_VERSION+1) })
+	db.Close()
+	if _, err := openSchemaTestBolt(); err == nil {
+		fmt.Println("A database from newer code should not open")
+		t.Fail()
+	}
+}
+
+func Test_schema_migrations(t *testing.T) {
+	defer os.Remove(schemaTestFile)
+	os.Remove(schemaTestFile)
+	db, err := openSchemaTestBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Records written under an old type hash.
+	var oldHash [32]byte
+	copy(oldHash[:], fct.Sha([]byte("OldAddress")).Bytes())
+	a := batchAddress("a")
+	data, _ := a.MarshalBinary()
+	db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("one")).Put([]byte("a"), JoinRecord(oldHash, data))
+	})
+	if _, err := db.GetRaw([]byte("one"), []byte("a")); !IsCorruption(err) {
+		fmt.Println("Expected the old record to be unreadable: ", err)
+		t.Fail()
+	}
+
+	steps := []Migration{
+		{From: SCHEMA_VERSION, Name: "Rename OldAddress", Migrate: func(tx IMigrationTx) error {
+			for _, bucket := range tx.Buckets() {
+				err := tx.ForEach(bucket, func(key []byte, record []byte) error {
+					hash, data, err := SplitRecord(record)
+					if err != nil || hash != oldHash {
+						return err
+					}
+					return tx.Put(bucket, key, JoinRecord(cp(a.GetDBHash()), data))
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{From: SCHEMA_VERSION + 1, Name: "Fails", Migrate: func(tx IMigrationTx) error {
+			tx.DeleteBucket([]byte("one"))
+			return fmt.Errorf("Failed on purpose")
+		}},
+	}
+
+	// The first step is kept even though the second fails, and the
+	// failed step changes nothing.
+	if err := db.migrate(SCHEMA_VERSION+2, steps); err == nil {
+		fmt.Println("Expected the second migration to fail")
+		t.Fail()
+	}
+	if v, _ := db.GetVersion(); v != SCHEMA_VERSION+1 {
+		fmt.Println("Expected to stop at version ", SCHEMA_VERSION+1, " but at ", v)
+		t.Fail()
+	}
+	if v, err := db.GetRaw([]byte("one"), []byte("a")); err != nil || a.IsEqual(v) != nil {
+		fmt.Println("Migrated record did not read back: ", err)
+		t.Fail()
+	}
+	if err := db.migrate(SCHEMA_VERSION+3, steps); err == nil {
+		fmt.Println("Migrating with a missing step should fail")
+		t.Fail()
+	}
+}
+
+func Test_schema_check(t *testing.T) {
+	defer os.Remove(schemaTestFile)
+
+	a := batchAddress("a")
+	record, _ := encodeRecord(a)
+	var unknown [32]byte
+	copy(unknown[:], fct.Sha([]byte("Unknown")).Bytes())
+	writeLegacyBolt(t, map[string][]byte{
+		"good":    record,
+		"unknown": JoinRecord(unknown, []byte{1, 2, 3}),
+		"short":   []byte{1, 2, 3},
+	})
+
+	report, err := CheckBolt(schemaTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Version != 0 || report.Records != 3 || len(report.Problems) != 2 {
+		fmt.Print(report.String())
+		t.Fail()
+	}
+	for _, p := range report.Problems {
+		if string(p.Bucket) != "one" || (string(p.Key) != "unknown" && string(p.Key) != "short") {
+			fmt.Println("Unexpected problem: ", p)
+			t.Fail()
+		}
+	}
+
+	// Checking changes nothing, not even the version.
+	report, _ = CheckBolt(schemaTestFile)
+	if report.Version != 0 {
+		fmt.Println("Check upgraded the database")
+		t.Fail()
+	}
+
+	if _, err := CheckBolt("/tmp/no_such_schema_test.db"); err == nil {
+		fmt.Println("Checking a missing database should fail")
+		t.Fail()
+	}
+}
+
+func Test_schema_read_only(t *testing.T) {
+	defer os.Remove(schemaTestFile)
+
+	a := batchAddress("a")
+	record, _ := encodeRecord(a)
+	writeLegacyBolt(t, map[string][]byte{"a": record})
+	before, _ := ioutil.ReadFile(schemaTestFile)
+
+	// An old database is refused, and left as it was.
+	if db, err := OpenBoltReadOnly(schemaTestFile); err == nil {
+		db.Close()
+		fmt.Println("Expected a version 0 database to be refused")
+		t.Fail()
+	}
+	if after, _ := ioutil.ReadFile(schemaTestFile); !bytes.Equal(before, after) {
+		fmt.Println("Opening the database read only changed it")
+		t.Fail()
+	}
+
+	db, err := openSchemaTestBolt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	before, _ = ioutil.ReadFile(schemaTestFile)
+
+	db, err = OpenBoltReadOnly(schemaTestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.GetRaw([]byte("one"), []byte("a")); err != nil || a.IsEqual(v) != nil {
+		fmt.Println("Record did not read back: ", err)
+		t.Fail()
+	}
+	db.Close()
+	if after, _ := ioutil.ReadFile(schemaTestFile); !bytes.Equal(before, after) {
+		fmt.Println("Reading the database changed it")
+		t.Fail()
+	}
+}
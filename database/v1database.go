@@ -0,0 +1,172 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+)
+
+/***********************************************
+ * IFDatabaseV1
+ *
+ * The first IFDatabase, whose methods did not return errors.  A database
+ * written against it can still be used through NewV1Database(), until it
+ * moves to IFDatabase.
+ *
+ * Only the methods the adapter needs are listed, so anything that met the
+ * first IFDatabase meets this one.
+ ************************************************/
+type IFDatabaseV1 interface {
+	fct.IBlock
+
+	Init(a ...interface{})
+	Close()
+
+	GetRaw(bucket []byte, key []byte) fct.IBlock
+	PutRaw(bucket []byte, key []byte, value fct.IBlock)
+	DeleteKey(bucket []byte, key []byte)
+
+	DoNotPersist(bucket string)
+	DoNotCache(bucket string)
+	GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock)
+}
+
+// Wraps an IFDatabaseV1 as an IFDatabase.  The first API panicked where
+// this one returns errors; a panic in a read is returned as a
+// *CorruptionError, and any other as an error.
+//
+// The old database can't apply a batch as one write, so Commit() makes
+// the writes of the batch one at a time, and stops at the first failure.
+type V1Database struct {
+	FDatabase
+	db IFDatabaseV1
+}
+
+var _ IFDatabase = (*V1Database)(nil)
+
+func NewV1Database(db IFDatabaseV1) *V1Database {
+	v := new(V1Database)
+	v.db = db
+	return v
+}
+
+// Turn a panic from the old database into an error.
+func recoverV1(err *error, read bool) {
+	if r := recover(); r != nil {
+		if read {
+			*err = NewCorruptionError("%v", r)
+		} else {
+			*err = fmt.Errorf("%v", r)
+		}
+	}
+}
+
+func (v *V1Database) Init(a ...interface{}) (err error) {
+	defer recoverV1(&err, false)
+	v.db.Init(a...)
+	return nil
+}
+
+func (v *V1Database) Close() {
+	v.db.Close()
+}
+
+func (v *V1Database) GetRaw(bucket []byte, key []byte) (value fct.IBlock, err error) {
+	if v.batch != nil {
+		if value, ok := v.batch.get(bucket, key); ok {
+			return value, nil
+		}
+	}
+	defer recoverV1(&err, true)
+	return v.db.GetRaw(bucket, key), nil
+}
+
+func (v *V1Database) Get(bucket string, key fct.IHash) (fct.IBlock, error) {
+	return v.GetRaw([]byte(bucket), key.Bytes())
+}
+
+func (v *V1Database) GetKey(key IDBKey) (fct.IBlock, error) {
+	return v.GetRaw(key.GetBucket(), key.GetKey())
+}
+
+func (v *V1Database) PutRaw(bucket []byte, key []byte, value fct.IBlock) (err error) {
+	if v.batch != nil {
+		v.batch.put(bucket, key, value)
+		return nil
+	}
+	defer recoverV1(&err, false)
+	v.db.PutRaw(bucket, key, value)
+	return nil
+}
+
+func (v *V1Database) Put(bucket string, key fct.IHash, value fct.IBlock) error {
+	return v.PutRaw([]byte(bucket), key.Bytes(), value)
+}
+
+func (v *V1Database) PutKey(key IDBKey, value fct.IBlock) error {
+	return v.PutRaw(key.GetBucket(), key.GetKey(), value)
+}
+
+func (v *V1Database) DeleteKey(bucket []byte, key []byte) (err error) {
+	if v.batch != nil {
+		v.batch.deleteKey(bucket, key)
+		return nil
+	}
+	defer recoverV1(&err, false)
+	v.db.DeleteKey(bucket, key)
+	return nil
+}
+
+func (v *V1Database) Commit() error {
+	batch := v.batch
+	if batch == nil {
+		return fmt.Errorf("No batch is open")
+	}
+	v.batch = nil
+	for _, op := range batch.ops {
+		var err error
+		if op.delete {
+			err = v.DeleteKey(op.bucket, op.key)
+		} else {
+			err = v.PutRaw(op.bucket, op.key, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *V1Database) DoNotPersist(bucket string) {
+	v.FDatabase.DoNotPersist(bucket)
+	v.db.DoNotPersist(bucket)
+}
+
+func (v *V1Database) DoNotCache(bucket string) {
+	v.FDatabase.DoNotCache(bucket)
+	v.db.DoNotCache(bucket)
+}
+
+func (v *V1Database) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock, err error) {
+	defer recoverV1(&err, true)
+	keys, values = v.db.GetKeysValues(bucket)
+	if v.batch != nil {
+		keys, values = v.batch.merge(bucket, keys, values)
+	}
+	return keys, values, nil
+}
+
+func (v *V1Database) Iterate(bucket []byte, r *KeyRange) (IIterator, error) {
+	keys, values, err := v.GetKeysValues(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return sortedIterator(keys, values, r), nil
+}
+
+func (v *V1Database) String() string {
+	return v.db.String()
+}
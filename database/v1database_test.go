@@ -0,0 +1,99 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"testing"
+)
+
+// A database written against the first IFDatabase.  Like the first BoltDB,
+// it panics on a record it can't read.
+type oldDB struct {
+	fct.IBlock
+	values map[string]fct.IBlock
+}
+
+func (db *oldDB) Init(a ...interface{}) {
+	db.values = make(map[string]fct.IBlock)
+}
+
+func (db *oldDB) Close() {}
+
+func (db *oldDB) GetRaw(bucket []byte, key []byte) fct.IBlock {
+	if string(key) == "bad" {
+		panic("Unknown type hash")
+	}
+	return db.values[encodeKey(bucket, key)]
+}
+
+func (db *oldDB) PutRaw(bucket []byte, key []byte, value fct.IBlock) {
+	db.values[encodeKey(bucket, key)] = value
+}
+
+func (db *oldDB) DeleteKey(bucket []byte, key []byte) {
+	delete(db.values, encodeKey(bucket, key))
+}
+
+func (db *oldDB) DoNotPersist(bucket string) {}
+func (db *oldDB) DoNotCache(bucket string)   {}
+
+func (db *oldDB) GetKeysValues(bucket []byte) (keys [][]byte, values []fct.IBlock) {
+	for k, v := range db.values {
+		dbKey := decodeKey(k)
+		if string(dbKey.GetBucket()) == string(bucket) {
+			keys = append(keys, dbKey.GetKey())
+			values = append(values, v)
+		}
+	}
+	return keys, values
+}
+
+func Test_V1Database(t *testing.T) {
+	old := new(oldDB)
+	db := NewV1Database(old)
+	if err := db.Init(); err != nil {
+		t.Fatal(err)
+	}
+	a1, a2 := batchAddress("a1"), batchAddress("a2")
+
+	if err := db.PutRaw([]byte("one"), []byte("k2"), a2); err != nil {
+		t.Fatal(err)
+	}
+	db.Begin()
+	db.PutRaw([]byte("one"), []byte("k1"), a1)
+	if old.GetRaw([]byte("one"), []byte("k1")) != nil {
+		fmt.Println("A batch was written before Commit()")
+		t.Fail()
+	}
+	if err := db.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := db.GetRaw([]byte("one"), []byte("k1")); err != nil || a1.IsEqual(v) != nil {
+		fmt.Println("Lost a committed write: ", err)
+		t.Fail()
+	}
+
+	it, err := db.Iterate([]byte("one"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k2" {
+		fmt.Println("Iterated the wrong keys: ", keys)
+		t.Fail()
+	}
+
+	// A panic in the old database comes back as an error.
+	if _, err := db.GetRaw([]byte("one"), []byte("bad")); !IsCorruption(err) {
+		fmt.Println("Expected a corruption error, got: ", err)
+		t.Fail()
+	}
+}
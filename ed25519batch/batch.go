@@ -0,0 +1,199 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package ed25519batch checks many ed25519 signatures together, in less
+// time than checking them one at a time.
+//
+// Each signature (R, s) by key A on message M is valid if
+//
+//	[s]B = R + [h]A,  h = SHA-512(R || A || M)
+//
+// A batch picks a random 128 bit z for each signature and checks the sum
+//
+//	[-sum(z s)]B + sum([z]R) + sum([z h]A) = 0
+//
+// with one multi-scalar multiplication, which shares its doublings across
+// all the points.  If every signature is valid the sum is zero.  If one is
+// not, the sum is zero only by a chance of about 2^-128, unless the
+// signature was built from points of small order (below).
+//
+// A batch accepts every set of signatures that ed25519.VerifyCanonical()
+// accepts one at a time, and rejects a set with a signature that fails.
+// The exception is signatures crafted with small order components in R or
+// A: one of those always fails the batch, but two or more can cancel out
+// and pass.  No signer makes these by accident, but anything that must
+// agree exactly with other nodes, like the validation of a new block,
+// should check signatures one at a time.
+package ed25519batch
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"math/big"
+)
+
+// The order of the base point, 2^252 + 27742317777372353535851937790883648493
+var order, _ = new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+
+type entry struct {
+	publicKey *[32]byte
+	message   []byte
+	signature *[64]byte
+}
+
+// A batch of signatures.  The zero value is an empty batch.
+type Batch struct {
+	entries []entry
+}
+
+// Add a signature to the batch.  Nothing is copied, so the key, message
+// and signature must not change until Verify() is done.
+func (b *Batch) Add(publicKey *[32]byte, message []byte, signature *[64]byte) {
+	b.entries = append(b.entries, entry{publicKey, message, signature})
+}
+
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+// True if every signature in the batch is valid.  False if any one is
+// invalid, or if no random numbers could be read; either way the caller
+// should check the signatures one at a time to find out which.
+func (b *Batch) Verify() bool {
+	n := len(b.entries)
+	if n == 0 {
+		return true
+	}
+
+	// Two points per signature, and the base point last
+	points := make([]point, 2*n+1)
+	scalars := make([][64]int8, 2*n+1)
+
+	random := make([]byte, 16*n)
+	if _, err := rand.Read(random); err != nil {
+		return false
+	}
+
+	sum := new(big.Int) // sum(z s)
+	z := new(big.Int)
+	s := new(big.Int)
+	h := new(big.Int)
+	var zb [32]byte
+	for i, e := range b.entries {
+		rb := new([32]byte)
+		copy(rb[:], e.signature[:32])
+		sb := new([32]byte)
+		copy(sb[:], e.signature[32:])
+
+		// s must be reduced, as VerifyCanonical() requires
+		setLittleEndian(s, sb[:])
+		if s.Cmp(order) >= 0 {
+			return false
+		}
+		if !pointFromBytes(&points[2*i], rb) || !isCanonical(&points[2*i], rb) {
+			return false
+		}
+		if !pointFromBytes(&points[2*i+1], e.publicKey) {
+			return false
+		}
+
+		digest := sha512.New()
+		digest.Write(rb[:])
+		digest.Write(e.publicKey[:])
+		digest.Write(e.message)
+		setLittleEndian(h, digest.Sum(nil))
+
+		// An odd z means one signature off by a point of small order
+		// can't vanish from the sum.
+		copy(zb[:], random[16*i:16*i+16])
+		zb[0] |= 1
+		setLittleEndian(z, zb[:16])
+		signedRadix16(&scalars[2*i], &zb)
+
+		h.Mul(h, z)
+		h.Mod(h, order)
+		signedRadix16(&scalars[2*i+1], scalarBytes(h))
+
+		s.Mul(s, z)
+		sum.Add(sum, s)
+	}
+	sum.Mod(sum, order)
+	sum.Sub(order, sum)
+	points[2*n] = basePoint
+	signedRadix16(&scalars[2*n], scalarBytes(sum))
+
+	var result point
+	multiScalarMult(&result, scalars, points)
+	return result.isIdentity()
+}
+
+func setLittleEndian(n *big.Int, b []byte) {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	n.SetBytes(be)
+}
+
+// A scalar less than 2^256 as 32 little endian bytes.
+func scalarBytes(n *big.Int) *[32]byte {
+	b := new([32]byte)
+	nb := n.Bytes()
+	for i := range nb {
+		b[i] = nb[len(nb)-1-i]
+	}
+	return b
+}
+
+// Write a scalar less than 2^255 as 64 digits from -8 to 8, least
+// significant first, as ref10 does.
+func signedRadix16(e *[64]int8, a *[32]byte) {
+	for i, v := range a {
+		e[2*i] = int8(v & 15)
+		e[2*i+1] = int8(v >> 4)
+	}
+	var carry int8
+	for i := 0; i < 63; i++ {
+		e[i] += carry
+		carry = (e[i] + 8) >> 4
+		e[i] -= carry << 4
+	}
+	e[63] += carry
+}
+
+// r = sum of [scalars[i]]points[i], by Straus' method: every point has a
+// table of its first eight multiples, and one run of doublings serves all
+// of them.  Variable time, which is fine as nothing here is secret.
+func multiScalarMult(r *point, scalars [][64]int8, points []point) {
+	tables := make([][8]cachedPoint, len(points))
+	for i := range points {
+		var p, multiple point
+		p = points[i]
+		tables[i][0].fromPoint(&p)
+		multiple = p
+		for j := 1; j < 8; j++ {
+			multiple.add(&multiple, &tables[i][0])
+			tables[i][j].fromPoint(&multiple)
+		}
+	}
+
+	r.setIdentity()
+	var neg cachedPoint
+	for w := 63; w >= 0; w-- {
+		r.double(r)
+		r.double(r)
+		r.double(r)
+		r.double(r)
+		for i := range points {
+			d := scalars[i][w]
+			switch {
+			case d > 0:
+				r.add(r, &tables[i][d-1])
+			case d < 0:
+				neg.neg(&tables[i][-d-1])
+				r.add(r, &neg)
+			}
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package ed25519batch
+
+import (
+	"fmt"
+	"github.com/FactomProject/ed25519"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+var fieldP = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+func randomFieldElement(r *rand.Rand) (*fieldElement, *big.Int) {
+	n := new(big.Int).Rand(r, fieldP)
+	v := new(fieldElement)
+	feFromBig(v, n)
+	return v, n
+}
+
+func feToBig(a *fieldElement) *big.Int {
+	var b [32]byte
+	feToBytes(&b, a)
+	n := new(big.Int)
+	setLittleEndian(n, b[:])
+	return n
+}
+
+func Test_field(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	exp := new(big.Int).Sub(fieldP, big.NewInt(5))
+	exp.Rsh(exp, 3)
+	for i := 0; i < 1000; i++ {
+		a, an := randomFieldElement(r)
+		b, bn := randomFieldElement(r)
+		var v fieldElement
+		want := new(big.Int)
+
+		feMul(&v, a, b)
+		if feToBig(&v).Cmp(want.Mod(want.Mul(an, bn), fieldP)) != 0 {
+			fmt.Println("Multiplication is wrong for ", an, bn)
+			t.FailNow()
+		}
+		feSub(&v, a, b)
+		if feToBig(&v).Cmp(want.Mod(want.Sub(an, bn), fieldP)) != 0 {
+			fmt.Println("Subtraction is wrong for ", an, bn)
+			t.FailNow()
+		}
+		feAdd(&v, a, b)
+		if feToBig(&v).Cmp(want.Mod(want.Add(an, bn), fieldP)) != 0 {
+			fmt.Println("Addition is wrong for ", an, bn)
+			t.FailNow()
+		}
+		if i%100 == 0 {
+			fePow22523(&v, a)
+			if feToBig(&v).Cmp(want.Exp(an, exp, fieldP)) != 0 {
+				fmt.Println("Exponentiation is wrong for ", an)
+				t.FailNow()
+			}
+		}
+	}
+
+	// Values of p and over load, and reduce.
+	var b [32]byte
+	feToBytes(&b, &feZero)
+	pb := scalarBytes(new(big.Int).Add(fieldP, big.NewInt(3)))
+	var v fieldElement
+	feFromBytes(&v, pb)
+	if feToBig(&v).Cmp(big.NewInt(3)) != 0 {
+		fmt.Println("p+3 did not reduce to 3")
+		t.Fail()
+	}
+}
+
+func Test_point(t *testing.T) {
+	// The base point times its order is the identity, and the base point
+	// times anything less is not.
+	var e [64]int8
+	signedRadix16(&e, scalarBytes(order))
+	var r point
+	multiScalarMult(&r, [][64]int8{e}, []point{basePoint})
+	if !r.isIdentity() {
+		fmt.Println("[L]B is not the identity")
+		t.Fail()
+	}
+	signedRadix16(&e, scalarBytes(new(big.Int).Sub(order, big.NewInt(1))))
+	multiScalarMult(&r, [][64]int8{e}, []point{basePoint})
+	if r.isIdentity() {
+		t.Fail()
+	}
+
+	// Doubling is adding a point to itself.
+	var c cachedPoint
+	var d1, d2 point
+	c.fromPoint(&basePoint)
+	d1.add(&basePoint, &c)
+	d2.double(&basePoint)
+	var b1, b2 [32]byte
+	encode(&b1, &d1)
+	encode(&b2, &d2)
+	if b1 != b2 {
+		fmt.Println("2B differs when doubled and when added")
+		t.Fail()
+	}
+
+	// The identity has encodings that decode, but are not canonical.
+	var p point
+	identity := [32]byte{1}
+	if !pointFromBytes(&p, &identity) || !isCanonical(&p, &identity) || !p.isIdentity() {
+		t.Fail()
+	}
+	for _, bad := range []*[32]byte{
+		scalarBytes(new(big.Int).Add(fieldP, big.NewInt(1))), // y = p+1
+		&[32]byte{1, 31: 0x80},                               // x = -0
+	} {
+		if !pointFromBytes(&p, bad) || isCanonical(&p, bad) {
+			fmt.Printf("%x should decode, and not be canonical\n", *bad)
+			t.Fail()
+		}
+	}
+	if pointFromBytes(&p, &[32]byte{2}) {
+		fmt.Println("y = 2 is not on the curve")
+		t.Fail()
+	}
+}
+
+// The canonical encoding of a point.
+func encode(b *[32]byte, p *point) {
+	var x, y, zinv fieldElement
+	// 1/Z = Z^(p-2), by way of big
+	zn := feToBig(&p.Z)
+	feFromBig(&zinv, zn.ModInverse(zn, fieldP))
+	feMul(&x, &p.X, &zinv)
+	feMul(&y, &p.Y, &zinv)
+	feToBytes(b, &y)
+	if feIsNegative(&x) {
+		b[31] |= 0x80
+	}
+}
+
+type testSignature struct {
+	publicKey *[32]byte
+	message   []byte
+	signature *[64]byte
+}
+
+func newTestSignatures(r *rand.Rand, n int) []testSignature {
+	sigs := make([]testSignature, n)
+	for i := range sigs {
+		public, private, _ := ed25519.GenerateKey(r)
+		message := make([]byte, r.Intn(200))
+		r.Read(message)
+		sigs[i] = testSignature{public, message, ed25519.Sign(private, message)}
+	}
+	return sigs
+}
+
+// Ways to break a signature, some of which VerifyCanonical() may still
+// accept.
+var corruptions = []func(r *rand.Rand, s *testSignature){
+	func(r *rand.Rand, s *testSignature) { s.message = append(s.message, 1) },
+	func(r *rand.Rand, s *testSignature) { s.signature[r.Intn(32)] ^= 1 << uint(r.Intn(8)) },
+	func(r *rand.Rand, s *testSignature) { s.signature[32+r.Intn(32)] ^= 1 << uint(r.Intn(8)) },
+	func(r *rand.Rand, s *testSignature) { s.publicKey[r.Intn(32)] ^= 1 << uint(r.Intn(8)) },
+	func(r *rand.Rand, s *testSignature) {
+		// s + L is the same signature, but not canonical
+		var sn big.Int
+		setLittleEndian(&sn, s.signature[32:])
+		copy(s.signature[32:], scalarBytes(sn.Add(&sn, order))[:])
+	},
+	func(r *rand.Rand, s *testSignature) {
+		// R of y = p+1 decodes, but is not canonical
+		copy(s.signature[:32], scalarBytes(new(big.Int).Add(fieldP, big.NewInt(1)))[:])
+	},
+}
+
+func copySignature(s testSignature) testSignature {
+	c := testSignature{new([32]byte), append([]byte{}, s.message...), new([64]byte)}
+	*c.publicKey = *s.publicKey
+	*c.signature = *s.signature
+	return c
+}
+
+func verifyBatch(sigs []testSignature) bool {
+	var b Batch
+	for _, s := range sigs {
+		b.Add(s.publicKey, s.message, s.signature)
+	}
+	return b.Verify()
+}
+
+func Test_Batch_equivalence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sigs := newTestSignatures(r, 100)
+	if !verifyBatch(sigs) {
+		fmt.Println("A batch of valid signatures failed")
+		t.Fail()
+	}
+	if !verifyBatch(nil) {
+		t.Fail()
+	}
+
+	for i := 0; i < 300; i++ {
+		s := copySignature(sigs[r.Intn(len(sigs))])
+		corruptions[i%len(corruptions)](r, &s)
+		want := ed25519.VerifyCanonical(s.publicKey, s.message, s.signature)
+		if got := verifyBatch([]testSignature{s}); got != want {
+			fmt.Printf("Batch says %v, VerifyCanonical says %v for corruption %d\n", got, want, i%len(corruptions))
+			t.Fail()
+		}
+
+		// One bad signature anywhere fails the whole batch.
+		batch := append([]testSignature{}, sigs[:10]...)
+		j := r.Intn(len(batch))
+		batch[j] = s
+		if got := verifyBatch(batch); got != want {
+			fmt.Printf("Batch says %v, VerifyCanonical says %v for corruption %d at %d\n", got, want, i%len(corruptions), j)
+			t.Fail()
+		}
+	}
+
+	// The identity as a public key is valid with s = r, R = [r]B, whatever
+	// the message.  Odd, but both agree.
+	var e [64]int8
+	rn := big.NewInt(123456789)
+	signedRadix16(&e, scalarBytes(rn))
+	var rp point
+	multiScalarMult(&rp, [][64]int8{e}, []point{basePoint})
+	s := testSignature{&[32]byte{1}, []byte("anything"), new([64]byte)}
+	encode((*[32]byte)(s.signature[:32]), &rp)
+	copy(s.signature[32:], scalarBytes(rn)[:])
+	if want := ed25519.VerifyCanonical(s.publicKey, s.message, s.signature); !want || !verifyBatch([]testSignature{s}) {
+		fmt.Println("Expected the identity key to verify: ", want)
+		t.Fail()
+	}
+}
+
+var benchSignatures []testSignature
+
+func getBenchSignatures() []testSignature {
+	if benchSignatures == nil {
+		benchSignatures = newTestSignatures(rand.New(rand.NewSource(1)), 64)
+	}
+	return benchSignatures
+}
+
+func Benchmark_Verify_64_each(b *testing.B) {
+	sigs := getBenchSignatures()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, s := range sigs {
+			if !ed25519.VerifyCanonical(s.publicKey, s.message, s.signature) {
+				b.Fatal("Signature failed")
+			}
+		}
+	}
+}
+
+func Benchmark_Verify_64_batch(b *testing.B) {
+	sigs := getBenchSignatures()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !verifyBatch(sigs) {
+			b.Fatal("Batch failed")
+		}
+	}
+}
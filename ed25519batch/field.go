@@ -0,0 +1,252 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package ed25519batch
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+/**************************************
+ * Arithmetic in GF(2^255-19)
+ *
+ * An element is five limbs of 51 bits, least significant first.  Limbs
+ * may run a few bits over 51 between operations; feReduce() brings an
+ * element to its canonical value, as feToBytes() writes it.
+ **************************************/
+
+type fieldElement [5]uint64
+
+const maskLow51 uint64 = 1<<51 - 1
+
+var (
+	feZero = fieldElement{0, 0, 0, 0, 0}
+	feOne  = fieldElement{1, 0, 0, 0, 0}
+)
+
+// Load 32 little endian bytes, ignoring the top bit.  Values of p and
+// over are not rejected, and reduce as they would in ref10.
+func feFromBytes(v *fieldElement, b *[32]byte) {
+	v[0] = binary.LittleEndian.Uint64(b[0:8]) & maskLow51
+	v[1] = (binary.LittleEndian.Uint64(b[6:14]) >> 3) & maskLow51
+	v[2] = (binary.LittleEndian.Uint64(b[12:20]) >> 6) & maskLow51
+	v[3] = (binary.LittleEndian.Uint64(b[19:27]) >> 1) & maskLow51
+	v[4] = (binary.LittleEndian.Uint64(b[24:32]) >> 12) & maskLow51
+}
+
+// Write the canonical encoding of the element.
+func feToBytes(b *[32]byte, a *fieldElement) {
+	v := *a
+	feReduce(&v)
+	*b = [32]byte{}
+	var buf [8]byte
+	for i, l := range v {
+		offset := i * 51
+		binary.LittleEndian.PutUint64(buf[:], l<<uint(offset%8))
+		for j, bb := range buf {
+			k := offset/8 + j
+			if k >= len(b) {
+				break
+			}
+			b[k] |= bb
+		}
+	}
+}
+
+// Bring the limbs back to 51 bits, folding the carry out of the top limb
+// back into the bottom one (2^255 = 19).
+func feCarry(v *fieldElement) {
+	c0 := v[0] >> 51
+	c1 := v[1] >> 51
+	c2 := v[2] >> 51
+	c3 := v[3] >> 51
+	c4 := v[4] >> 51
+	v[0] = v[0]&maskLow51 + c4*19
+	v[1] = v[1]&maskLow51 + c0
+	v[2] = v[2]&maskLow51 + c1
+	v[3] = v[3]&maskLow51 + c2
+	v[4] = v[4]&maskLow51 + c3
+}
+
+// Reduce to the canonical value, less than p.
+func feReduce(v *fieldElement) {
+	feCarry(v)
+
+	// Now v < 2^255 + 2^13*19.  Adding 19 carries out of the top limb
+	// only if v >= p, in which case p is subtracted.
+	c := (v[0] + 19) >> 51
+	c = (v[1] + c) >> 51
+	c = (v[2] + c) >> 51
+	c = (v[3] + c) >> 51
+	c = (v[4] + c) >> 51
+
+	v[0] += 19 * c
+	v[1] += v[0] >> 51
+	v[0] &= maskLow51
+	v[2] += v[1] >> 51
+	v[1] &= maskLow51
+	v[3] += v[2] >> 51
+	v[2] &= maskLow51
+	v[4] += v[3] >> 51
+	v[3] &= maskLow51
+	v[4] &= maskLow51 // The carry out of here is the p we subtract
+}
+
+func feAdd(v, a, b *fieldElement) {
+	v[0] = a[0] + b[0]
+	v[1] = a[1] + b[1]
+	v[2] = a[2] + b[2]
+	v[3] = a[3] + b[3]
+	v[4] = a[4] + b[4]
+	feCarry(v)
+}
+
+// a - b, computed as a + 2p - b so no limb goes negative.
+func feSub(v, a, b *fieldElement) {
+	v[0] = (a[0] + 0xFFFFFFFFFFFDA) - b[0]
+	v[1] = (a[1] + 0xFFFFFFFFFFFFE) - b[1]
+	v[2] = (a[2] + 0xFFFFFFFFFFFFE) - b[2]
+	v[3] = (a[3] + 0xFFFFFFFFFFFFE) - b[3]
+	v[4] = (a[4] + 0xFFFFFFFFFFFFE) - b[4]
+	feCarry(v)
+}
+
+func feNeg(v, a *fieldElement) {
+	feSub(v, &feZero, a)
+}
+
+// A 128 bit product, and the sums of them.
+type uint128 struct {
+	lo, hi uint64
+}
+
+func mul64(a, b uint64) uint128 {
+	hi, lo := bits.Mul64(a, b)
+	return uint128{lo, hi}
+}
+
+func addMul64(v uint128, a, b uint64) uint128 {
+	hi, lo := bits.Mul64(a, b)
+	lo, c := bits.Add64(lo, v.lo, 0)
+	hi, _ = bits.Add64(hi, v.hi, c)
+	return uint128{lo, hi}
+}
+
+func shiftRightBy51(a uint128) uint64 {
+	return (a.hi << (64 - 51)) | (a.lo >> 51)
+}
+
+// Schoolbook multiplication.  The products that land past 2^255 are
+// folded back in times 19.
+func feMul(v, a, b *fieldElement) {
+	a0, a1, a2, a3, a4 := a[0], a[1], a[2], a[3], a[4]
+	b0, b1, b2, b3, b4 := b[0], b[1], b[2], b[3], b[4]
+
+	a1_19 := a1 * 19
+	a2_19 := a2 * 19
+	a3_19 := a3 * 19
+	a4_19 := a4 * 19
+
+	r0 := mul64(a0, b0)
+	r0 = addMul64(r0, a1_19, b4)
+	r0 = addMul64(r0, a2_19, b3)
+	r0 = addMul64(r0, a3_19, b2)
+	r0 = addMul64(r0, a4_19, b1)
+
+	r1 := mul64(a0, b1)
+	r1 = addMul64(r1, a1, b0)
+	r1 = addMul64(r1, a2_19, b4)
+	r1 = addMul64(r1, a3_19, b3)
+	r1 = addMul64(r1, a4_19, b2)
+
+	r2 := mul64(a0, b2)
+	r2 = addMul64(r2, a1, b1)
+	r2 = addMul64(r2, a2, b0)
+	r2 = addMul64(r2, a3_19, b4)
+	r2 = addMul64(r2, a4_19, b3)
+
+	r3 := mul64(a0, b3)
+	r3 = addMul64(r3, a1, b2)
+	r3 = addMul64(r3, a2, b1)
+	r3 = addMul64(r3, a3, b0)
+	r3 = addMul64(r3, a4_19, b4)
+
+	r4 := mul64(a0, b4)
+	r4 = addMul64(r4, a1, b3)
+	r4 = addMul64(r4, a2, b2)
+	r4 = addMul64(r4, a3, b1)
+	r4 = addMul64(r4, a4, b0)
+
+	c0 := shiftRightBy51(r0)
+	c1 := shiftRightBy51(r1)
+	c2 := shiftRightBy51(r2)
+	c3 := shiftRightBy51(r3)
+	c4 := shiftRightBy51(r4)
+
+	v[0] = r0.lo&maskLow51 + c4*19
+	v[1] = r1.lo&maskLow51 + c0
+	v[2] = r2.lo&maskLow51 + c1
+	v[3] = r3.lo&maskLow51 + c2
+	v[4] = r4.lo&maskLow51 + c3
+	feCarry(v)
+}
+
+func feSquare(v, a *fieldElement) {
+	feMul(v, a, a)
+}
+
+// Square n times.
+func feSquareN(v, a *fieldElement, n int) {
+	feSquare(v, a)
+	for i := 1; i < n; i++ {
+		feSquare(v, v)
+	}
+}
+
+func feEqual(a, b *fieldElement) bool {
+	var ab, bb [32]byte
+	feToBytes(&ab, a)
+	feToBytes(&bb, b)
+	return ab == bb
+}
+
+func feIsZero(a *fieldElement) bool {
+	return feEqual(a, &feZero)
+}
+
+// The sign of an element is the low bit of its canonical value.
+func feIsNegative(a *fieldElement) bool {
+	var b [32]byte
+	feToBytes(&b, a)
+	return b[0]&1 == 1
+}
+
+// a^((p-5)/8) = a^(2^252-3), for square roots.  The addition chain is
+// the one from ref10.
+func fePow22523(v, a *fieldElement) {
+	var t0, t1, t2 fieldElement
+	feSquare(&t0, a)         // a^2
+	feSquareN(&t1, &t0, 2)   // a^8
+	feMul(&t1, a, &t1)       // a^9
+	feMul(&t0, &t0, &t1)     // a^11
+	feSquare(&t0, &t0)       // a^22
+	feMul(&t0, &t1, &t0)     // a^31 = a^(2^5-1)
+	feSquareN(&t1, &t0, 5)   // a^(2^10-2^5)
+	feMul(&t0, &t1, &t0)     // a^(2^10-1)
+	feSquareN(&t1, &t0, 10)  // a^(2^20-2^10)
+	feMul(&t1, &t1, &t0)     // a^(2^20-1)
+	feSquareN(&t2, &t1, 20)  // a^(2^40-2^20)
+	feMul(&t1, &t2, &t1)     // a^(2^40-1)
+	feSquareN(&t1, &t1, 10)  // a^(2^50-2^10)
+	feMul(&t0, &t1, &t0)     // a^(2^50-1)
+	feSquareN(&t1, &t0, 50)  // a^(2^100-2^50)
+	feMul(&t1, &t1, &t0)     // a^(2^100-1)
+	feSquareN(&t2, &t1, 100) // a^(2^200-2^100)
+	feMul(&t1, &t2, &t1)     // a^(2^200-1)
+	feSquareN(&t1, &t1, 50)  // a^(2^250-2^50)
+	feMul(&t0, &t1, &t0)     // a^(2^250-1)
+	feSquareN(&t0, &t0, 2)   // a^(2^252-4)
+	feMul(v, &t0, a)         // a^(2^252-3)
+}
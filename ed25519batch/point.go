@@ -0,0 +1,193 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package ed25519batch
+
+import (
+	"math/big"
+)
+
+/**************************************
+ * Points on the curve -x^2 + y^2 = 1 + d x^2 y^2
+ *
+ * Points are kept in extended coordinates (X:Y:Z:T), with x = X/Z,
+ * y = Y/Z and xy = T/Z.  The formulas are those of Hisil, Wong, Carter
+ * and Dawson, "Twisted Edwards Curves Revisited", for a = -1.
+ **************************************/
+
+type point struct {
+	X, Y, Z, T fieldElement
+}
+
+// A point ready to be added: (Y+X, Y-X, Z, 2dT).
+type cachedPoint struct {
+	YplusX, YminusX, Z, T2d fieldElement
+}
+
+var (
+	feD      fieldElement // d = -121665/121666
+	feD2     fieldElement // 2d
+	feSqrtM1 fieldElement // A square root of -1
+
+	basePoint point
+)
+
+func init() {
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	d := new(big.Int).ModInverse(big.NewInt(121666), p)
+	d.Mul(d, big.NewInt(-121665))
+	d.Mod(d, p)
+	feFromBig(&feD, d)
+	feAdd(&feD2, &feD, &feD)
+
+	e := new(big.Int).Sub(p, big.NewInt(1))
+	e.Rsh(e, 2)
+	feFromBig(&feSqrtM1, new(big.Int).Exp(big.NewInt(2), e, p))
+
+	// The encoding of the base point; y = 4/5, and x is positive.
+	var b [32]byte
+	b[0] = 0x58
+	for i := 1; i < 32; i++ {
+		b[i] = 0x66
+	}
+	if !pointFromBytes(&basePoint, &b) {
+		panic("The ed25519 base point does not decode")
+	}
+}
+
+func feFromBig(v *fieldElement, n *big.Int) {
+	var b [32]byte
+	nb := n.Bytes()
+	for i := range nb {
+		b[i] = nb[len(nb)-1-i] // little endian
+	}
+	feFromBytes(v, &b)
+}
+
+func (p *point) setIdentity() {
+	p.X = feZero
+	p.Y = feOne
+	p.Z = feOne
+	p.T = feZero
+}
+
+func (p *point) isIdentity() bool {
+	return feIsZero(&p.X) && feEqual(&p.Y, &p.Z)
+}
+
+// Decode a point the way ref10 does: the y coordinate is not required to
+// be reduced, and an x of zero may have its sign bit set.  False if y is
+// not the y of a point on the curve.
+func pointFromBytes(p *point, b *[32]byte) bool {
+	var y, y2, u, v, v3, vxx, x, check fieldElement
+	feFromBytes(&y, b)
+
+	// x^2 = (y^2 - 1) / (d y^2 + 1) = u/v
+	feSquare(&y2, &y)
+	feSub(&u, &y2, &feOne)
+	feMul(&v, &y2, &feD)
+	feAdd(&v, &v, &feOne)
+
+	// x = u v^3 (u v^7)^((p-5)/8)
+	feSquare(&v3, &v)
+	feMul(&v3, &v3, &v) // v^3
+	feSquare(&x, &v3)
+	feMul(&x, &x, &v)
+	feMul(&x, &x, &u) // u v^7
+	fePow22523(&x, &x)
+	feMul(&x, &x, &v3)
+	feMul(&x, &x, &u)
+
+	feSquare(&vxx, &x)
+	feMul(&vxx, &vxx, &v)
+	if !feEqual(&vxx, &u) {
+		feNeg(&check, &u)
+		if !feEqual(&vxx, &check) {
+			return false
+		}
+		feMul(&x, &x, &feSqrtM1)
+	}
+
+	if feIsNegative(&x) != (b[31]>>7 == 1) {
+		feNeg(&x, &x)
+	}
+
+	p.X = x
+	p.Y = y
+	p.Z = feOne
+	feMul(&p.T, &x, &y)
+	return true
+}
+
+// True if b is the one encoding of a point that pointFromBytes() allows
+// several encodings of: y is reduced, and a zero x has no sign bit.
+func isCanonical(p *point, b *[32]byte) bool {
+	var yb [32]byte
+	feToBytes(&yb, &p.Y)
+	yb[31] |= b[31] & 0x80
+	if yb != *b {
+		return false
+	}
+	return !(feIsZero(&p.X) && b[31]>>7 == 1)
+}
+
+func (c *cachedPoint) fromPoint(p *point) {
+	feAdd(&c.YplusX, &p.Y, &p.X)
+	feSub(&c.YminusX, &p.Y, &p.X)
+	c.Z = p.Z
+	feMul(&c.T2d, &p.T, &feD2)
+}
+
+// -P is (-x, y), so Y+X and Y-X trade places.
+func (c *cachedPoint) neg(a *cachedPoint) {
+	c.YplusX, c.YminusX = a.YminusX, a.YplusX
+	c.Z = a.Z
+	feNeg(&c.T2d, &a.T2d)
+}
+
+// r = p + q
+func (r *point) add(p *point, q *cachedPoint) {
+	var a, b, c, d, e, f, g, h fieldElement
+	feSub(&a, &p.Y, &p.X)
+	feMul(&a, &a, &q.YminusX)
+	feAdd(&b, &p.Y, &p.X)
+	feMul(&b, &b, &q.YplusX)
+	feMul(&c, &p.T, &q.T2d)
+	feMul(&d, &p.Z, &q.Z)
+	feAdd(&d, &d, &d)
+
+	feSub(&e, &b, &a)
+	feSub(&f, &d, &c)
+	feAdd(&g, &d, &c)
+	feAdd(&h, &b, &a)
+
+	feMul(&r.X, &e, &f)
+	feMul(&r.Y, &g, &h)
+	feMul(&r.T, &e, &h)
+	feMul(&r.Z, &f, &g)
+}
+
+// r = 2p
+func (r *point) double(p *point) {
+	var a, b, c, e, f, g, h fieldElement
+	feSquare(&a, &p.X)
+	feSquare(&b, &p.Y)
+	feSquare(&c, &p.Z)
+	feAdd(&c, &c, &c)
+
+	feAdd(&e, &p.X, &p.Y)
+	feSquare(&e, &e)
+	feSub(&e, &e, &a)
+	feSub(&e, &e, &b) // 2xy
+	feSub(&g, &b, &a) // y^2 - x^2, as a = -1
+	feSub(&f, &g, &c)
+	feNeg(&h, &a)
+	feSub(&h, &h, &b) // -x^2 - y^2
+
+	feMul(&r.X, &e, &f)
+	feMul(&r.Y, &g, &h)
+	feMul(&r.T, &e, &h)
+	feMul(&r.Z, &f, &g)
+}
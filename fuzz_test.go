@@ -0,0 +1,161 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Decode data that may be anything.  Decoding must never panic, and what
+// decodes must marshal and decode again to the same thing.
+func checkRoundTrip(test *testing.T, first IBlock, second IBlock, data []byte) {
+	if _, err := first.UnmarshalBinaryData(data); err != nil {
+		return
+	}
+	bin, err := first.MarshalBinary()
+	if err != nil {
+		test.Fatalf("Decoded %x, but could not marshal it: %v", data, err)
+	}
+	if _, err := second.UnmarshalBinaryData(bin); err != nil {
+		test.Fatalf("Marshaled %x, but could not decode it: %v", bin, err)
+	}
+	if first.IsEqual(second) != nil {
+		test.Fatalf("%x did not decode to the same thing twice", data)
+	}
+}
+
+// Add a valid encoding to the seeds, along with every way of cutting it
+// short.
+func addSeeds(f *testing.F, b IBlock) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(data)
+	for i := 0; i < len(data); i++ {
+		f.Add(data[:i])
+	}
+}
+
+func fuzzTransaction() ITransaction {
+	t := new(Transaction)
+	t.SetMilliTimestamp(1444444444444)
+	t.AddInput(nextAddress(), 1000)
+	t.AddRCD(NewRCD_1(nextSig()))
+	t.AddInput(nextAddress(), 2000)
+	t.AddRCD(nextAuth2())
+	t.AddOutput(nextAddress(), 1500)
+	t.AddECOutput(nextAddress(), 500)
+	return t
+}
+
+func FuzzTransaction(f *testing.F) {
+	addSeeds(f, fuzzTransaction())
+	addSeeds(f, new(Transaction))
+	v3 := fuzzTransaction()
+	v3.SetVersion(TRANSACTION_VERSION_SIGHASH)
+	v3.GetSignatureBlock(1).SetSigHashType(SIGHASH_SINGLE | SIGHASH_ANYONECANPAY)
+	addSeeds(f, v3)
+	claim := fuzzTransaction()
+	htlc, _ := NewRCD_4(nextSig(), 1000, nextSig(), nextSig())
+	claim.AddInput(nextAddress(), 3000)
+	claim.AddRCD(htlc)
+	claim.GetSignatureBlock(2).SetPreimage([]byte("preimage"))
+	addSeeds(f, claim)
+	f.Fuzz(func(test *testing.T, data []byte) {
+		checkRoundTrip(test, new(Transaction), new(Transaction), data)
+
+		// What decodes must be exactly what MarshalBinary() writes, or
+		// the cached bytes would not match the transaction.
+		t := new(Transaction)
+		rest, err := t.UnmarshalBinaryData(data)
+		if err != nil {
+			return
+		}
+		t.clearCaches()
+		if bin, _ := t.MarshalBinary(); !bytes.Equal(bin, data[:len(data)-len(rest)]) {
+			test.Fatalf("%x decoded, but marshals as %x", data, bin)
+		}
+	})
+}
+
+func FuzzRCD(f *testing.F) {
+	addSeeds(f, NewRCD_1(nextSig()))
+	addSeeds(f, nextAuth2())
+	lock, _ := NewRCD_3(LOCK_DBHEIGHT, 1000, NewRCD_1(nextSig()))
+	addSeeds(f, lock)
+	htlc, _ := NewRCD_4(nextSig(), 1000, nextSig(), nextSig())
+	addSeeds(f, htlc)
+	f.Fuzz(func(test *testing.T, data []byte) {
+		first, second := CreateRCD(data), CreateRCD(data)
+		if first == nil {
+			return
+		}
+		checkRoundTrip(test, first, second, data)
+	})
+}
+
+func FuzzAddress(f *testing.F) {
+	addSeeds(f, nextAddress())
+	f.Fuzz(func(test *testing.T, data []byte) {
+		checkRoundTrip(test, new(Address), new(Address), data)
+	})
+}
+
+func FuzzSignature(f *testing.F) {
+	sig := new(Signature)
+	sig.SetSignature(append(nextSig(), nextSig()...))
+	addSeeds(f, sig)
+	f.Fuzz(func(test *testing.T, data []byte) {
+		checkRoundTrip(test, new(Signature), new(Signature), data)
+	})
+}
+
+func Test_DecodeCanonicalVarInt(test *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 300, 1<<32 - 1, 1 << 56, 1 << 63, 1<<64 - 1} {
+		var out bytes.Buffer
+		EncodeVarInt(&out, v)
+		out.WriteByte(0x55)
+		d, rest, err := DecodeCanonicalVarInt(out.Bytes())
+		if err != nil || d != v || !bytes.Equal(rest, []byte{0x55}) {
+			Prtln("Failed to decode ", v, ": ", d, " ", err)
+			test.Fail()
+		}
+	}
+	bad := [][]byte{
+		{},
+		{0x81},                         // Ends inside the integer
+		{0x80, 0x01},                   // Not the shortest form of 1
+		{0x80, 0x80, 0x00},             // Nor of 0
+		bytes.Repeat([]byte{0xFF}, 10), // Past 64 bits
+		append(append([]byte{0x82}, bytes.Repeat([]byte{0x80}, 8)...), 0x00), // Also past 64 bits
+	}
+	for _, data := range bad {
+		if _, _, err := DecodeCanonicalVarInt(data); err == nil {
+			Prtln("Should not decode ", data)
+			test.Fail()
+		}
+	}
+}
+
+// Every truncation of a valid encoding is an error, not a panic.
+func Test_truncated_decodes(test *testing.T) {
+	sig := new(Signature)
+	sig.SetSignature(append(nextSig(), nextSig()...))
+	blocks := []IBlock{fuzzTransaction(), NewRCD_1(nextSig()), nextAuth2(), sig, nextAddress()}
+	for _, b := range blocks {
+		data, err := b.MarshalBinary()
+		if err != nil {
+			test.Fatal(err)
+		}
+		for i := 0; i < len(data); i++ {
+			if _, err := b.GetNewInstance().UnmarshalBinaryData(data[:i]); err == nil {
+				Prtln(b.GetDBHash(), ": decoded from ", i, " of ", len(data), " bytes")
+				test.Fail()
+			}
+		}
+	}
+}
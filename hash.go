@@ -46,6 +46,10 @@ func (Hash) GetHash() IHash {
 	return nil
 }
 
+func init() {
+	RegisterType(new(Hash))
+}
+
 func (w1 Hash) GetDBHash() IHash {
 	return Sha([]byte("Hash"))
 }
@@ -101,9 +105,8 @@ func (h Hash) MarshalBinary() ([]byte, error) {
 }
 
 func (h *Hash) UnmarshalBinary(p []byte) error {
-	h.hash = *new([32]byte)
-	copy(h.hash[:], p)
-	return nil
+	_, err := h.UnmarshalBinaryData(p)
+	return err
 }
 
 // Make a copy of the hash in this hash.  Changes to the return value WILL NOT be
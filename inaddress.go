@@ -25,6 +25,10 @@ func (b InAddress) String() string {
 	return string(txt)
 }
 
+func init() {
+	RegisterType(new(InAddress))
+}
+
 func (InAddress) GetDBHash() IHash {
 	return Sha([]byte("InAddress"))
 }
@@ -25,6 +25,10 @@ func (b OutAddress) String() string {
 	return string(txt)
 }
 
+func init() {
+	RegisterType(new(OutAddress))
+}
+
 func (OutAddress) GetDBHash() IHash {
 	return Sha([]byte("OutAddress"))
 }
@@ -28,6 +28,10 @@ func (b OutECAddress) String() string {
 	return string(txt)
 }
 
+func init() {
+	RegisterType(new(OutECAddress))
+}
+
 func (OutECAddress) GetDBHash() IHash {
 	return Sha([]byte("OutECAddress"))
 }
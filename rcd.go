@@ -19,7 +19,8 @@ type IRCD interface {
 	GetAddress() (IAddress, error)
 	Clone() IRCD
 	NumberOfSignatures() int
-	CheckSig(trans ITransaction, sigblk ISignatureBlock) bool
+	// Check the signatures of the given input of the transaction.
+	CheckSig(trans ITransaction, input int, sigblk ISignatureBlock) bool
 }
 
 /***********************
@@ -36,6 +37,10 @@ func UnmarshalBinaryAuth(data []byte) (a IRCD, newData []byte, err error) {
 		auth = new(RCD_1)
 	case 2:
 		auth = new(RCD_2)
+	case 3:
+		auth = new(RCD_3)
+	case 4:
+		auth = new(RCD_4)
 	default:
 		return nil, nil, fmt.Errorf("Invalid type byte for authorizations: %x ", int(t))
 	}
@@ -66,13 +71,22 @@ func NewRCD_2(n int, m int, addresses []IAddress) (IRCD, error) {
 	return au, nil
 }
 
+// Create an empty RCD of the type given by the first byte of data, or nil
+// if data does not start with a known type.
 func CreateRCD(data []byte) IRCD {
+	if len(data) == 0 {
+		return nil
+	}
 	switch data[0] {
 	case 1:
 		return new(RCD_1)
 	case 2:
 		return new(RCD_2)
+	case 3:
+		return new(RCD_3)
+	case 4:
+		return new(RCD_4)
 	default:
-		panic("Bad Data encountered by CreateRCD.  Should never happen")
+		return nil
 	}
 }
@@ -40,7 +40,7 @@ func (b RCD_1) GetHash() IHash {
  *       Methods
  ***************************************/
 
-func (b RCD_1) UnmarshalBinary(data []byte) error {
+func (b *RCD_1) UnmarshalBinary(data []byte) error {
 	_, err := b.UnmarshalBinaryData(data)
 	return err
 }
@@ -52,19 +52,11 @@ func (b RCD_1) String() string {
 	return string(txt)
 }
 
-func (w RCD_1) CheckSig(trans ITransaction, sigblk ISignatureBlock) bool {
+func (w RCD_1) CheckSig(trans ITransaction, input int, sigblk ISignatureBlock) bool {
 	if sigblk == nil {
 		return false
 	}
-	data, err := trans.MarshalBinarySig()
-	if err != nil {
-		return false
-	}
-	signature := sigblk.GetSignature(0)
-	if signature == nil {
-		return false
-	}
-	cryptosig := signature.GetSignature()
+	data, cryptosig := signedData(trans, input, sigblk)
 	if cryptosig == nil {
 		return false
 	}
@@ -84,6 +76,10 @@ func (w RCD_1) GetAddress() (IAddress, error) {
 	return CreateAddress(Shad(data)), nil
 }
 
+func init() {
+	RegisterType(new(RCD_1))
+}
+
 func (RCD_1) GetDBHash() IHash {
 	return Sha([]byte("RCD_1"))
 }
@@ -113,6 +109,9 @@ func (a1 *RCD_1) IsEqual(addr IBlock) []IBlock {
 
 func (t *RCD_1) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 
+	if len(data) == 0 {
+		return nil, fmt.Errorf("No data to unmarshal an RCD_1")
+	}
 	typ := int8(data[0])
 	data = data[1:]
 
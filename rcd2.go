@@ -50,12 +50,12 @@ func (b RCD_2) NumberOfSignatures() int {
  *       Methods
  ***************************************/
 
-func (b RCD_2) UnmarshalBinary(data []byte) error {
+func (b *RCD_2) UnmarshalBinary(data []byte) error {
 	_, err := b.UnmarshalBinaryData(data)
 	return err
 }
 
-func (b RCD_2) CheckSig(trans ITransaction, sigblk ISignatureBlock) bool {
+func (b RCD_2) CheckSig(trans ITransaction, input int, sigblk ISignatureBlock) bool {
 	return false
 }
 
@@ -78,6 +78,10 @@ func (w RCD_2) Clone() IRCD {
 	return c
 }
 
+func init() {
+	RegisterType(new(RCD_2))
+}
+
 func (RCD_2) GetDBHash() IHash {
 	return Sha([]byte("RCD_2"))
 }
@@ -108,6 +112,9 @@ func (a1 *RCD_2) IsEqual(addr IBlock) []IBlock {
 
 func (t *RCD_2) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 
+	if len(data) < 5 {
+		return nil, fmt.Errorf("Data source too short to unmarshal an RCD_2: %d", len(data))
+	}
 	typ := int8(data[0])
 	data = data[1:]
 	if typ != 2 {
@@ -116,6 +123,9 @@ func (t *RCD_2) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 
 	t.n, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
 	t.m, data = int(binary.BigEndian.Uint16(data[0:2])), data[2:]
+	if len(data) < t.m*ADDRESS_LENGTH {
+		return nil, fmt.Errorf("Data source too short for the %d addresses of an RCD_2: %d", t.m, len(data))
+	}
 
 	t.n_addresses = make([]IAddress, t.m, t.m)
 
@@ -0,0 +1,236 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/**************************
+ * RCD_3 Time Lock
+ **************************/
+
+// A time lock wraps another RCD.  Its address can't be spent from until the
+// lock expires, and after that it is spent just as the inner RCD would be.
+// The lock is either an absolute directory block height, or a time in
+// milliseconds compared to the coinbase timestamp of the block.
+//
+//   type byte 3, lock kind byte, 8 byte lock value, inner RCD
+//
+// The lock is part of the address, so the same key locked until different
+// heights gives different addresses; a vesting schedule is a set of them.
+
+type LockKind byte
+
+const (
+	LOCK_DBHEIGHT  LockKind = 0 // Locked until a directory block height
+	LOCK_MILLITIME LockKind = 1 // Locked until a time in milliseconds
+)
+
+func (k LockKind) IsValid() bool {
+	return k == LOCK_DBHEIGHT || k == LOCK_MILLITIME
+}
+
+func (k LockKind) String() string {
+	switch k {
+	case LOCK_DBHEIGHT:
+		return "dbheight"
+	case LOCK_MILLITIME:
+		return "millitime"
+	}
+	return fmt.Sprintf("lock %#x", byte(k))
+}
+
+type IRCD_3 interface {
+	IRCD
+	GetLockKind() LockKind
+	GetLockValue() uint64
+	GetInnerRCD() IRCD
+	// True if the inputs of the address can be spent in a block of the
+	// given height and coinbase timestamp.
+	IsUnlocked(dbheight uint32, milliTime uint64) bool
+}
+
+type RCD_3 struct {
+	kind  LockKind
+	value uint64
+	inner IRCD
+}
+
+var _ IRCD_3 = (*RCD_3)(nil)
+
+// The type byte and the lock.
+const RCD_3_HEADER_LENGTH = 10
+
+func NewRCD_3(kind LockKind, value uint64, inner IRCD) (IRCD, error) {
+	if !kind.IsValid() {
+		return nil, fmt.Errorf("Invalid lock kind: %d", kind)
+	}
+	if !isSignatureRCD(inner) {
+		return nil, fmt.Errorf("A time lock must hold a signature RCD")
+	}
+	return &RCD_3{kind, value, inner.Clone()}, nil
+}
+
+// Only RCDs that are spent by signatures alone can be locked.  Locks don't
+// nest, and an RCD_4 has a lock of its own.
+func isSignatureRCD(rcd IRCD) bool {
+	switch rcd.(type) {
+	case *RCD_1, *RCD_2:
+		return true
+	}
+	return false
+}
+
+/*************************************
+ *       Stubs
+ *************************************/
+
+func (b RCD_3) GetHash() IHash {
+	return nil
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+func (b *RCD_3) UnmarshalBinary(data []byte) error {
+	_, err := b.UnmarshalBinaryData(data)
+	return err
+}
+
+func (b RCD_3) String() string {
+	txt, err := b.CustomMarshalText()
+	if err != nil {
+		return "<error>"
+	}
+	return string(txt)
+}
+
+func (b RCD_3) GetLockKind() LockKind {
+	return b.kind
+}
+
+func (b RCD_3) GetLockValue() uint64 {
+	return b.value
+}
+
+func (b RCD_3) GetInnerRCD() IRCD {
+	return b.inner
+}
+
+func (b RCD_3) IsUnlocked(dbheight uint32, milliTime uint64) bool {
+	if b.kind == LOCK_DBHEIGHT {
+		return uint64(dbheight) >= b.value
+	}
+	return milliTime >= b.value
+}
+
+// The lock is checked against the block by the Factoid State; the
+// signatures are those of the inner RCD.
+func (b RCD_3) CheckSig(trans ITransaction, input int, sigblk ISignatureBlock) bool {
+	return b.inner.CheckSig(trans, input, sigblk)
+}
+
+func (b RCD_3) Clone() IRCD {
+	c := new(RCD_3)
+	c.kind = b.kind
+	c.value = b.value
+	c.inner = b.inner.Clone()
+	return c
+}
+
+func (b RCD_3) GetAddress() (IAddress, error) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return CreateAddress(Shad(data)), nil
+}
+
+func init() {
+	RegisterType(new(RCD_3))
+}
+
+func (RCD_3) GetDBHash() IHash {
+	return Sha([]byte("RCD_3"))
+}
+
+func (RCD_3) GetNewInstance() IBlock {
+	return new(RCD_3)
+}
+
+func (b RCD_3) NumberOfSignatures() int {
+	return b.inner.NumberOfSignatures()
+}
+
+func (a1 *RCD_3) IsEqual(addr IBlock) []IBlock {
+	a2, ok := addr.(*RCD_3)
+	if !ok || a1.kind != a2.kind || a1.value != a2.value {
+		r := make([]IBlock, 0, 5)
+		return append(r, a1)
+	}
+	if r := a1.inner.IsEqual(a2.inner); r != nil {
+		return append(r, a1)
+	}
+	return nil
+}
+
+func (t *RCD_3) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if len(data) < RCD_3_HEADER_LENGTH {
+		return nil, fmt.Errorf("Data source too short to unmarshal an RCD_3: %d", len(data))
+	}
+	if data[0] != 3 {
+		return nil, fmt.Errorf("Bad type byte: %d", data[0])
+	}
+	t.kind = LockKind(data[1])
+	if !t.kind.IsValid() {
+		return nil, fmt.Errorf("Invalid lock kind: %d", data[1])
+	}
+	t.value = binary.BigEndian.Uint64(data[2:RCD_3_HEADER_LENGTH])
+	data = data[RCD_3_HEADER_LENGTH:]
+
+	t.inner = CreateRCD(data)
+	if !isSignatureRCD(t.inner) {
+		return nil, fmt.Errorf("Missing or unknown RCD in an RCD_3")
+	}
+	return t.inner.UnmarshalBinaryData(data)
+}
+
+func (a RCD_3) MarshalBinary() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte(byte(3))
+	out.WriteByte(byte(a.kind))
+	binary.Write(&out, binary.BigEndian, a.value)
+
+	data, err := a.inner.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	out.Write(data)
+
+	return out.Bytes(), nil
+}
+
+func (a RCD_3) CustomMarshalText() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString(" RCD 3: ")
+	WriteNumber8(&out, uint8(3)) // Type 3 Authorization
+	out.WriteString(" locked until ")
+	out.WriteString(a.kind.String())
+	out.WriteString(" ")
+	WriteNumber64(&out, a.value)
+	out.WriteString("\n")
+
+	data, err := a.inner.CustomMarshalText()
+	if err != nil {
+		return nil, err
+	}
+	out.Write(data)
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/FactomProject/ed25519"
+)
+
+/**************************
+ * RCD_4 Hash Time Lock
+ **************************/
+
+// A hash time locked contract, for atomic swaps.  The address can be spent
+// two ways:
+//
+//   Claim:   the recipient signs, and the signature block reveals a
+//            preimage whose SHA-256 is the hash of the contract.
+//   Refund:  the sender signs, in a block at or after the refund height.
+//
+// The preimage follows the signature in the signature block of the input,
+// as a length byte and the preimage.  A length of zero is a refund.  The
+// refund height is checked by the Factoid State, like an RCD_3 time lock.
+//
+//   type byte 4, 32 byte hash, 4 byte refund height, recipient key, sender key
+
+type IRCD_4 interface {
+	IRCD
+	GetHashLock() []byte
+	GetRefundHeight() uint32
+	GetRecipientKey() []byte
+	GetSenderKey() []byte
+	// True if the sender can take the funds back in a block at the
+	// given height.
+	IsRefundable(dbheight uint32) bool
+}
+
+type RCD_4 struct {
+	hash         [ADDRESS_LENGTH]byte // SHA-256 of the preimage
+	refundHeight uint32
+	recipient    [ADDRESS_LENGTH]byte // Public key that claims with the preimage
+	sender       [ADDRESS_LENGTH]byte // Public key that takes a refund
+}
+
+var _ IRCD_4 = (*RCD_4)(nil)
+
+const (
+	RCD_4_LENGTH        = 1 + ADDRESS_LENGTH + 4 + 2*ADDRESS_LENGTH
+	MAX_PREIMAGE_LENGTH = 32 // The size swaps with other chains use
+)
+
+func NewRCD_4(hash []byte, refundHeight uint32, recipient []byte, sender []byte) (IRCD, error) {
+	if len(hash) != ADDRESS_LENGTH || len(recipient) != ADDRESS_LENGTH || len(sender) != ADDRESS_LENGTH {
+		return nil, fmt.Errorf("Bad hash or public keys for an RCD_4")
+	}
+	a := new(RCD_4)
+	copy(a.hash[:], hash)
+	a.refundHeight = refundHeight
+	copy(a.recipient[:], recipient)
+	copy(a.sender[:], sender)
+	return a, nil
+}
+
+// Check that a preimage can claim an RCD_4 with the given hash.
+func CheckPreimage(hash []byte, preimage []byte) bool {
+	if len(preimage) == 0 || len(preimage) > MAX_PREIMAGE_LENGTH {
+		return false
+	}
+	h := sha256.Sum256(preimage)
+	return bytes.Equal(h[:], hash)
+}
+
+/*************************************
+ *       Stubs
+ *************************************/
+
+func (b RCD_4) GetHash() IHash {
+	return nil
+}
+
+/***************************************
+ *       Methods
+ ***************************************/
+
+func (b *RCD_4) UnmarshalBinary(data []byte) error {
+	_, err := b.UnmarshalBinaryData(data)
+	return err
+}
+
+func (b RCD_4) String() string {
+	txt, err := b.CustomMarshalText()
+	if err != nil {
+		return "<error>"
+	}
+	return string(txt)
+}
+
+func (b RCD_4) GetHashLock() []byte {
+	return b.hash[:]
+}
+
+func (b RCD_4) GetRefundHeight() uint32 {
+	return b.refundHeight
+}
+
+func (b RCD_4) GetRecipientKey() []byte {
+	return b.recipient[:]
+}
+
+func (b RCD_4) GetSenderKey() []byte {
+	return b.sender[:]
+}
+
+func (b RCD_4) IsRefundable(dbheight uint32) bool {
+	return dbheight >= b.refundHeight
+}
+
+// A signature block with a preimage is a claim, and must be signed by the
+// recipient.  Without one it is a refund, and must be signed by the sender.
+func (b RCD_4) CheckSig(trans ITransaction, input int, sigblk ISignatureBlock) bool {
+	if sigblk == nil {
+		return false
+	}
+	key := &b.sender
+	if preimage := sigblk.GetPreimage(); len(preimage) > 0 {
+		if !CheckPreimage(b.hash[:], preimage) {
+			return false
+		}
+		key = &b.recipient
+	}
+	data, cryptosig := signedData(trans, input, sigblk)
+	if cryptosig == nil {
+		return false
+	}
+
+	return ed25519.VerifyCanonical(key, data, cryptosig)
+}
+
+func (b RCD_4) Clone() IRCD {
+	c := b
+	return &c
+}
+
+func (b RCD_4) GetAddress() (IAddress, error) {
+	data, err := b.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return CreateAddress(Shad(data)), nil
+}
+
+func init() {
+	RegisterType(new(RCD_4))
+}
+
+func (RCD_4) GetDBHash() IHash {
+	return Sha([]byte("RCD_4"))
+}
+
+func (RCD_4) GetNewInstance() IBlock {
+	return new(RCD_4)
+}
+
+func (b RCD_4) NumberOfSignatures() int {
+	return 1
+}
+
+func (a1 *RCD_4) IsEqual(addr IBlock) []IBlock {
+	a2, ok := addr.(*RCD_4)
+	if !ok || *a1 != *a2 {
+		r := make([]IBlock, 0, 5)
+		return append(r, a1)
+	}
+	return nil
+}
+
+func (t *RCD_4) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if len(data) < RCD_4_LENGTH {
+		return nil, fmt.Errorf("Data source too short to unmarshal an RCD_4: %d", len(data))
+	}
+	if data[0] != 4 {
+		return nil, fmt.Errorf("Bad type byte: %d", data[0])
+	}
+	data = data[1:]
+
+	copy(t.hash[:], data[:ADDRESS_LENGTH])
+	data = data[ADDRESS_LENGTH:]
+	t.refundHeight, data = binary.BigEndian.Uint32(data[:4]), data[4:]
+	copy(t.recipient[:], data[:ADDRESS_LENGTH])
+	data = data[ADDRESS_LENGTH:]
+	copy(t.sender[:], data[:ADDRESS_LENGTH])
+	data = data[ADDRESS_LENGTH:]
+
+	return data, nil
+}
+
+func (a RCD_4) MarshalBinary() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte(byte(4))
+	out.Write(a.hash[:])
+	binary.Write(&out, binary.BigEndian, a.refundHeight)
+	out.Write(a.recipient[:])
+	out.Write(a.sender[:])
+
+	return out.Bytes(), nil
+}
+
+func (a RCD_4) CustomMarshalText() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteString(" RCD 4: ")
+	WriteNumber8(&out, uint8(4)) // Type 4 Authorization
+	out.WriteString("\n  hash:      ")
+	out.WriteString(hex.EncodeToString(a.hash[:]))
+	out.WriteString("\n  refund at: ")
+	WriteNumber32(&out, a.refundHeight)
+	out.WriteString("\n  recipient: ")
+	out.WriteString(hex.EncodeToString(a.recipient[:]))
+	out.WriteString("\n  sender:    ")
+	out.WriteString(hex.EncodeToString(a.sender[:]))
+	out.WriteString("\n")
+
+	return out.Bytes(), nil
+}
@@ -5,6 +5,7 @@
 package factoid
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/FactomProject/ed25519"
 	"math/rand"
@@ -32,3 +33,149 @@ func Test_Auth2_Equals(test *testing.T) {
 		test.Fail()
 	}
 }
+
+func Test_RCD_3(test *testing.T) {
+	inner, private := nextKey()
+	if _, err := NewRCD_3(LockKind(2), 1000, inner); err == nil {
+		test.Fail()
+	}
+	rcd, err := NewRCD_3(LOCK_DBHEIGHT, 1000, inner)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := NewRCD_3(LOCK_DBHEIGHT, 1000, rcd); err == nil {
+		Prtln("Time locks should not nest")
+		test.Fail()
+	}
+
+	// The lock is part of the address.
+	adr, _ := rcd.GetAddress()
+	inadr, _ := inner.GetAddress()
+	later, _ := NewRCD_3(LOCK_DBHEIGHT, 1001, inner)
+	ladr, _ := later.GetAddress()
+	if adr.IsSameAs(inadr) || adr.IsSameAs(ladr) {
+		Prtln("A time lock should have its own address")
+		test.Fail()
+	}
+
+	data, _ := rcd.MarshalBinary()
+	rcd2, rest, err := UnmarshalBinaryAuth(data)
+	if err != nil || len(rest) != 0 || rcd.IsEqual(rcd2) != nil || rcd.IsEqual(later) == nil {
+		Prtln("RCD_3 did not round trip: ", err)
+		test.Fail()
+	}
+	for _, bad := range [][]byte{data[:RCD_3_HEADER_LENGTH], data[:len(data)-1]} {
+		if _, err := CreateRCD(bad).UnmarshalBinaryData(bad); err == nil {
+			Prtln("Decoded a truncated RCD_3")
+			test.Fail()
+		}
+	}
+
+	lock := rcd2.(IRCD_3)
+	if lock.IsUnlocked(999, 1<<40) || !lock.IsUnlocked(1000, 0) {
+		Prtln("The height lock is wrong")
+		test.Fail()
+	}
+	tlock, _ := NewRCD_3(LOCK_MILLITIME, 1000, inner)
+	if tlock.(IRCD_3).IsUnlocked(1<<31, 999) || !tlock.(IRCD_3).IsUnlocked(0, 1000) {
+		Prtln("The time lock is wrong")
+		test.Fail()
+	}
+
+	// Spent with the signature of the inner RCD
+	t := new(Transaction)
+	t.SetMilliTimestamp(1000)
+	t.AddInput(adr, 1000)
+	t.AddRCD(rcd)
+	t.AddOutput(nextAddress(), 900)
+	signInput(t, 0, private, SIGHASH_ALL)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	tdata, _ := t.MarshalBinary()
+	t2 := new(Transaction)
+	if err := t2.UnmarshalBinary(tdata); err != nil || t.IsEqual(t2) != nil {
+		Prtln("A transaction with an RCD_3 did not round trip: ", err)
+		test.Fail()
+	}
+}
+
+func Test_RCD_4(test *testing.T) {
+	recipient, rprivate := nextKey()
+	sender, sprivate := nextKey()
+	preimage := []byte("the secret of the swap")
+	hash := Sha(preimage).Bytes()
+	rcd, err := NewRCD_4(hash, 1000, recipient.(IRCD_1).GetPublicKey(), sender.(IRCD_1).GetPublicKey())
+	if err != nil {
+		test.Fatal(err)
+	}
+	data, _ := rcd.MarshalBinary()
+	rcd2, rest, err := UnmarshalBinaryAuth(data)
+	if err != nil || len(rest) != 0 || rcd.IsEqual(rcd2) != nil || len(data) != RCD_4_LENGTH {
+		Prtln("RCD_4 did not round trip: ", err)
+		test.Fail()
+	}
+	if _, err := CreateRCD(data).UnmarshalBinaryData(data[:len(data)-1]); err == nil {
+		Prtln("Decoded a truncated RCD_4")
+		test.Fail()
+	}
+	if _, err := NewRCD_3(LOCK_DBHEIGHT, 1000, rcd); err == nil {
+		Prtln("A time lock should not hold a hash time lock")
+		test.Fail()
+	}
+	if rcd.(IRCD_4).IsRefundable(999) || !rcd.(IRCD_4).IsRefundable(1000) {
+		test.Fail()
+	}
+
+	adr, _ := rcd.GetAddress()
+	t := new(Transaction)
+	t.SetMilliTimestamp(1000)
+	t.AddInput(adr, 1000)
+	t.AddRCD(rcd)
+	t.AddOutput(nextAddress(), 900)
+
+	// The recipient claims with the preimage.
+	signInput(t, 0, rprivate, SIGHASH_ALL)
+	t.GetSignatureBlock(0).SetPreimage(preimage)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	tdata, _ := t.MarshalBinary()
+	t2 := new(Transaction)
+	if err := t2.UnmarshalBinary(tdata); err != nil || t.IsEqual(t2) != nil ||
+		!bytes.Equal(t2.GetSignatureBlock(0).GetPreimage(), preimage) {
+		Prtln("A claim did not round trip: ", err)
+		test.Fail()
+	}
+	bad := append([]byte{}, tdata...)
+	bad[len(bad)-len(preimage)-1] = MAX_PREIMAGE_LENGTH + 1
+	if err := new(Transaction).UnmarshalBinary(bad); err == nil {
+		Prtln("Decoded a preimage that is too long")
+		test.Fail()
+	}
+
+	// Without the preimage, only the sender's signature counts.
+	t.GetSignatureBlock(0).SetPreimage([]byte("a guess"))
+	if t.ValidateSignatures() == nil {
+		Prtln("Claimed with the wrong preimage")
+		test.Fail()
+	}
+	t.GetSignatureBlock(0).SetPreimage(nil)
+	if t.ValidateSignatures() == nil {
+		Prtln("Refunded with the recipient's signature")
+		test.Fail()
+	}
+	signInput(t, 0, sprivate, SIGHASH_ALL)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	tdata, _ = t.MarshalBinary()
+	t3 := new(Transaction)
+	if err := t3.UnmarshalBinary(tdata); err != nil || len(t3.GetSignatureBlock(0).GetPreimage()) != 0 {
+		Prtln("A refund did not round trip: ", err)
+		test.Fail()
+	}
+}
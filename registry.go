@@ -0,0 +1,73 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Every IBlock that is stored or sent registers itself here under its
+// GetDBHash(), usually from an init() next to its GetDBHash() method.
+// Anything that has the type hash and the binary of an IBlock can then
+// get the IBlock back with Decode(), without keeping its own map of
+// instances.
+var registry = make(map[[ADDRESS_LENGTH]byte]reflect.Type)
+var registryLock sync.RWMutex
+
+// Register an IBlock type, given a pointer to an instance of it.  Two types
+// that return the same GetDBHash() can't both be registered; that is a bug,
+// so RegisterType panics.  Registering the same type twice does nothing.
+func RegisterType(b IBlock) {
+	t := reflect.TypeOf(b)
+	if t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("RegisterType() requires a pointer, not a %v", t))
+	}
+	var hash [ADDRESS_LENGTH]byte
+	copy(hash[:], b.GetDBHash().Bytes())
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if other, ok := registry[hash]; ok && other != t.Elem() {
+		panic(fmt.Sprintf("%v and %v have the same type hash %x", other, t.Elem(), hash))
+	}
+	registry[hash] = t.Elem()
+}
+
+// A new instance of the type registered under the type hash, or nil if
+// no type is.
+func GetRegisteredType(hash [ADDRESS_LENGTH]byte) IBlock {
+	registryLock.RLock()
+	t, ok := registry[hash]
+	registryLock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return reflect.New(t).Interface().(IBlock)
+}
+
+// Maps the type hash of every registered type to an instance of it.
+func GetRegisteredTypes() map[[ADDRESS_LENGTH]byte]IBlock {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	types := make(map[[ADDRESS_LENGTH]byte]IBlock, len(registry))
+	for hash, t := range registry {
+		types[hash] = reflect.New(t).Interface().(IBlock)
+	}
+	return types
+}
+
+// Build the IBlock of the given type from its binary.
+func Decode(typeHash [ADDRESS_LENGTH]byte, data []byte) (IBlock, error) {
+	b := GetRegisteredType(typeHash)
+	if b == nil {
+		return nil, fmt.Errorf("No IBlock type is registered for the type hash %x", typeHash)
+	}
+	if err := b.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%T failed to unmarshal: %s", b, err.Error())
+	}
+	return b, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"testing"
+)
+
+// Claims the type hash of an Address.
+type fakeAddress struct {
+	Address
+}
+
+func (fakeAddress) GetDBHash() IHash {
+	return Sha([]byte("Address"))
+}
+
+func typeHash(b IBlock) (hash [ADDRESS_LENGTH]byte) {
+	copy(hash[:], b.GetDBHash().Bytes())
+	return
+}
+
+func expectPanic(test *testing.T, what string, f func()) {
+	defer func() {
+		if recover() == nil {
+			Prtln(what, " should panic")
+			test.Fail()
+		}
+	}()
+	f()
+}
+
+func Test_RegisterType(test *testing.T) {
+	// Registering a type again does nothing.
+	RegisterType(new(Address))
+
+	expectPanic(test, "Registering a duplicate type hash", func() {
+		RegisterType(new(fakeAddress))
+	})
+
+	if _, ok := GetRegisteredType(typeHash(new(Address))).(*Address); !ok {
+		Prtln("The registry lost the Address type")
+		test.Fail()
+	}
+	types := GetRegisteredTypes()
+	for _, b := range []IBlock{new(Address), new(Hash), new(RCD_1), new(RCD_2), new(Signature),
+		new(SignatureBlock), new(InAddress), new(OutAddress), new(OutECAddress),
+		new(TransAddress), new(Transaction)} {
+		if types[typeHash(b)] == nil {
+			Prtln(b.GetDBHash().String(), " is not registered")
+			test.Fail()
+		}
+	}
+}
+
+func Test_Decode(test *testing.T) {
+	a := NewAddress(address1[:])
+	data, err := a.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	b, err := Decode(typeHash(a), data)
+	if err != nil || a.IsEqual(b) != nil {
+		Prtln("Decode() did not return the Address: ", err)
+		test.Fail()
+	}
+
+	rcd := NewRCD_1(address2[:])
+	data, err = rcd.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if b, err := Decode(typeHash(rcd), data); err != nil || rcd.IsEqual(b) != nil {
+		Prtln("Decode() did not return the RCD_1: ", err)
+		test.Fail()
+	}
+	if _, err := Decode(typeHash(rcd), data[:5]); err == nil {
+		Prtln("Decode() should fail on short data")
+		test.Fail()
+	}
+	var unknown [ADDRESS_LENGTH]byte
+	if _, err := Decode(unknown, data); err == nil {
+		Prtln("Decode() should fail on an unknown type hash")
+		test.Fail()
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+)
+
+/**************************************
+ * Sighash types
+ *
+ * https://github.com/FactomProject/FactomDocs/blob/master/factomDataStructureDetails.md#sighash-type
+ *
+ * A sighash type says what part of a transaction a signature covers.
+ * SIGHASH_ALL covers all the inputs and outputs, and is the only type a
+ * version 2 transaction has.  In a version 3 transaction each signature
+ * block starts with its sighash type, so signers can commit to less:
+ *
+ *   SIGHASH_SINGLE covers all the inputs, but only the output with the
+ *   same index as the input signed, and none of the Entry Credit outputs.
+ *
+ *   SIGHASH_ANYONECANPAY, added to either, covers only the input signed
+ *   of the inputs, so others can add inputs of their own.  Crowdfunding
+ *   is ALL|ANYONECANPAY.
+ **************************************/
+
+type SigHashType byte
+
+const (
+	SIGHASH_ALL          SigHashType = 0x01
+	SIGHASH_SINGLE       SigHashType = 0x03
+	SIGHASH_ANYONECANPAY SigHashType = 0x80
+)
+
+const (
+	TRANSACTION_VERSION         = 2 // All signatures are SIGHASH_ALL
+	TRANSACTION_VERSION_SIGHASH = 3 // Signature blocks carry a sighash type
+)
+
+// The type without the SIGHASH_ANYONECANPAY flag.
+func (h SigHashType) Base() SigHashType {
+	return h &^ SIGHASH_ANYONECANPAY
+}
+
+func (h SigHashType) AnyoneCanPay() bool {
+	return h&SIGHASH_ANYONECANPAY != 0
+}
+
+func (h SigHashType) IsValid() bool {
+	return h.Base() == SIGHASH_ALL || h.Base() == SIGHASH_SINGLE
+}
+
+func (h SigHashType) String() string {
+	var name string
+	switch h.Base() {
+	case SIGHASH_ALL:
+		name = "ALL"
+	case SIGHASH_SINGLE:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("sighash %#x", byte(h))
+	}
+	if h.AnyoneCanPay() {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"github.com/FactomProject/ed25519"
+	"testing"
+)
+
+// Sign input i of the transaction with the given sighash type.
+func signInput(t ITransaction, i int, private *[64]byte, h SigHashType) error {
+	data, err := t.MarshalBinarySigHash(i, h)
+	if err != nil {
+		return err
+	}
+	sig := new(Signature)
+	sig.SetSignature(ed25519.Sign(private, data)[:])
+	sigblk := new(SignatureBlock)
+	sigblk.AddSignature(sig)
+	sigblk.SetSigHashType(h)
+	t.SetSignatureBlock(i, sigblk)
+	return nil
+}
+
+func addKeyInput(t ITransaction, amount uint64) *[64]byte {
+	rcd, private := nextKey()
+	adr, _ := rcd.GetAddress()
+	t.AddInput(adr, amount)
+	t.AddRCD(rcd)
+	return private
+}
+
+func Test_SigHashType(test *testing.T) {
+	valid := map[SigHashType]string{
+		SIGHASH_ALL:                           "ALL",
+		SIGHASH_SINGLE:                        "SINGLE",
+		SIGHASH_ALL | SIGHASH_ANYONECANPAY:    "ALL|ANYONECANPAY",
+		SIGHASH_SINGLE | SIGHASH_ANYONECANPAY: "SINGLE|ANYONECANPAY",
+	}
+	for h, name := range valid {
+		if !h.IsValid() || h.String() != name {
+			Prtln(h, " should be a valid ", name)
+			test.Fail()
+		}
+	}
+	for _, h := range []SigHashType{0, 2, SIGHASH_ANYONECANPAY, 0x41} {
+		if h.IsValid() {
+			Prtln(h, " should not be valid")
+			test.Fail()
+		}
+	}
+}
+
+// Only a version 3 transaction has sighash types, and it marshals them.
+func Test_SigHash_versions(test *testing.T) {
+	t := new(Transaction)
+	t.SetMilliTimestamp(1000)
+	private := addKeyInput(t, 1000)
+	t.AddOutput(nextAddress(), 900)
+
+	if err := signInput(t, 0, private, SIGHASH_SINGLE); err == nil {
+		Prtln("A version 2 transaction was signed SIGHASH_SINGLE")
+		test.Fail()
+	}
+	signInput(t, 0, private, SIGHASH_ALL)
+	v2, _ := t.MarshalBinary()
+	t.GetSignatureBlock(0).SetSigHashType(SIGHASH_SINGLE)
+	if _, err := t.MarshalBinary(); err == nil {
+		Prtln("A version 2 transaction marshaled a sighash type")
+		test.Fail()
+	}
+
+	if err := t.SetVersion(4); err == nil {
+		test.Fail()
+	}
+	t.SetVersion(TRANSACTION_VERSION_SIGHASH)
+	signInput(t, 0, private, SIGHASH_SINGLE|SIGHASH_ANYONECANPAY)
+	v3, err := t.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(v3) != len(v2)+1 {
+		Prtln("Version 3 should add a byte per signature block: ", len(v2), " ", len(v3))
+		test.Fail()
+	}
+
+	t2 := new(Transaction)
+	if err := t2.UnmarshalBinary(v3); err != nil {
+		test.Fatal(err)
+	}
+	if t.IsEqual(t2) != nil || t2.GetVersion() != TRANSACTION_VERSION_SIGHASH ||
+		t2.GetSignatureBlock(0).GetSigHashType() != SIGHASH_SINGLE|SIGHASH_ANYONECANPAY {
+		Prtln("Version 3 did not decode to the same transaction")
+		test.Fail()
+	}
+	if err := t2.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	t2.clearCaches()
+	if again, _ := t2.MarshalBinary(); !bytes.Equal(again, v3) {
+		test.Fail()
+	}
+
+	// An unknown sighash type does not decode.
+	bad := append([]byte{}, v3...)
+	bad[len(bad)-SIGNATURE_LENGTH-1] = 0x02
+	if err := new(Transaction).UnmarshalBinary(bad); err == nil {
+		Prtln("Decoded an unknown sighash type")
+		test.Fail()
+	}
+}
+
+// Contributors each sign their own input with ALL|ANYONECANPAY, so inputs
+// can be added after they sign.
+func Test_SigHash_crowdfunding(test *testing.T) {
+	t := new(Transaction)
+	t.SetVersion(TRANSACTION_VERSION_SIGHASH)
+	t.SetMilliTimestamp(1000)
+	t.AddOutput(nextAddress(), 100000000)
+
+	acp := SIGHASH_ALL | SIGHASH_ANYONECANPAY
+	private1 := addKeyInput(t, 60000000)
+	signInput(t, 0, private1, acp)
+	private2 := addKeyInput(t, 60000000)
+	signInput(t, 1, private2, acp)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+
+	// A plain SIGHASH_ALL signature is broken by a new input.
+	private3 := addKeyInput(t, 1000)
+	signInput(t, 2, private3, SIGHASH_ALL)
+	addKeyInput(t, 1000)
+	if err := t.ValidateSignatures(); err == nil {
+		Prtln("Adding an input should break a SIGHASH_ALL signature")
+		test.Fail()
+	} else if err.(*ValidationError).Input != 2 {
+		Prtln("Expected input 2 to fail, got: ", err)
+		test.Fail()
+	}
+
+	// No sighash type lets the outputs change.
+	t.GetOutputs()[0].SetAmount(200000000)
+	for i := 0; i < 2; i++ {
+		if t.GetRCDs()[i].CheckSig(t, i, t.GetSignatureBlock(i)) {
+			Prtln("Changing the output should break the signature of input ", i)
+			test.Fail()
+		}
+	}
+}
+
+// SIGHASH_SINGLE covers the output of the same index, and no others.
+func Test_SigHash_single(test *testing.T) {
+	t := new(Transaction)
+	t.SetVersion(TRANSACTION_VERSION_SIGHASH)
+	t.SetMilliTimestamp(1000)
+	private := addKeyInput(t, 1000)
+	if err := signInput(t, 0, private, SIGHASH_SINGLE); err == nil {
+		Prtln("Signed SIGHASH_SINGLE with no output to sign")
+		test.Fail()
+	}
+	t.AddOutput(nextAddress(), 500)
+	t.AddOutput(nextAddress(), 400)
+	signInput(t, 0, private, SIGHASH_SINGLE)
+
+	t.GetOutputs()[1].SetAmount(300)
+	t.AddECOutput(nextAddress(), 100)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln("Other outputs should not matter: ", err)
+		test.Fail()
+	}
+	t.GetOutputs()[0].SetAmount(600)
+	if err := t.ValidateSignatures(); err == nil {
+		Prtln("Changing the signed output should break the signature")
+		test.Fail()
+	}
+	t.GetOutputs()[0].SetAmount(500)
+
+	// The sighash type is signed too.
+	t.GetSignatureBlock(0).SetSigHashType(SIGHASH_SINGLE | SIGHASH_ANYONECANPAY)
+	if err := t.ValidateSignatures(); err == nil {
+		Prtln("Changing the sighash type should break the signature")
+		test.Fail()
+	}
+}
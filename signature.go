@@ -44,6 +44,10 @@ func (b Signature) String() string {
 	return string(txt)
 }
 
+func init() {
+	RegisterType(new(Signature))
+}
+
 func (Signature) GetDBHash() IHash {
 	return Sha([]byte("Signature"))
 }
@@ -96,6 +100,9 @@ func (s Signature) CustomMarshalText() ([]byte, error) {
 }
 
 func (s *Signature) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	if len(data) < SIGNATURE_LENGTH {
+		return nil, fmt.Errorf("Data source too short to unmarshal a Signature: %d", len(data))
+	}
 	copy(s.signature[:], data[:SIGNATURE_LENGTH])
 	return data[SIGNATURE_LENGTH:], nil
 }
@@ -6,6 +6,7 @@ package factoid
 
 import (
 	"bytes"
+	"encoding/hex"
 	"fmt"
 )
 
@@ -23,10 +24,19 @@ type ISignatureBlock interface {
 	GetSignatures() []ISignature
 	AddSignature(sig ISignature)
 	GetSignature(int) ISignature
+	// What part of the transaction the signatures cover.  See sighash.go
+	GetSigHashType() SigHashType
+	SetSigHashType(SigHashType)
+	// The preimage that claims an RCD_4, or nil.  See rcd4.go
+	GetPreimage() []byte
+	SetPreimage([]byte)
 }
 
 type SignatureBlock struct {
-	signatures []ISignature
+	signatures  []ISignature
+	sigHashType SigHashType  // Zero is taken as SIGHASH_ALL
+	preimage    []byte       // Only for an RCD_4
+	owner       *Transaction // The transaction holding this block, if any
 }
 
 var _ ISignatureBlock = (*SignatureBlock)(nil)
@@ -34,7 +44,7 @@ var _ IBlock = (*SignatureBlock)(nil)
 
 func (b SignatureBlock) GetHash() IHash { return nil }
 
-func (b SignatureBlock) UnmarshalBinary(data []byte) error {
+func (b *SignatureBlock) UnmarshalBinary(data []byte) error {
 	_, err := b.UnmarshalBinaryData(data)
 	return err
 }
@@ -58,7 +68,8 @@ func (s *SignatureBlock) IsEqual(signatureBlock IBlock) []IBlock {
 
 	sigs1 := s.GetSignatures()
 	sigs2 := sb.GetSignatures()
-	if len(sigs1) != len(sigs2) {
+	if len(sigs1) != len(sigs2) || s.GetSigHashType() != sb.GetSigHashType() ||
+		!bytes.Equal(s.preimage, sb.GetPreimage()) {
 		r := make([]IBlock, 0, 5)
 		return append(r, s)
 	}
@@ -78,6 +89,41 @@ func (s *SignatureBlock) AddSignature(sig ISignature) {
 	} else {
 		s.signatures = append(s.signatures, sig)
 	}
+	s.changed()
+}
+
+// Changing a signature block changes the transaction holding it, so the
+// caches that cover the signatures must go.  The signed part of the
+// transaction is not changed.
+func (s *SignatureBlock) changed() {
+	if s.owner != nil {
+		s.owner.clearBinCache()
+	}
+}
+
+func (s *SignatureBlock) setOwner(t *Transaction) {
+	s.owner = t
+}
+
+func (s SignatureBlock) GetSigHashType() SigHashType {
+	if s.sigHashType == 0 {
+		return SIGHASH_ALL
+	}
+	return s.sigHashType
+}
+
+func (s *SignatureBlock) SetSigHashType(h SigHashType) {
+	s.sigHashType = h
+	s.changed()
+}
+
+func (s SignatureBlock) GetPreimage() []byte {
+	return s.preimage
+}
+
+func (s *SignatureBlock) SetPreimage(preimage []byte) {
+	s.preimage = preimage
+	s.changed()
 }
 
 func (s SignatureBlock) GetSignature(index int) ISignature {
@@ -87,6 +133,10 @@ func (s SignatureBlock) GetSignature(index int) ISignature {
 	return s.signatures[index]
 }
 
+func init() {
+	RegisterType(new(SignatureBlock))
+}
+
 func (SignatureBlock) GetDBHash() IHash {
 	return Sha([]byte("SignatureBlock"))
 }
@@ -131,6 +181,11 @@ func (s SignatureBlock) CustomMarshalText() ([]byte, error) {
 		out.WriteString("\n")
 
 	}
+	if len(s.preimage) > 0 {
+		out.WriteString(" Preimage: ")
+		out.WriteString(hex.EncodeToString(s.preimage))
+		out.WriteString("\n")
+	}
 
 	return out.Bytes(), nil
 }
@@ -141,9 +196,9 @@ func (s *SignatureBlock) UnmarshalBinaryData(data []byte) (newData []byte, err e
 	s.signatures[0] = new(Signature)
 	data, err = s.signatures[0].UnmarshalBinaryData(data)
 	if err != nil {
-		fmt.Println("error")
-		return nil, fmt.Errorf("Failure to unmarshal Signature")
+		return nil, fmt.Errorf("Failure to unmarshal Signature: %s", err.Error())
 	}
+	s.changed()
 
 	return data, nil
 }
@@ -0,0 +1,229 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/block"
+)
+
+// The rules checked by ValidateBlock()
+const (
+	RULE_TRANSACTION = "transaction" // Transaction is malformed, badly signed, or doesn't pay its fee
+	RULE_COINBASE    = "coinbase"    // Coinbase doesn't match the coinbase schedule
+	RULE_DUPLICATE   = "duplicate"   // Transaction ID appears twice in the block
+	RULE_TIMESTAMP   = "timestamp"   // Transaction is too old or too new for the block
+	RULE_LOCK        = "lock"        // Transaction spends a time locked input too early
+	RULE_BALANCE     = "balance"     // Inputs overspend the balance of an address
+	RULE_BODY_MR     = "bodymr"      // BodyMR does not match the transactions
+)
+
+// The read only part of the Factoid State needed to validate a block.  Any
+// IFactoidState will do.
+type IFactoidStateView interface {
+	GetBalance(address fct.IAddress) (uint64, error)
+	GetECBalance(address fct.IAddress) (uint64, error)
+}
+
+// Reports why a block is invalid.  Index is the index of the failing
+// transaction in the block, or -1 if the failure is with the block as a whole.
+// Err is usually a *fct.ValidationError, and its kind is the kind of the report.
+type BlockValidationReport struct {
+	DBHeight uint32
+	Index    int
+	Rule     string
+	Err      error
+}
+
+var _ fct.IValidationError = (*BlockValidationReport)(nil)
+
+func (r *BlockValidationReport) Error() string {
+	if r.Index < 0 {
+		return fmt.Sprintf("Block %d failed %s validation: %s", r.DBHeight, r.Rule, r.Err.Error())
+	}
+	return fmt.Sprintf("Block %d, transaction %d failed %s validation: %s",
+		r.DBHeight, r.Index, r.Rule, r.Err.Error())
+}
+
+func (r *BlockValidationReport) GetKind() fct.ValidationErrorKind {
+	return fct.GetValidationErrorKind(r.Err)
+}
+
+// Balances as they would be with some number of transactions applied on
+// top of a Factoid State.  The Factoid State itself is never modified.
+type balanceOverlay struct {
+	view       IFactoidStateView
+	balances   map[[32]byte]uint64
+	ecbalances map[[32]byte]uint64
+}
+
+func newBalanceOverlay(view IFactoidStateView) *balanceOverlay {
+	o := new(balanceOverlay)
+	o.view = view
+	o.balances = make(map[[32]byte]uint64, 100)
+	o.ecbalances = make(map[[32]byte]uint64, 100)
+	return o
+}
+
+func (o *balanceOverlay) getBalance(address fct.IAddress) (uint64, error) {
+	if bal, ok := o.balances[address.Fixed()]; ok {
+		return bal, nil
+	}
+	return o.view.GetBalance(address)
+}
+
+func (o *balanceOverlay) getECBalance(address fct.IAddress) (uint64, error) {
+	if bal, ok := o.ecbalances[address.Fixed()]; ok {
+		return bal, nil
+	}
+	return o.view.GetECBalance(address)
+}
+
+// Apply a transaction to the overlay, in the same order as
+// FactoidState.UpdateTransaction().  Nothing is changed if the
+// transaction would overspend an address.
+func (o *balanceOverlay) apply(trans fct.ITransaction) error {
+	balances := make(map[[32]byte]uint64, len(trans.GetInputs())+len(trans.GetOutputs()))
+	ecbalances := make(map[[32]byte]uint64, len(trans.GetECOutputs()))
+	get := func(address fct.IAddress) (uint64, error) {
+		if bal, ok := balances[address.Fixed()]; ok {
+			return bal, nil
+		}
+		return o.getBalance(address)
+	}
+
+	for i, input := range trans.GetInputs() {
+		bal, err := get(input.GetAddress())
+		if err != nil {
+			return err
+		}
+		if input.GetAmount() > bal {
+			e := fct.NewValidationError(fct.ERR_INSUFFICIENT_FUNDS, "Input %s spends %s but only %s is available",
+				fct.ConvertFctAddressToUserStr(input.GetAddress()),
+				fct.Amount(input.GetAmount()).String(),
+				fct.Amount(bal).String())
+			e.Input = i
+			e.Address = input.GetAddress()
+			e.Required = input.GetAmount()
+			e.Provided = bal
+			return e
+		}
+		balances[input.GetAddress().Fixed()] = bal - input.GetAmount()
+	}
+	for _, output := range trans.GetOutputs() {
+		prev, err := get(output.GetAddress())
+		if err != nil {
+			return err
+		}
+		bal, err := fct.ValidateAmounts(prev, output.GetAmount())
+		if err != nil {
+			return err
+		}
+		balances[output.GetAddress().Fixed()] = bal
+	}
+	for _, ecoutput := range trans.GetECOutputs() {
+		prev, ok := ecbalances[ecoutput.GetAddress().Fixed()]
+		if !ok {
+			var err error
+			if prev, err = o.getECBalance(ecoutput.GetAddress()); err != nil {
+				return err
+			}
+		}
+		bal, err := fct.ValidateAmounts(prev, ecoutput.GetAmount())
+		if err != nil {
+			return err
+		}
+		ecbalances[ecoutput.GetAddress().Fixed()] = bal
+	}
+
+	for k, v := range balances {
+		o.balances[k] = v
+	}
+	for k, v := range ecbalances {
+		o.ecbalances[k] = v
+	}
+	return nil
+}
+
+// Validate a block in the context of the given Factoid State.  Each
+// transaction is checked on its own, then applied in order to the balances
+// of the state, so transactions that together overspend an address are
+// caught.  Duplicate transactions, transactions outside the time window
+// of the block, and spends of time locked inputs before the lock expires are
+// rejected.  Nothing in the state is modified.
+//
+// Returns nil if the block is valid, otherwise a *BlockValidationReport.  If
+// the balances can't be read, the error from the database is returned as is.
+func ValidateBlock(view IFactoidStateView, blk block.IFBlock) error {
+	return validateBlock(view, blk, block.ValidateTransactions)
+}
+
+// The same as ValidateBlock(), but the signatures are checked in batches.
+// Only for blocks the network has already accepted, as when the state is
+// rebuilt from the database; see block.ValidateTransactionsBatched().
+func ValidateReplayedBlock(view IFactoidStateView, blk block.IFBlock) error {
+	return validateBlock(view, blk, block.ValidateTransactionsBatched)
+}
+
+func validateBlock(view IFactoidStateView, blk block.IFBlock, validate func(block.IFBlock) (int, error)) error {
+	report := func(index int, rule string, err error) error {
+		return &BlockValidationReport{blk.GetDBHeight(), index, rule, err}
+	}
+
+	transactions := blk.GetTransactions()
+	if len(transactions) == 0 {
+		return report(-1, RULE_COINBASE, fct.NewValidationError(fct.ERR_COINBASE, "Block has no coinbase transaction"))
+	}
+	tsblk := blk.GetCoinbaseTimestamp()
+
+	// Signatures are checked up front on a pool of workers.  Everything
+	// else is checked in order, so the failure reported is always the
+	// first in the block.
+	failed, txerr := validate(blk)
+
+	overlay := newBalanceOverlay(view)
+	ids := make(map[[32]byte]int, len(transactions))
+	for i, trans := range transactions {
+		if i == failed {
+			return report(i, RULE_TRANSACTION, txerr)
+		}
+		if i == 0 {
+			// The genesis block's coinbase distributes the initial allocation
+			if blk.GetDBHeight() > 0 {
+				err := block.GetCoinbaseSchedule().ValidateCoinbase(blk.GetDBHeight(), trans)
+				if err != nil {
+					return report(i, RULE_COINBASE, err)
+				}
+			}
+		} else {
+			if err := checkTransactionAge(tsblk, trans); err != nil {
+				return report(i, RULE_TIMESTAMP, err)
+			}
+			if err := checkLocks(blk.GetDBHeight(), tsblk, trans); err != nil {
+				return report(i, RULE_LOCK, err)
+			}
+		}
+
+		id := trans.GetSigHash().Fixed()
+		if j, ok := ids[id]; ok {
+			return report(i, RULE_DUPLICATE, fct.NewValidationError(fct.ERR_MALFORMED, "Transaction is a duplicate of transaction %d", j))
+		}
+		ids[id] = i
+
+		if err := overlay.apply(trans); err != nil {
+			if fct.GetValidationErrorKind(err) == fct.ERR_UNKNOWN {
+				return err // Failed to read a balance
+			}
+			return report(i, RULE_BALANCE, err)
+		}
+	}
+
+	if err := blk.ValidateBodyMR(); err != nil {
+		return report(-1, RULE_BODY_MR, err)
+	}
+
+	return nil
+}
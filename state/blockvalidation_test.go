@@ -0,0 +1,421 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package state
+
+import (
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/block"
+	"github.com/FactomProject/factoid/database"
+	"github.com/FactomProject/factoid/wallet"
+	"testing"
+)
+
+// Builds a Factoid State from a genesis block funding a wallet address,
+// and returns the state, the wallet, the funded address and a destination.
+func newValidationState(test *testing.T) (*FactoidState, wallet.ISCWallet, fct.IAddress, fct.IAddress) {
+	w := new(wallet.SCWallet)
+	w.Init()
+	w.NewSeed([]byte("block validation"))
+	from, _ := w.GenerateFctAddress([]byte("from"), 1, 1)
+	to, _ := w.GenerateFctAddress([]byte("to"), 1, 1)
+
+	allocations := []block.GenesisAllocation{{Address: from, Amount: 1000000000}}
+	gb, err := block.NewGenesisFBlock(1000000, 1000, allocations)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	db := new(database.MapDB)
+	db.Init()
+	fs := new(FactoidState)
+	fs.SetDB(db)
+	fs.SetGenesisBlock(gb)
+	if err := fs.AddTransactionBlock(gb); err != nil {
+		test.Fatal(err)
+	}
+	return fs, w, from, to
+}
+
+func newValidationTransaction(w wallet.ISCWallet, ts uint64, from, to fct.IAddress, amount uint64) fct.ITransaction {
+	t := w.CreateTransaction(ts)
+	w.AddInput(t, from, amount)
+	w.AddOutput(t, to, amount)
+	fee, _ := t.CalculateFee(1000)
+	w.UpdateInput(t, 0, from, amount+fee)
+	w.SignInputs(t)
+	return t
+}
+
+func newValidationBlock(ts uint64, transactions ...fct.ITransaction) block.IFBlock {
+	blk := block.NewFBlock(1000, 1)
+	blk.AddCoinbase(block.GetCoinbase(ts, 1))
+	for _, t := range transactions {
+		blk.(*block.FBlock).Transactions = append(blk.GetTransactions(), t)
+	}
+	blk.CalculateHashes()
+	return blk
+}
+
+func expectReport(test *testing.T, err error, index int, rule string) {
+	r, ok := err.(*BlockValidationReport)
+	if !ok {
+		fct.Prtln("Expected a validation report, got: ", err)
+		test.Fail()
+		return
+	}
+	if r.Index != index || r.Rule != rule {
+		fct.Prtln("Expected failure of ", rule, " at ", index, ", got: ", r)
+		test.Fail()
+	}
+}
+
+func Test_ValidateBlock_FactoidState(test *testing.T) {
+	fs, w, from, to := newValidationState(test)
+	ts := uint64(1000000)
+
+	t1 := newValidationTransaction(w, ts+1, from, to, 600000000)
+	t2 := newValidationTransaction(w, ts+2, from, to, 300000000)
+	if err := fs.ValidateBlock(newValidationBlock(ts, t1, t2)); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+
+	// Each spend is covered by the balance on its own, but not together.
+	t3 := newValidationTransaction(w, ts+3, from, to, 600000000)
+	err := fs.ValidateBlock(newValidationBlock(ts, t1, t2, t3))
+	expectReport(test, err, 3, RULE_BALANCE)
+	if fct.GetValidationErrorKind(err) != fct.ERR_INSUFFICIENT_FUNDS {
+		fct.Prtln("Expected insufficient funds, got: ", err)
+		test.Fail()
+	}
+
+	// Validation must not touch the balances of the state
+	if bal, _ := fs.GetBalance(from); bal != 1000000000 {
+		fct.Prtln("ValidateBlock modified the Factoid State")
+		test.Fail()
+	}
+	if bal, _ := fs.GetBalance(to); bal != 0 {
+		fct.Prtln("ValidateBlock modified the Factoid State")
+		test.Fail()
+	}
+
+	err = fs.ValidateBlock(newValidationBlock(ts, t1, t1))
+	expectReport(test, err, 2, RULE_DUPLICATE)
+
+	old := newValidationTransaction(w, ts-uint64(fct.TRANSACTION_PRIOR_LIMIT)-1, from, to, 100)
+	err = fs.ValidateBlock(newValidationBlock(ts, old))
+	expectReport(test, err, 1, RULE_TIMESTAMP)
+	if fct.GetValidationErrorKind(err) != fct.ERR_TOO_OLD {
+		fct.Prtln("Expected a transaction that is too old, got: ", err)
+		test.Fail()
+	}
+
+	blk := newValidationBlock(ts, t1)
+	blk.GetTransactions()[1].GetOutputs()[0].SetAmount(1)
+	err = fs.ValidateBlock(blk)
+	expectReport(test, err, 1, RULE_TRANSACTION)
+
+	// A block that fails validation is not applied.
+	if err := fs.AddTransactionBlock(newValidationBlock(ts, t1, t2, t3)); err == nil {
+		fct.Prtln("Added a block that overspends an address")
+		test.Fail()
+	}
+	if bal, _ := fs.GetBalance(from); bal != 1000000000 {
+		fct.Prtln("A block that failed validation was partially applied")
+		test.Fail()
+	}
+}
+
+func Test_ValidateBlock_parallel_FactoidState(test *testing.T) {
+	defer block.SetValidationWorkers(block.GetValidationWorkers())
+
+	fs, w, from, to := newValidationState(test)
+	ts := uint64(1000000)
+
+	transactions := make([]fct.ITransaction, 0, 20)
+	for i := 0; i < 20; i++ {
+		transactions = append(transactions, newValidationTransaction(w, ts+uint64(i), from, to, 1000))
+	}
+	// Break a signature late in the block, and overspend earlier on.  The
+	// overspend must be reported no matter how many workers are used.
+	transactions[15].GetSignatureBlock(0).GetSignatures()[0].SetSignature(make([]byte, fct.SIGNATURE_LENGTH))
+	transactions[10] = newValidationTransaction(w, ts+100, from, to, 2000000000)
+	blk := newValidationBlock(ts, transactions...)
+
+	for _, workers := range []int{1, 2, 8} {
+		block.SetValidationWorkers(workers)
+		err := fs.ValidateBlock(blk)
+		expectReport(test, err, 11, RULE_BALANCE)
+	}
+
+	transactions[10] = newValidationTransaction(w, ts+100, from, to, 1000)
+	blk = newValidationBlock(ts, transactions...)
+	for _, workers := range []int{1, 2, 8} {
+		block.SetValidationWorkers(workers)
+		err := fs.ValidateBlock(blk)
+		expectReport(test, err, 16, RULE_TRANSACTION)
+		if fct.GetValidationErrorKind(err) != fct.ERR_BAD_SIGNATURE {
+			fct.Prtln("Expected a bad signature, got: ", err)
+			test.Fail()
+		}
+	}
+}
+
+// Checking signatures in batches must find the same failure as checking
+// them one at a time, however the block is broken.
+func Test_ValidateReplayedBlock_FactoidState(test *testing.T) {
+	defer block.SetValidationWorkers(block.GetValidationWorkers())
+
+	fs, w, from, to := newValidationState(test)
+	ts := uint64(1000000)
+
+	newTransactions := func() []fct.ITransaction {
+		transactions := make([]fct.ITransaction, 0, 20)
+		for i := 0; i < 20; i++ {
+			transactions = append(transactions, newValidationTransaction(w, ts+uint64(i), from, to, 1000))
+		}
+		return transactions
+	}
+	badSignature := func(t fct.ITransaction) {
+		t.GetSignatureBlock(0).GetSignatures()[0].GetSignature()[3] ^= 0x10
+	}
+
+	var blocks []block.IFBlock
+	blocks = append(blocks, newValidationBlock(ts, newTransactions()...))
+
+	transactions := newTransactions()
+	badSignature(transactions[15])
+	blocks = append(blocks, newValidationBlock(ts, transactions...))
+
+	transactions = newTransactions()
+	badSignature(transactions[15])
+	badSignature(transactions[4])
+	badSignature(transactions[5])
+	blocks = append(blocks, newValidationBlock(ts, transactions...))
+
+	// A bad fee before a bad signature
+	transactions = newTransactions()
+	badSignature(transactions[15])
+	transactions[6].GetOutputs()[0].SetAmount(100000000)
+	blocks = append(blocks, newValidationBlock(ts, transactions...))
+
+	// A bad signature before an overspend
+	transactions = newTransactions()
+	badSignature(transactions[2])
+	transactions[1] = newValidationTransaction(w, ts+100, from, to, 2000000000)
+	blocks = append(blocks, newValidationBlock(ts, transactions...))
+
+	transactions = newTransactions()
+	badSignature(transactions[0])
+	blocks = append(blocks, newValidationBlock(ts, transactions...))
+
+	for i, blk := range blocks {
+		for _, workers := range []int{1, 3, 8, 32} {
+			block.SetValidationWorkers(workers)
+			want, wanterr := block.ValidateTransactions(blk)
+			got, goterr := block.ValidateTransactionsBatched(blk)
+			if want != got || (wanterr == nil) != (goterr == nil) ||
+				(wanterr != nil && wanterr.Error() != goterr.Error()) {
+				fct.Prtln("Block ", i, " with ", workers, " workers: batched ", got, goterr, ", expected ", want, wanterr)
+				test.Fail()
+			}
+
+			want2 := fs.ValidateBlock(blk)
+			got2 := ValidateReplayedBlock(fs, blk)
+			if (want2 == nil) != (got2 == nil) || (want2 != nil && want2.Error() != got2.Error()) {
+				fct.Prtln("Block ", i, " with ", workers, " workers: replayed ", got2, ", expected ", want2)
+				test.Fail()
+			}
+			if i > 0 && want2 == nil {
+				fct.Prtln("Block ", i, " should not validate")
+				test.Fail()
+			}
+		}
+	}
+
+	// A replayed block is applied like any other.
+	if err := fs.ReplayTransactionBlock(blocks[0]); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	if bal, _ := fs.GetBalance(to); bal != 20*1000 {
+		fct.Prtln("Expected the replayed block to be applied, got a balance of ", bal)
+		test.Fail()
+	}
+	if err := fs.ReplayTransactionBlock(blocks[1]); err == nil {
+		fct.Prtln("Replayed a block with a bad signature")
+		test.Fail()
+	}
+}
+
+// A synthetic chain of blocks full of signed transactions, for benchmarking
+// chain replay.
+var benchChain []block.IFBlock
+
+func getBenchChain(b *testing.B) []block.IFBlock {
+	if benchChain != nil {
+		return benchChain
+	}
+	w := new(wallet.SCWallet)
+	w.Init()
+	w.NewSeed([]byte("replay benchmark"))
+	from, _ := w.GenerateFctAddress([]byte("from"), 1, 1)
+	to, _ := w.GenerateFctAddress([]byte("to"), 1, 1)
+
+	ts := uint64(1000000)
+	gb, err := block.NewGenesisFBlock(ts, 1000, []block.GenesisAllocation{{Address: from, Amount: 100000000000}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	chain := []block.IFBlock{gb}
+	for height := uint32(1); height <= 20; height++ {
+		blk := block.NewFBlock(1000, height)
+		blk.AddCoinbase(block.GetCoinbase(ts, height))
+		for i := 0; i < 50; i++ {
+			t := newValidationTransaction(w, ts+uint64(i), from, to, 1000)
+			blk.(*block.FBlock).Transactions = append(blk.GetTransactions(), t)
+		}
+		blk.CalculateHashes()
+		chain = append(chain, blk)
+	}
+	benchChain = chain
+	return chain
+}
+
+func benchmarkReplay(b *testing.B, workers int, batched bool) {
+	defer block.SetValidationWorkers(block.GetValidationWorkers())
+	block.SetValidationWorkers(workers)
+
+	chain := getBenchChain(b)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		db := new(database.MapDB)
+		db.Init()
+		fs := new(FactoidState)
+		fs.SetDB(db)
+		fs.SetGenesisBlock(chain[0])
+		for _, blk := range chain {
+			add := fs.AddTransactionBlock
+			if batched {
+				add = fs.ReplayTransactionBlock
+			}
+			if err := add(blk); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_Replay_1_worker(b *testing.B)  { benchmarkReplay(b, 1, false) }
+func Benchmark_Replay_2_workers(b *testing.B) { benchmarkReplay(b, 2, false) }
+func Benchmark_Replay_4_workers(b *testing.B) { benchmarkReplay(b, 4, false) }
+func Benchmark_Replay_8_workers(b *testing.B) { benchmarkReplay(b, 8, false) }
+
+func Benchmark_Replay_batched_1_worker(b *testing.B)  { benchmarkReplay(b, 1, true) }
+func Benchmark_Replay_batched_2_workers(b *testing.B) { benchmarkReplay(b, 2, true) }
+func Benchmark_Replay_batched_4_workers(b *testing.B) { benchmarkReplay(b, 4, true) }
+func Benchmark_Replay_batched_8_workers(b *testing.B) { benchmarkReplay(b, 8, true) }
+
+func Test_ValidateBlock_locks_FactoidState(test *testing.T) {
+	w := new(wallet.SCWallet)
+	w.Init()
+	w.NewSeed([]byte("time locks"))
+	ts := uint64(1000000)
+	height, _ := w.GenerateTimeLockedFctAddress([]byte("height"), fct.LOCK_DBHEIGHT, 2)
+	time, _ := w.GenerateTimeLockedFctAddress([]byte("time"), fct.LOCK_MILLITIME, ts+10)
+	to, _ := w.GenerateFctAddress([]byte("to"), 1, 1)
+
+	allocations := []block.GenesisAllocation{{Address: height, Amount: 1000000000}, {Address: time, Amount: 1000000000}}
+	gb, err := block.NewGenesisFBlock(1000000, 1000, allocations)
+	if err != nil {
+		test.Fatal(err)
+	}
+	db := new(database.MapDB)
+	db.Init()
+	fs := new(FactoidState)
+	fs.SetDB(db)
+	fs.SetGenesisBlock(gb)
+	if err := fs.AddTransactionBlock(gb); err != nil {
+		test.Fatal(err)
+	}
+
+	// Blocks from newValidationBlock() are at height 1
+	t1 := newValidationTransaction(w, ts+1, height, to, 100000000)
+	if err := t1.ValidateSignatures(); err != nil {
+		fct.Prtln("The wallet did not sign the time locked input: ", err)
+		test.Fail()
+	}
+	err = fs.ValidateBlock(newValidationBlock(ts, t1))
+	expectReport(test, err, 1, RULE_LOCK)
+	if e, ok := err.(*BlockValidationReport).Err.(*fct.ValidationError); !ok || e.Kind != fct.ERR_LOCKED ||
+		e.Required != 2 || e.Provided != 1 || e.Input != 0 {
+		fct.Prtln("Expected input 0 locked until height 2, got: ", err)
+		test.Fail()
+	}
+	if err := fs.Validate(1, t1); fct.GetValidationErrorKind(err) != fct.ERR_LOCKED {
+		fct.Prtln("The Factoid State accepted a spend before its lock: ", err)
+		test.Fail()
+	}
+
+	t2 := newValidationTransaction(w, ts+1, time, to, 100000000)
+	err = fs.ValidateBlock(newValidationBlock(ts, t2))
+	expectReport(test, err, 1, RULE_LOCK)
+	if err := fs.ValidateBlock(newValidationBlock(ts+10, t2)); err != nil {
+		fct.Prtln("The time lock should have expired: ", err)
+		test.Fail()
+	}
+}
+
+func Test_ValidateBlock_HTLC_FactoidState(test *testing.T) {
+	w := new(wallet.SCWallet)
+	w.Init()
+	w.NewSeed([]byte("atomic swap"))
+	recipient, _ := w.GenerateFctAddress([]byte("recipient"), 1, 1)
+	sender, _ := w.GenerateFctAddress([]byte("sender"), 1, 1)
+	rwe, _ := w.GetAddressDetailsAddr(recipient.Bytes())
+	swe, _ := w.GetAddressDetailsAddr(sender.Bytes())
+	preimage := []byte("swap secret")
+	contract, _ := w.CreateHTLC([]byte("swap"), fct.Sha(preimage).Bytes(), 2, rwe.GetKey(0), swe.GetKey(0))
+
+	allocations := []block.GenesisAllocation{{Address: contract, Amount: 1000000000}}
+	gb, err := block.NewGenesisFBlock(1000000, 1000, allocations)
+	if err != nil {
+		test.Fatal(err)
+	}
+	db := new(database.MapDB)
+	db.Init()
+	fs := new(FactoidState)
+	fs.SetDB(db)
+	fs.SetGenesisBlock(gb)
+	if err := fs.AddTransactionBlock(gb); err != nil {
+		test.Fatal(err)
+	}
+
+	spend := func(ts uint64, claim bool) fct.ITransaction {
+		t := w.CreateTransaction(ts)
+		if claim {
+			w.ClaimHTLC(t, contract, 600000000, preimage)
+		} else {
+			w.RefundHTLC(t, contract, 600000000)
+		}
+		w.AddOutput(t, recipient, 500000000)
+		w.SignInputs(t)
+		return t
+	}
+
+	// Blocks from newValidationBlock() are at height 1, before the refund.
+	ts := uint64(1000000)
+	err = fs.ValidateBlock(newValidationBlock(ts, spend(ts+1, false)))
+	expectReport(test, err, 1, RULE_LOCK)
+	if e, ok := err.(*BlockValidationReport).Err.(*fct.ValidationError); !ok || e.Kind != fct.ERR_LOCKED ||
+		e.Required != 2 || e.Provided != 1 {
+		fct.Prtln("Expected a refund locked until height 2, got: ", err)
+		test.Fail()
+	}
+	if err := fs.ValidateBlock(newValidationBlock(ts, spend(ts+1, true))); err != nil {
+		fct.Prtln("The claim should be valid: ", err)
+		test.Fail()
+	}
+}
@@ -30,6 +30,12 @@ type IFactoidState interface {
 	// Load the address state of Factoids
 	LoadState() error
 
+	// The genesis block used by LoadState() to initialize an empty
+	// database.  Defaults to the mainnet genesis block.  Set it to
+	// run a private network.
+	SetGenesisBlock(block.IFBlock)
+	GetGenesisBlock() block.IFBlock
+
 	// Get the wallet used to help manage the Factoid State in
 	// some applications.
 	GetWallet() wallet.ISCWallet
@@ -57,19 +63,28 @@ type IFactoidState interface {
 	UseECs(address fct.IAddress, amount uint64) error
 
 	// Return the Factoid balance for an address
-	GetBalance(address fct.IAddress) uint64
+	GetBalance(address fct.IAddress) (uint64, error)
 
 	// Return the Entry Credit balance for an address
-	GetECBalance(address fct.IAddress) uint64
+	GetECBalance(address fct.IAddress) (uint64, error)
 
 	// Add a transaction block.  Useful for catching up with the network.
 	AddTransactionBlock(block.IFBlock) error
 
+	// Add a transaction block that the network has already accepted, as
+	// when rebuilding the state from the database.  Signatures are checked
+	// in batches, which is faster, but see ValidateReplayedBlock().
+	ReplayTransactionBlock(block.IFBlock) error
+
+	// Validate a transaction block against the current balances, without
+	// changing them.  Returns a *BlockValidationReport if the block is invalid.
+	ValidateBlock(block.IFBlock) error
+
 	// Return the Factoid block with this hash.  If unknown, returns
 	// a null.
-	GetTransactionBlock(fct.IHash) block.IFBlock
+	GetTransactionBlock(fct.IHash) (block.IFBlock, error)
 	// Put a Factoid block with this hash into the database.
-	PutTransactionBlock(fct.IHash, block.IFBlock)
+	PutTransactionBlock(fct.IHash, block.IFBlock) error
 
 	// Time is something that can vary across multiple systems, and
 	// must be controlled in order to build reliable, repeatable
@@ -100,8 +115,8 @@ type IFactoidState interface {
 	ProcessEndOfMinute()
 
 	// Process End of Block.
-	ProcessEndOfBlock() // to be replaced by ProcessEndOfBlock2
-	ProcessEndOfBlock2(uint32)
+	ProcessEndOfBlock() error // to be replaced by ProcessEndOfBlock2
+	ProcessEndOfBlock2(uint32) error
 
 	// Get the current Directory Block Height
 	GetDBHeight() uint32
@@ -114,6 +129,7 @@ type IFactoidState interface {
 type FactoidState struct {
 	database        db.IFDatabase
 	factoshisPerEC  uint64
+	genesisBlock    block.IFBlock
 	currentBlock    block.IFBlock
 	dbheight        uint32
 	wallet          wallet.ISCWallet
@@ -134,6 +150,17 @@ func (fs *FactoidState) SetWallet(w wallet.ISCWallet) {
 	fs.wallet = w
 }
 
+func (fs *FactoidState) SetGenesisBlock(gb block.IFBlock) {
+	fs.genesisBlock = gb
+}
+
+func (fs *FactoidState) GetGenesisBlock() block.IFBlock {
+	if fs.genesisBlock == nil {
+		fs.genesisBlock = block.GetGenesisFBlock()
+	}
+	return fs.genesisBlock
+}
+
 func (fs *FactoidState) GetCurrentBlock() block.IFBlock {
 	return fs.currentBlock
 }
@@ -142,21 +169,54 @@ func (fs *FactoidState) GetDBHeight() uint32 {
 	return fs.dbheight
 }
 
+// Run f with all of its writes to the database in one batch.  If f
+// fails, or the batch can't be committed, none of its writes are kept.
+func (fs *FactoidState) batch(f func() error) error {
+	if err := fs.database.Begin(); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		fs.database.Rollback()
+		return err
+	}
+	return fs.database.Commit()
+}
+
 // When we are playing catchup, adding the transaction block is a pretty
-// useful feature.
+// useful feature.  The balances are updated as one batch.
 func (fs *FactoidState) AddTransactionBlock(blk block.IFBlock) error {
+	return fs.addTransactionBlock(blk, ValidateBlock)
+}
+
+func (fs *FactoidState) ReplayTransactionBlock(blk block.IFBlock) error {
+	return fs.addTransactionBlock(blk, ValidateReplayedBlock)
+}
 
-	if err := blk.Validate(); err != nil {
+func (fs *FactoidState) addTransactionBlock(blk block.IFBlock, validate func(IFactoidStateView, block.IFBlock) error) error {
+	if err := validate(fs, blk); err != nil {
 		return err
 	}
 
-	transactions := blk.GetTransactions()
-	for _, trans := range transactions {
-		err := fs.UpdateTransaction(trans)
-		if err != nil {
+	err := fs.batch(func() error {
+		return fs.updateTransactions(blk)
+	})
+	if err != nil {
+		return err
+	}
+	fs.addedTransactionBlock(blk)
+	return nil
+}
+
+func (fs *FactoidState) updateTransactions(blk block.IFBlock) error {
+	for _, trans := range blk.GetTransactions() {
+		if err := fs.UpdateTransaction(trans); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+func (fs *FactoidState) addedTransactionBlock(blk block.IFBlock) {
 	fs.currentBlock = blk
 	fs.SetFactoshisPerEC(blk.GetExchRate())
 
@@ -166,27 +226,83 @@ func (fs *FactoidState) AddTransactionBlock(blk block.IFBlock) error {
 		fmt.Sprintf("Added Factoid Block %d", blk.GetDBHeight()), // Title
 		"", // message
 		60) // sixty seconds should be enough
+}
 
-	return nil
+func (fs *FactoidState) ValidateBlock(blk block.IFBlock) error {
+	return ValidateBlock(fs, blk)
 }
 
 // Checks the transaction timestamp for validity in being included in the current block.
 // No node has any responsiblity to forward on transactions that do not fall within
 // the timeframe around a block defined by TRANSACTION_PRIOR_LIMIT and TRANSACTION_POST_LIMIT
 func (fs *FactoidState) ValidateTransactionAge(trans fct.ITransaction) error {
-	tsblk := fs.GetCurrentBlock().GetCoinbaseTimestamp()
+	return checkTransactionAge(fs.GetCurrentBlock().GetCoinbaseTimestamp(), trans)
+}
+
+// Checks the transaction timestamp against the timestamp of the coinbase of
+// a block.
+func checkTransactionAge(tsblk int64, trans fct.ITransaction) error {
 	if tsblk < 0 {
-		return fmt.Errorf("Block has no coinbase transaction at this time")
+		return fct.NewValidationError(fct.ERR_COINBASE, "Block has no coinbase transaction at this time")
 	}
 
 	tstrans := int64(trans.GetMilliTimestamp())
 
 	if tsblk-tstrans > fct.TRANSACTION_PRIOR_LIMIT {
-		return fmt.Errorf("Transaction is too old to be included in the current block")
+		e := fct.NewValidationError(fct.ERR_TOO_OLD, "Transaction is too old to be included in the current block")
+		e.Required = uint64(tsblk - fct.TRANSACTION_PRIOR_LIMIT)
+		e.Provided = uint64(tstrans)
+		return e
 	}
 
 	if tstrans-tsblk > fct.TRANSACTION_POST_LIMIT {
-		return fmt.Errorf("Transaction is dated too far in the future to be included in the current block")
+		e := fct.NewValidationError(fct.ERR_TOO_NEW, "Transaction is dated too far in the future to be included in the current block")
+		e.Required = uint64(tsblk + fct.TRANSACTION_POST_LIMIT)
+		e.Provided = uint64(tstrans)
+		return e
+	}
+	return nil
+}
+
+// Checks that no input of the transaction is time locked past a block of
+// the given height and coinbase timestamp, and that no hash time lock is
+// refunded before its refund height.
+func checkLocks(dbheight uint32, tsblk int64, trans fct.ITransaction) error {
+	var milliTime uint64
+	if tsblk > 0 {
+		milliTime = uint64(tsblk)
+	}
+	sigblks := trans.GetSignatureBlocks()
+	for i, rcd := range trans.GetRCDs() {
+		var e *fct.ValidationError
+		switch lock := rcd.(type) {
+		case fct.IRCD_3:
+			if lock.IsUnlocked(dbheight, milliTime) {
+				continue
+			}
+			e = fct.NewValidationError(fct.ERR_LOCKED, "Input %d is locked until %s %d", i, lock.GetLockKind(), lock.GetLockValue())
+			e.Required = lock.GetLockValue()
+			e.Provided = milliTime
+			if lock.GetLockKind() == fct.LOCK_DBHEIGHT {
+				e.Provided = uint64(dbheight)
+			}
+		case fct.IRCD_4:
+			// An input without a signature block has no preimage.
+			claimed := i < len(sigblks) && sigblks[i] != nil && len(sigblks[i].GetPreimage()) > 0
+			if claimed || lock.IsRefundable(dbheight) {
+				continue
+			}
+			e = fct.NewValidationError(fct.ERR_LOCKED, "Input %d can't be refunded until dbheight %d", i, lock.GetRefundHeight())
+			e.Required = uint64(lock.GetRefundHeight())
+			e.Provided = uint64(dbheight)
+		default:
+			continue
+		}
+		e.Input = i
+		if i < len(trans.GetInputs()) {
+			e.Address = trans.GetInputs()[i].GetAddress()
+		}
+		return e
 	}
 	return nil
 }
@@ -199,7 +315,10 @@ func (fs *FactoidState) AddTransaction(index int, trans fct.ITransaction) error
 	if err := fs.ValidateTransactionAge(trans); err != nil {
 		return err
 	}
-	if err := fs.UpdateTransaction(trans); err != nil {
+	err := fs.batch(func() error {
+		return fs.UpdateTransaction(trans)
+	})
+	if err != nil {
 		return err
 	}
 	if err := fs.currentBlock.AddTransaction(trans); err != nil {
@@ -246,28 +365,42 @@ func (fs *FactoidState) ProcessEndOfMinute() {
 
 // End of Block means packing the current block away, and setting
 // up the next block.
-func (fs *FactoidState) ProcessEndOfBlock() {
+func (fs *FactoidState) ProcessEndOfBlock() error {
 	var hash, hash2 fct.IHash
 
 	if fs.GetCurrentBlock() == nil {
-		panic("Invalid state on initialization")
+		return fmt.Errorf("Invalid state on initialization")
 	}
 
 	hash = fs.currentBlock.GetHash()
 	hash2 = fs.currentBlock.GetLedgerKeyMR()
 
-	fs.PutTransactionBlock(hash, fs.currentBlock)
-	fs.PutTransactionBlock(fct.FACTOID_CHAINID_HASH, fs.currentBlock)
+	dbheight := fs.dbheight + 1
+	nextBlock := block.NewFBlock(fs.GetFactoshisPerEC(), dbheight)
 
-	fs.dbheight += 1
-	fs.currentBlock = block.NewFBlock(fs.GetFactoshisPerEC(), fs.dbheight)
+	t := block.GetCoinbase(fs.GetTimeMilli(), dbheight)
+	err := nextBlock.AddCoinbase(t)
+	if err != nil {
+		return err
+	}
 
-	t := block.GetCoinbase(fs.GetTimeMilli())
-	err := fs.currentBlock.AddCoinbase(t)
+	// The block, the new head, and the coinbase payouts of the next block
+	// are written together.
+	err = fs.batch(func() error {
+		if err := fs.PutTransactionBlock(hash, fs.currentBlock); err != nil {
+			return err
+		}
+		if err := fs.PutTransactionBlock(fct.FACTOID_CHAINID_HASH, fs.currentBlock); err != nil {
+			return err
+		}
+		return fs.UpdateTransaction(t)
+	})
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	fs.UpdateTransaction(t)
+
+	fs.dbheight = dbheight
+	fs.currentBlock = nextBlock
 
 	if hash != nil {
 		fs.currentBlock.SetPrevKeyMR(hash.Bytes())
@@ -280,12 +413,14 @@ func (fs *FactoidState) ProcessEndOfBlock() {
 		fmt.Sprintf("Directory Block Height: %d", fs.GetDBHeight()), // Title
 		"", // Msg
 		0)
+
+	return nil
 }
 
 // End of Block means packing the current block away, and setting
 // up the next block.
 // this function is to replace the existing function: ProcessEndOfBlock
-func (fs *FactoidState) ProcessEndOfBlock2(nextBlkHeight uint32) {
+func (fs *FactoidState) ProcessEndOfBlock2(nextBlkHeight uint32) error {
 	var hash, hash2 fct.IHash
 
 	if fs.currentBlock != nil { // If no blocks, the current block is nil
@@ -293,14 +428,20 @@ func (fs *FactoidState) ProcessEndOfBlock2(nextBlkHeight uint32) {
 		hash2 = fs.currentBlock.GetLedgerKeyMR()
 	}
 
-	fs.currentBlock = block.NewFBlock(fs.GetFactoshisPerEC(), nextBlkHeight)
+	nextBlock := block.NewFBlock(fs.GetFactoshisPerEC(), nextBlkHeight)
 
-	t := block.GetCoinbase(fs.GetTimeMilli())
-	err := fs.currentBlock.AddCoinbase(t)
+	t := block.GetCoinbase(fs.GetTimeMilli(), nextBlkHeight)
+	err := nextBlock.AddCoinbase(t)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
-	fs.UpdateTransaction(t)
+	err = fs.batch(func() error {
+		return fs.UpdateTransaction(t)
+	})
+	if err != nil {
+		return err
+	}
+	fs.currentBlock = nextBlock
 
 	if hash != nil {
 		fs.currentBlock.SetPrevKeyMR(hash.Bytes())
@@ -314,11 +455,15 @@ func (fs *FactoidState) ProcessEndOfBlock2(nextBlkHeight uint32) {
 		"", // Msg
 		0)
 
+	return nil
 }
 
 func (fs *FactoidState) LoadState() error {
 	var hashes []fct.IHash
-	cblk := fs.GetTransactionBlock(fct.FACTOID_CHAINID_HASH)
+	cblk, err := fs.GetTransactionBlock(fct.FACTOID_CHAINID_HASH)
+	if err != nil {
+		return err
+	}
 	// If there is no head for the Factoids in the database, we have an
 	// uninitialized database.  We need to add the Genesis Block. TODO
 	if cblk == nil {
@@ -328,17 +473,26 @@ func (fs *FactoidState) LoadState() error {
 			"Creating the Factoid Genesis Block", // Title
 			"", // Msg
 			60) // Expire
-		//gb := block.GetGenesisFBlock(fs.GetTimeMilli(), 1000000,10,200000000000)
-		gb := block.GetGenesisFBlock()
-		fs.PutTransactionBlock(gb.GetHash(), gb)
-		fs.PutTransactionBlock(fct.FACTOID_CHAINID_HASH, gb)
-		err := fs.AddTransactionBlock(gb)
+		gb := fs.GetGenesisBlock()
+		err := fs.ValidateBlock(gb)
+		if err == nil {
+			// The genesis block and its balances are written together
+			err = fs.batch(func() error {
+				if err := fs.PutTransactionBlock(gb.GetHash(), gb); err != nil {
+					return err
+				}
+				if err := fs.PutTransactionBlock(fct.FACTOID_CHAINID_HASH, gb); err != nil {
+					return err
+				}
+				return fs.updateTransactions(gb)
+			})
+		}
 		if err != nil {
 			fct.Prtln("Failed to build initial state.\n", err)
 			return err
 		}
-		fs.ProcessEndOfBlock()
-		return nil
+		fs.addedTransactionBlock(gb)
+		return fs.ProcessEndOfBlock()
 	}
 	blk := cblk
 	// First run back from the head back to the genesis block, collecting hashes.
@@ -355,9 +509,15 @@ func (fs *FactoidState) LoadState() error {
 		}
 		hashes = append(hashes, h)
 		if bytes.Compare(blk.GetPrevKeyMR().Bytes(), fct.ZERO_HASH) == 0 {
+			if !h.IsSameAs(fs.GetGenesisBlock().GetHash()) {
+				return fmt.Errorf("The database was built from a different genesis block")
+			}
 			break
 		}
-		tblk := fs.GetTransactionBlock(blk.GetPrevKeyMR())
+		tblk, err := fs.GetTransactionBlock(blk.GetPrevKeyMR())
+		if err != nil {
+			return err
+		}
 		if tblk == nil {
 			return fmt.Errorf("Failed to find the block at height: %d", blk.GetDBHeight()-1)
 		}
@@ -377,7 +537,10 @@ func (fs *FactoidState) LoadState() error {
 
 	// Now run forward, and build our accounting
 	for i := len(hashes) - 1; i >= 0; i-- {
-		blk = fs.GetTransactionBlock(hashes[i])
+		blk, err = fs.GetTransactionBlock(hashes[i])
+		if err != nil {
+			return err
+		}
 		if blk == nil {
 
 			return fmt.Errorf("Should never happen.  Block not found in the Database\n"+
@@ -385,7 +548,7 @@ func (fs *FactoidState) LoadState() error {
 
 		}
 
-		err := fs.AddTransactionBlock(blk) // updates accounting for this block
+		err := fs.ReplayTransactionBlock(blk) // updates accounting for this block
 		if err != nil {
 			fct.Prtln("Failed to rebuild state.\n", err)
 			return err
@@ -400,8 +563,7 @@ func (fs *FactoidState) LoadState() error {
 	}
 
 	fs.dbheight = blk.GetDBHeight()
-	fs.ProcessEndOfBlock()
-	return nil
+	return fs.ProcessEndOfBlock()
 }
 
 // Returns an error message about what is wrong with the transaction if it is
@@ -413,17 +575,29 @@ func (fs *FactoidState) Validate(index int, trans fct.ITransaction) error {
 	}
 
 	var sums = make(map[[32]byte]uint64, 10)  // Look at the sum of an address's inputs
-	for _, input := range trans.GetInputs() { //    to a transaction.
+	for i, input := range trans.GetInputs() { //    to a transaction.
 		bal, err := fct.ValidateAmounts(sums[input.GetAddress().Fixed()], input.GetAmount())
 		if err != nil {
 			return err
 		}
-		if bal > fs.GetBalance(input.GetAddress()) {
-			return fmt.Errorf("Not enough funds in input addresses for the transaction")
+		available, err := fs.GetBalance(input.GetAddress())
+		if err != nil {
+			return err
+		}
+		if bal > available {
+			e := fct.NewValidationError(fct.ERR_INSUFFICIENT_FUNDS, "Not enough funds in input addresses for the transaction")
+			e.Input = i
+			e.Address = input.GetAddress()
+			e.Required = bal
+			e.Provided = available
+			return e
 		}
 		sums[input.GetAddress().Fixed()] = bal
 	}
-	return nil
+
+	// Time locked inputs can't be spent before their lock expires
+	blk := fs.GetCurrentBlock()
+	return checkLocks(blk.GetDBHeight(), blk.GetCoinbaseTimestamp(), trans)
 }
 
 func (fs *FactoidState) GetFactoshisPerEC() uint64 {
@@ -434,16 +608,19 @@ func (fs *FactoidState) SetFactoshisPerEC(factoshisPerEC uint64) {
 	fs.factoshisPerEC = factoshisPerEC
 }
 
-func (fs *FactoidState) PutTransactionBlock(hash fct.IHash, trans block.IFBlock) {
-	fs.database.Put(fct.DB_FACTOID_BLOCKS, hash, trans)
+func (fs *FactoidState) PutTransactionBlock(hash fct.IHash, trans block.IFBlock) error {
+	return fs.database.Put(fct.DB_FACTOID_BLOCKS, hash, trans)
 }
 
-func (fs *FactoidState) GetTransactionBlock(hash fct.IHash) block.IFBlock {
-	transblk := fs.database.Get(fct.DB_FACTOID_BLOCKS, hash)
+func (fs *FactoidState) GetTransactionBlock(hash fct.IHash) (block.IFBlock, error) {
+	transblk, err := fs.database.Get(fct.DB_FACTOID_BLOCKS, hash)
+	if err != nil {
+		return nil, err
+	}
 	if transblk == nil {
-		return nil
+		return nil, nil
 	}
-	return transblk.(block.IFBlock)
+	return transblk.(block.IFBlock), nil
 }
 
 func (fs *FactoidState) GetTimeMilli() uint64 {
@@ -463,67 +640,85 @@ func (fs *FactoidState) GetDB() db.IFDatabase {
 }
 
 // Any address that is not defined has a zero balance.
-func (fs *FactoidState) GetBalance(address fct.IAddress) uint64 {
-	balance := uint64(0)
-	b := fs.database.GetRaw([]byte(fct.DB_F_BALANCES), address.Bytes())
-	if b != nil {
-		balance = b.(*FSbalance).number
-	}
-	return balance
+func (fs *FactoidState) GetBalance(address fct.IAddress) (uint64, error) {
+	return fs.getBalance(fct.DB_F_BALANCES, address)
 }
 
 // Any address that is not defined has a zero balance.
-func (fs *FactoidState) GetECBalance(address fct.IAddress) uint64 {
-	balance := uint64(0)
-	b := fs.database.GetRaw([]byte(fct.DB_EC_BALANCES), address.Bytes())
-	if b != nil {
-		balance = b.(*FSbalance).number
+func (fs *FactoidState) GetECBalance(address fct.IAddress) (uint64, error) {
+	return fs.getBalance(fct.DB_EC_BALANCES, address)
+}
+
+func (fs *FactoidState) getBalance(bucket string, address fct.IAddress) (uint64, error) {
+	b, err := fs.database.GetRaw([]byte(bucket), address.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	if b == nil {
+		return 0, nil
 	}
-	return balance
+	return b.(*FSbalance).number, nil
 }
 
 // Update balance throws an error if your update will drive the balance negative.
 func (fs *FactoidState) UpdateBalance(address fct.IAddress, amount int64) error {
-	nbalance := int64(fs.GetBalance(address)) + amount
+	bal, err := fs.GetBalance(address)
+	if err != nil {
+		return err
+	}
+	nbalance := int64(bal) + amount
 	if nbalance < 0 {
-		return fmt.Errorf("The update to this address would drive the balance negative.")
+		e := fct.NewValidationError(fct.ERR_INSUFFICIENT_FUNDS, "The update to this address would drive the balance negative.")
+		e.Address = address
+		return e
 	}
 	balance := uint64(nbalance)
-	fs.database.PutRaw([]byte(fct.DB_F_BALANCES), address.Bytes(), &FSbalance{number: balance})
-
-	return nil
+	return fs.database.PutRaw([]byte(fct.DB_F_BALANCES), address.Bytes(), &FSbalance{number: balance})
 }
 
 // Update ec balance throws an error if your update will drive the balance negative.
 func (fs *FactoidState) UpdateECBalance(address fct.IAddress, amount int64) error {
-	nbalance := int64(fs.GetECBalance(address)) + amount
+	bal, err := fs.GetECBalance(address)
+	if err != nil {
+		return err
+	}
+	nbalance := int64(bal) + amount
 	if nbalance < 0 {
-		return fmt.Errorf("The update to this Entry Credit address would drive the balance negative.")
+		e := fct.NewValidationError(fct.ERR_INSUFFICIENT_FUNDS, "The update to this Entry Credit address would drive the balance negative.")
+		e.Address = address
+		return e
 	}
 	balance := uint64(nbalance)
-	fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
-
-	return nil
+	return fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
 }
 
 // Add to Entry Credit Balance.  Note Entry Credit balances are maintained
 // as entry credits, not Factoids.  But adding is done in Factoids, using
 // done in Entry Credits. Using lowers the Entry Credit Balance.
 func (fs *FactoidState) AddToECBalance(address fct.IAddress, amount uint64) error {
-	ecs := amount / fs.GetFactoshisPerEC()
-	balance := fs.GetECBalance(address) + ecs
-	fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
-	return nil
+	ecs, err := fct.Amount(amount).ToEC(fs.GetFactoshisPerEC(), fct.ROUND_DOWN)
+	if err != nil {
+		return err
+	}
+	bal, err := fs.GetECBalance(address)
+	if err != nil {
+		return err
+	}
+	balance := bal + ecs
+	return fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
 }
 
 // Use Entry Credits.  Note Entry Credit balances are maintained
 // as entry credits, not Factoids.  But adding is done in Factoids, using
 // done in Entry Credits.  Using lowers the Entry Credit Balance.
 func (fs *FactoidState) UseECs(address fct.IAddress, amount uint64) error {
-	balance := fs.GetECBalance(address) - amount
+	bal, err := fs.GetECBalance(address)
+	if err != nil {
+		return err
+	}
+	balance := bal - amount
 	if balance < 0 {
 		return fmt.Errorf("Overdraft of Entry Credits attempted.")
 	}
-	fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
-	return nil
+	return fs.database.PutRaw([]byte(fct.DB_EC_BALANCES), address.Bytes(), &FSbalance{number: balance})
 }
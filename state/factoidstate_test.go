@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"github.com/FactomProject/ed25519"
 	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/block"
 	"github.com/FactomProject/factoid/database"
 	"math/rand"
 	"testing"
@@ -63,3 +64,214 @@ func Test_updating_balances_FactoidState(test *testing.T) {
 	fs.database = GetDatabase()
 
 }
+
+func Test_LoadState_genesis_FactoidState(test *testing.T) {
+	adr := fct.NewAddress(fct.Sha([]byte("genesis funds")).Bytes())
+	allocations := []block.GenesisAllocation{{Address: adr, Amount: 200000000000}}
+	gb, err := block.NewGenesisFBlock(1000, 666600, allocations)
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+
+	db := new(database.MapDB)
+	db.Init()
+
+	fs := new(FactoidState)
+	fs.SetDB(db)
+	fs.SetGenesisBlock(gb)
+	if err := fs.LoadState(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	if bal, _ := fs.GetBalance(adr); bal != 200000000000 {
+		fct.Prtln("Genesis allocation not funded: ", bal)
+		test.Fail()
+	}
+
+	// Reloading the same database rebuilds the same balances.
+	fs2 := new(FactoidState)
+	fs2.SetDB(db)
+	fs2.SetGenesisBlock(gb)
+	if err := fs2.LoadState(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+
+	// But the database can't be loaded against another genesis block.
+	fs3 := new(FactoidState)
+	fs3.SetDB(db)
+	if err := fs3.LoadState(); err == nil {
+		fct.Prtln("Loaded a database built from another genesis block")
+		test.Fail()
+	}
+}
+
+// A database that reports every record in one bucket as corrupted.
+type corruptDB struct {
+	database.MapDB
+	bucket string
+}
+
+func (db *corruptDB) GetRaw(bucket []byte, key []byte) (fct.IBlock, error) {
+	if string(bucket) == db.bucket {
+		return nil, database.NewCorruptionError("Test corruption")
+	}
+	return db.MapDB.GetRaw(bucket, key)
+}
+
+func Test_database_errors_FactoidState(test *testing.T) {
+	adr := fct.NewAddress(fct.Sha([]byte("genesis funds")).Bytes())
+	allocations := []block.GenesisAllocation{{Address: adr, Amount: 200000000000}}
+	gb, _ := block.NewGenesisFBlock(1000, 666600, allocations)
+
+	db := new(corruptDB)
+	db.Init()
+	db.bucket = fct.DB_F_BALANCES
+
+	fs := new(FactoidState)
+	fs.SetDB(new(database.MapDB))
+	fs.GetDB().Init()
+	fs.GetDB().SetPersist(db)
+	fs.SetGenesisBlock(gb)
+
+	if _, err := fs.GetBalance(adr); !database.IsCorruption(err) {
+		fct.Prtln("Expected a corrupted balance, got: ", err)
+		test.Fail()
+	}
+	if err := fs.LoadState(); !database.IsCorruption(err) {
+		fct.Prtln("Expected LoadState to report the corruption, got: ", err)
+		test.Fail()
+	}
+}
+
+// A database that fails to commit any batch.
+type failingCommitDB struct {
+	database.MapDB
+}
+
+func (db *failingCommitDB) Commit() error {
+	db.Rollback()
+	return fmt.Errorf("Disk full")
+}
+
+func Test_block_batch_FactoidState(test *testing.T) {
+	adr := fct.NewAddress(fct.Sha([]byte("genesis funds")).Bytes())
+	allocations := []block.GenesisAllocation{{Address: adr, Amount: 200000000000}}
+	gb, _ := block.NewGenesisFBlock(1000, 666600, allocations)
+
+	persist := new(failingCommitDB)
+	persist.Init()
+
+	fs := new(FactoidState)
+	fs.SetDB(new(database.MapDB))
+	fs.GetDB().Init()
+	fs.GetDB().SetPersist(persist)
+	fs.SetGenesisBlock(gb)
+
+	if err := fs.LoadState(); err == nil {
+		fct.Prtln("LoadState should fail when the block can't be committed")
+		test.Fail()
+	}
+	if bal, _ := fs.GetBalance(adr); bal != 0 {
+		fct.Prtln("Balances of a block that failed to commit were kept")
+		test.Fail()
+	}
+	if blk, _ := fs.GetTransactionBlock(fct.FACTOID_CHAINID_HASH); blk != nil {
+		fct.Prtln("The head of a block that failed to commit was kept")
+		test.Fail()
+	}
+}
+
+// A state whose balances are held in memory, over a FaultDB that holds the
+// blocks, as stateinit builds it over a BoltDB.
+func newFaultState(fdb *database.FaultDB, gb block.IFBlock) *FactoidState {
+	db := new(database.MapDB)
+	db.Init()
+	db.SetPersist(fdb)
+	db.SetBacker(fdb)
+	db.DoNotPersist(fct.DB_F_BALANCES)
+	db.DoNotPersist(fct.DB_EC_BALANCES)
+
+	fs := new(FactoidState)
+	fs.SetDB(db)
+	fs.SetGenesisBlock(gb)
+	return fs
+}
+
+func Test_crash_recovery_FactoidState(test *testing.T) {
+	adr := fct.NewAddress(fct.Sha([]byte("genesis funds")).Bytes())
+	allocations := []block.GenesisAllocation{{Address: adr, Amount: 200000000000}}
+	gb, _ := block.NewGenesisFBlock(1000, 666600, allocations)
+
+	buckets := [][]byte{
+		[]byte(fct.DB_FACTOID_BLOCKS),
+		[]byte(fct.DB_F_BALANCES),
+		[]byte(fct.DB_EC_BALANCES),
+	}
+	fdb := new(database.FaultDB)
+	fdb.Init(buckets)
+
+	fs := newFaultState(fdb, gb)
+	if err := fs.LoadState(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if err := fs.ProcessEndOfBlock(); err != nil {
+			fct.Prtln(err)
+			test.Fail()
+			return
+		}
+	}
+
+	// The disk fails while a block is written, and then we crash.
+	height := fs.GetDBHeight()
+	fdb.InjectFault(1, database.FAULT_FAIL)
+	if err := fs.ProcessEndOfBlock(); err == nil {
+		fct.Prtln("ProcessEndOfBlock should report the failed write")
+		test.Fail()
+	}
+	if fs.GetDBHeight() != height {
+		fct.Prtln("The height moved past a block that was not written")
+		test.Fail()
+	}
+	fdb.Close()
+	fdb.Init(buckets)
+
+	// On restart, we are back at the last block written, with the same
+	// balances.
+	fs2 := newFaultState(fdb, gb)
+	if err := fs2.LoadState(); err != nil {
+		fct.Prtln("Failed to recover: ", err)
+		test.Fail()
+		return
+	}
+	if fs2.GetDBHeight() != height {
+		fct.Prtln("Recovered at height ", fs2.GetDBHeight(), " expected ", height)
+		test.Fail()
+	}
+	if bal, _ := fs2.GetBalance(adr); bal != 200000000000 {
+		fct.Prtln("Recovered the wrong balance: ", bal)
+		test.Fail()
+	}
+
+	// A block written to a disk that damages it is found on restart.
+	fdb.InjectFault(1, database.FAULT_CORRUPT)
+	if err := fs2.ProcessEndOfBlock(); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	fdb.Close()
+	fdb.Init(buckets)
+
+	fs3 := newFaultState(fdb, gb)
+	if err := fs3.LoadState(); !database.IsCorruption(err) {
+		fct.Prtln("Expected LoadState to find the corrupted block, got: ", err)
+		test.Fail()
+	}
+}
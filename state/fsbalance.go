@@ -10,6 +10,7 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	fct "github.com/FactomProject/factoid"
 )
 
@@ -28,11 +29,18 @@ func (FSbalance) GetNewInstance() fct.IBlock {
 	return new(FSbalance)
 }
 
+func init() {
+	fct.RegisterType(new(FSbalance))
+}
+
 func (FSbalance) GetDBHash() fct.IHash {
 	return fct.Sha([]byte("FSbalance"))
 }
 
 func (f *FSbalance) UnmarshalBinaryData(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("Data source too short to unmarshal an FSbalance: %d", len(data))
+	}
 	num, data := binary.BigEndian.Uint64(data), data[8:]
 	f.number = num
 	return data, nil
@@ -12,87 +12,172 @@ package stateinit
 import (
 	"fmt"
 	fct "github.com/FactomProject/factoid"
-	"github.com/FactomProject/factoid/block"
 	"github.com/FactomProject/factoid/database"
 	"github.com/FactomProject/factoid/state"
 	"github.com/FactomProject/factoid/wallet"
+	"path/filepath"
+	"strings"
 )
 
 var _ = fmt.Printf
 
-func NewFactoidState(filename string) state.IFactoidState {
+// The most entries the chain database holds in memory.  Balances are not
+// persisted, so they are held regardless.
+const CACHE_ENTRIES = 100000
+
+// Where the chain state and the wallet are kept.  They are separate
+// databases, so the chain can be deleted and resynced without touching
+// the keys in the wallet.
+type Paths struct {
+	Chain  string
+	Wallet string
+}
+
+// The wallet is kept beside the chain database, with "_wallet" added to
+// its name.
+func DefaultPaths(filename string) Paths {
+	ext := filepath.Ext(filename)
+	return Paths{
+		Chain:  filename,
+		Wallet: strings.TrimSuffix(filename, ext) + "_wallet" + ext,
+	}
+}
+
+func NewFactoidState(filename string) (state.IFactoidState, error) {
+	return NewFactoidStateAt(DefaultPaths(filename))
+}
+
+func NewFactoidStateAt(paths Paths) (state.IFactoidState, error) {
 	fs := new(state.FactoidState)
 	wall := new(wallet.SCWallet)
-	wall.Init()
+	if err := wall.Init(); err != nil {
+		return nil, err
+	}
 
 	fs.SetWallet(wall)
-	fs.GetWallet().GetDB().Init()
-
-	// Use Bolt DB
-	if true {
-		fs.SetDB(new(database.MapDB))
-		fs.GetDB().Init()
-		db := GetDatabase(filename)
-		fs.GetDB().SetPersist(db)
-		fs.GetDB().SetBacker(db)
-		fs.GetWallet().GetDB().SetPersist(db)
-		fs.GetWallet().GetDB().SetBacker(db)
-
-		fs.GetDB().DoNotPersist(fct.DB_F_BALANCES)
-		fs.GetDB().DoNotPersist(fct.DB_EC_BALANCES)
-		fs.GetDB().DoNotPersist(fct.DB_BUILD_TRANS)
-		fs.GetDB().DoNotCache(fct.DB_FACTOID_BLOCKS)
-		fs.GetDB().DoNotCache(fct.DB_TRANSACTIONS)
-
-	} else {
-		fs.SetDB(GetDatabase(filename))
+
+	fs.SetDB(new(database.LRUDB))
+	if err := fs.GetDB().Init(CACHE_ENTRIES); err != nil {
+		return nil, err
+	}
+	chain, err := GetDatabase(paths.Chain)
+	if err != nil {
+		return nil, err
 	}
+	fs.GetDB().SetPersist(chain)
+	fs.GetDB().SetBacker(chain)
+
+	fs.GetDB().DoNotPersist(fct.DB_F_BALANCES)
+	fs.GetDB().DoNotPersist(fct.DB_EC_BALANCES)
+	fs.GetDB().DoNotPersist(fct.DB_BUILD_TRANS)
+	fs.GetDB().DoNotCache(fct.DB_FACTOID_BLOCKS)
+	fs.GetDB().DoNotCache(fct.DB_TRANSACTIONS)
+
+	walletDB, err := GetWalletDatabase(paths.Wallet)
+	if err != nil {
+		chain.Close()
+		return nil, err
+	}
+	if err := importWallet(chain, walletDB); err != nil {
+		chain.Close()
+		walletDB.Close()
+		return nil, err
+	}
+	fs.GetWallet().GetDB().SetPersist(walletDB)
+	fs.GetWallet().GetDB().SetBacker(walletDB)
 
-	return fs
+	return fs, nil
 }
 
-func GetDatabase(filename string) database.IFDatabase {
+// Get the chain database.
+func GetDatabase(filename string) (database.IFDatabase, error) {
+	return openDatabase(filename, GetBucketList())
+}
 
-	var bucketList [][]byte
-	var instances map[[fct.ADDRESS_LENGTH]byte]fct.IBlock
+func GetWalletDatabase(filename string) (database.IFDatabase, error) {
+	return openDatabase(filename, GetWalletBucketList())
+}
+
+// Files with the LogDB extension are opened as a LogDB.  Anything else is
+// a BoltDB.  The types the databases hold are found in the registry of
+// IBlock types, which the packages imported here fill in as they load.
+func openDatabase(filename string, buckets [][]byte) (database.IFDatabase, error) {
+	var db database.IFDatabase = new(database.BoltDB)
+	if filepath.Ext(filename) == database.LOGDB_EXT {
+		db = new(database.LogDB)
+	}
+	if err := db.Init(buckets, filename); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Chain databases written before the wallet had its own database hold the
+// wallet too.  If the wallet database is empty, the wallet is copied out of
+// the chain database.  The copy in the chain database is left alone.
+func importWallet(chain database.IFDatabase, walletDB database.IFDatabase) error {
+	keys, _, err := walletDB.GetKeysValues([]byte(fct.W_SEEDS))
+	if err != nil || len(keys) > 0 {
+		return err
+	}
+	// The wallet types are found in the registry of IBlock types, so the
+	// chain database reads the wallet without being told about them.
+	if err := walletDB.Begin(); err != nil {
+		return err
+	}
+	for _, bucket := range GetWalletBucketList() {
+		if err := copyBucket(chain, walletDB, bucket); err != nil {
+			walletDB.Rollback()
+			return err
+		}
+	}
+	return walletDB.Commit()
+}
 
+func copyBucket(from database.IFDatabase, to database.IFDatabase, bucket []byte) error {
+	it, err := from.Iterate(bucket, nil)
+	if database.IsNoBucket(err) {
+		return nil // The bucket isn't there, so there is nothing to copy
+	}
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if err := to.PutRaw(bucket, it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// The buckets the chain database holds.
+func GetBucketList() [][]byte {
+
+	var bucketList [][]byte
 	bucketList = make([][]byte, 0, 5)
 
 	bucketList = append(bucketList, []byte(fct.DB_FACTOID_BLOCKS))
 	bucketList = append(bucketList, []byte(fct.DB_BAD_TRANS))
 	bucketList = append(bucketList, []byte(fct.DB_F_BALANCES))
 	bucketList = append(bucketList, []byte(fct.DB_EC_BALANCES))
-
 	bucketList = append(bucketList, []byte(fct.DB_BUILD_TRANS))
 	bucketList = append(bucketList, []byte(fct.DB_TRANSACTIONS))
+
+	return bucketList
+}
+
+// The buckets the wallet database holds.
+func GetWalletBucketList() [][]byte {
+
+	var bucketList [][]byte
+	bucketList = make([][]byte, 0, 5)
+
 	bucketList = append(bucketList, []byte(fct.W_RCD_ADDRESS_HASH))
 	bucketList = append(bucketList, []byte(fct.W_ADDRESS_PUB_KEY))
 	bucketList = append(bucketList, []byte(fct.W_NAME))
 	bucketList = append(bucketList, []byte(fct.W_SEEDS))
 	bucketList = append(bucketList, []byte(fct.W_SEED_HEADS))
 
-	instances = make(map[[fct.ADDRESS_LENGTH]byte]fct.IBlock)
-
-	var addinstance = func(b fct.IBlock) {
-		key := new([32]byte)
-		copy(key[:], b.GetDBHash().Bytes())
-		instances[*key] = b
-	}
-	addinstance(new(database.ByteStore))
-	addinstance(new(fct.Address))
-	addinstance(new(fct.Hash))
-	addinstance(new(fct.InAddress))
-	addinstance(new(fct.OutAddress))
-	addinstance(new(fct.OutECAddress))
-	addinstance(new(fct.RCD_1))
-	addinstance(new(fct.RCD_2))
-	addinstance(new(fct.Signature))
-	addinstance(new(fct.Transaction))
-	addinstance(new(block.FBlock))
-	addinstance(new(state.FSbalance))
-	addinstance(new(wallet.WalletEntry))
-
-	db := new(database.BoltDB)
-	db.Init(bucketList, instances, filename)
-	return db
+	return bucketList
 }
@@ -0,0 +1,137 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package stateinit
+
+import (
+	"bytes"
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/database"
+	"os"
+	"testing"
+)
+
+func Test_DefaultPaths(test *testing.T) {
+	p := DefaultPaths("/tmp/factoid_bolt.db")
+	if p.Chain != "/tmp/factoid_bolt.db" || p.Wallet != "/tmp/factoid_bolt_wallet.db" {
+		fct.Prtln("Unexpected paths: ", p)
+		test.Fail()
+	}
+}
+
+func Test_separate_wallet_database(test *testing.T) {
+	paths := Paths{Chain: "/tmp/stateinit_chain.db", Wallet: "/tmp/stateinit_wallet.db"}
+	os.Remove(paths.Chain)
+	os.Remove(paths.Wallet)
+	defer os.Remove(paths.Chain)
+	defer os.Remove(paths.Wallet)
+
+	// A chain database from before the wallet had its own database.
+	legacy := new(database.BoltDB)
+	if err := legacy.Init(append(GetBucketList(), GetWalletBucketList()...), paths.Chain); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	seed := new(database.ByteStore)
+	seed.SetBytes(fct.Sha([]byte("legacy seed")).Bytes())
+	legacy.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], seed)
+	legacy.Close()
+
+	fs, err := NewFactoidStateAt(paths)
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	chain := fs.GetDB().GetPersist()
+	walletDB := fs.GetWallet().GetDB().GetPersist()
+	defer chain.Close()
+	defer walletDB.Close()
+
+	if chain == walletDB {
+		fct.Prtln("The wallet and the chain share a database")
+		test.Fail()
+	}
+
+	// The wallet was copied out of the chain database.
+	v, err := walletDB.GetRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:])
+	if err != nil || v == nil || !bytes.Equal(v.(database.IByteStore).Bytes(), seed.Bytes()) {
+		fct.Prtln("The legacy wallet was not imported: ", err)
+		test.Fail()
+	}
+
+	// New wallet writes go only to the wallet database.
+	if err := fs.GetWallet().SetSeed(fct.Sha([]byte("new seed")).Bytes()); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+	v, _ = chain.GetRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:])
+	if v == nil || !bytes.Equal(v.(database.IByteStore).Bytes(), seed.Bytes()) {
+		fct.Prtln("A wallet write reached the chain database")
+		test.Fail()
+	}
+
+	// The chain database does not hold wallet buckets, nor the wallet
+	// database chain buckets.
+	if _, err := walletDB.Iterate([]byte(fct.DB_FACTOID_BLOCKS), nil); err == nil {
+		fct.Prtln("The wallet database holds chain buckets")
+		test.Fail()
+	}
+}
+
+func Test_LogDB_extension(test *testing.T) {
+	filename := "/tmp/stateinit_test" + database.LOGDB_EXT
+	os.Remove(filename)
+	defer os.Remove(filename)
+	db, err := GetDatabase(filename)
+	if err != nil {
+		fct.Prtln(err)
+		test.Fail()
+		return
+	}
+	defer db.Close()
+	if _, ok := db.(*database.LogDB); !ok {
+		fct.Prtln("Expected a LogDB for ", filename)
+		test.Fail()
+	}
+}
+
+// A wallet bucket that can't be read stops the import, rather than leaving
+// a partial wallet that would never be imported again.
+func Test_importWallet_read_failure(test *testing.T) {
+	seed := new(database.ByteStore)
+	seed.SetBytes(fct.Sha([]byte("legacy seed")).Bytes())
+
+	// Only some of the wallet buckets are there, which is fine.
+	chain := new(database.FaultDB)
+	chain.Init([][]byte{[]byte(fct.W_SEEDS)})
+	chain.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], seed)
+	walletDB := new(database.FaultDB)
+	walletDB.Init(GetWalletBucketList())
+	if err := importWallet(chain, walletDB); err != nil {
+		fct.Prtln("Missing buckets should be skipped: ", err)
+		test.Fail()
+	}
+	if v, _ := walletDB.GetRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:]); v == nil {
+		fct.Prtln("The seed was not imported")
+		test.Fail()
+	}
+
+	chain = new(database.FaultDB)
+	chain.Init(GetWalletBucketList())
+	chain.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], seed)
+	chain.InjectFault(1, database.FAULT_CORRUPT)
+	chain.PutRaw([]byte(fct.W_NAME), []byte("name"), seed)
+	walletDB = new(database.FaultDB)
+	walletDB.Init(GetWalletBucketList())
+	if err := importWallet(chain, walletDB); !database.IsCorruption(err) {
+		fct.Prtln("Expected the unreadable bucket to fail the import: ", err)
+		test.Fail()
+	}
+	if keys, _, _ := walletDB.GetKeysValues([]byte(fct.W_SEEDS)); len(keys) != 0 {
+		fct.Prtln("A partial wallet was imported")
+		test.Fail()
+	}
+}
@@ -5,7 +5,6 @@
 package test
 
 import (
-	"bytes"
 	"fmt"
 	fct "github.com/FactomProject/factoid"
 	"github.com/FactomProject/factoid/state"
@@ -67,7 +66,7 @@ func (fs *Test_state) newTransaction(maxIn, maxOut int) fct.ITransaction {
 	var max, max2 uint64
 	fs.inputAddresses = make([]fct.IAddress, 0, 20)
 	for _, output := range fs.outputAddresses {
-		bal := fs.GetBalance(output)
+		bal, _ := fs.GetBalance(output)
 		if bal > 100000 {
 			fs.inputAddresses = append(fs.inputAddresses, output)
 		}
@@ -122,7 +121,7 @@ func (fs *Test_state) newTransaction(maxIn, maxOut int) fct.ITransaction {
 	var paid uint64
 	t := fs.twallet.CreateTransaction(fs.GetTimeMilli())
 	for _, adr := range inputs {
-		balance := fs.GetBalance(adr)
+		balance, _ := fs.GetBalance(adr)
 		toPay := uint64(rand.Int63()) % (balance)
 		paid = toPay + paid
 		fs.twallet.AddInput(t, adr, toPay)
@@ -158,12 +157,12 @@ func (fs *Test_state) newTransaction(maxIn, maxOut int) fct.ITransaction {
 
 		fs.stats.badAddresses += 1
 
-		str := []byte(err.Error())[:10]
-		if bytes.Compare(str, []byte("The inputs")) != 0 {
-			str = []byte(err.Error())[:30]
+		if err == nil {
+			err = err1
 		}
-		fs.stats.errors[string(str)] += 1
-		fs.stats.full[string(str)] = err.Error()
+		kind := fct.GetValidationErrorKind(err).String()
+		fs.stats.errors[kind] += 1
+		fs.stats.full[kind] = err.Error()
 
 		return fs.newTransaction(maxIn, maxOut)
 	}
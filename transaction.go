@@ -21,23 +21,30 @@ type ITransaction interface {
 	// of the RCDs, so they are included indirectly.  The signatures
 	// sign this hash, so they are included indirectly.
 	MarshalBinarySig() ([]byte, error)
-	// Add an input to the transaction.  No validation.
-	AddInput(input IAddress, amount uint64)
+	// Marshals what the signature of the given input covers, by its
+	// sighash type.  For SIGHASH_ALL that is MarshalBinarySig().
+	MarshalBinarySigHash(input int, h SigHashType) ([]byte, error)
+	// Add an input to the transaction.  No validation.  The Add and Set
+	// methods only fail on a transaction that has been built.
+	AddInput(input IAddress, amount uint64) error
 	// Add an output to the transaction.  No validation.
-	AddOutput(output IAddress, amount uint64)
+	AddOutput(output IAddress, amount uint64) error
 	// Add an Entry Credit output to the transaction.  Denominated in
 	// Factoids, and interpreted by the exchange rate in the server at
 	// the time the transaction is added to Factom.
-	AddECOutput(ecoutput IAddress, amount uint64)
+	AddECOutput(ecoutput IAddress, amount uint64) error
 	// Add an RCD.  Must match the input in the same order.  Inputs and
 	// RCDs are generally added at the same time.
-	AddRCD(rcd IRCD)
+	AddRCD(rcd IRCD) error
+	// Replace the RCD of an input, as when the input itself is replaced.
+	SetRCD(i int, rcd IRCD) error
 
 	// Get the hash of the signed portion (not including signatures)
 	GetSigHash() IHash
 
 	// Accessors the inputs, outputs, and Entry Credit outputs (ecoutputs)
-	// to this transaction.
+	// to this transaction.  The slices are the transaction's own, not
+	// copies; don't change them.
 	GetInput(int) (IInAddress, error)
 	GetOutput(int) (IOutAddress, error)
 	GetECOutput(int) (IOutECAddress, error)
@@ -48,12 +55,15 @@ type ITransaction interface {
 	GetRCDs() []IRCD
 
 	GetVersion() uint64
+	// Only a version 3 transaction can have signatures that are not
+	// SIGHASH_ALL.  Set the version before signing, as it is signed.
+	SetVersion(uint64) error
 	// Locktime serves as a nonce to make every transaction unique. Transactions
 	// that are more than 24 hours old are not included nor propagated through
 	// the network.
 	GetMilliTimestamp() uint64
-	SetMilliTimestamp(uint64)
-	// Get a signature
+	SetMilliTimestamp(uint64) error
+	// Get a signature.  Signatures may be set on a built transaction.
 	GetSignatureBlock(i int) ISignatureBlock
 	SetSignatureBlock(i int, signatureblk ISignatureBlock)
 	GetSignatureBlocks() []ISignatureBlock
@@ -75,9 +85,9 @@ type ITransaction interface {
 }
 
 type Transaction struct {
-	TransactionID IHash // Unique hash for this transaction
-	BlockHeight   int   // Used internally.  You can't rely on this being set
-	// version     uint64         Version of transaction. Hardcoded, naturally.
+	TransactionID  IHash  // Unique hash for this transaction
+	BlockHeight    int    // Used internally.  You can't rely on this being set
+	version        uint64 // Version of transaction.  Zero is TRANSACTION_VERSION
 	MilliTimestamp uint64
 	// #inputs     uint8          number of inputs
 	// #outputs    uint8          number of outputs
@@ -87,6 +97,22 @@ type Transaction struct {
 	OutECs    []IOutECAddress
 	RCDs      []IRCD
 	SigBlocks []ISignatureBlock
+
+	// The cached MarshalBinarySig(), MarshalBinary() and GetHash() of the
+	// transaction.  TransactionID caches GetSigHash().  Any of them may be
+	// nil, and are built as needed, so even reading a transaction can
+	// write to it: a transaction shared between goroutines must be locked
+	// by its users, reads included.
+	//
+	// The caches are cleared by the Add and Set methods of the transaction,
+	// and of the inputs, outputs and signature blocks it holds.  The
+	// addresses, RCDs and signatures within them are values; replace them
+	// through those methods rather than changing them in place.
+	sigBin []byte
+	bin    []byte
+	hash   IHash
+
+	sealed bool // Built by a TransactionBuilder; see checkSealed()
 }
 
 var _ ITransaction = (*Transaction)(nil)
@@ -99,30 +125,79 @@ func (t *Transaction) GetBlockHeight() int {
 	return t.BlockHeight
 }
 
-// Clears caches if they are no long valid.
+// A transaction from TransactionBuilder.Build() has been validated, so only
+// its signatures may change.  The Add and Set methods of the transaction
+// and of its inputs and outputs return this error for any other change.
+//
+// The seal only covers those methods.  GetInputs() and the like return the
+// transaction's own slices, which must not be changed through.
+func (t *Transaction) checkSealed() error {
+	if t.sealed {
+		return fmt.Errorf("Cannot change a transaction once it has been built")
+	}
+	return nil
+}
+
+// True if the transaction came from TransactionBuilder.Build().
+func (t *Transaction) IsSealed() bool {
+	return t.sealed
+}
+
+// Clears the caches.  They are rebuilt when next asked for.
 func (t *Transaction) clearCaches() {
-	return
 	t.TransactionID = nil
+	t.sigBin = nil
+	t.clearBinCache()
 }
 
-func (Transaction) GetVersion() uint64 {
-	return 2
+// Clears just the caches that cover the signatures, as when a signature
+// block changes.
+func (t *Transaction) clearBinCache() {
+	t.bin = nil
+	t.hash = nil
 }
 
-func (t Transaction) GetHash() IHash {
-	m, err := t.MarshalBinary()
-	if err != nil {
-		return nil
+func (t Transaction) GetVersion() uint64 {
+	if t.version == 0 {
+		return TRANSACTION_VERSION
+	}
+	return t.version
+}
+
+func (t *Transaction) SetVersion(v uint64) error {
+	if v != TRANSACTION_VERSION && v != TRANSACTION_VERSION_SIGHASH {
+		return fmt.Errorf("Unknown Transaction Version %d", v)
+	}
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
+	t.version = v
+	t.clearCaches()
+	return nil
+}
+
+// The hash of the whole transaction, signatures included.  Cached; see
+// Transaction.
+func (t *Transaction) GetHash() IHash {
+	if t.hash == nil {
+		m, err := t.MarshalBinary()
+		if err != nil {
+			return nil
+		}
+		t.hash = Sha(m)
 	}
-	return Sha(m)
+	return t.hash
 }
 
+// The hash of the signed part of the transaction.  Cached; see Transaction.
 func (t *Transaction) GetSigHash() IHash {
-	m, err := t.MarshalBinarySig()
-	if err != nil {
-		return nil
+	if t.TransactionID == nil {
+		m, err := t.MarshalBinarySig()
+		if err != nil {
+			return nil
+		}
+		t.TransactionID = Sha(m)
 	}
-	t.TransactionID = Sha(m)
 	return t.TransactionID
 }
 
@@ -138,27 +213,72 @@ func (t Transaction) String() string {
 func (t *Transaction) GetMilliTimestamp() uint64 {
 	return t.MilliTimestamp
 }
-func (t *Transaction) SetMilliTimestamp(ts uint64) {
+func (t *Transaction) SetMilliTimestamp(ts uint64) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	t.MilliTimestamp = ts
+	t.clearCaches()
+	return nil
 }
 
 func (t *Transaction) SetSignatureBlock(i int, sig ISignatureBlock) {
 	for len(t.SigBlocks) <= i {
-		t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+		t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock())
+	}
+	if b, ok := sig.(*SignatureBlock); ok {
+		b.setOwner(t)
 	}
 	t.SigBlocks[i] = sig
+	t.clearBinCache()
 }
 
 func (t *Transaction) GetSignatureBlock(i int) ISignatureBlock {
 	for len(t.SigBlocks) <= i {
-		t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+		t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock())
 	}
 	return t.SigBlocks[i]
 }
 
-func (t *Transaction) AddRCD(rcd IRCD) {
+func (t *Transaction) newSignatureBlock() *SignatureBlock {
+	b := new(SignatureBlock)
+	b.setOwner(t)
+	return b
+}
+
+// The signature block of input i, or an empty one if it has none yet.
+// Marshaling uses this rather than GetSignatureBlock(), so that reading a
+// transaction doesn't add signature blocks to it.
+func (t *Transaction) sigBlockOrEmpty(i int) ISignatureBlock {
+	if i < len(t.SigBlocks) && t.SigBlocks[i] != nil {
+		return t.SigBlocks[i]
+	}
+	return new(SignatureBlock)
+}
+
+func (t *Transaction) AddRCD(rcd IRCD) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	t.RCDs = append(t.RCDs, rcd)
 	t.clearCaches()
+	return nil
+}
+
+func (t *Transaction) SetRCD(i int, rcd IRCD) error {
+	if i < 0 || i >= len(t.RCDs) {
+		return fmt.Errorf("Index out of Range")
+	}
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
+	t.RCDs[i] = rcd
+	t.clearCaches()
+	return nil
+}
+
+func init() {
+	RegisterType(new(Transaction))
 }
 
 func (Transaction) GetDBHash() IHash {
@@ -183,16 +303,19 @@ func (w1 Transaction) GetNewInstance() IBlock {
 //Number of signatures checked -- These cause expensive computation on
 //    all full nodes. A fee of 10 EC equivalent must be paid for each
 //    signature included.
-func (t Transaction) CalculateFee(factoshisPerEC uint64) (uint64, error) {
+func (t *Transaction) CalculateFee(factoshisPerEC uint64) (uint64, error) {
 
 	// First look at the size of the transaction, and make sure
 	// everything is inbounds.
 	data, err := t.MarshalBinary()
 	if err != nil {
-		return 0, fmt.Errorf("Can't Marshal the Transaction")
+		return 0, NewValidationError(ERR_MALFORMED, "Can't Marshal the Transaction")
 	}
 	if len(data) > MAX_TRANSACTION_SIZE { // Can't be bigger than our limits
-		return 0, fmt.Errorf("Transaction is greater than the max transaction size")
+		e := NewValidationError(ERR_TOO_LARGE, "Transaction is greater than the max transaction size")
+		e.Required = MAX_TRANSACTION_SIZE
+		e.Provided = uint64(len(data))
+		return 0, e
 	}
 	// Okay, we know the transaction is mostly good. Let's calculate
 	// fees.
@@ -213,14 +336,14 @@ func (t Transaction) CalculateFee(factoshisPerEC uint64) (uint64, error) {
 // a signed boundry.  Returns false if invalid, and the
 // sum if valid.  Returns 0 and true if nothing is passed in.
 func ValidateAmounts(amts ...uint64) (uint64, error) {
-	var sum int64
+	var sum Amount
 	for _, amt := range amts {
-		if int64(amt) < 0 {
-			return 0, fmt.Errorf("Amount is out of range")
+		if Amount(amt) > MAX_AMOUNT {
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "Amount is out of range")
 		}
-		sum += int64(amt)
-		if int64(sum) < 0 {
-			return 0, fmt.Errorf("Amounts on the transaction are out of range")
+		var err error
+		if sum, err = sum.Add(Amount(amt)); err != nil {
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "Amounts on the transaction are out of range")
 		}
 	}
 	return uint64(sum), nil
@@ -228,12 +351,12 @@ func ValidateAmounts(amts ...uint64) (uint64, error) {
 
 func (t Transaction) TotalInputs() (sum uint64, err error) {
 	if len(t.Inputs) > 255 {
-		return 0, fmt.Errorf("The number of inputs must be less than 255")
+		return 0, NewValidationError(ERR_TOO_LARGE, "The number of inputs must be less than 255")
 	}
 	for _, input := range t.Inputs {
 		sum, err = ValidateAmounts(sum, input.GetAmount())
 		if err != nil {
-			return 0, fmt.Errorf("Error totalling Inputs: %s", err.Error())
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "Error totalling Inputs: %s", err.Error())
 		}
 	}
 	return
@@ -241,12 +364,12 @@ func (t Transaction) TotalInputs() (sum uint64, err error) {
 
 func (t Transaction) TotalOutputs() (sum uint64, err error) {
 	if len(t.Outputs) > 255 {
-		return 0, fmt.Errorf("The number of outputs must be less than 255")
+		return 0, NewValidationError(ERR_TOO_LARGE, "The number of outputs must be less than 255")
 	}
 	for _, output := range t.Outputs {
 		sum, err = ValidateAmounts(sum, output.GetAmount())
 		if err != nil {
-			return 0, fmt.Errorf("Error totalling Outputs: %s", err.Error())
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "Error totalling Outputs: %s", err.Error())
 		}
 	}
 	return
@@ -254,12 +377,12 @@ func (t Transaction) TotalOutputs() (sum uint64, err error) {
 
 func (t Transaction) TotalECs() (sum uint64, err error) {
 	if len(t.OutECs) > 255 {
-		return 0, fmt.Errorf("The number of Entry Credit outputs must be less than 255")
+		return 0, NewValidationError(ERR_TOO_LARGE, "The number of Entry Credit outputs must be less than 255")
 	}
 	for _, ec := range t.OutECs {
 		sum, err = ValidateAmounts(sum, ec.GetAmount())
 		if err != nil {
-			return 0, fmt.Errorf("Error totalling Entry Credit outputs: %s", err.Error())
+			return 0, NewValidationError(ERR_AMOUNT_OVERFLOW, "Error totalling Entry Credit outputs: %s", err.Error())
 		}
 	}
 	return
@@ -305,25 +428,28 @@ func (t Transaction) Validate(index int) error {
 
 	// Inputs cover outputs and ecoutputs.
 	if index != 0 && tInputs < tOutputs+tecs {
-		return fmt.Errorf("The Inputs of the transaction do not cover the outputs")
+		e := NewValidationError(ERR_INSUFFICIENT_FUNDS, "The Inputs of the transaction do not cover the outputs")
+		e.Required = tOutputs + tecs
+		e.Provided = tInputs
+		return e
 	}
 	// Cannot have zero inputs.  This means you cannot use this function
 	// to validate coinbase transactions, because they cannot have any
 	// inputs.
 	if len(t.Inputs) == 0 {
 		if index > 0 {
-			return fmt.Errorf("Transactions (other than the coinbase) must have at least one input")
+			return NewValidationError(ERR_MALFORMED, "Transactions (other than the coinbase) must have at least one input")
 		}
 	} else {
 		if index == 0 {
 			PrtStk()
 			fmt.Println(index, t)
-			return fmt.Errorf("Coinbase transactions cannot have inputs.")
+			return NewValidationError(ERR_COINBASE, "Coinbase transactions cannot have inputs.")
 		}
 	}
 	// Every input must have an RCD block
 	if len(t.Inputs) != len(t.RCDs) {
-		return fmt.Errorf("All inputs must have a cooresponding RCD")
+		return NewValidationError(ERR_RCD_MISMATCH, "All inputs must have a cooresponding RCD")
 	}
 	// Every input must match the address of an RCD (which is the hash
 	// of the RCD
@@ -333,12 +459,17 @@ func (t Transaction) Validate(index int) error {
 		// If there is anything wrong with the RCD, then the transaction isn't
 		// valid.
 		if err != nil {
-			return fmt.Errorf("RCD %d failed to provide an address to compare with its input", i)
+			e := NewValidationError(ERR_RCD_MISMATCH, "RCD %d failed to provide an address to compare with its input", i)
+			e.Input = i
+			return e
 		}
 		// If the Address (which is really a hash) isn't equal to the hash of
 		// the RCD, this transaction is bogus.
 		if t.Inputs[i].GetAddress().IsEqual(address) != nil {
-			return fmt.Errorf("The %d Input does not match the %d RCD", i, i)
+			e := NewValidationError(ERR_RCD_MISMATCH, "The %d Input does not match the %d RCD", i, i)
+			e.Input = i
+			e.Address = t.Inputs[i].GetAddress()
+			return e
 		}
 	}
 
@@ -348,16 +479,25 @@ func (t Transaction) Validate(index int) error {
 // This call ONLY checks signatures.  Call ITransaction.Validate() to check the structure of the
 // transaction.
 //
-func (t Transaction) ValidateSignatures() error {
+func (t *Transaction) ValidateSignatures() error {
 	missingCnt := 0
+	first := -1
 	sigBlks := t.GetSignatureBlocks()
 	for i, rcd := range t.RCDs {
-		if !rcd.CheckSig(&t, sigBlks[i]) {
+		if !rcd.CheckSig(t, i, sigBlks[i]) {
+			if missingCnt == 0 {
+				first = i
+			}
 			missingCnt++
 		}
 	}
 	if missingCnt != 0 {
-		return fmt.Errorf("Missing %d of %d signatures", missingCnt, len(t.RCDs))
+		e := NewValidationError(ERR_BAD_SIGNATURE, "Missing %d of %d signatures", missingCnt, len(t.RCDs))
+		e.Input = first
+		if first < len(t.Inputs) {
+			e.Address = t.Inputs[first].GetAddress()
+		}
+		return e
 	}
 
 	return nil
@@ -371,6 +511,7 @@ func (t1 *Transaction) IsEqual(trans IBlock) []IBlock {
 	t2, ok := trans.(ITransaction)
 
 	if !ok || // Not the right kind of IBlock
+		t1.GetVersion() != t2.GetVersion() ||
 		len(t1.Inputs) != len(t2.GetInputs()) || // Size of arrays has to match
 		len(t1.Outputs) != len(t2.GetOutputs()) || // Size of arrays has to match
 		len(t1.OutECs) != len(t2.GetECOutputs()) { // Size of arrays has to match
@@ -451,7 +592,7 @@ func (t *Transaction) GetSignatureBlocks() []ISignatureBlock {
 		return t.SigBlocks
 	}
 	for i := len(t.SigBlocks); i < len(t.Inputs); i++ { // If too short, then
-		t.SigBlocks = append(t.SigBlocks, new(SignatureBlock)) // pad it with
+		t.SigBlocks = append(t.SigBlocks, t.newSignatureBlock()) // pad it with
 	} // signature blocks.
 	return t.SigBlocks
 }
@@ -484,23 +625,32 @@ func (t *Transaction) GetRCD(i int) (IRCD, error) {
 	return t.RCDs[i], nil
 }
 
-// UnmarshalBinary assumes that the Binary is all good.  We do error
-// out if there isn't enough data, or the transaction is too large.
+// We error out if there isn't enough data, or if the data is not
+// what MarshalBinary() would have written.
+//
+// Decoding is on the hot path of loading blocks, so the inputs, outputs,
+// their addresses, and the signatures are each allocated in one slice
+// rather than one at a time.  The transaction keeps one copy of the data
+// it was decoded from as its cached MarshalBinary(), so the caller is free
+// to reuse data.
 func (t *Transaction) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if err := t.checkSealed(); err != nil {
+		return nil, err
+	}
+	t.clearCaches()
+	start := data
 
-	// To catch memory errors, I capture the panic and turn it into
-	// a reported error.
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling transaction: %v", r)
-		}
-	}()
-
-	// To capture the panic, my code needs to be in a function.  So I'm
-	// creating one here, and call it at the end of this function.
-	v, data := DecodeVarInt(data)
-	if v != t.GetVersion() {
-		return nil, fmt.Errorf("Wrong Transaction Version encountered. Expected %v and found %v", t.GetVersion(), v)
+	v, data, err := DecodeCanonicalVarInt(data)
+	if err != nil {
+		return nil, err
+	}
+	if v != TRANSACTION_VERSION && v != TRANSACTION_VERSION_SIGHASH {
+		return nil, fmt.Errorf("Wrong Transaction Version encountered. Expected %v or %v and found %v",
+			TRANSACTION_VERSION, TRANSACTION_VERSION_SIGHASH, v)
+	}
+	t.version = v
+	if len(data) < 9 {
+		return nil, fmt.Errorf("Data source too short to unmarshal a Transaction: %d", len(data))
 	}
 	hd, data := binary.BigEndian.Uint32(data[:]), data[4:]
 	ld, data := binary.BigEndian.Uint16(data[:]), data[2:]
@@ -517,45 +667,95 @@ func (t *Transaction) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 	t.Outputs = make([]IOutAddress, numOutputs, numOutputs)
 	t.OutECs = make([]IOutECAddress, numOutECs, numOutECs)
 
-	for i, _ := range t.Inputs {
-		t.Inputs[i] = new(InAddress)
-		data, err = t.Inputs[i].UnmarshalBinaryData(data)
-		if err != nil || t.Inputs[i] == nil {
+	addresses := make([]Address, numInputs+numOutputs+numOutECs)
+	inputs := make([]InAddress, numInputs)
+	outputs := make([]OutAddress, numOutputs)
+	outECs := make([]OutECAddress, numOutECs)
+
+	for i := range inputs {
+		data, err = inputs[i].unmarshalInto(data, &addresses[0])
+		if err != nil {
 			return nil, err
 		}
+		inputs[i].owner = t
+		t.Inputs[i] = &inputs[i]
+		addresses = addresses[1:]
 	}
-	for i, _ := range t.Outputs {
-		t.Outputs[i] = new(OutAddress)
-		data, err = t.Outputs[i].UnmarshalBinaryData(data)
+	for i := range outputs {
+		data, err = outputs[i].unmarshalInto(data, &addresses[0])
 		if err != nil {
 			return nil, err
 		}
+		outputs[i].owner = t
+		t.Outputs[i] = &outputs[i]
+		addresses = addresses[1:]
 	}
-	for i, _ := range t.OutECs {
-		t.OutECs[i] = new(OutECAddress)
-		data, err = t.OutECs[i].UnmarshalBinaryData(data)
+	for i := range outECs {
+		data, err = outECs[i].unmarshalInto(data, &addresses[0])
 		if err != nil {
 			return nil, err
 		}
+		outECs[i].owner = t
+		t.OutECs[i] = &outECs[i]
+		addresses = addresses[1:]
 	}
+	sigLen := len(start) - len(data)
 
 	t.RCDs = make([]IRCD, len(t.Inputs))
 	t.SigBlocks = make([]ISignatureBlock, len(t.Inputs))
 
+	sigBlks := make([]SignatureBlock, len(t.Inputs))
+	sigs := make([]Signature, len(t.Inputs))
+	isigs := make([]ISignature, len(t.Inputs))
+
 	for i := 0; i < len(t.Inputs); i++ {
 		t.RCDs[i] = CreateRCD(data)
+		if t.RCDs[i] == nil {
+			return nil, fmt.Errorf("Missing or unknown RCD for input %d", i)
+		}
 		data, err = t.RCDs[i].UnmarshalBinaryData(data)
 		if err != nil {
 			return nil, err
 		}
 
-		t.SigBlocks[i] = new(SignatureBlock)
-		data, err = t.SigBlocks[i].UnmarshalBinaryData(data)
+		// In version 3, the signature block starts with its sighash
+		// type.
+		if v == TRANSACTION_VERSION_SIGHASH {
+			if len(data) == 0 || !SigHashType(data[0]).IsValid() {
+				return nil, fmt.Errorf("Missing or unknown sighash type for input %d", i)
+			}
+			sigBlks[i].sigHashType = SigHashType(data[0])
+			data = data[1:]
+		}
+
+		// A signature block holds one signature, the same as
+		// SignatureBlock.UnmarshalBinaryData() would read.
+		data, err = sigs[i].UnmarshalBinaryData(data)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("Failure to unmarshal Signature: %s", err.Error())
+		}
+		isigs[i] = &sigs[i]
+		sigBlks[i].signatures = isigs[i : i+1 : i+1]
+		sigBlks[i].owner = t
+		t.SigBlocks[i] = &sigBlks[i]
+
+		if _, ok := t.RCDs[i].(IRCD_4); ok {
+			if len(data) == 0 || int(data[0]) > MAX_PREIMAGE_LENGTH || len(data) < 1+int(data[0]) {
+				return nil, fmt.Errorf("Missing or bad preimage for input %d", i)
+			}
+			if n := int(data[0]); n > 0 {
+				sigBlks[i].preimage = make([]byte, n)
+				copy(sigBlks[i].preimage, data[1:1+n])
+			}
+			data = data[1+int(data[0]):]
 		}
 	}
 
+	n := len(start) - len(data)
+	t.bin = make([]byte, n)
+	copy(t.bin, start)
+	t.sigBin = t.bin[:sigLen:sigLen]
+
 	return data, nil
 }
 
@@ -566,8 +766,16 @@ func (t *Transaction) UnmarshalBinary(data []byte) (err error) {
 
 // This is what Gets Signed.  Yet signature blocks are part of the transaction.
 // We don't include them here, and tack them on later.
+//
+// The result is cached, and shared with the caller.  It must not be
+// changed.
 func (t *Transaction) MarshalBinarySig() (newData []byte, err error) {
+	if t.sigBin != nil {
+		return t.sigBin, nil
+	}
+
 	var out bytes.Buffer
+	out.Grow(16 + (len(t.Inputs)+len(t.Outputs)+len(t.OutECs))*(ADDRESS_LENGTH+9))
 
 	EncodeVarInt(&out, t.GetVersion())
 
@@ -604,18 +812,95 @@ func (t *Transaction) MarshalBinarySig() (newData []byte, err error) {
 		out.Write(data)
 	}
 
+	// Cap the slice, so a caller that appends to it cannot write into
+	// the cache.
+	t.sigBin = out.Bytes()[:out.Len():out.Len()]
+	return t.sigBin, nil
+}
+
+// What the signature of an input signs.  Anything but SIGHASH_ALL starts
+// with "SigHash" and the type, so it can't be mistaken for what a
+// SIGHASH_ALL signature signs, nor for another type.
+func (t *Transaction) MarshalBinarySigHash(input int, h SigHashType) ([]byte, error) {
+	if input < 0 || input >= len(t.Inputs) {
+		return nil, fmt.Errorf("Index out of Range")
+	}
+	if !h.IsValid() {
+		return nil, fmt.Errorf("Unknown sighash type %s", h)
+	}
+	if h == SIGHASH_ALL {
+		return t.MarshalBinarySig()
+	}
+	if t.GetVersion() != TRANSACTION_VERSION_SIGHASH {
+		return nil, fmt.Errorf("Signing %s needs a version %d transaction", h, TRANSACTION_VERSION_SIGHASH)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("SigHash")
+	out.WriteByte(byte(h))
+
+	EncodeVarInt(&out, t.GetVersion())
+	binary.Write(&out, binary.BigEndian, uint32(t.MilliTimestamp>>16))
+	binary.Write(&out, binary.BigEndian, uint16(t.MilliTimestamp&0xFFFF))
+
+	inputs := t.Inputs
+	if h.AnyoneCanPay() {
+		inputs = t.Inputs[input : input+1]
+	}
+	outputs := t.Outputs
+	var outECs []IOutECAddress
+	if h.Base() == SIGHASH_SINGLE {
+		if input >= len(t.Outputs) {
+			return nil, fmt.Errorf("There is no output %d for input %d to sign %s", input, input, h)
+		}
+		outputs = t.Outputs[input : input+1]
+	} else {
+		outECs = t.OutECs
+	}
+
+	out.WriteByte(byte(len(inputs)))
+	out.WriteByte(byte(len(outputs)))
+	out.WriteByte(byte(len(outECs)))
+	for _, input := range inputs {
+		data, err := input.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+	}
+	for _, output := range outputs {
+		data, err := output.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+	}
+	for _, outEC := range outECs {
+		data, err := outEC.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data)
+	}
 	return out.Bytes(), nil
 }
 
 // This just Marshals what gets signed, i.e. MarshalBinarySig(), then
 // Marshals the signatures and the RCDs for this transaction.
-func (t Transaction) MarshalBinary() ([]byte, error) {
-	var out bytes.Buffer
+//
+// The result is cached, and shared with the caller.  It must not be
+// changed.
+func (t *Transaction) MarshalBinary() ([]byte, error) {
+	if t.bin != nil {
+		return t.bin, nil
+	}
 
 	data, err := t.MarshalBinarySig()
 	if err != nil {
 		return nil, err
 	}
+	var out bytes.Buffer
+	out.Grow(len(data) + len(t.RCDs)*(2+ADDRESS_LENGTH+SIGNATURE_LENGTH))
 	out.Write(data)
 
 	for i, rcd := range t.RCDs {
@@ -632,55 +917,100 @@ func (t Transaction) MarshalBinary() ([]byte, error) {
 		// to control the writing of the signatures.  After all,
 		// we don't want to restrict what might be required to
 		// sign an input.
-		if len(t.SigBlocks) <= i {
-			t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+		sigblk := t.sigBlockOrEmpty(i)
+		h := sigblk.GetSigHashType()
+		if t.GetVersion() == TRANSACTION_VERSION_SIGHASH {
+			if !h.IsValid() {
+				return nil, fmt.Errorf("Unknown sighash type %s for input %d", h, i)
+			}
+			out.WriteByte(byte(h))
+		} else if h != SIGHASH_ALL {
+			return nil, fmt.Errorf("Input %d is signed %s, which needs a version %d transaction",
+				i, h, TRANSACTION_VERSION_SIGHASH)
 		}
-		data, err = t.SigBlocks[i].MarshalBinary()
+		data, err = sigblk.MarshalBinary()
 		if err != nil {
 			return nil, err
 		}
 		out.Write(data)
+
+		// A hash time lock is claimed with the preimage after the
+		// signature.  A refund has a preimage of length zero.
+		if _, ok := rcd.(IRCD_4); ok {
+			preimage := sigblk.GetPreimage()
+			if len(preimage) > MAX_PREIMAGE_LENGTH {
+				return nil, fmt.Errorf("The preimage for input %d is too long: %d", i, len(preimage))
+			}
+			out.WriteByte(byte(len(preimage)))
+			out.Write(preimage)
+		}
 	}
 
-	return out.Bytes(), nil
+	t.bin = out.Bytes()[:out.Len():out.Len()]
+	return t.bin, nil
+}
+
+// Addresses added to or decoded into a transaction clear its caches
+// when they are changed through SetAmount() or SetAddress().
+func (t *Transaction) adopt(adr ITransAddress) {
+	if ta, ok := adr.(interface {
+		setOwner(*Transaction)
+	}); ok {
+		ta.setOwner(t)
+	}
 }
 
 // Helper function for building transactions.  Add an input to
 // the transaction.  I'm guessing 5 inputs is about all anyone
 // will need, so I'll default to 5.  Of course, go will grow
 // past that if needed.
-func (t *Transaction) AddInput(input IAddress, amount uint64) {
+func (t *Transaction) AddInput(input IAddress, amount uint64) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	if t.Inputs == nil {
 		t.Inputs = make([]IInAddress, 0, 5)
 	}
 	out := NewInAddress(input, amount)
+	t.adopt(out)
 	t.Inputs = append(t.Inputs, out)
 	t.clearCaches()
+	return nil
 }
 
 // Helper function for building transactions.  Add an output to
 // the transaction.  I'm guessing 5 outputs is about all anyone
 // will need, so I'll default to 5.  Of course, go will grow
 // past that if needed.
-func (t *Transaction) AddOutput(output IAddress, amount uint64) {
+func (t *Transaction) AddOutput(output IAddress, amount uint64) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	if t.Outputs == nil {
 		t.Outputs = make([]IOutAddress, 0, 5)
 	}
 	out := NewOutAddress(output, amount)
+	t.adopt(out)
 	t.Outputs = append(t.Outputs, out)
 	t.clearCaches()
+	return nil
 }
 
 // Add a EntryCredit output.  Validating this is going to require
 // access to the exchange rate.  This is literally how many entry
 // credits are being added to the specified Entry Credit address.
-func (t *Transaction) AddECOutput(ecoutput IAddress, amount uint64) {
+func (t *Transaction) AddECOutput(ecoutput IAddress, amount uint64) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	if t.OutECs == nil {
 		t.OutECs = make([]IOutECAddress, 0, 5)
 	}
 	out := NewOutECAddress(ecoutput, amount)
+	t.adopt(out)
 	t.OutECs = append(t.OutECs, out)
 	t.clearCaches()
+	return nil
 }
 
 // Marshal to text.  Largely a debugging thing.
@@ -726,10 +1056,11 @@ func (t *Transaction) CustomMarshalText() (text []byte, err error) {
 		}
 		out.Write(text)
 
-		for len(t.SigBlocks) <= i {
-			t.SigBlocks = append(t.SigBlocks, new(SignatureBlock))
+		sigblk := t.sigBlockOrEmpty(i)
+		if t.GetVersion() == TRANSACTION_VERSION_SIGHASH {
+			out.WriteString(fmt.Sprintf(" Sighash: %s\n", sigblk.GetSigHashType()))
 		}
-		text, err := t.SigBlocks[i].CustomMarshalText()
+		text, err := sigblk.CustomMarshalText()
 		if err != nil {
 			return nil, err
 		}
@@ -742,11 +1073,16 @@ func (t *Transaction) CustomMarshalText() (text []byte, err error) {
 // Helper Function.  This simply adds an Authorization to a
 // transaction.  DOES NO VALIDATION.  Not the job of construction.
 // That's why we have a validation call.
-func (t *Transaction) AddAuthorization(auth IRCD) {
+func (t *Transaction) AddAuthorization(auth IRCD) error {
+	if err := t.checkSealed(); err != nil {
+		return err
+	}
 	if t.RCDs == nil {
 		t.RCDs = make([]IRCD, 0, 5)
 	}
 	t.RCDs = append(t.RCDs, auth)
+	t.clearCaches()
+	return nil
 }
 
 func (e *Transaction) JSONByte() ([]byte, error) {
@@ -5,6 +5,7 @@
 package factoid
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/FactomProject/ed25519"
 	"math/rand"
@@ -190,3 +191,203 @@ func Test_ValidateAmounts(test *testing.T) {
 		test.Failed()
 	}
 }
+
+// A transaction signed the way a wallet would sign it, with two inputs,
+// two outputs and an Entry Credit purchase.
+func newSignedTransaction(ts uint64) *Transaction {
+	t := new(Transaction)
+	t.SetMilliTimestamp(ts)
+	privates := make([]*[64]byte, 2)
+	for i := range privates {
+		public, private, _ := ed25519.GenerateKey(zero)
+		privates[i] = private
+		rcd := NewRCD_1(public[:])
+		adr, _ := rcd.GetAddress()
+		t.AddInput(adr, 100000000)
+		t.AddRCD(rcd)
+	}
+	t.AddOutput(nextAddress(), 50000000)
+	t.AddOutput(nextAddress(), 49000000)
+	t.AddECOutput(nextAddress(), 900000)
+
+	data, _ := t.MarshalBinarySig()
+	for i, private := range privates {
+		sig := new(Signature)
+		sig.SetSignature(ed25519.Sign(private, data)[:])
+		sigblk := new(SignatureBlock)
+		sigblk.AddSignature(sig)
+		t.SetSignatureBlock(i, sigblk)
+	}
+	return t
+}
+
+func Test_Transaction_caches(test *testing.T) {
+	t := newSignedTransaction(1000)
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	hash := t.GetHash().Bytes()
+	sigHash := t.GetSigHash().Bytes()
+	data, _ := t.MarshalBinary()
+
+	// A decoded transaction hashes and marshals to the same thing, and
+	// doesn't hold on to the data it was decoded from.
+	buf := append([]byte{}, data...)
+	t2 := new(Transaction)
+	if err := t2.UnmarshalBinary(buf); err != nil {
+		test.Fatal(err)
+	}
+	for i := range buf {
+		buf[i] = 0
+	}
+	data2, _ := t2.MarshalBinary()
+	if !bytes.Equal(data, data2) || !t2.GetHash().IsSameAs(NewHash(hash)) ||
+		!t2.GetSigHash().IsSameAs(NewHash(sigHash)) {
+		Prtln("The decoded transaction does not match")
+		test.Fail()
+	}
+	t2.clearCaches()
+	if data3, _ := t2.MarshalBinary(); !bytes.Equal(data, data3) {
+		Prtln("The decoded transaction does not marshal back to the same bytes")
+		test.Fail()
+	}
+
+	// Changes through the API clear the caches, decoded or not.
+	for _, tr := range []*Transaction{t, t2} {
+		tr.GetOutputs()[0].SetAmount(1)
+		if tr.GetHash().IsSameAs(NewHash(hash)) || tr.GetSigHash().IsSameAs(NewHash(sigHash)) {
+			Prtln("Changing an output did not change the hashes")
+			test.Fail()
+		}
+		if tr.ValidateSignatures() == nil {
+			Prtln("The signatures should no longer be valid")
+			test.Fail()
+		}
+		tr.GetOutputs()[0].SetAmount(50000000)
+		if !tr.GetHash().IsSameAs(NewHash(hash)) {
+			Prtln("Changing the output back did not restore the hash")
+			test.Fail()
+		}
+	}
+
+	sig := new(Signature)
+	t.SetSignatureBlock(0, new(SignatureBlock))
+	t.GetSignatureBlock(0).AddSignature(sig)
+	if t.GetHash().IsSameAs(NewHash(hash)) || !t.GetSigHash().IsSameAs(NewHash(sigHash)) {
+		Prtln("A new signature should change the hash, but not the signature hash")
+		test.Fail()
+	}
+
+	// So do changes to a signature block or an RCD in place, decoded or
+	// not.
+	for _, tr := range []*Transaction{t, t2} {
+		before := tr.GetHash()
+		sig := new(Signature)
+		sig.SetSignature(bytes.Repeat([]byte{7}, SIGNATURE_LENGTH))
+		tr.GetSignatureBlock(0).AddSignature(sig)
+		if tr.GetHash().IsSameAs(before) || !tr.GetSigHash().IsSameAs(NewHash(sigHash)) {
+			Prtln("Changing a signature block in place did not change the hash")
+			test.Fail()
+		}
+		before = tr.GetHash()
+		rcd, _ := nextKey()
+		if err := tr.SetRCD(0, rcd); err != nil || tr.GetHash().IsSameAs(before) {
+			Prtln("Replacing an RCD did not change the hash: ", err)
+			test.Fail()
+		}
+		if tr.SetRCD(len(tr.GetRCDs()), rcd) == nil {
+			test.Fail()
+		}
+	}
+
+	// The cached bytes can't be changed by appending to them.
+	data, _ = t.MarshalBinarySig()
+	_ = append(data, 0xFF)
+	if again, _ := t.MarshalBinarySig(); !bytes.Equal(data, again) || cap(again) != len(again) {
+		test.Fail()
+	}
+}
+
+// Signing a transaction after it has been hashed or marshaled must change
+// both, whether the signature block was added before or after.
+func Test_Transaction_sign_after_hash(test *testing.T) {
+	for _, read := range []func(*Transaction){
+		func(t *Transaction) { t.GetHash() },
+		func(t *Transaction) { t.MarshalBinary() },
+		func(t *Transaction) { t.CustomMarshalText() },
+		func(t *Transaction) { t.GetSignatureBlocks() },
+	} {
+		t := newSignedTransaction(1000)
+		signed := t.SigBlocks
+		t.SigBlocks = nil
+
+		read(t)
+		hash := t.GetHash()
+		data, _ := t.MarshalBinary()
+		for i, sigblk := range signed {
+			t.GetSignatureBlock(i).AddSignature(sigblk.GetSignatures()[0])
+		}
+		if t.GetHash().IsSameAs(hash) {
+			Prtln("Signing did not change the hash")
+			test.Fail()
+		}
+		if data2, _ := t.MarshalBinary(); bytes.Equal(data, data2) {
+			Prtln("Signing did not change the marshaled transaction")
+			test.Fail()
+		}
+
+		data, _ = t.MarshalBinary()
+		t2 := new(Transaction)
+		if err := t2.UnmarshalBinary(data); err != nil {
+			test.Fatal(err)
+		}
+		if err := t2.ValidateSignatures(); err != nil {
+			Prtln("The signatures were lost: ", err)
+			test.Fail()
+		}
+	}
+}
+
+func Benchmark_Transaction_Marshal(b *testing.B) {
+	t := newSignedTransaction(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.clearCaches()
+		t.MarshalBinary()
+	}
+}
+
+func Benchmark_Transaction_Unmarshal(b *testing.B) {
+	data, _ := newSignedTransaction(1000).MarshalBinary()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t := new(Transaction)
+		if err := t.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Transaction_GetHash(b *testing.B) {
+	t := newSignedTransaction(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.clearCaches()
+		t.GetHash()
+		t.GetSigHash()
+	}
+}
+
+func Benchmark_Transaction_GetHash_cached(b *testing.B) {
+	t := newSignedTransaction(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.GetHash()
+		t.GetSigHash()
+	}
+}
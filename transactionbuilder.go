@@ -0,0 +1,411 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+)
+
+/**************************************
+ * ITransactionBuilder
+ *
+ * Builds a transaction a step at a time.  Each input is added with its
+ * RCD, so the two can't get out of order, and inputs and outputs can be
+ * removed or replaced.  The limits on the number of inputs and outputs and
+ * on the size of a transaction are checked as the transaction is built.
+ *
+ * The methods return the builder, so calls can be chained.  The first
+ * error stops the builder; later calls do nothing, and Build() returns
+ * the error.
+ **************************************/
+
+// The most inputs, outputs, or Entry Credit outputs a transaction can have.
+const MAX_TRANSACTION_ENTRIES = 255
+
+type ITransactionBuilder interface {
+	SetMilliTimestamp(uint64) ITransactionBuilder
+	// Use TRANSACTION_VERSION_SIGHASH to sign with other than SIGHASH_ALL.
+	SetVersion(uint64) ITransactionBuilder
+	// Add an input, spending amount from the address of the RCD.
+	AddInput(rcd IRCD, amount uint64) ITransactionBuilder
+	RemoveInput(i int) ITransactionBuilder
+	ReplaceInput(i int, rcd IRCD, amount uint64) ITransactionBuilder
+	SetInputAmount(i int, amount uint64) ITransactionBuilder
+	AddOutput(address IAddress, amount uint64) ITransactionBuilder
+	RemoveOutput(i int) ITransactionBuilder
+	ReplaceOutput(i int, address IAddress, amount uint64) ITransactionBuilder
+	AddECOutput(address IAddress, amount uint64) ITransactionBuilder
+	RemoveECOutput(i int) ITransactionBuilder
+	ReplaceECOutput(i int, address IAddress, amount uint64) ITransactionBuilder
+	// Set the amount of the given input so the inputs pay for the outputs,
+	// the Entry Credit outputs, and the fee at the given exchange rate.
+	BalanceFee(factoshisPerEC uint64, input int) ITransactionBuilder
+
+	NumInputs() int
+	NumOutputs() int
+	NumECOutputs() int
+	// The size of the transaction once signed.
+	Size() (int, error)
+	// The first error, if any.
+	Err() error
+	// Validate and return the transaction.  The transaction cannot be
+	// changed, but for adding its signatures: methods that change it
+	// return an error if they can, and otherwise do nothing.  The builder
+	// can go on to build others.
+	Build() (ITransaction, error)
+}
+
+type builderInput struct {
+	rcd     IRCD
+	address IAddress
+	amount  uint64
+}
+
+type builderOutput struct {
+	address IAddress
+	amount  uint64
+}
+
+type TransactionBuilder struct {
+	milliTimestamp uint64
+	version        uint64
+	inputs         []builderInput
+	outputs        []builderOutput
+	ecoutputs      []builderOutput
+	factoshisPerEC uint64 // The rate of the last BalanceFee(), or zero
+	err            error
+}
+
+var _ ITransactionBuilder = (*TransactionBuilder)(nil)
+
+func NewTransactionBuilder(milliTimestamp uint64) *TransactionBuilder {
+	b := new(TransactionBuilder)
+	b.milliTimestamp = milliTimestamp
+	return b
+}
+
+// Start a builder from an existing transaction, to build a changed copy
+// of it.  The signatures are not copied.
+func NewTransactionBuilderFrom(t ITransaction) *TransactionBuilder {
+	b := NewTransactionBuilder(t.GetMilliTimestamp())
+	b.version = t.GetVersion()
+	if len(t.GetInputs()) != len(t.GetRCDs()) {
+		b.err = NewValidationError(ERR_RCD_MISMATCH, "All inputs must have a cooresponding RCD")
+		return b
+	}
+	for i, input := range t.GetInputs() {
+		b.inputs = append(b.inputs, builderInput{t.GetRCDs()[i].Clone(), input.GetAddress(), input.GetAmount()})
+	}
+	for _, output := range t.GetOutputs() {
+		b.outputs = append(b.outputs, builderOutput{output.GetAddress(), output.GetAmount()})
+	}
+	for _, ecoutput := range t.GetECOutputs() {
+		b.ecoutputs = append(b.ecoutputs, builderOutput{ecoutput.GetAddress(), ecoutput.GetAmount()})
+	}
+	b.checkLimits()
+	return b
+}
+
+func (b *TransactionBuilder) Err() error {
+	return b.err
+}
+
+func (b *TransactionBuilder) NumInputs() int    { return len(b.inputs) }
+func (b *TransactionBuilder) NumOutputs() int   { return len(b.outputs) }
+func (b *TransactionBuilder) NumECOutputs() int { return len(b.ecoutputs) }
+
+func (b *TransactionBuilder) SetMilliTimestamp(ts uint64) ITransactionBuilder {
+	if b.err == nil {
+		b.milliTimestamp = ts
+	}
+	return b
+}
+
+func (b *TransactionBuilder) SetVersion(v uint64) ITransactionBuilder {
+	if b.err != nil {
+		return b
+	}
+	if v != TRANSACTION_VERSION && v != TRANSACTION_VERSION_SIGHASH {
+		b.err = fmt.Errorf("Unknown Transaction Version %d", v)
+		return b
+	}
+	old := b.version
+	b.version = v
+	if !b.checkLimits() {
+		b.version = old
+	}
+	return b
+}
+
+func (b *TransactionBuilder) AddInput(rcd IRCD, amount uint64) ITransactionBuilder {
+	return b.ReplaceInput(len(b.inputs), rcd, amount)
+}
+
+func (b *TransactionBuilder) RemoveInput(i int) ITransactionBuilder {
+	if b.checkIndex("input", i, len(b.inputs)) {
+		b.inputs = append(b.inputs[:i:i], b.inputs[i+1:]...)
+	}
+	return b
+}
+
+// Replace input i.  Replacing the input one past the last adds an input.
+func (b *TransactionBuilder) ReplaceInput(i int, rcd IRCD, amount uint64) ITransactionBuilder {
+	if !b.checkIndex("input", i, len(b.inputs)+1) {
+		return b
+	}
+	if rcd == nil {
+		b.err = NewValidationError(ERR_RCD_MISMATCH, "Input %d has no RCD", i)
+		return b
+	}
+	address, err := rcd.GetAddress()
+	if err != nil {
+		b.err = NewValidationError(ERR_RCD_MISMATCH, "RCD %d failed to provide an address: %s", i, err.Error())
+		return b
+	}
+	old := b.inputs
+	b.inputs = append(b.inputs[:i:i], builderInput{rcd, address, amount})
+	if i < len(old) {
+		b.inputs = append(b.inputs, old[i+1:]...)
+	}
+	if !b.checkLimits() {
+		b.inputs = old
+	}
+	return b
+}
+
+func (b *TransactionBuilder) SetInputAmount(i int, amount uint64) ITransactionBuilder {
+	if b.checkIndex("input", i, len(b.inputs)) {
+		old := b.inputs[i].amount
+		b.inputs[i].amount = amount
+		if !b.checkLimits() {
+			b.inputs[i].amount = old
+		}
+	}
+	return b
+}
+
+func (b *TransactionBuilder) AddOutput(address IAddress, amount uint64) ITransactionBuilder {
+	return b.ReplaceOutput(len(b.outputs), address, amount)
+}
+
+func (b *TransactionBuilder) RemoveOutput(i int) ITransactionBuilder {
+	return b.removeOutput("output", &b.outputs, i)
+}
+
+// Replace output i.  Replacing the output one past the last adds an output.
+func (b *TransactionBuilder) ReplaceOutput(i int, address IAddress, amount uint64) ITransactionBuilder {
+	return b.replaceOutput("output", &b.outputs, i, address, amount)
+}
+
+func (b *TransactionBuilder) AddECOutput(address IAddress, amount uint64) ITransactionBuilder {
+	return b.ReplaceECOutput(len(b.ecoutputs), address, amount)
+}
+
+func (b *TransactionBuilder) RemoveECOutput(i int) ITransactionBuilder {
+	return b.removeOutput("Entry Credit output", &b.ecoutputs, i)
+}
+
+// Replace Entry Credit output i.  Replacing the one past the last adds an
+// Entry Credit output.
+func (b *TransactionBuilder) ReplaceECOutput(i int, address IAddress, amount uint64) ITransactionBuilder {
+	return b.replaceOutput("Entry Credit output", &b.ecoutputs, i, address, amount)
+}
+
+// Outputs and Entry Credit outputs are removed and replaced the same way.
+func (b *TransactionBuilder) removeOutput(what string, outputs *[]builderOutput, i int) ITransactionBuilder {
+	if b.checkIndex(what, i, len(*outputs)) {
+		*outputs = append((*outputs)[:i:i], (*outputs)[i+1:]...)
+	}
+	return b
+}
+
+func (b *TransactionBuilder) replaceOutput(what string, outputs *[]builderOutput, i int, address IAddress, amount uint64) ITransactionBuilder {
+	if !b.checkIndex(what, i, len(*outputs)+1) {
+		return b
+	}
+	if address == nil {
+		b.err = NewValidationError(ERR_MALFORMED, "The %s %d has no address", what, i)
+		return b
+	}
+	old := *outputs
+	*outputs = append(old[:i:i], builderOutput{address, amount})
+	if i < len(old) {
+		*outputs = append(*outputs, old[i+1:]...)
+	}
+	if !b.checkLimits() {
+		*outputs = old
+	}
+	return b
+}
+
+// Checks an index, and records an error if it is out of range.
+func (b *TransactionBuilder) checkIndex(what string, i int, limit int) bool {
+	if b.err != nil {
+		return false
+	}
+	if i < 0 || i >= limit {
+		b.err = fmt.Errorf("No %s %d in a transaction with %d", what, i, limit)
+		return false
+	}
+	return true
+}
+
+// Checks the number of inputs and outputs, and the size of the
+// transaction.  Records an error if any is over its limit.
+func (b *TransactionBuilder) checkLimits() bool {
+	counts := []struct {
+		what string
+		n    int
+	}{
+		{"inputs", len(b.inputs)},
+		{"outputs", len(b.outputs)},
+		{"Entry Credit outputs", len(b.ecoutputs)},
+	}
+	for _, c := range counts {
+		if c.n > MAX_TRANSACTION_ENTRIES {
+			e := NewValidationError(ERR_TOO_LARGE, "A transaction cannot have more than %d %s", MAX_TRANSACTION_ENTRIES, c.what)
+			e.Required = MAX_TRANSACTION_ENTRIES
+			e.Provided = uint64(c.n)
+			b.err = e
+			return false
+		}
+	}
+	size, err := b.Size()
+	if err != nil {
+		b.err = err
+		return false
+	}
+	if size > MAX_TRANSACTION_SIZE {
+		e := NewValidationError(ERR_TOO_LARGE, "Transaction is greater than the max transaction size")
+		e.Required = MAX_TRANSACTION_SIZE
+		e.Provided = uint64(size)
+		b.err = e
+		return false
+	}
+	return true
+}
+
+// The transaction as it stands.  Every input has an empty signature
+// block, which marshals to the same size as the signature it will hold.
+func (b *TransactionBuilder) transaction() *Transaction {
+	t := new(Transaction)
+	t.version = b.version
+	t.SetMilliTimestamp(b.milliTimestamp)
+	for _, input := range b.inputs {
+		t.AddInput(input.address, input.amount)
+		t.AddRCD(input.rcd)
+	}
+	for _, output := range b.outputs {
+		t.AddOutput(output.address, output.amount)
+	}
+	for _, ecoutput := range b.ecoutputs {
+		t.AddECOutput(ecoutput.address, ecoutput.amount)
+	}
+	t.GetSignatureBlocks()
+	return t
+}
+
+func (b *TransactionBuilder) Size() (int, error) {
+	data, err := b.transaction().MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Set the amount of the given input to pay for everything else.  The fee
+// depends on the size of the transaction, and the size on the amount, so
+// this may take a few tries to settle.
+func (b *TransactionBuilder) BalanceFee(factoshisPerEC uint64, input int) ITransactionBuilder {
+	if !b.checkIndex("input", input, len(b.inputs)) {
+		return b
+	}
+	for tries := 0; tries < 4; tries++ {
+		t := b.transaction()
+		fee, err := t.CalculateFee(factoshisPerEC)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		tout, err := t.TotalOutputs()
+		if err != nil {
+			b.err = err
+			return b
+		}
+		tec, err := t.TotalECs()
+		if err != nil {
+			b.err = err
+			return b
+		}
+		need, err := ValidateAmounts(tout, tec, fee)
+		if err != nil {
+			b.err = err
+			return b
+		}
+		var others uint64
+		for i, in := range b.inputs {
+			if i != input {
+				if others, err = ValidateAmounts(others, in.amount); err != nil {
+					b.err = err
+					return b
+				}
+			}
+		}
+		if others > need {
+			b.err = fmt.Errorf("The other inputs already pay %s more than the outputs and the fee",
+				Amount(others-need).String())
+			return b
+		}
+		if b.inputs[input].amount == need-others {
+			b.factoshisPerEC = factoshisPerEC
+			return b
+		}
+		b.SetInputAmount(input, need-others)
+		if b.err != nil {
+			return b
+		}
+	}
+	b.err = fmt.Errorf("The fee did not settle")
+	return b
+}
+
+func (b *TransactionBuilder) Build() (ITransaction, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if !b.checkLimits() {
+		return nil, b.err
+	}
+	t := b.transaction()
+	if err := t.Validate(1); err != nil {
+		return nil, err
+	}
+
+	// If we balanced the fee, make sure nothing has upset the balance
+	// since.
+	if b.factoshisPerEC != 0 {
+		fee, err := t.CalculateFee(b.factoshisPerEC)
+		if err != nil {
+			return nil, err
+		}
+		tin, _ := t.TotalInputs()
+		tout, _ := t.TotalOutputs()
+		tec, _ := t.TotalECs()
+		sum, err := ValidateAmounts(tout, tec, fee)
+		if err != nil {
+			return nil, err
+		}
+		if tin < sum {
+			e := NewValidationError(ERR_FEE_TOO_LOW, "The inputs %s do not cover the outputs and the fee %s",
+				Amount(tin).String(), Amount(fee).String())
+			e.Required = sum
+			e.Provided = tin
+			return nil, e
+		}
+	}
+
+	t.sealed = true
+	return t, nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"github.com/FactomProject/ed25519"
+	"testing"
+)
+
+func nextKey() (IRCD, *[64]byte) {
+	public, private, _ := ed25519.GenerateKey(zero)
+	return NewRCD_1(public[:]), private
+}
+
+func Test_TransactionBuilder(test *testing.T) {
+	rcd1, private1 := nextKey()
+	rcd2, private2 := nextKey()
+	dest := nextAddress()
+
+	b := NewTransactionBuilder(1000)
+	b.AddInput(rcd1, 0).
+		AddInput(rcd2, 50000000).
+		AddOutput(dest, 100000000).
+		AddECOutput(nextAddress(), 2000000).
+		BalanceFee(1000, 0)
+	t, err := b.Build()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// The inputs pay exactly for the outputs and the fee.
+	fee, _ := t.CalculateFee(1000)
+	tin, _ := t.TotalInputs()
+	if tin != 100000000+2000000+fee || len(t.GetRCDs()) != 2 {
+		Prtln("The fee was not balanced: ", tin, " ", fee)
+		test.Fail()
+	}
+
+	// A built transaction can be signed, but not changed.
+	data, _ := t.MarshalBinarySig()
+	for i, private := range []*[64]byte{private1, private2} {
+		sig := new(Signature)
+		sig.SetSignature(ed25519.Sign(private, data)[:])
+		sigblk := new(SignatureBlock)
+		sigblk.AddSignature(sig)
+		t.SetSignatureBlock(i, sigblk)
+	}
+	if err := t.ValidateSignatures(); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+	hash := t.GetHash()
+	data, _ = t.MarshalBinary()
+	if t.AddOutput(dest, 1) == nil || t.AddECOutput(dest, 1) == nil || t.AddInput(dest, 1) == nil ||
+		t.AddRCD(rcd2) == nil || t.(*Transaction).AddAuthorization(rcd2) == nil || t.SetMilliTimestamp(1) == nil ||
+		t.GetOutputs()[0].SetAmount(1) == nil || t.GetInputs()[0].SetAddress(dest) == nil ||
+		t.SetVersion(TRANSACTION_VERSION_SIGHASH) == nil || t.SetRCD(0, rcd2) == nil ||
+		t.UnmarshalBinary(data) == nil {
+		Prtln("Expected errors changing a built transaction")
+		test.Fail()
+	}
+	if !t.GetHash().IsSameAs(hash) {
+		Prtln("Changed a built transaction")
+		test.Fail()
+	}
+
+	// The builder goes on, and the first transaction doesn't change.
+	b.RemoveInput(0).ReplaceOutput(0, dest, 40000000).BalanceFee(1000, 0)
+	t2, err := b.Build()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(t2.GetInputs()) != 1 || t2.GetRCDs()[0].IsEqual(rcd2) != nil || len(t.GetInputs()) != 2 {
+		Prtln("Removing an input did not remove its RCD")
+		test.Fail()
+	}
+	if err := t2.Validate(1); err != nil {
+		Prtln(err)
+		test.Fail()
+	}
+
+	// Rebuild from a transaction.
+	t3, err := NewTransactionBuilderFrom(t).Build()
+	if err != nil || t3.GetSigHash().IsSameAs(t.GetSigHash()) == false {
+		Prtln("Did not rebuild the same transaction: ", err)
+		test.Fail()
+	}
+}
+
+func Test_TransactionBuilder_limits(test *testing.T) {
+	rcd, _ := nextKey()
+	b := NewTransactionBuilder(1000)
+	b.AddInput(rcd, 100000000)
+	for i := 0; i < MAX_TRANSACTION_ENTRIES; i++ {
+		b.AddOutput(nextAddress(), 1)
+	}
+	if b.Err() != nil {
+		test.Fatal(b.Err())
+	}
+	b.AddOutput(nextAddress(), 1)
+	if e, ok := b.Err().(*ValidationError); !ok || e.Kind != ERR_TOO_LARGE || e.Provided != 256 {
+		Prtln("Expected too many outputs, got: ", b.Err())
+		test.Fail()
+	}
+	if b.NumOutputs() != MAX_TRANSACTION_ENTRIES {
+		Prtln("A change over the limit was kept")
+		test.Fail()
+	}
+	if _, err := b.Build(); err != b.Err() {
+		test.Fail()
+	}
+
+	// With the outputs full, Entry Credit outputs push the transaction
+	// over its size.
+	b = NewTransactionBuilder(1000)
+	b.AddInput(rcd, 100000000)
+	for i := 0; i < MAX_TRANSACTION_ENTRIES; i++ {
+		b.AddOutput(nextAddress(), 1)
+	}
+	for b.Err() == nil {
+		b.AddECOutput(nextAddress(), 1000000)
+	}
+	size, _ := b.Size()
+	if e, ok := b.Err().(*ValidationError); !ok || e.Kind != ERR_TOO_LARGE || e.Required != MAX_TRANSACTION_SIZE ||
+		size > MAX_TRANSACTION_SIZE || b.NumECOutputs() >= MAX_TRANSACTION_ENTRIES {
+		Prtln("Expected a transaction too large, got: ", b.Err(), " at ", size, " bytes")
+		test.Fail()
+	}
+}
+
+func Test_TransactionBuilder_errors(test *testing.T) {
+	rcd, _ := nextKey()
+
+	b := NewTransactionBuilder(1000)
+	b.AddInput(rcd, 1).RemoveOutput(0).AddOutput(nextAddress(), 1)
+	if b.Err() == nil || b.NumOutputs() != 0 {
+		Prtln("Removing a missing output should stop the builder")
+		test.Fail()
+	}
+
+	// Outputs more than the inputs, with no fee balanced.
+	b = NewTransactionBuilder(1000)
+	b.AddInput(rcd, 1).AddOutput(nextAddress(), 2)
+	if _, err := b.Build(); GetValidationErrorKind(err) != ERR_INSUFFICIENT_FUNDS {
+		Prtln("Expected insufficient funds, got: ", err)
+		test.Fail()
+	}
+
+	// Other inputs already pay more than the outputs.
+	rcd2, _ := nextKey()
+	b = NewTransactionBuilder(1000)
+	b.AddInput(rcd, 1).AddInput(rcd2, 100000000).AddOutput(nextAddress(), 2).BalanceFee(1000, 0)
+	if b.Err() == nil {
+		Prtln("The fee should not balance")
+		test.Fail()
+	}
+
+	// A balanced fee is checked again on Build().
+	b = NewTransactionBuilder(1000)
+	b.AddInput(rcd, 0).AddOutput(nextAddress(), 100).BalanceFee(1000, 0).AddOutput(nextAddress(), 0)
+	if _, err := b.Build(); GetValidationErrorKind(err) != ERR_FEE_TOO_LOW {
+		Prtln("Expected the fee to be too low, got: ", err)
+		test.Fail()
+	}
+}
@@ -22,9 +22,9 @@ var _ = hex.EncodeToString
 type ITransAddress interface {
 	IBlock
 	GetAmount() uint64
-	SetAmount(uint64)
+	SetAmount(uint64) error
 	GetAddress() IAddress
-	SetAddress(IAddress)
+	SetAddress(IAddress) error
 	GetUserAddress() string
 	SetUserAddress(string)
 	CustomMarshalText2(string) ([]byte, error)
@@ -34,6 +34,8 @@ type TransAddress struct {
 	Amount      uint64
 	Address     IAddress
 	UserAddress string
+
+	owner *Transaction // The transaction holding this address, if any
 }
 
 var _ ITransAddress = (*TransAddress)(nil)
@@ -51,6 +53,10 @@ func (t *TransAddress) GetHash() IHash {
 	return nil
 }
 
+func init() {
+	RegisterType(new(TransAddress))
+}
+
 func (t *TransAddress) GetDBHash() IHash {
 	return Sha([]byte("TransAddress"))
 }
@@ -88,13 +94,22 @@ func (t *TransAddress) IsEqual(addr IBlock) []IBlock {
 }
 
 func (t *TransAddress) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	return t.unmarshalInto(data, new(Address))
+}
+
+// Unmarshal into the given Address.  Lets a Transaction allocate the
+// addresses of all its inputs and outputs at once.
+func (t *TransAddress) unmarshalInto(data []byte, adr *Address) (newData []byte, err error) {
 
-	if len(data) < 36 {
+	if len(data) < ADDRESS_LENGTH+1 { // At least a one byte amount, and the address
 		return nil, fmt.Errorf("Data source too short to UnmarshalBinary() an address: %d", len(data))
 	}
 
-	t.Amount, data = DecodeVarInt(data)
-	t.Address = new(Address)
+	t.Amount, data, err = DecodeCanonicalVarInt(data)
+	if err != nil {
+		return nil, err
+	}
+	t.Address = adr
 
 	data, err = t.Address.UnmarshalBinaryData(data)
 
@@ -128,8 +143,13 @@ func (ta TransAddress) GetAmount() uint64 {
 }
 
 // Accessor.  Get the amount with this address.
-func (ta *TransAddress) SetAmount(amount uint64) {
+func (ta *TransAddress) SetAmount(amount uint64) error {
+	if err := ta.checkSealed(); err != nil {
+		return err
+	}
 	ta.Amount = amount
+	ta.changed()
+	return nil
 }
 
 // Accessor.  Get the raw address.  Could be an actual address,
@@ -140,15 +160,39 @@ func (ta TransAddress) GetAddress() IAddress {
 
 // Accessor.  Get the raw address.  Could be an actual address,
 // or a hash of an authorization block.  See authorization.go
-func (ta *TransAddress) SetAddress(address IAddress) {
+func (ta *TransAddress) SetAddress(address IAddress) error {
+	if err := ta.checkSealed(); err != nil {
+		return err
+	}
 	ta.Address = address
+	ta.changed()
+	return nil
+}
+
+// Changing an address changes the transaction holding it, so its
+// caches must go.
+func (ta *TransAddress) changed() {
+	if ta.owner != nil {
+		ta.owner.clearCaches()
+	}
+}
+
+func (ta *TransAddress) checkSealed() error {
+	if ta.owner != nil {
+		return ta.owner.checkSealed()
+	}
+	return nil
+}
+
+func (ta *TransAddress) setOwner(t *Transaction) {
+	ta.owner = t
 }
 
 // Make this into somewhat readable text.
 func (ta TransAddress) CustomMarshalTextAll(fct bool, label string) ([]byte, error) {
 	var out bytes.Buffer
 	out.WriteString(fmt.Sprintf("   %8s: ", label))
-	v := strings.TrimSpace(ConvertDecimal(ta.Amount))
+	v := Amount(ta.Amount).String()
 	fill := 9 - len(v) + strings.Index(v, ".")
 	fstr := fmt.Sprintf("%%%vs%%%vs ", 16-fill, fill)
 	out.WriteString(fmt.Sprintf(fstr, v, ""))
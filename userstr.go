@@ -0,0 +1,183 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/btcsuitereleases/btcutil/base58"
+	"strings"
+)
+
+/**************************************
+ * Human readable strings
+ *
+ * Factoid addresses, Entry Credit public keys, and the private keys of
+ * both are shown to users in base58, as a two byte prefix that tells what
+ * the string is, 32 bytes of key or address, and the first 4 bytes of the
+ * sha256d of the prefix and key as a checksum.  ParseUserStr() reads any
+ * of them.
+ **************************************/
+
+// What a human readable string holds.
+type UserStrKind int
+
+const (
+	USER_STR_UNKNOWN UserStrKind = iota
+	USER_FCT_ADDRESS             // FA..., the hash of the RCD of a Factoid address
+	USER_EC_ADDRESS              // EC..., the public key of an Entry Credit address
+	USER_FCT_PRIVATE             // Fs..., a Factoid private key
+	USER_EC_PRIVATE              // Es..., an Entry Credit private key
+)
+
+const (
+	USER_STR_LENGTH     = 52 // Characters in a human readable string
+	USER_STR_BINARY_LEN = 38 // Bytes in its binary form
+)
+
+var userStrNames = map[UserStrKind]string{
+	USER_STR_UNKNOWN: "unknown",
+	USER_FCT_ADDRESS: "Factoid address",
+	USER_EC_ADDRESS:  "Entry Credit address",
+	USER_FCT_PRIVATE: "Factoid private key",
+	USER_EC_PRIVATE:  "Entry Credit private key",
+}
+
+func (k UserStrKind) String() string {
+	if name, ok := userStrNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+// The prefix for each kind of string.
+func (k UserStrKind) Prefix() []byte {
+	switch k {
+	case USER_FCT_ADDRESS:
+		return FactoidPrefix
+	case USER_EC_ADDRESS:
+		return EntryCreditPrefix
+	case USER_FCT_PRIVATE:
+		return FactoidPrivatePrefix
+	case USER_EC_PRIVATE:
+		return EntryCreditPrivatePrefix
+	}
+	return nil
+}
+
+// A parsed human readable string.
+type UserStr struct {
+	Kind UserStrKind
+	Key  IAddress // The address, public key, or private key
+}
+
+// The human readable form again.
+func (u *UserStr) String() string {
+	return base58.Encode(ConvertAddressToUser(u.Kind.Prefix(), u.Key))
+}
+
+// Why a string could not be parsed.
+type UserStrErrorKind int
+
+const (
+	ERR_USER_STR_UNKNOWN  UserStrErrorKind = iota // Not a UserStrError
+	ERR_USER_STR_LENGTH                           // The string, or what it decodes to, is the wrong length
+	ERR_USER_STR_PREFIX                           // The prefix is not one we know, or not the one expected
+	ERR_USER_STR_CHECKSUM                         // The checksum doesn't match
+	ERR_USER_STR_BASE58                           // The string is not valid base58
+)
+
+var userStrErrorNames = map[UserStrErrorKind]string{
+	ERR_USER_STR_UNKNOWN:  "unknown",
+	ERR_USER_STR_LENGTH:   "bad length",
+	ERR_USER_STR_PREFIX:   "bad prefix",
+	ERR_USER_STR_CHECKSUM: "bad checksum",
+	ERR_USER_STR_BASE58:   "bad base58",
+}
+
+func (k UserStrErrorKind) String() string {
+	if name, ok := userStrErrorNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+type UserStrError struct {
+	Kind UserStrErrorKind
+	Str  string // The string that failed to parse
+	Msg  string
+}
+
+func NewUserStrError(kind UserStrErrorKind, str string, format string, args ...interface{}) *UserStrError {
+	e := new(UserStrError)
+	e.Kind = kind
+	e.Str = str
+	e.Msg = fmt.Sprintf(format, args...)
+	return e
+}
+
+func (e *UserStrError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind.String(), e.Msg)
+}
+
+// Returns the kind of a parse error, or ERR_USER_STR_UNKNOWN if err is nil
+// or isn't a UserStrError.
+func GetUserStrErrorKind(err error) UserStrErrorKind {
+	if e, ok := err.(*UserStrError); ok {
+		return e.Kind
+	}
+	return ERR_USER_STR_UNKNOWN
+}
+
+// Parse any human readable Factoid or Entry Credit address or private key.
+// Leading and trailing white space is ignored.
+func ParseUserStr(str string) (*UserStr, error) {
+	str = strings.TrimSpace(str)
+	if len(str) != USER_STR_LENGTH {
+		return nil, NewUserStrError(ERR_USER_STR_LENGTH, str,
+			"Expected %d characters, found %d", USER_STR_LENGTH, len(str))
+	}
+	v := base58.Decode(str)
+	if len(v) == 0 {
+		return nil, NewUserStrError(ERR_USER_STR_BASE58, str, "%s is not valid base58", str)
+	}
+	if len(v) != USER_STR_BINARY_LEN {
+		return nil, NewUserStrError(ERR_USER_STR_LENGTH, str,
+			"Expected %d bytes once decoded, found %d", USER_STR_BINARY_LEN, len(v))
+	}
+
+	kind := USER_STR_UNKNOWN
+	for k := USER_FCT_ADDRESS; k <= USER_EC_PRIVATE; k++ {
+		if bytes.Equal(v[:2], k.Prefix()) {
+			kind = k
+		}
+	}
+	if kind == USER_STR_UNKNOWN {
+		return nil, NewUserStrError(ERR_USER_STR_PREFIX, str, "Unknown prefix %x", v[:2])
+	}
+
+	sha256d := Sha(Sha(v[:34]).Bytes()).Bytes()
+	if !bytes.Equal(sha256d[:4], v[34:]) {
+		return nil, NewUserStrError(ERR_USER_STR_CHECKSUM, str, "The checksum of %s does not match", str)
+	}
+
+	u := new(UserStr)
+	u.Kind = kind
+	u.Key = NewAddress(v[2:34])
+	return u, nil
+}
+
+// Parse a human readable string that must be of the given kind.  A string
+// of another kind is an ERR_USER_STR_PREFIX.
+func ParseUserStrAs(str string, kind UserStrKind) (*UserStr, error) {
+	u, err := ParseUserStr(str)
+	if err != nil {
+		return nil, err
+	}
+	if u.Kind != kind {
+		return nil, NewUserStrError(ERR_USER_STR_PREFIX, str, "Expected a %s, but found a %s", kind, u.Kind)
+	}
+	return u, nil
+}
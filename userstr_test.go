@@ -0,0 +1,77 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_ParseUserStr(test *testing.T) {
+	key := NewAddress(Sha([]byte("A fake address")).Bytes())
+	strs := map[UserStrKind]string{
+		USER_FCT_ADDRESS: ConvertFctAddressToUserStr(key),
+		USER_EC_ADDRESS:  ConvertECAddressToUserStr(key),
+		USER_FCT_PRIVATE: ConvertFctPrivateToUserStr(key),
+		USER_EC_PRIVATE:  ConvertECPrivateToUserStr(key),
+	}
+	for kind, str := range strs {
+		u, err := ParseUserStr(" " + str + "\n")
+		if err != nil {
+			Prtln(kind, ": ", err)
+			test.Fail()
+			continue
+		}
+		if u.Kind != kind || key.IsEqual(u.Key) != nil || u.String() != str {
+			Prtln(kind, ": parsed as a ", u.Kind, " ", u.String())
+			test.Fail()
+		}
+		if _, err := ParseUserStrAs(str, kind); err != nil {
+			Prtln(kind, ": ", err)
+			test.Fail()
+		}
+	}
+	if _, err := ParseUserStrAs(strs[USER_FCT_PRIVATE], USER_FCT_ADDRESS); GetUserStrErrorKind(err) != ERR_USER_STR_PREFIX {
+		Prtln("A private key should not parse as an address: ", err)
+		test.Fail()
+	}
+	// The first two letters say what kind of string it is.
+	for kind, prefix := range map[UserStrKind]string{USER_FCT_ADDRESS: "FA", USER_EC_ADDRESS: "EC",
+		USER_FCT_PRIVATE: "Fs", USER_EC_PRIVATE: "Es"} {
+		if !strings.HasPrefix(strs[kind], prefix) {
+			Prtln(kind, " does not start with ", prefix, ": ", strs[kind])
+			test.Fail()
+		}
+	}
+}
+
+func Test_ParseUserStr_errors(test *testing.T) {
+	good := ConvertFctAddressToUserStr(NewAddress(Sha([]byte("A fake address")).Bytes()))
+	bad := map[string]UserStrErrorKind{
+		"":                          ERR_USER_STR_LENGTH,
+		good[:51]:                   ERR_USER_STR_LENGTH,
+		good + "1":                  ERR_USER_STR_LENGTH,
+		good[:10] + "0" + good[11:]: ERR_USER_STR_BASE58, // No zero in base58
+		good[:10] + "l" + good[11:]: ERR_USER_STR_BASE58, // Nor a lower case L
+		strings.Repeat("1", 52):     ERR_USER_STR_LENGTH, // Decodes to 52 zeros
+		strings.Repeat("z", 52):     ERR_USER_STR_LENGTH,
+		"A" + good[1:]:              ERR_USER_STR_PREFIX,
+		good[:51] + "x":             ERR_USER_STR_CHECKSUM,
+	}
+	for str, kind := range bad {
+		_, err := ParseUserStr(str)
+		if GetUserStrErrorKind(err) != kind {
+			Prtln("Expected ", kind, " for '", str, "', got: ", err)
+			test.Fail()
+		}
+		if ValidateFUserStr(str) || ConvertUserStrToAddress(str) != nil {
+			Prtln("'", str, "' should not be valid")
+			test.Fail()
+		}
+	}
+	if GetUserStrErrorKind(nil) != ERR_USER_STR_UNKNOWN {
+		test.Fail()
+	}
+}
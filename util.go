@@ -141,7 +141,8 @@ var FactoidPrivatePrefix = []byte{0x64, 0x78}
 var EntryCreditPrivatePrefix = []byte{0x5d, 0xb6}
 
 // Take fixed point data and produce a nice decimial point
-// sort of output that users can handle.
+// sort of output that users can handle.  The output is padded
+// to line up in columns; Amount.String() is not.
 func ConvertDecimal(v uint64) string {
 	tv := v / 100000000
 	bv := v - (tv * 100000000)
@@ -164,7 +165,8 @@ func ConvertDecimal(v uint64) string {
 }
 
 // Convert Decimal point input to FixedPoint (no decimal point)
-// output suitable for Factom to chew on.
+// output suitable for Factom to chew on.  Anything past 8 decimal
+// places is dropped; ParseAmount() reports it as an error instead.
 func ConvertFixedPoint(amt string) (string, error) {
 	var v int64
 	var err error
@@ -246,25 +248,15 @@ func ConvertECPrivateToUserStr(addr IAddress) string {
 // Validates a User representation of a Factom and
 // Entry Credit addresses.
 //
-// Returns false if the length is wrong.
-// Returns false if the prefix is wrong.
-// Returns false if the checksum is wrong.
+// Returns false if the string is not valid, or is not of the kind the
+// prefix asks for.  Use ParseUserStr() to find out why.
 //
 func validateUserStr(prefix []byte, userFAddr string) bool {
-	if len(userFAddr) != 52 {
+	u, err := ParseUserStr(userFAddr)
+	if err != nil {
 		return false
-
-	}
-	v := base58.Decode(userFAddr)
-	if bytes.Compare(prefix, v[:2]) != 0 {
-		return false
-
 	}
-	sha256d := Sha(Sha(v[:34]).Bytes()).Bytes()
-	if bytes.Compare(sha256d[:4], v[34:]) != 0 {
-		return false
-	}
-	return true
+	return bytes.Equal(prefix, u.Kind.Prefix())
 }
 
 // Validate Factoids
@@ -289,11 +281,15 @@ func ValidateECPrivateUserStr(userFAddr string) bool {
 
 // Convert a User facing Factoid or Entry Credit address
 // or their Private Key representations
-// to the regular form.  Note validation must be done
-// separately!
+// to the regular form.  Returns nil if the string is not
+// valid.  ParseUserStr() also says what kind of string it
+// was.
 func ConvertUserStrToAddress(userFAddr string) []byte {
-	v := base58.Decode(userFAddr)
-	return v[2:34]
+	u, err := ParseUserStr(userFAddr)
+	if err != nil {
+		return nil
+	}
+	return u.Key.Bytes()
 }
 
 func DecodeVarInt(data []byte) (uint64, []byte) {
@@ -304,9 +300,33 @@ func EncodeVarInt(out *bytes.Buffer, v uint64) error {
 	return EncodeVarIntGo(out, v)
 }
 
+// Decode a variable integer written by EncodeVarInt(), and check it.
+// Data that ends inside the integer, an integer past 64 bits, and any
+// encoding but the shortest one are errors.  Decoders of data that came
+// from outside should use this rather than DecodeVarInt().
+func DecodeCanonicalVarInt(data []byte) (uint64, []byte, error) {
+	if len(data) > 0 && data[0] == 0x80 {
+		return 0, nil, fmt.Errorf("Variable integer is not in its shortest form")
+	}
+	var v uint64
+	for i, b := range data {
+		if v>>57 != 0 {
+			return 0, nil, fmt.Errorf("Variable integer is more than 64 bits")
+		}
+		v = v<<7 + uint64(b&0x7F)
+		if b < 0x80 {
+			return v, data[i+1:], nil
+		}
+	}
+	return 0, nil, fmt.Errorf("Data ends inside a variable integer")
+}
+
 // Decode a varaible integer from the given data buffer.
 // We use the algorithm used by Go, only BigEndian.
 func DecodeVarIntGo(data []byte) (uint64, []byte) {
+	if len(data) == 0 {
+		return 0, data
+	}
 
 	var v uint64
 	var cnt int
@@ -0,0 +1,102 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+)
+
+/**************************************
+ * IValidationError
+ *
+ * Validation of transactions and blocks returns a ValidationError, so
+ * callers can branch on why something is invalid rather than parsing
+ * the error message.
+ **************************************/
+
+// The kinds of validation failures.
+type ValidationErrorKind int
+
+const (
+	ERR_UNKNOWN            ValidationErrorKind = iota // Not a ValidationError
+	ERR_MALFORMED                                     // Transaction or block is not well formed
+	ERR_INSUFFICIENT_FUNDS                            // Inputs or balances don't cover what is spent
+	ERR_FEE_TOO_LOW                                   // Inputs cover the outputs, but not the fee
+	ERR_BAD_SIGNATURE                                 // A signature is missing or doesn't verify
+	ERR_RCD_MISMATCH                                  // An RCD doesn't match its input
+	ERR_TOO_LARGE                                     // Transaction, or a count within it, exceeds a limit
+	ERR_TOO_OLD                                       // Transaction is dated too far before the block
+	ERR_TOO_NEW                                       // Transaction is dated too far after the block
+	ERR_COINBASE                                      // Coinbase transaction breaks the coinbase rules
+	ERR_AMOUNT_OVERFLOW                               // An amount, or a sum of amounts, is out of range
+	ERR_LOCKED                                        // An input is time locked past the block
+)
+
+var validationErrorNames = map[ValidationErrorKind]string{
+	ERR_UNKNOWN:            "unknown",
+	ERR_MALFORMED:          "malformed",
+	ERR_INSUFFICIENT_FUNDS: "insufficient funds",
+	ERR_FEE_TOO_LOW:        "fee too low",
+	ERR_BAD_SIGNATURE:      "bad signature",
+	ERR_RCD_MISMATCH:       "rcd mismatch",
+	ERR_TOO_LARGE:          "too large",
+	ERR_TOO_OLD:            "too old",
+	ERR_TOO_NEW:            "too new",
+	ERR_COINBASE:           "coinbase",
+	ERR_AMOUNT_OVERFLOW:    "amount overflow",
+	ERR_LOCKED:             "locked",
+}
+
+func (k ValidationErrorKind) String() string {
+	if name, ok := validationErrorNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind %d", int(k))
+}
+
+type IValidationError interface {
+	error
+	GetKind() ValidationErrorKind
+}
+
+// A validation failure, with whatever details apply to its kind.  Input is
+// the index of the input (or RCD, or output) at fault, or -1.  Required and
+// Provided are set for the kinds that compare amounts or sizes.
+type ValidationError struct {
+	Kind     ValidationErrorKind
+	Msg      string
+	Input    int
+	Address  IAddress
+	Required uint64
+	Provided uint64
+}
+
+var _ IValidationError = (*ValidationError)(nil)
+
+// Create a ValidationError of the given kind, with a formatted message.
+func NewValidationError(kind ValidationErrorKind, format string, args ...interface{}) *ValidationError {
+	e := new(ValidationError)
+	e.Kind = kind
+	e.Msg = fmt.Sprintf(format, args...)
+	e.Input = -1
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func (e *ValidationError) GetKind() ValidationErrorKind {
+	return e.Kind
+}
+
+// Returns the kind of a validation error, or ERR_UNKNOWN if err is nil or
+// isn't a validation error.
+func GetValidationErrorKind(err error) ValidationErrorKind {
+	if verr, ok := err.(IValidationError); ok {
+		return verr.GetKind()
+	}
+	return ERR_UNKNOWN
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factoid
+
+import (
+	"fmt"
+	"testing"
+)
+
+func Test_ValidationError_kinds(test *testing.T) {
+	pub := nextSig()
+	rcd := NewRCD_1(pub)
+	adr, _ := rcd.GetAddress()
+
+	t := new(Transaction)
+	t.AddInput(adr, 1000)
+	t.AddOutput(nextAddress(), 2000)
+	t.AddRCD(rcd)
+
+	err := t.Validate(1)
+	if GetValidationErrorKind(err) != ERR_INSUFFICIENT_FUNDS {
+		fmt.Println("Expected insufficient funds, got: ", err)
+		test.Fail()
+	} else if e := err.(*ValidationError); e.Required != 2000 || e.Provided != 1000 {
+		fmt.Println("Expected 2000 required and 1000 provided, got: ", e.Required, e.Provided)
+		test.Fail()
+	}
+
+	t.Outputs[0].SetAmount(500)
+	if err := t.Validate(1); err != nil {
+		fmt.Println(err)
+		test.Fail()
+	}
+	if GetValidationErrorKind(t.Validate(0)) != ERR_COINBASE {
+		fmt.Println("A coinbase with inputs should break the coinbase rules")
+		test.Fail()
+	}
+
+	t.RCDs[0] = NewRCD_1(nextSig())
+	err = t.Validate(1)
+	if GetValidationErrorKind(err) != ERR_RCD_MISMATCH || err.(*ValidationError).Input != 0 {
+		fmt.Println("Expected an RCD mismatch on input 0, got: ", err)
+		test.Fail()
+	}
+
+	t.RCDs[0] = rcd
+	if GetValidationErrorKind(t.ValidateSignatures()) != ERR_BAD_SIGNATURE {
+		fmt.Println("An unsigned transaction should have a bad signature")
+		test.Fail()
+	}
+
+	if _, err := ValidateAmounts(1<<62, 1<<62); GetValidationErrorKind(err) != ERR_AMOUNT_OVERFLOW {
+		fmt.Println("Expected an amount overflow, got: ", err)
+		test.Fail()
+	}
+
+	if GetValidationErrorKind(nil) != ERR_UNKNOWN || GetValidationErrorKind(fmt.Errorf("x")) != ERR_UNKNOWN {
+		test.Fail()
+	}
+}
@@ -1,10 +1,9 @@
 package wallet
 
 import (
-	"fmt"
+	fct "github.com/FactomProject/factoid"
 	"github.com/FactomProject/go-bip32"
 	"github.com/FactomProject/go-bip39"
-	"github.com/btcsuitereleases/btcutil/base58"
 	"strings"
 )
 
@@ -29,29 +28,17 @@ func MnemonicStringToPrivateKey(mnemonic string) ([]byte, error) {
 }
 
 func HumanReadableFactoidPrivateKeyToPrivateKey(human string) ([]byte, error) {
-	human = strings.TrimSpace(human)
-	base, version, err := base58.CheckDecode(human)
+	u, err := fct.ParseUserStrAs(human, fct.USER_FCT_PRIVATE)
 	if err != nil {
 		return nil, err
 	}
-
-	if version != 0x64 || base[0] != 0x78 {
-		return nil, fmt.Errorf("Invalid prefix")
-	}
-
-	return base[1:], nil
+	return u.Key.Bytes(), nil
 }
 
 func HumanReadableECPrivateKeyToPrivateKey(human string) ([]byte, error) {
-	human = strings.TrimSpace(human)
-	base, version, err := base58.CheckDecode(human)
+	u, err := fct.ParseUserStrAs(human, fct.USER_EC_PRIVATE)
 	if err != nil {
 		return nil, err
 	}
-
-	if version != 0x5d || base[0] != 0xb6 {
-		return nil, fmt.Errorf("Invalid prefix")
-	}
-
-	return base[1:], nil
+	return u.Key.Bytes(), nil
 }
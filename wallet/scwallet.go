@@ -27,13 +27,13 @@ import (
 type ISCWallet interface {
 
 	//initialize the object.  call before using other functions
-	Init(a ...interface{})
+	Init(a ...interface{}) error
 	// A New Seed is generated for the wallet.
-	NewSeed(data []byte)
+	NewSeed(data []byte) error
 	// Set the seed for a wallet
-	SetSeed(seed []byte)
+	SetSeed(seed []byte) error
 	// Get the seed for a wallet
-	GetSeed() []byte
+	GetSeed() ([]byte, error)
 	// Set the current deterministic root (Initialization function)
 	SetRoot([]byte)
 	// Returns the backing database for the wallet
@@ -58,9 +58,30 @@ type ISCWallet interface {
 
 	// Generate a Factoid Address from a set of 12 words from the token sale
 	GenerateFctAddressFromMnemonic(name []byte, mnemonic string, m int, n int) (fct.IAddress, error)
+	// Generate a Factoid Address that can't be spent from until the lock
+	// expires, at a directory block height or a time in milliseconds.  A
+	// vesting schedule is a set of these.
+	GenerateTimeLockedFctAddress(name []byte, kind fct.LockKind, value uint64) (fct.IAddress, error)
+	// Get the time locked addresses in the wallet
+	GetTimeLockedAddresses() ([]IWalletEntry, error)
+
+	/** Hash time locked contracts, for atomic swaps **/
+	// Create a contract that the recipient can claim by revealing the
+	// preimage of the hash, or the sender can take back from the refund
+	// height on.  The keys are public keys.  The wallet keeps the contract
+	// under the given name.
+	CreateHTLC(name []byte, hash []byte, refundHeight uint32, recipient []byte, sender []byte) (fct.IAddress, error)
+	// Add an output paying into a contract
+	FundHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64) error
+	// Add an input claiming from a contract with the preimage.  The
+	// recipient signs it with SignInputs()
+	ClaimHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64, preimage []byte) error
+	// Add an input refunding from a contract.  The sender signs it with
+	// SignInputs()
+	RefundHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64) error
 
 	// Get details for an address
-	GetAddressDetailsAddr(addr []byte) IWalletEntry
+	GetAddressDetailsAddr(addr []byte) (IWalletEntry, error)
 	// Returns the Address hash (what we use for inputs) given the public key
 	GetAddressHash(fct.IAddress) (fct.IAddress, error)
 
@@ -89,8 +110,16 @@ type ISCWallet interface {
 	// to be sent to other people to complete the signing process.  This will
 	// be particularly useful with multisig.
 	SignInputs(fct.ITransaction) (bool, error) // True if all inputs are signed
-	// Sign a CommitEntry or a CommitChain with the eckey
+	// Sign the inputs with the given sighash type.  Anything but
+	// SIGHASH_ALL needs a version 3 transaction.
+	SignInputsWith(fct.ITransaction, fct.SigHashType) (bool, error)
+	// Sign a CommitEntry or a CommitChain with the eckey.  Returns nil if
+	// the signer won't sign it.
 	SignCommit(we IWalletEntry, data []byte) []byte
+	// Set the signer the wallet asks for signatures.  Nil, the default,
+	// signs with the private keys held in the wallet.
+	SetSigner(ISigner)
+	GetSigner() ISigner
 	// Get the exchange rate of Factoids per Entry Credit
 	// 	GetECRate() uint64
 }
@@ -102,6 +131,7 @@ type SCWallet struct {
 	isInitialized bool //defaults to 0 and false
 	RootSeed      []byte
 	NextSeed      []byte
+	signer        ISigner
 }
 
 var _ ISCWallet = (*SCWallet)(nil)
@@ -130,36 +160,64 @@ func (SCWallet) GetDBHash() fct.IHash {
 	return fct.Sha([]byte("SCWallet"))
 }
 
-func (w *SCWallet) SignInputs(trans fct.ITransaction) (bool, error) {
+func (w *SCWallet) SetSigner(signer ISigner) {
+	w.signer = signer
+}
 
-	data, err := trans.MarshalBinarySig() // Get the part of the transaction we sign
-	if err != nil {
-		return false, err
+func (w *SCWallet) GetSigner() ISigner {
+	if w.signer == nil {
+		return NewWalletSigner(&w.db)
 	}
+	return w.signer
+}
+
+func (w *SCWallet) SignInputs(trans fct.ITransaction) (bool, error) {
+	return w.SignInputsWith(trans, fct.SIGHASH_ALL)
+}
+
+func (w *SCWallet) SignInputsWith(trans fct.ITransaction, h fct.SigHashType) (bool, error) {
 
 	var errMsg []byte
 
+	signer := w.GetSigner()
 	rcds := trans.GetRCDs()
 	for i, rcd := range rcds {
-		rcd1, ok := rcd.(*fct.RCD_1)
-		if ok {
-			pub := rcd1.GetPublicKey()
-			we, ok := w.db.GetRaw([]byte(fct.W_ADDRESS_PUB_KEY), pub).(*WalletEntry)
-			if ok {
-				var pri [fct.SIGNATURE_LENGTH]byte
-				copy(pri[:], we.private[0])
-				bsig := ed25519.Sign(&pri, data)
-				sig := new(fct.Signature)
-				sig.SetSignature(bsig[:])
-				sigblk := new(fct.SignatureBlock)
-				sigblk.AddSignature(sig)
-				trans.SetSignatureBlock(i, sigblk)
-			} else {
-				errMsg = append(errMsg,
-					[]byte("Do not have the private key for: "+
-						fct.ConvertFctAddressToUserStr(fct.NewAddress(pub))+"\n")...)
+		if lock, ok := rcd.(fct.IRCD_3); ok {
+			rcd = lock.GetInnerRCD() // Signed with the key inside the lock
+		}
+		var pub, preimage []byte
+		switch r := rcd.(type) {
+		case *fct.RCD_1:
+			pub = r.GetPublicKey()
+		case fct.IRCD_4:
+			// The recipient signs a claim, and the sender a refund
+			preimage = trans.GetSignatureBlock(i).GetPreimage()
+			pub = r.GetSenderKey()
+			if len(preimage) > 0 {
+				pub = r.GetRecipientKey()
 			}
+		default:
+			continue
 		}
+		data, err := trans.MarshalBinarySigHash(i, h) // Get the part of the transaction we sign
+		if err != nil {
+			return false, err
+		}
+		bsig, err := signer.Sign(&SignRequest{pub, data, trans, i, h})
+		if IsNoKey(err) {
+			errMsg = append(errMsg, []byte(err.Error()+"\n")...)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		sig := new(fct.Signature)
+		sig.SetSignature(bsig)
+		sigblk := new(fct.SignatureBlock)
+		sigblk.AddSignature(sig)
+		sigblk.SetSigHashType(h)
+		sigblk.SetPreimage(preimage)
+		trans.SetSignatureBlock(i, sigblk)
 	}
 
 	if errMsg != nil {
@@ -173,11 +231,12 @@ func (w *SCWallet) SignInputs(trans fct.ITransaction) (bool, error) {
 func (w *SCWallet) SignCommit(we IWalletEntry, data []byte) []byte {
 	pub := new([fct.ADDRESS_LENGTH]byte)
 	copy(pub[:], we.GetKey(0))
-	pri := new([fct.PRIVATE_LENGTH]byte)
-	copy(pri[:], we.GetPrivKey(0))
-	sig := ed25519.Sign(pri, data)
+	sig, err := w.GetSigner().Sign(&SignRequest{Public: pub[:], Data: data})
+	if err != nil {
+		return nil
+	}
 	r := append(data, pub[:]...)
-	r = append(r, sig[:]...)
+	r = append(r, sig...)
 
 	return r
 }
@@ -186,8 +245,15 @@ func (w *SCWallet) GetECRate() uint64 {
 	return factoshisPerEC
 }
 
-func (w *SCWallet) GetAddressDetailsAddr(name []byte) IWalletEntry {
-	return w.db.GetRaw([]byte("wallet.address.addr"), name).(IWalletEntry)
+func (w *SCWallet) GetAddressDetailsAddr(name []byte) (IWalletEntry, error) {
+	v, err := w.db.GetRaw([]byte(fct.W_RCD_ADDRESS_HASH), name)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("Unknown address")
+	}
+	return v.(IWalletEntry), nil
 }
 
 func (w *SCWallet) generateAddressFromPrivateKey(addrtype string, name []byte, privateKey []byte, m int, n int) (fct.IAddress, error) {
@@ -219,10 +285,21 @@ func (w *SCWallet) generateAddress(addrtype string, name []byte, m int, n int) (
 }
 
 func (w *SCWallet) AddKeyPair(addrtype string, name []byte, pub []byte, pri []byte, generateRandomIfAddressPresent bool) (address fct.IAddress, err error) {
+	return w.addKeyPair(addrtype, name, pub, pri, generateRandomIfAddressPresent, func(pub []byte) (fct.IRCD, error) {
+		return fct.NewRCD_1(pub), nil
+	})
+}
+
+// Add a key pair, with the RCD built from the public key by newRCD.
+func (w *SCWallet) addKeyPair(addrtype string, name []byte, pub []byte, pri []byte, generateRandomIfAddressPresent bool,
+	newRCD func(pub []byte) (fct.IRCD, error)) (address fct.IAddress, err error) {
 
 	we := new(WalletEntry)
 
-	nm := w.db.GetRaw([]byte(fct.W_NAME), name)
+	nm, err := w.db.GetRaw([]byte(fct.W_NAME), name)
+	if err != nil {
+		return nil, err
+	}
 	if nm != nil {
 		str := fmt.Sprintf("The name '%s' already exists. Duplicate names are not supported", string(name))
 		return nil, fmt.Errorf(str)
@@ -230,7 +307,14 @@ func (w *SCWallet) AddKeyPair(addrtype string, name []byte, pub []byte, pri []by
 
 	// Make sure we have not generated this pair before;  Keep
 	// generating until we have a unique pair.
-	for w.db.GetRaw([]byte(fct.W_ADDRESS_PUB_KEY), pub) != nil {
+	for {
+		v, err := w.db.GetRaw([]byte(fct.W_ADDRESS_PUB_KEY), pub)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			break
+		}
 		if generateRandomIfAddressPresent {
 			pub, pri, err = w.generateKey()
 			if err != nil {
@@ -241,9 +325,13 @@ func (w *SCWallet) AddKeyPair(addrtype string, name []byte, pub []byte, pri []by
 		}
 	}
 
+	rcd, err := newRCD(pub)
+	if err != nil {
+		return nil, err
+	}
 	we.AddKey(pub, pri)
 	we.SetName(name)
-	we.SetRCD(fct.NewRCD_1(pub))
+	we.SetRCD(rcd)
 	if addrtype == "fct" {
 		we.SetType("fct")
 	} else {
@@ -251,9 +339,15 @@ func (w *SCWallet) AddKeyPair(addrtype string, name []byte, pub []byte, pri []by
 	}
 	//
 	address, _ = we.GetAddress()
-	w.db.PutRaw([]byte(fct.W_RCD_ADDRESS_HASH), address.Bytes(), we)
-	w.db.PutRaw([]byte(fct.W_ADDRESS_PUB_KEY), pub, we)
-	w.db.PutRaw([]byte(fct.W_NAME), name, we)
+	if err = w.db.PutRaw([]byte(fct.W_RCD_ADDRESS_HASH), address.Bytes(), we); err != nil {
+		return nil, err
+	}
+	if err = w.db.PutRaw([]byte(fct.W_ADDRESS_PUB_KEY), pub, we); err != nil {
+		return nil, err
+	}
+	if err = w.db.PutRaw([]byte(fct.W_NAME), name, we); err != nil {
+		return nil, err
+	}
 
 	return
 }
@@ -265,6 +359,122 @@ func (w *SCWallet) GenerateFctAddress(name []byte, m int, n int) (hash fct.IAddr
 	return w.generateAddress("fct", name, m, n)
 }
 
+func (w *SCWallet) GenerateTimeLockedFctAddress(name []byte, kind fct.LockKind, value uint64) (fct.IAddress, error) {
+	pub, pri, err := w.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	return w.addKeyPair("fct", name, pub, pri, true, func(pub []byte) (fct.IRCD, error) {
+		return fct.NewRCD_3(kind, value, fct.NewRCD_1(pub))
+	})
+}
+
+func (w *SCWallet) GetTimeLockedAddresses() ([]IWalletEntry, error) {
+	_, values, err := w.db.GetKeysValues([]byte(fct.W_RCD_ADDRESS_HASH))
+	if err != nil {
+		return nil, err
+	}
+	var locked []IWalletEntry
+	for _, v := range values {
+		we, ok := v.(IWalletEntry)
+		if !ok {
+			continue
+		}
+		if _, ok := we.GetRCD().(fct.IRCD_3); ok {
+			locked = append(locked, we)
+		}
+	}
+	return locked, nil
+}
+
+func (w *SCWallet) CreateHTLC(name []byte, hash []byte, refundHeight uint32, recipient []byte, sender []byte) (fct.IAddress, error) {
+	rcd, err := fct.NewRCD_4(hash, refundHeight, recipient, sender)
+	if err != nil {
+		return nil, err
+	}
+
+	nm, err := w.db.GetRaw([]byte(fct.W_NAME), name)
+	if err != nil {
+		return nil, err
+	}
+	if nm != nil {
+		return nil, fmt.Errorf("The name '%s' already exists. Duplicate names are not supported", string(name))
+	}
+
+	// The wallet holds no keys for the contract itself, only the keys
+	// of the recipient or the sender.
+	we := new(WalletEntry)
+	we.SetName(name)
+	we.SetRCD(rcd)
+	we.SetType("fct")
+	address, err := we.GetAddress()
+	if err != nil {
+		return nil, err
+	}
+	if err = w.db.PutRaw([]byte(fct.W_RCD_ADDRESS_HASH), address.Bytes(), we); err != nil {
+		return nil, err
+	}
+	if err = w.db.PutRaw([]byte(fct.W_NAME), name, we); err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// The contract in the wallet at the given address.
+func (w *SCWallet) getHTLC(contract fct.IAddress) (fct.IRCD_4, fct.IAddress, error) {
+	we, adr, err := w.getWalletEntry([]byte(fct.W_RCD_ADDRESS_HASH), contract)
+	if err != nil {
+		return nil, nil, err
+	}
+	rcd, ok := we.GetRCD().(fct.IRCD_4)
+	if !ok {
+		return nil, nil, fmt.Errorf("Not a hash time locked contract")
+	}
+	return rcd, adr, nil
+}
+
+func (w *SCWallet) FundHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64) error {
+	_, adr, err := w.getHTLC(contract)
+	if err != nil {
+		return err
+	}
+	return trans.AddOutput(fct.CreateAddress(adr), amount)
+}
+
+func (w *SCWallet) ClaimHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64, preimage []byte) error {
+	rcd, adr, err := w.getHTLC(contract)
+	if err != nil {
+		return err
+	}
+	if !fct.CheckPreimage(rcd.GetHashLock(), preimage) {
+		return fmt.Errorf("The preimage does not match the hash of the contract")
+	}
+	return w.addHTLCInput(trans, rcd, adr, amount, preimage)
+}
+
+func (w *SCWallet) RefundHTLC(trans fct.ITransaction, contract fct.IAddress, amount uint64) error {
+	rcd, adr, err := w.getHTLC(contract)
+	if err != nil {
+		return err
+	}
+	return w.addHTLCInput(trans, rcd, adr, amount, nil)
+}
+
+// The preimage goes in the signature block of the input, where
+// SignInputs() finds it.
+func (w *SCWallet) addHTLCInput(trans fct.ITransaction, rcd fct.IRCD, adr fct.IAddress, amount uint64, preimage []byte) error {
+	if err := trans.AddRCD(rcd); err != nil {
+		return err
+	}
+	if err := trans.AddInput(fct.CreateAddress(adr), amount); err != nil {
+		return err
+	}
+	sigblk := new(fct.SignatureBlock)
+	sigblk.SetPreimage(preimage)
+	trans.SetSignatureBlock(len(trans.GetInputs())-1, sigblk)
+	return nil
+}
+
 func (w *SCWallet) GenerateECAddressFromPrivateKey(name []byte, privateKey []byte) (hash fct.IAddress, err error) {
 	return w.generateAddressFromPrivateKey("ec", name, privateKey, 1, 1)
 }
@@ -296,41 +506,50 @@ func (w *SCWallet) GenerateFctAddressFromMnemonic(name []byte, mnemonic string,
 	return w.GenerateFctAddressFromPrivateKey(name, priv, m, n)
 }
 
-func (w *SCWallet) NewSeed(data []byte) {
+func (w *SCWallet) NewSeed(data []byte) error {
 	if len(data) == 0 {
-		return
+		return nil
 	} // No data, no change
 	hasher := sha512.New()
 	hasher.Write(data)
 	seedhash := hasher.Sum(nil)
-	w.NextSeed = seedhash
-	w.RootSeed = seedhash
-	b := new(database.ByteStore)
-	b.SetBytes(w.RootSeed)
-	w.db.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], b)
-	w.db.PutRaw([]byte(fct.W_SEEDS), w.RootSeed[:32], b)
-	w.db.PutRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32], b)
+	return w.SetSeed(seedhash)
 }
 
-func (w *SCWallet) SetSeed(seed []byte) {
+func (w *SCWallet) SetSeed(seed []byte) error {
 	w.NextSeed = seed
 	w.RootSeed = seed
 	b := new(database.ByteStore)
 	b.SetBytes(w.RootSeed)
-	w.db.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], b)
-	w.db.PutRaw([]byte(fct.W_SEEDS), w.RootSeed[:32], b)
-	w.db.PutRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32], b)
+	if err := w.db.PutRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:], b); err != nil {
+		return err
+	}
+	if err := w.db.PutRaw([]byte(fct.W_SEEDS), w.RootSeed[:32], b); err != nil {
+		return err
+	}
+	return w.db.PutRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32], b)
 }
 
-func (w *SCWallet) GetSeed() []byte {
-	iroot := w.db.GetRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:])
+func (w *SCWallet) GetSeed() ([]byte, error) {
+	iroot, err := w.db.GetRaw([]byte(fct.W_SEEDS), fct.CURRENT_SEED[:])
+	if err != nil {
+		return nil, err
+	}
 	if iroot == nil {
 		randomstuff := make([]byte, 1024)
 		rand.Read(randomstuff)
-		w.NewSeed(randomstuff)
+		if err := w.NewSeed(randomstuff); err != nil {
+			return nil, err
+		}
 	} else if w.RootSeed == nil {
 		w.RootSeed = iroot.(database.IByteStore).Bytes()
-		inext := w.db.GetRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32])
+		inext, err := w.db.GetRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32])
+		if err != nil {
+			return nil, err
+		}
+		if inext == nil {
+			return nil, database.NewCorruptionError("Wallet has a root seed, but no seed head")
+		}
 		w.NextSeed = inext.(database.IByteStore).Bytes()
 	}
 	hasher := sha512.New()
@@ -340,17 +559,22 @@ func (w *SCWallet) GetSeed() []byte {
 
 	b := new(database.ByteStore)
 	b.SetBytes(w.NextSeed)
-	w.db.PutRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32], b)
+	if err := w.db.PutRaw([]byte(fct.W_SEED_HEADS), w.RootSeed[:32], b); err != nil {
+		return nil, err
+	}
 
-	return w.NextSeed
+	return w.NextSeed, nil
 }
 
-func (w *SCWallet) Init(a ...interface{}) {
+func (w *SCWallet) Init(a ...interface{}) error {
 	if w.isInitialized != false {
-		return
+		return nil
+	}
+	if err := w.db.Init(); err != nil {
+		return err
 	}
 	w.isInitialized = true
-	w.db.Init()
+	return nil
 }
 
 // This function pulls the next private key from the deterministic
@@ -363,9 +587,13 @@ func (w *SCWallet) Init(a ...interface{}) {
 // The public key essentially returns twice because of this.
 func (w *SCWallet) generateKey() (public []byte, private []byte, err error) {
 
+	seed, err := w.GetSeed()
+	if err != nil {
+		return nil, nil, err
+	}
 	keypair := new([64]byte)
 	// the secret part of the keypair is the top 32 bytes of the sha512 hash
-	copy(keypair[:32], w.GetSeed()[:32])
+	copy(keypair[:32], seed[:32])
 	// the crypto library puts the pubkey in the lower 32 bytes and returns the same 32 bytes.
 	pub := ed25519.GetPublicKey(keypair)
 
@@ -400,7 +628,10 @@ func (w *SCWallet) CreateTransaction(time uint64) fct.ITransaction {
 
 func (w *SCWallet) getWalletEntry(bucket []byte, address fct.IAddress) (IWalletEntry, fct.IAddress, error) {
 
-	v := w.db.GetRaw([]byte(fct.W_RCD_ADDRESS_HASH), address.Bytes())
+	v, err := w.db.GetRaw([]byte(fct.W_RCD_ADDRESS_HASH), address.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
 	if v == nil {
 		return nil, nil, fmt.Errorf("Unknown address")
 	}
@@ -430,18 +661,20 @@ func (w *SCWallet) AddInput(trans fct.ITransaction, address fct.IAddress, amount
 	// If it isn't, we assume the user knows what they are doing.
 	if we == nil || err != nil {
 		rcd := fct.NewRCD_1(address.Bytes())
-		trans.AddRCD(rcd)
 		adr, err := rcd.GetAddress()
 		if err != nil {
 			return err
 		}
-		trans.AddInput(fct.CreateAddress(adr), amount)
-	} else {
-		trans.AddRCD(we.GetRCD())
-		trans.AddInput(fct.CreateAddress(adr), amount)
+		if err := trans.AddRCD(rcd); err != nil {
+			return err
+		}
+		return trans.AddInput(fct.CreateAddress(adr), amount)
 	}
 
-	return nil
+	if err := trans.AddRCD(we.GetRCD()); err != nil {
+		return err
+	}
+	return trans.AddInput(fct.CreateAddress(adr), amount)
 }
 
 func (w *SCWallet) UpdateInput(trans fct.ITransaction, index int, address fct.IAddress, amount uint64) error {
@@ -456,12 +689,15 @@ func (w *SCWallet) UpdateInput(trans fct.ITransaction, index int, address fct.IA
 		return err
 	}
 
-	trans.GetRCDs()[index] = we.GetRCD() // The RCD must match the (possibly) new input
-
-	in.SetAddress(adr)
-	in.SetAmount(amount)
+	// The RCD must match the (possibly) new input
+	if err := trans.SetRCD(index, we.GetRCD()); err != nil {
+		return err
+	}
 
-	return nil
+	if err := in.SetAddress(adr); err != nil {
+		return err
+	}
+	return in.SetAmount(amount)
 }
 
 func (w *SCWallet) AddOutput(trans fct.ITransaction, address fct.IAddress, amount uint64) error {
@@ -471,9 +707,7 @@ func (w *SCWallet) AddOutput(trans fct.ITransaction, address fct.IAddress, amoun
 		adr = address
 	}
 
-	trans.AddOutput(fct.CreateAddress(adr), amount)
-
-	return nil
+	return trans.AddOutput(fct.CreateAddress(adr), amount)
 }
 
 func (w *SCWallet) AddECOutput(trans fct.ITransaction, address fct.IAddress, amount uint64) error {
@@ -483,8 +717,7 @@ func (w *SCWallet) AddECOutput(trans fct.ITransaction, address fct.IAddress, amo
 		adr = address
 	}
 
-	trans.AddECOutput(fct.CreateAddress(adr), amount)
-	return nil
+	return trans.AddECOutput(fct.CreateAddress(adr), amount)
 }
 
 func (w *SCWallet) Validate(index int, trans fct.ITransaction) error {
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"github.com/FactomProject/ed25519"
 	"github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/database"
 	"math/rand"
 	"testing"
 )
@@ -181,3 +182,227 @@ func Test_SignTransaction_swcallet(test *testing.T) {
 	}
 
 }
+
+// A built transaction can't be updated, and is left as it was.
+func Test_UpdateInput_built_swcallet(test *testing.T) {
+	w := new(SCWallet)
+	w.Init()
+	w.NewSeed([]byte("built"))
+	h0, _ := w.GenerateFctAddress([]byte("test 0"), 1, 1)
+	h1, _ := w.GenerateFctAddress([]byte("test 1"), 1, 1)
+	we, _ := w.GetAddressDetailsAddr(h0.Bytes())
+
+	t, err := fct.NewTransactionBuilder(0).
+		AddInput(we.GetRCD(), 2000000).
+		AddOutput(h1, 1000000).
+		Build()
+	if err != nil {
+		test.Fatal(err)
+	}
+	hash := t.GetHash()
+	if err := w.UpdateInput(t, 0, h1, 5); err == nil {
+		fct.Prtln("Updated an input of a built transaction")
+		test.Fail()
+	}
+	if w.AddInput(t, h1, 5) == nil || w.AddOutput(t, h0, 5) == nil || w.AddECOutput(t, h0, 5) == nil {
+		fct.Prtln("Added to a built transaction")
+		test.Fail()
+	}
+	if !t.GetHash().IsSameAs(hash) {
+		fct.Prtln("UpdateInput changed a built transaction")
+		test.Fail()
+	}
+}
+
+// A database whose writes always fail, as if the disk were full.
+type fullDB struct {
+	database.MapDB
+}
+
+func (fullDB) PutRaw(bucket []byte, key []byte, value factoid.IBlock) error {
+	return fmt.Errorf("Disk full")
+}
+
+func TestWalletDatabaseErrors(t *testing.T) {
+	w := new(SCWallet)
+	w.Init()
+	w.NewSeed([]byte("lkdfsgjlagkjlasd"))
+
+	full := new(fullDB)
+	full.Init()
+	w.GetDB().SetPersist(full)
+
+	if _, err := w.GenerateFctAddress([]byte("lost"), 1, 1); err == nil {
+		t.Errorf("A failed write should fail address generation")
+	}
+	if err := w.SetSeed(make([]byte, 64)); err == nil {
+		t.Errorf("A failed write should fail setting the seed")
+	}
+	if _, err := w.GetAddressDetailsAddr(make([]byte, 32)); err == nil {
+		t.Errorf("Details of an unknown address should be an error")
+	}
+}
+
+func Test_SignInputsWith_swcallet(test *testing.T) {
+	w := new(SCWallet) // make me a wallet
+	w.Init()
+	w.NewSeed([]byte("lkdfsgjlagkjlasd"))
+	h1, _ := w.GenerateFctAddress([]byte("test 1"), 1, 1)
+	h2, _ := w.GenerateFctAddress([]byte("test 2"), 1, 1)
+
+	t := w.CreateTransaction(0)
+	w.AddInput(t, h1, 1000000)
+	w.AddOutput(t, h2, 900000)
+
+	acp := fct.SIGHASH_ALL | fct.SIGHASH_ANYONECANPAY
+	if signed, err := w.SignInputsWith(t, acp); signed || err == nil {
+		factoid.Prtln("A version 2 transaction was signed ", acp)
+		test.Fail()
+	}
+	t.SetVersion(fct.TRANSACTION_VERSION_SIGHASH)
+	if signed, err := w.SignInputsWith(t, acp); !signed || err != nil {
+		factoid.Prtln("Signed Fail: ", signed, err)
+		test.Fail()
+	}
+	if t.GetSignatureBlock(0).GetSigHashType() != acp {
+		test.Fail()
+	}
+
+	// Another input doesn't disturb the signature
+	w.AddInput(t, h2, 1000)
+	if !t.GetRCDs()[0].CheckSig(t, 0, t.GetSignatureBlock(0)) {
+		factoid.Prtln("Adding an input broke an ANYONECANPAY signature")
+		test.Fail()
+	}
+}
+
+func Test_TimeLockedAddresses_swcallet(test *testing.T) {
+	w := new(SCWallet) // make me a wallet
+	w.Init()
+	w.NewSeed([]byte("vesting schedule"))
+	w.GenerateFctAddress([]byte("unlocked"), 1, 1)
+
+	// Vest a quarter at each of four heights
+	schedule := make(map[string]uint64)
+	for i := uint64(1); i <= 4; i++ {
+		name := fmt.Sprintf("vest %d", i)
+		if _, err := w.GenerateTimeLockedFctAddress([]byte(name), fct.LOCK_DBHEIGHT, 1000*i); err != nil {
+			test.Fatal(err)
+		}
+		schedule[name] = 1000 * i
+	}
+	if _, err := w.GenerateTimeLockedFctAddress([]byte("bad"), fct.LockKind(7), 1); err == nil {
+		factoid.Prtln("Generated an address with an unknown lock")
+		test.Fail()
+	}
+
+	locked, err := w.GetTimeLockedAddresses()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(locked) != len(schedule) {
+		factoid.Prtln("Expected ", len(schedule), " time locked addresses, got ", len(locked))
+		test.Fail()
+	}
+	for _, we := range locked {
+		lock := we.GetRCD().(fct.IRCD_3)
+		if schedule[string(we.GetName())] != lock.GetLockValue() {
+			factoid.Prtln("Wrong lock for ", string(we.GetName()))
+			test.Fail()
+		}
+
+		// The lock is kept when the entry is stored
+		data, _ := we.MarshalBinary()
+		we2 := new(WalletEntry)
+		if err := we2.UnmarshalBinary(data); err != nil || we2.GetRCD().IsEqual(lock) != nil {
+			factoid.Prtln("The time lock was not stored: ", err)
+			test.Fail()
+		}
+	}
+}
+
+func Test_HTLC_swcallet(test *testing.T) {
+	// The recipient and the sender of the swap each have a wallet.
+	rw := new(SCWallet)
+	rw.Init()
+	rw.NewSeed([]byte("recipient"))
+	radr, _ := rw.GenerateFctAddress([]byte("recipient"), 1, 1)
+	rwe, _ := rw.GetAddressDetailsAddr(radr.Bytes())
+
+	sw := new(SCWallet)
+	sw.Init()
+	sw.NewSeed([]byte("sender"))
+	sadr, _ := sw.GenerateFctAddress([]byte("sender"), 1, 1)
+	swe, _ := sw.GetAddressDetailsAddr(sadr.Bytes())
+
+	preimage := []byte("swap secret")
+	hash := fct.Sha(preimage).Bytes()
+	contract, err := sw.CreateHTLC([]byte("swap"), hash, 2000, rwe.GetKey(0), swe.GetKey(0))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := sw.CreateHTLC([]byte("swap"), hash, 2000, rwe.GetKey(0), swe.GetKey(0)); err == nil {
+		factoid.Prtln("Created two contracts with the same name")
+		test.Fail()
+	}
+	rcontract, _ := rw.CreateHTLC([]byte("swap"), hash, 2000, rwe.GetKey(0), swe.GetKey(0))
+	if !contract.IsSameAs(rcontract) {
+		factoid.Prtln("Both sides should agree on the contract address")
+		test.Fail()
+	}
+
+	fund := sw.CreateTransaction(0)
+	sw.AddInput(fund, sadr, 1000000)
+	if err := sw.FundHTLC(fund, contract, 900000); err != nil {
+		test.Fatal(err)
+	}
+	if err := sw.FundHTLC(fund, sadr, 1); err == nil {
+		factoid.Prtln("Funded an address that is not a contract")
+		test.Fail()
+	}
+	if !fund.GetOutputs()[0].GetAddress().IsSameAs(contract) {
+		test.Fail()
+	}
+
+	// The recipient claims with the preimage.
+	claim := rw.CreateTransaction(0)
+	if err := rw.ClaimHTLC(claim, contract, 900000, []byte("a guess")); err == nil {
+		factoid.Prtln("Claimed with the wrong preimage")
+		test.Fail()
+	}
+	if err := rw.ClaimHTLC(claim, contract, 900000, preimage); err != nil {
+		test.Fatal(err)
+	}
+	rw.AddOutput(claim, radr, 800000)
+	if signed, err := rw.SignInputs(claim); !signed || err != nil {
+		factoid.Prtln("Signed Fail: ", signed, err)
+		test.Fail()
+	}
+	if err := rw.ValidateSignatures(claim); err != nil {
+		factoid.Prtln(err)
+		test.Fail()
+	}
+	if signed, _ := sw.SignInputs(claim); signed {
+		factoid.Prtln("The sender signed a claim")
+		test.Fail()
+	}
+
+	// Or the sender takes a refund.
+	refund := sw.CreateTransaction(0)
+	if err := sw.RefundHTLC(refund, contract, 900000); err != nil {
+		test.Fatal(err)
+	}
+	sw.AddOutput(refund, sadr, 800000)
+	if signed, _ := rw.SignInputs(refund); signed {
+		factoid.Prtln("The recipient signed a refund")
+		test.Fail()
+	}
+	if signed, err := sw.SignInputs(refund); !signed || err != nil {
+		factoid.Prtln("Signed Fail: ", signed, err)
+		test.Fail()
+	}
+	if err := sw.ValidateSignatures(refund); err != nil {
+		factoid.Prtln(err)
+		test.Fail()
+	}
+}
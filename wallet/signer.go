@@ -0,0 +1,191 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wallet
+
+import (
+	"fmt"
+	"github.com/FactomProject/ed25519"
+	fct "github.com/FactomProject/factoid"
+	"github.com/FactomProject/factoid/database"
+)
+
+/**************************************
+ * ISigner
+ *
+ * The wallet never signs with a private key itself; it asks a signer for
+ * the signature of the key behind a public key.  By default the signer is
+ * a WalletSigner over the wallet's own keys.  A SocketSigner asks a signer
+ * daemon in another process instead (see SignerServer), so the keys need
+ * never live in the node.
+ **************************************/
+
+// A request for a signature.  Data is what is signed.  If Data is the
+// sighash of an input of a transaction, Transaction, Input and SigHash say
+// which, so a signer can check what it is agreeing to.  For anything else,
+// like a commit, Transaction is nil.
+type SignRequest struct {
+	Public      []byte // The public key of the key to sign with
+	Data        []byte
+	Transaction fct.ITransaction
+	Input       int
+	SigHash     fct.SigHashType
+}
+
+type ISigner interface {
+	// Sign the data of the request with the private key for its public
+	// key, and return the signature.  If the signer doesn't hold the key,
+	// the error is a SignerError for which IsNoKey() is true.
+	Sign(req *SignRequest) ([]byte, error)
+}
+
+// An error from a signer that didn't sign: either it doesn't hold the key,
+// or it refused.
+type SignerError struct {
+	NoKey bool
+	Msg   string
+}
+
+func (e *SignerError) Error() string {
+	return e.Msg
+}
+
+func newNoKeyError(public []byte) *SignerError {
+	return &SignerError{true, "Do not have the private key for: " +
+		fct.ConvertFctAddressToUserStr(fct.NewAddress(public))}
+}
+
+// True if err says the signer doesn't hold the key.
+func IsNoKey(err error) bool {
+	e, ok := err.(*SignerError)
+	return ok && e.NoKey
+}
+
+/**************************************
+ * WalletSigner
+ **************************************/
+
+// Signs with the private keys of the wallet entries in a database, the
+// same database an SCWallet keeps its addresses in.
+type WalletSigner struct {
+	db database.IFDatabase
+}
+
+var _ ISigner = (*WalletSigner)(nil)
+
+func NewWalletSigner(db database.IFDatabase) *WalletSigner {
+	s := new(WalletSigner)
+	s.db = db
+	return s
+}
+
+func (s *WalletSigner) Sign(req *SignRequest) ([]byte, error) {
+	v, err := s.db.GetRaw([]byte(fct.W_ADDRESS_PUB_KEY), req.Public)
+	if err != nil {
+		return nil, err
+	}
+	// An entry imported without a private key is only an address
+	we, ok := v.(*WalletEntry)
+	if !ok {
+		return nil, newNoKeyError(req.Public)
+	}
+	private := we.GetPrivKey(0)
+	if len(private) != fct.PRIVATE_LENGTH {
+		return nil, newNoKeyError(req.Public)
+	}
+	var pri [fct.PRIVATE_LENGTH]byte
+	copy(pri[:], private)
+	sig := ed25519.Sign(&pri, req.Data)
+	return sig[:], nil
+}
+
+/**************************************
+ * Policy
+ **************************************/
+
+// Decides what a signer daemon agrees to sign.
+type ISignerPolicy interface {
+	// Return nil to sign the request, or an error saying why not.
+	Check(req *SignRequest) error
+}
+
+// A simple policy.  The zero value signs any transaction, but nothing
+// else.
+type SignerPolicy struct {
+	// The most a transaction may pay to outputs and Entry Credits
+	// together, in Factoshis.  Zero for no limit.
+	MaxAmount uint64
+	// If not empty, the only addresses a transaction may pay, including
+	// Entry Credit addresses.
+	Destinations []fct.IAddress
+	// Sign data that isn't a transaction, like commits.  A policy that
+	// allows this can be got around, as a transaction's sighash can be
+	// sent as plain data.
+	AllowData bool
+}
+
+var _ ISignerPolicy = (*SignerPolicy)(nil)
+
+func (p *SignerPolicy) Check(req *SignRequest) error {
+	trans := req.Transaction
+	if trans == nil {
+		if !p.AllowData {
+			return fmt.Errorf("Policy only allows signing transactions")
+		}
+		return nil
+	}
+	if p.MaxAmount == 0 && len(p.Destinations) == 0 {
+		return nil
+	}
+
+	// Limits on the outputs mean nothing unless the signature covers all
+	// of them.
+	if req.SigHash.Base() != fct.SIGHASH_ALL {
+		return fmt.Errorf("Policy does not allow signing %s", req.SigHash)
+	}
+
+	if p.MaxAmount > 0 {
+		tout, err := trans.TotalOutputs()
+		if err != nil {
+			return err
+		}
+		tec, err := trans.TotalECs()
+		if err != nil {
+			return err
+		}
+		sum, err := fct.ValidateAmounts(tout, tec)
+		if err != nil {
+			return err
+		}
+		if sum > p.MaxAmount {
+			return fmt.Errorf("Transaction pays %s, more than the policy allows (%s)",
+				fct.Amount(sum).String(), fct.Amount(p.MaxAmount).String())
+		}
+	}
+
+	if len(p.Destinations) > 0 {
+		for _, output := range trans.GetOutputs() {
+			if !p.allows(output.GetAddress()) {
+				return fmt.Errorf("Policy does not allow paying %s",
+					fct.ConvertFctAddressToUserStr(output.GetAddress()))
+			}
+		}
+		for _, output := range trans.GetECOutputs() {
+			if !p.allows(output.GetAddress()) {
+				return fmt.Errorf("Policy does not allow paying %s",
+					fct.ConvertECAddressToUserStr(output.GetAddress()))
+			}
+		}
+	}
+	return nil
+}
+
+func (p *SignerPolicy) allows(adr fct.IAddress) bool {
+	for _, allowed := range p.Destinations {
+		if adr.IsEqual(allowed) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wallet
+
+import (
+	"github.com/FactomProject/ed25519"
+	fct "github.com/FactomProject/factoid"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A stand-in for the signer daemon: a SignerServer with the keys of the
+// given wallet, on a unix socket in a temporary directory.  Returns the
+// path of the socket, and a function to shut it down.
+func startTestSigner(test *testing.T, keys *SCWallet, policy ISignerPolicy) (string, func()) {
+	dir, err := ioutil.TempDir("", "fctsigner")
+	if err != nil {
+		test.Fatal(err)
+	}
+	path := filepath.Join(dir, "signer.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		test.Fatal(err)
+	}
+	server := NewSignerServer(NewWalletSigner(keys.GetDB()), policy)
+	go server.Serve(l)
+	return path, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Import the public key of an address from one wallet into another.
+func importAddress(test *testing.T, from, to *SCWallet, addrtype string, name string, adr fct.IAddress) {
+	we, err := from.GetAddressDetailsAddr(adr.Bytes())
+	if err != nil || we == nil {
+		test.Fatal("Address not found: ", err)
+	}
+	if _, err := to.AddKeyPair(addrtype, []byte(name), we.GetKey(0), nil, false); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func Test_SocketSigner_signer(test *testing.T) {
+	// The keys live with the signer; the node only has the addresses.
+	keys := new(SCWallet)
+	keys.Init()
+	keys.NewSeed([]byte("signer daemon"))
+	from, _ := keys.GenerateFctAddress([]byte("from"), 1, 1)
+	ec, _ := keys.GenerateECAddress([]byte("ec"))
+
+	node := new(SCWallet)
+	node.Init()
+	node.NewSeed([]byte("node"))
+	importAddress(test, keys, node, "fct", "from", from)
+	importAddress(test, keys, node, "ec", "ec", ec)
+	to, _ := node.GenerateFctAddress([]byte("to"), 1, 1)
+	other, _ := node.GenerateFctAddress([]byte("other"), 1, 1)
+	nodeOnly, _ := node.GenerateFctAddress([]byte("node only"), 1, 1)
+
+	newTransaction := func(dest fct.IAddress, amount uint64) fct.ITransaction {
+		t := node.CreateTransaction(1000)
+		node.AddInput(t, from, amount+100000)
+		node.AddOutput(t, dest, amount)
+		return t
+	}
+
+	// Without a signer, the node has no key to sign with.
+	t := newTransaction(to, 500000)
+	if signed, err := node.SignInputs(t); signed || err == nil ||
+		!strings.Contains(err.Error(), "Do not have the private key") {
+		fct.Prtln("Signed without the key: ", signed, err)
+		test.Fail()
+	}
+
+	path, stop := startTestSigner(test, keys, &SignerPolicy{MaxAmount: 1000000, Destinations: []fct.IAddress{to}})
+	defer stop()
+	signer := NewSocketSigner(path)
+	defer signer.Close()
+	node.SetSigner(signer)
+
+	if signed, err := node.SignInputs(t); !signed || err != nil {
+		fct.Prtln("Signing through the daemon failed: ", err)
+		test.Fail()
+	}
+	if err := node.ValidateSignatures(t); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+
+	// The policy is checked on every request.
+	for _, t := range []fct.ITransaction{newTransaction(to, 2000000), newTransaction(other, 500000)} {
+		signed, err := node.SignInputs(t)
+		if signed || err == nil || IsNoKey(err) {
+			fct.Prtln("Expected the policy to refuse: ", signed, err)
+			test.Fail()
+		}
+	}
+	t = newTransaction(to, 500000)
+	t.SetVersion(fct.TRANSACTION_VERSION_SIGHASH)
+	if signed, err := node.SignInputsWith(t, fct.SIGHASH_SINGLE|fct.SIGHASH_ANYONECANPAY); signed || err == nil {
+		fct.Prtln("Expected the policy to refuse SIGHASH_SINGLE: ", signed, err)
+		test.Fail()
+	}
+
+	// Keys the daemon doesn't hold are reported as before.
+	t = newTransaction(to, 500000)
+	node.AddInput(t, nodeOnly, 0)
+	if signed, err := node.SignInputs(t); signed || err == nil ||
+		!strings.Contains(err.Error(), "Do not have the private key") {
+		fct.Prtln("Expected a missing key: ", signed, err)
+		test.Fail()
+	}
+
+	// Commits are data, which this policy doesn't sign.
+	ecwe, _ := node.GetAddressDetailsAddr(ec.Bytes())
+	if r := node.SignCommit(ecwe, []byte("commit")); r != nil {
+		fct.Prtln("Expected the policy to refuse a commit")
+		test.Fail()
+	}
+
+	// Once the daemon is gone, signing fails, and not for want of a key.
+	stop()
+	t = newTransaction(to, 500000)
+	if signed, err := node.SignInputs(t); signed || err == nil || IsNoKey(err) {
+		fct.Prtln("Signed without the daemon: ", signed, err)
+		test.Fail()
+	}
+}
+
+func Test_SocketSigner_commit_signer(test *testing.T) {
+	keys := new(SCWallet)
+	keys.Init()
+	keys.NewSeed([]byte("signer daemon"))
+	ec, _ := keys.GenerateECAddress([]byte("ec"))
+
+	node := new(SCWallet)
+	node.Init()
+	importAddress(test, keys, node, "ec", "ec", ec)
+
+	path, stop := startTestSigner(test, keys, &SignerPolicy{AllowData: true})
+	defer stop()
+	node.SetSigner(NewSocketSigner(path))
+
+	ecwe, _ := node.GetAddressDetailsAddr(ec.Bytes())
+	data := []byte("commit")
+	r := node.SignCommit(ecwe, data)
+	if len(r) != len(data)+fct.ADDRESS_LENGTH+fct.SIGNATURE_LENGTH {
+		fct.Prtln("Failed to sign a commit: ", r)
+		test.FailNow()
+	}
+	var pub [fct.ADDRESS_LENGTH]byte
+	var sig [fct.SIGNATURE_LENGTH]byte
+	copy(pub[:], r[len(data):])
+	copy(sig[:], r[len(data)+fct.ADDRESS_LENGTH:])
+	if !ed25519.VerifyCanonical(&pub, data, &sig) {
+		fct.Prtln("The commit signature does not verify")
+		test.Fail()
+	}
+}
+
+// A claim carries its preimage to the daemon, and comes back signed by the
+// recipient.
+func Test_SocketSigner_HTLC_signer(test *testing.T) {
+	keys := new(SCWallet)
+	keys.Init()
+	keys.NewSeed([]byte("recipient"))
+	radr, _ := keys.GenerateFctAddress([]byte("recipient"), 1, 1)
+	sadr, _ := keys.GenerateFctAddress([]byte("sender"), 1, 1)
+	rwe, _ := keys.GetAddressDetailsAddr(radr.Bytes())
+	swe, _ := keys.GetAddressDetailsAddr(sadr.Bytes())
+
+	node := new(SCWallet)
+	node.Init()
+	node.NewSeed([]byte("node"))
+	preimage := []byte("swap secret")
+	contract, err := node.CreateHTLC([]byte("swap"), fct.Sha(preimage).Bytes(), 2000, rwe.GetKey(0), swe.GetKey(0))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	path, stop := startTestSigner(test, keys, nil)
+	defer stop()
+	node.SetSigner(NewSocketSigner(path))
+
+	claim := node.CreateTransaction(1000)
+	node.ClaimHTLC(claim, contract, 900000, preimage)
+	node.AddOutput(claim, radr, 800000)
+	if signed, err := node.SignInputs(claim); !signed || err != nil {
+		fct.Prtln("Signing the claim failed: ", err)
+		test.Fail()
+	}
+	if err := node.ValidateSignatures(claim); err != nil {
+		fct.Prtln(err)
+		test.Fail()
+	}
+}
+
+func Test_SignerPolicy_signer(test *testing.T) {
+	data := &SignRequest{Public: make([]byte, 32), Data: []byte("data")}
+	if new(SignerPolicy).Check(data) == nil {
+		fct.Prtln("The zero policy should not sign data")
+		test.Fail()
+	}
+	if (&SignerPolicy{AllowData: true}).Check(data) != nil {
+		test.Fail()
+	}
+
+	// Garbage never reaches the policy or the signer.
+	server := NewSignerServer(nil, nil)
+	for _, body := range [][]byte{nil, {SIGN_INPUT, 0}, {SIGN_INPUT, 0, 0, 1, 2}, {7, 0}, {SIGN_DATA, 40}} {
+		if reply := server.handle(body); len(reply) == 0 || reply[0] != SIGNER_REFUSE {
+			fct.Prtln("Expected garbage to be refused: ", body)
+			test.Fail()
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wallet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	fct "github.com/FactomProject/factoid"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+/**************************************
+ * SocketSigner and SignerServer
+ *
+ * A SocketSigner sends each request over a local socket to a SignerServer,
+ * which holds the keys in its own process and checks every request against
+ * its policy before signing.
+ *
+ * Every message is a 4 byte length and a body.  A request body is
+ *
+ *   kind byte, public key length byte, public key, and then
+ *     SIGN_DATA:  the data
+ *     SIGN_INPUT: input byte, sighash type byte, the transaction
+ *
+ * The server works out the data of an input for itself, from the
+ * transaction, so what it signs is always what its policy looked at.  The
+ * reply is a status byte, and the signature or the reason it was refused.
+ **************************************/
+
+const (
+	SIGN_DATA  byte = 0
+	SIGN_INPUT byte = 1
+
+	SIGNER_OK     byte = 0
+	SIGNER_NO_KEY byte = 1
+	SIGNER_REFUSE byte = 2
+
+	// Limit on the size of a message, well past the largest transaction
+	SIGNER_MAX_MESSAGE = 1 << 20
+)
+
+// How long to wait for the signer daemon to answer.
+var SignerTimeout = 30 * time.Second
+
+func writeMessage(w io.Writer, body []byte) error {
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, uint32(len(body)))
+	out.Write(body)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func readMessage(r io.Reader) ([]byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > SIGNER_MAX_MESSAGE {
+		return nil, fmt.Errorf("Signer message too long: %d", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Inputs not yet signed can't be marshaled, so the transaction goes to the
+// signer as a copy with empty signatures in their place.
+func marshalForSigner(trans fct.ITransaction) ([]byte, error) {
+	c := new(fct.Transaction)
+	if err := c.SetVersion(trans.GetVersion()); err != nil {
+		return nil, err
+	}
+	if err := c.SetMilliTimestamp(trans.GetMilliTimestamp()); err != nil {
+		return nil, err
+	}
+	for _, input := range trans.GetInputs() {
+		if err := c.AddInput(input.GetAddress(), input.GetAmount()); err != nil {
+			return nil, err
+		}
+	}
+	for _, output := range trans.GetOutputs() {
+		if err := c.AddOutput(output.GetAddress(), output.GetAmount()); err != nil {
+			return nil, err
+		}
+	}
+	for _, output := range trans.GetECOutputs() {
+		if err := c.AddECOutput(output.GetAddress(), output.GetAmount()); err != nil {
+			return nil, err
+		}
+	}
+	sigBlks := trans.GetSignatureBlocks()
+	for i, rcd := range trans.GetRCDs() {
+		if err := c.AddRCD(rcd); err != nil {
+			return nil, err
+		}
+		sigblk := c.GetSignatureBlock(i)
+		sigblk.AddSignature(new(fct.Signature))
+		if i < len(sigBlks) && sigBlks[i] != nil {
+			sigblk.SetSigHashType(sigBlks[i].GetSigHashType())
+			sigblk.SetPreimage(sigBlks[i].GetPreimage())
+		}
+	}
+	return c.MarshalBinary()
+}
+
+func marshalSignRequest(req *SignRequest) ([]byte, error) {
+	var out bytes.Buffer
+	if len(req.Public) > 255 {
+		return nil, fmt.Errorf("Public key too long: %d", len(req.Public))
+	}
+	if req.Transaction == nil {
+		out.WriteByte(SIGN_DATA)
+	} else {
+		out.WriteByte(SIGN_INPUT)
+	}
+	out.WriteByte(byte(len(req.Public)))
+	out.Write(req.Public)
+	if req.Transaction == nil {
+		out.Write(req.Data)
+		return out.Bytes(), nil
+	}
+
+	if req.Input < 0 || req.Input > 255 {
+		return nil, fmt.Errorf("Input out of range: %d", req.Input)
+	}
+	out.WriteByte(byte(req.Input))
+	out.WriteByte(byte(req.SigHash))
+	data, err := marshalForSigner(req.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	out.Write(data)
+	return out.Bytes(), nil
+}
+
+func unmarshalSignRequest(data []byte) (*SignRequest, error) {
+	if len(data) < 2 || len(data) < 2+int(data[1]) {
+		return nil, fmt.Errorf("Sign request too short: %d", len(data))
+	}
+	req := new(SignRequest)
+	kind := data[0]
+	req.Public = data[2 : 2+int(data[1])]
+	data = data[2+int(data[1]):]
+
+	switch kind {
+	case SIGN_DATA:
+		req.Data = data
+	case SIGN_INPUT:
+		if len(data) < 2 {
+			return nil, fmt.Errorf("Sign request too short for an input")
+		}
+		req.Input = int(data[0])
+		req.SigHash = fct.SigHashType(data[1])
+		trans := new(fct.Transaction)
+		rest, err := trans.UnmarshalBinaryData(data[2:])
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) != 0 {
+			return nil, fmt.Errorf("%d bytes left over after the transaction", len(rest))
+		}
+		req.Transaction = trans
+		if req.Data, err = trans.MarshalBinarySigHash(req.Input, req.SigHash); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown kind of sign request: %d", kind)
+	}
+	return req, nil
+}
+
+/**************************************
+ * SocketSigner
+ **************************************/
+
+// Asks a signer daemon listening on a unix socket for signatures.  One
+// connection is kept open, and opened again after any error.
+type SocketSigner struct {
+	path  string
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+var _ ISigner = (*SocketSigner)(nil)
+
+func NewSocketSigner(path string) *SocketSigner {
+	s := new(SocketSigner)
+	s.path = path
+	return s
+}
+
+func (s *SocketSigner) Sign(req *SignRequest) ([]byte, error) {
+	body, err := marshalSignRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	reply, err := s.roundTrip(body)
+	if err != nil {
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		return nil, fmt.Errorf("Signer at %s failed: %s", s.path, err.Error())
+	}
+
+	if len(reply) == 0 {
+		return nil, fmt.Errorf("Empty reply from the signer at %s", s.path)
+	}
+	switch reply[0] {
+	case SIGNER_OK:
+		if len(reply) != 1+fct.SIGNATURE_LENGTH {
+			return nil, fmt.Errorf("Bad signature from the signer at %s", s.path)
+		}
+		return reply[1:], nil
+	case SIGNER_NO_KEY:
+		return nil, newNoKeyError(req.Public)
+	}
+	return nil, &SignerError{false, "Signer refused: " + string(reply[1:])}
+}
+
+func (s *SocketSigner) roundTrip(body []byte) ([]byte, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("unix", s.path, SignerTimeout)
+		if err != nil {
+			return nil, err
+		}
+		s.conn = conn
+	}
+	s.conn.SetDeadline(time.Now().Add(SignerTimeout))
+	if err := writeMessage(s.conn, body); err != nil {
+		return nil, err
+	}
+	return readMessage(s.conn)
+}
+
+// Close the connection to the signer daemon, if there is one.
+func (s *SocketSigner) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+/**************************************
+ * SignerServer
+ **************************************/
+
+// The signer daemon's end: answers SocketSigners with the given signer,
+// for the requests the policy allows.  A nil policy is the zero
+// SignerPolicy.
+type SignerServer struct {
+	signer ISigner
+	policy ISignerPolicy
+
+	mutex     sync.Mutex
+	closed    bool
+	listeners map[net.Listener]bool
+	conns     map[net.Conn]bool
+}
+
+func NewSignerServer(signer ISigner, policy ISignerPolicy) *SignerServer {
+	s := new(SignerServer)
+	s.signer = signer
+	s.policy = policy
+	if policy == nil {
+		s.policy = new(SignerPolicy)
+	}
+	s.listeners = make(map[net.Listener]bool)
+	s.conns = make(map[net.Conn]bool)
+	return s
+}
+
+// Answer connections on the listener until it or the server is closed.
+func (s *SignerServer) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return fmt.Errorf("Signer server is closed")
+	}
+	defer s.untrack(l, nil)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Stop serving: close the listeners, and the connections open on them.
+func (s *SignerServer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (s *SignerServer) track(l net.Listener, conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = true
+	}
+	if conn != nil {
+		s.conns[conn] = true
+	}
+	return true
+}
+
+func (s *SignerServer) untrack(l net.Listener, conn net.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.listeners, l)
+	delete(s.conns, conn)
+}
+
+func (s *SignerServer) serveConn(conn net.Conn) {
+	defer s.untrack(nil, conn)
+	defer conn.Close()
+	for {
+		body, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		if err := writeMessage(conn, s.handle(body)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *SignerServer) handle(body []byte) []byte {
+	refuse := func(err error) []byte {
+		return append([]byte{SIGNER_REFUSE}, err.Error()...)
+	}
+	req, err := unmarshalSignRequest(body)
+	if err != nil {
+		return refuse(err)
+	}
+	if err := s.policy.Check(req); err != nil {
+		return refuse(err)
+	}
+	sig, err := s.signer.Sign(req)
+	if IsNoKey(err) {
+		return []byte{SIGNER_NO_KEY}
+	}
+	if err != nil {
+		return refuse(err)
+	}
+	return append([]byte{SIGNER_OK}, sig...)
+}
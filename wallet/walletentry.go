@@ -26,12 +26,15 @@ type IWalletEntry interface {
 	GetRCD() fct.IRCD
 	// Add a public and private key.  USE WITH CAUTION! You change
 	// the hash and thus the address returned by the wallet entry!
+	// A nil private key adds just the public key, for a key held by a
+	// signer elsewhere.
 	AddKey(public, private []byte)
 	// Get the name for this address
 	GetName() []byte
 	// Get the Public Key by its index
 	GetKey(i int) []byte
-	// Get the Private Key by its index
+	// Get the Private Key for the Public Key of the same index, or nil if
+	// the entry holds only the public key
 	GetPrivKey(i int) []byte
 	// Set the name for this address
 	SetName([]byte)
@@ -50,7 +53,8 @@ type WalletEntry struct {
 	rcd  fct.IRCD // Verification block for this IWalletEntry
 	// 1 byte count of public keys
 	public [][]byte // Set of public keys necessary towe sign the rcd
-	// 1 byte count of private keys
+	// 1 byte count of private keys.  Keys held by a signer elsewhere have
+	// no private key here, so private[i] need not go with public[i].
 	private [][]byte // Set of private keys necessary to sign the rcd
 }
 
@@ -116,6 +120,10 @@ func (w1 WalletEntry) GetAddress() (fct.IAddress, error) {
 	return adr, nil
 }
 
+func init() {
+	fct.RegisterType(new(WalletEntry))
+}
+
 func (w1 WalletEntry) GetDBHash() fct.IHash {
 	return fct.Sha([]byte("WalletEntry"))
 }
@@ -142,6 +150,9 @@ func (w1 *WalletEntry) IsEqual(w fct.IBlock) []fct.IBlock {
 
 func (w *WalletEntry) UnmarshalBinaryData(data []byte) ([]byte, error) {
 
+	if len(data) < 3 {
+		return nil, fmt.Errorf("Data source too short to unmarshal a WalletEntry: %d", len(data))
+	}
 	// handle the type byte
 	if uint(data[0]) > 1 {
 		return nil, fmt.Errorf("Invalid type byte")
@@ -153,38 +164,55 @@ func (w *WalletEntry) UnmarshalBinaryData(data []byte) ([]byte, error) {
 	}
 	data = data[1:]
 
-	len, data := binary.BigEndian.Uint16(data[0:2]), data[2:]
-	n := make([]byte, len, len) // build a place for the name
-	copy(n, data[:len])         // copy it into that place
-	data = data[len:]           // update data pointer
-	w.name = n                  // Finally!  set the name
+	nlen, data := int(binary.BigEndian.Uint16(data[0:2])), data[2:]
+	if nlen > len(data) {
+		return nil, fmt.Errorf("WalletEntry name runs past the end of the data")
+	}
+	n := make([]byte, nlen, nlen) // build a place for the name
+	copy(n, data[:nlen])          // copy it into that place
+	data = data[nlen:]            // update data pointer
+	w.name = n                    // Finally!  set the name
 
 	if w.rcd == nil {
 		w.rcd = fct.CreateRCD(data) // looks ahead, and creates the right RCD
+		if w.rcd == nil {
+			return nil, fmt.Errorf("Missing or unknown RCD in WalletEntry")
+		}
 	}
 	data, err := w.rcd.UnmarshalBinaryData(data)
 	if err != nil {
 		return nil, err
 	}
 
-	blen, data := data[0], data[1:]
-	w.public = make([][]byte, len, len)
-	for i := 0; i < int(blen); i++ {
-		w.public[i] = make([]byte, fct.ADDRESS_LENGTH, fct.ADDRESS_LENGTH)
-		copy(w.public[i], data[:fct.ADDRESS_LENGTH])
-		data = data[fct.ADDRESS_LENGTH:]
+	w.public, data, err = unmarshalKeys(data, fct.ADDRESS_LENGTH)
+	if err != nil {
+		return nil, err
 	}
-
-	blen, data = data[0], data[1:]
-	w.private = make([][]byte, len, len)
-	for i := 0; i < int(blen); i++ {
-		w.private[i] = make([]byte, fct.PRIVATE_LENGTH, fct.PRIVATE_LENGTH)
-		copy(w.private[i], data[:fct.PRIVATE_LENGTH])
-		data = data[fct.PRIVATE_LENGTH:]
+	w.private, data, err = unmarshalKeys(data, fct.PRIVATE_LENGTH)
+	if err != nil {
+		return nil, err
 	}
 	return data, nil
 }
 
+// Read a count byte, and that many keys of the given length.
+func unmarshalKeys(data []byte, keylen int) ([][]byte, []byte, error) {
+	if len(data) < 1 {
+		return nil, nil, fmt.Errorf("Data source too short to unmarshal keys in a WalletEntry")
+	}
+	blen, data := int(data[0]), data[1:]
+	if len(data) < blen*keylen {
+		return nil, nil, fmt.Errorf("Data source too short for %d keys in a WalletEntry: %d", blen, len(data))
+	}
+	keys := make([][]byte, blen, blen)
+	for i := range keys {
+		keys[i] = make([]byte, keylen, keylen)
+		copy(keys[i], data[:keylen])
+		data = data[keylen:]
+	}
+	return keys, data, nil
+}
+
 func (w *WalletEntry) UnmarshalBinary(data []byte) error {
 	_, err := w.UnmarshalBinaryData(data)
 	return err
@@ -259,18 +287,20 @@ func (w WalletEntry) GetRCD() fct.IRCD {
 }
 
 func (w *WalletEntry) AddKey(public, private []byte) {
-	if len(public) != fct.ADDRESS_LENGTH || (len(private) != fct.ADDRESS_LENGTH &&
+	if len(public) != fct.ADDRESS_LENGTH || (len(private) != 0 && len(private) != fct.ADDRESS_LENGTH &&
 		len(private) != fct.PRIVATE_LENGTH) {
 		panic(fmt.Sprintf("Bad Keys presented to AddKey.  Should not happen."+
 			"\n  public: %x\n  private: %x", public, private))
 	}
 	pu := make([]byte, fct.ADDRESS_LENGTH, fct.ADDRESS_LENGTH)
-	pr := make([]byte, fct.PRIVATE_LENGTH, fct.PRIVATE_LENGTH)
 	copy(pu, public)
-	copy(pr[:32], private)
-	copy(pr[32:], public)
 	w.public = append(w.public, pu)
-	w.private = append(w.private, pr)
+	if len(private) != 0 {
+		pr := make([]byte, fct.PRIVATE_LENGTH, fct.PRIVATE_LENGTH)
+		copy(pr[:32], private)
+		copy(pr[32:], public)
+		w.private = append(w.private, pr)
+	}
 
 	w.rcd = fct.NewRCD_1(pu)
 }
@@ -279,8 +309,20 @@ func (we *WalletEntry) GetKey(i int) []byte {
 	return we.public[i]
 }
 
+// A private key ends with its public key, which finds the one for public[i].
 func (we *WalletEntry) GetPrivKey(i int) []byte {
-	return we.private[i]
+	if i < 0 || i >= len(we.public) {
+		return nil
+	}
+	for _, private := range we.private {
+		if len(private) != fct.PRIVATE_LENGTH {
+			continue
+		}
+		if bytes.Equal(private[fct.PRIVATE_LENGTH-fct.ADDRESS_LENGTH:], we.public[i]) {
+			return private
+		}
+	}
+	return nil
 }
 
 func (w *WalletEntry) SetName(name []byte) {
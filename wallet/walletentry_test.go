@@ -5,6 +5,7 @@
 package wallet
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"github.com/FactomProject/ed25519"
@@ -54,3 +55,49 @@ func Test_create_walletentry(test *testing.T) {
 		test.Fail()
 	}
 }
+
+// An entry can hold public keys without their private keys.
+func Test_public_only_walletentry(test *testing.T) {
+	w := new(SCWallet)
+	w.Init()
+	w.NewSeed([]byte("public only"))
+	pub1, _, _ := w.generateKey()
+	pub2, pri2, _ := w.generateKey()
+
+	we := new(WalletEntry)
+	we.SetType("fct")
+	we.AddKey(pub1, nil)
+	if we.GetPrivKey(0) != nil {
+		factoid.Prtln("A public only entry returned a private key")
+		test.Fail()
+	}
+
+	// The private key still goes with its own public key.
+	we.AddKey(pub2, pri2)
+	if we.GetPrivKey(0) != nil || we.GetPrivKey(2) != nil || we.GetPrivKey(-1) != nil {
+		factoid.Prtln("Returned a private key for a key without one")
+		test.Fail()
+	}
+	if pri := we.GetPrivKey(1); len(pri) != factoid.PRIVATE_LENGTH ||
+		!bytes.Equal(pri[:32], pri2[:32]) || !bytes.Equal(pri[32:], pub2) {
+		factoid.Prtln("Wrong private key for the second public key: ", pri)
+		test.Fail()
+	}
+
+	data, err := we.MarshalBinary()
+	if err != nil {
+		test.Fatal(err)
+	}
+	we2 := new(WalletEntry)
+	if err := we2.UnmarshalBinary(data); err != nil || we2.GetPrivKey(0) != nil || we2.GetPrivKey(1) == nil {
+		factoid.Prtln("A mixed entry did not round trip: ", err)
+		test.Fail()
+	}
+
+	// A short private key, as from a corrupt wallet, is skipped.
+	we.private = append([][]byte{{1, 2, 3}}, we.private...)
+	if we.GetPrivKey(0) != nil || we.GetPrivKey(1) == nil {
+		factoid.Prtln("A short private key was not skipped")
+		test.Fail()
+	}
+}